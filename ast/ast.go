@@ -3,9 +3,26 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
 	"lisp/token"
 )
 
+// The names of the special forms, which are SExpressions that are not
+// evaluated as function calls. These names can't be used as values or bound to
+// variables.
+var SpecialForms = map[string]bool{
+	"if":       true,
+	"def":      true,
+	"lambda":   true,
+	"let":      true,
+	"cond":     true,
+	"when":     true,
+	"unless":   true,
+	"do":       true,
+	"while":    true,
+	"defmacro": true,
+}
+
 // Base interface for all Expressions.
 //
 // expression() is an empty method used
@@ -68,6 +85,30 @@ func (sl *StringLiteral) String() string {
 
 func (sl *StringLiteral) expression() {}
 
+// A SymbolLiteral is a quoted name, such as 'a, which evaluates to a symbol
+// rather than the value of a variable.
+type SymbolLiteral struct {
+	Token token.Token
+}
+
+func (sl *SymbolLiteral) String() string {
+	return "'" + sl.Token.Literal
+}
+
+func (sl *SymbolLiteral) expression() {}
+
+// A KeywordLiteral is a name that starts with a colon, such as :name, which
+// evaluates to a keyword of that name.
+type KeywordLiteral struct {
+	Token token.Token
+}
+
+func (kl *KeywordLiteral) String() string {
+	return ":" + kl.Token.Literal
+}
+
+func (kl *KeywordLiteral) expression() {}
+
 // SExpressions are the lisp representation of a function call.
 //
 // Fn represents the function `func` and Args represents the
@@ -83,6 +124,13 @@ type SExpression struct {
 	// Name is only used in the compiler. The purpose is to associate a name
 	// with a lambda expression to detect recursive calls.
 	Name string
+	// Quoted is true when the SExpression was written as a quoted list of
+	// the form '(a b c), which the parser converts to (list 'a 'b 'c).
+	Quoted bool
+	// The line and column of the source the SExpression starts on, zero if
+	// unknown.
+	Line   int
+	Column int
 }
 
 // Recursively print the values in the SExpression.
@@ -105,3 +153,124 @@ func (se *SExpression) String() string {
 }
 
 func (se *SExpression) expression() {}
+
+// Report whether the SExpression is a quoted list of literal values, such as
+// '(1 "a" b (true) ()), so that it's the same each time it's evaluated. Only a
+// quoted list containing a dict isn't literal.
+func (se *SExpression) IsQuotedLiteral() bool {
+	if !se.Quoted {
+		return false
+	}
+
+	for _, arg := range se.Args {
+		switch arg := arg.(type) {
+		case *FloatLiteral, *StringLiteral, *SymbolLiteral, *KeywordLiteral:
+		case *Identifier:
+			switch arg.String() {
+			case "true", "false", "null":
+			default:
+				return false
+			}
+		case *SExpression:
+			if arg.Fn != nil && !arg.IsQuotedLiteral() {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// A Binding is a name and the expression whose value is bound to it, such as
+// (x 1) in (let ((x 1)) x).
+type Binding struct {
+	Name  *Identifier
+	Value Expression
+}
+
+// Return the bindings of a list of the form ((name value) ...), in order, or an
+// error describing why the expression isn't one.
+func ParseBindings(expr Expression) ([]Binding, error) {
+	list, ok := expr.(*SExpression)
+
+	if !ok || list.Quoted {
+		return nil, fmt.Errorf("expected a list of bindings, got %s", expr.String())
+	}
+
+	if list.Fn == nil {
+		return nil, nil
+	}
+
+	bindings := []Binding{}
+
+	for _, b := range append([]Expression{list.Fn}, list.Args...) {
+		pair, ok := b.(*SExpression)
+
+		if !ok || len(pair.Args) != 1 {
+			return nil, fmt.Errorf("expected a binding of the form (name value), got %s", b.String())
+		}
+
+		name, ok := pair.Fn.(*Identifier)
+
+		if !ok {
+			return nil, fmt.Errorf("binding names must be identifiers, got %s", b.String())
+		}
+
+		bindings = append(bindings, Binding{Name: name, Value: pair.Args[0]})
+	}
+
+	return bindings, nil
+}
+
+// A Clause is a test and the expression whose value is the result when the
+// test is true, such as ((< x 1) "small") in a cond expression.
+type Clause struct {
+	Test Expression
+	Body Expression
+}
+
+// Report whether the clause always matches, because its test is else or true.
+func (c Clause) IsDefault() bool {
+	ident, ok := c.Test.(*Identifier)
+
+	return ok && (ident.String() == "else" || ident.String() == "true")
+}
+
+// Return the clauses of a cond expression, each of the form (test expr), in
+// order, or an error describing the first expression that isn't a clause.
+func ParseClauses(exprs []Expression) ([]Clause, error) {
+	clauses := []Clause{}
+
+	for _, expr := range exprs {
+		clause, ok := expr.(*SExpression)
+
+		if !ok || clause.Quoted || clause.Fn == nil || len(clause.Args) != 1 {
+			return nil, fmt.Errorf("expected a clause of the form (test expr), got %s", expr.String())
+		}
+
+		clauses = append(clauses, Clause{Test: clause.Fn, Body: clause.Args[0]})
+	}
+
+	return clauses, nil
+}
+
+// Remove the & marker from the parameter names of a lambda, such as
+// (a b & rest), and report whether it was present. The single parameter after
+// the marker collects any arguments beyond those before it into a list.
+func ParseRestParameter(names []string) ([]string, bool, error) {
+	for i, name := range names {
+		if name != "&" {
+			continue
+		}
+
+		if len(names)-i-1 != 1 {
+			return nil, false, fmt.Errorf("expected one parameter after &, got %d", len(names)-i-1)
+		}
+
+		return append(names[:i:i], names[i+1]), true, nil
+	}
+
+	return names, false, nil
+}
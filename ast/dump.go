@@ -0,0 +1,81 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Return an indented tree of the Expression and everything it contains, with
+// the type of each node and the line it starts on when known. For example,
+// (def a 5) is shown as:
+//
+//	SExpression line 1
+//	  Identifier def line 1
+//	  Identifier a line 1
+//	  FloatLiteral 5 line 1
+func Dump(e Expression) string {
+	var out bytes.Buffer
+
+	dump(&out, e, 0)
+
+	return out.String()
+}
+
+func dump(out *bytes.Buffer, e Expression, depth int) {
+	out.WriteString(strings.Repeat("  ", depth))
+
+	switch e := e.(type) {
+	case *Program:
+		out.WriteString("Program\n")
+
+		for _, expr := range e.Expressions {
+			dump(out, expr, depth+1)
+		}
+	case *SExpression:
+		out.WriteString("SExpression")
+
+		if e.Quoted {
+			out.WriteString(" quoted")
+		}
+
+		writeLine(out, e.Line)
+
+		if e.Fn != nil {
+			dump(out, e.Fn, depth+1)
+		}
+
+		for _, arg := range e.Args {
+			dump(out, arg, depth+1)
+		}
+	case *Identifier:
+		fmt.Fprintf(out, "Identifier %s", e.Token.Literal)
+		writeLine(out, e.Token.Line)
+	case *SymbolLiteral:
+		fmt.Fprintf(out, "SymbolLiteral %s", e.Token.Literal)
+		writeLine(out, e.Token.Line)
+	case *KeywordLiteral:
+		fmt.Fprintf(out, "KeywordLiteral %s", e.Token.Literal)
+		writeLine(out, e.Token.Line)
+	case *FloatLiteral:
+		fmt.Fprintf(out, "FloatLiteral %s", e.Token.Literal)
+		writeLine(out, e.Token.Line)
+	case *StringLiteral:
+		fmt.Fprintf(out, "StringLiteral %s", strconv.Quote(e.Value))
+		writeLine(out, e.Token.Line)
+	case nil:
+		out.WriteString("<nil>\n")
+	default:
+		fmt.Fprintf(out, "%T\n", e)
+	}
+}
+
+// End the line describing a node, including its line in the source if known.
+func writeLine(out *bytes.Buffer, line int) {
+	if line > 0 {
+		fmt.Fprintf(out, " line %d", line)
+	}
+
+	out.WriteString("\n")
+}
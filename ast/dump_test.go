@@ -0,0 +1,82 @@
+// The tests parse their input, and the parser depends on ast, so they're in a
+// package of their own.
+package ast_test
+
+import (
+	"lisp/ast"
+	"lisp/lexer"
+	"lisp/parser"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"(def f (lambda (x)\n  (+ x 1)))",
+			`Program
+  SExpression line 1
+    Identifier def line 1
+    Identifier f line 1
+    SExpression line 1
+      Identifier lambda line 1
+      SExpression line 1
+        Identifier x line 1
+      SExpression line 2
+        Identifier + line 2
+        Identifier x line 2
+        FloatLiteral 1 line 2
+`,
+		},
+		{
+			`{:a 1 "b" (list 2)}`,
+			`Program
+  SExpression line 1
+    Identifier dict line 1
+    KeywordLiteral a line 1
+    FloatLiteral 1 line 1
+    StringLiteral "b" line 1
+    SExpression line 1
+      Identifier list line 1
+      FloatLiteral 2 line 1
+`,
+		},
+		{
+			`'(a (b "c") :d)`,
+			`Program
+  SExpression quoted line 1
+    Identifier list line 1
+    SymbolLiteral a line 1
+    SExpression quoted line 1
+      Identifier list line 1
+      SymbolLiteral b line 1
+      StringLiteral "c" line 1
+    KeywordLiteral d line 1
+`,
+		},
+		{
+			"'x\n(quote x)",
+			`Program
+  SymbolLiteral x line 1
+  SExpression line 2
+    Identifier quote line 2
+    Identifier x line 2
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		if len(p.Errors) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors)
+		}
+
+		if dump := ast.Dump(program); dump != tt.expected {
+			t.Errorf("wrong dump of %q\nwant=\n%s\ngot=\n%s", tt.input, tt.expected, dump)
+		}
+	}
+}
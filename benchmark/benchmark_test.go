@@ -0,0 +1,100 @@
+package main
+
+import (
+	"lisp/evaluator"
+	"lisp/object"
+	"lisp/vm"
+	"testing"
+)
+
+// Find the workload with the given name.
+func findWorkload(b *testing.B, name string) workload {
+	for _, w := range workloads {
+		if w.name == name {
+			return w
+		}
+	}
+
+	b.Fatalf("no workload named %s", name)
+	return workload{}
+}
+
+// Evaluate the workload b.N times, parsing it once beforehand.
+func benchmarkEvaluator(b *testing.B, name string) {
+	program, err := parse(findWorkload(b, name).source)
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		result := evaluator.Evaluate(program, object.NewEnvironment(nil))
+
+		if result.Type() == object.ERROR_OBJ {
+			b.Fatalf("evaluator error: %s", result.Inspect())
+		}
+	}
+}
+
+// Run the workload with the VM b.N times, compiling it once beforehand.
+func benchmarkVM(b *testing.B, name string) {
+	bytecode, err := compile(findWorkload(b, name).source)
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		if err := vm.New(bytecode).Run(); err != nil {
+			b.Fatalf("vm error: %s", err)
+		}
+	}
+}
+
+func BenchmarkEvaluatorFibonacci(b *testing.B)  { benchmarkEvaluator(b, "fibonacci") }
+func BenchmarkEvaluatorArithmetic(b *testing.B) { benchmarkEvaluator(b, "arithmetic") }
+func BenchmarkEvaluatorLists(b *testing.B)      { benchmarkEvaluator(b, "lists") }
+func BenchmarkEvaluatorStrings(b *testing.B)    { benchmarkEvaluator(b, "strings") }
+func BenchmarkEvaluatorDicts(b *testing.B)      { benchmarkEvaluator(b, "dicts") }
+
+func BenchmarkVMFibonacci(b *testing.B)  { benchmarkVM(b, "fibonacci") }
+func BenchmarkVMArithmetic(b *testing.B) { benchmarkVM(b, "arithmetic") }
+func BenchmarkVMLists(b *testing.B)      { benchmarkVM(b, "lists") }
+func BenchmarkVMStrings(b *testing.B)    { benchmarkVM(b, "strings") }
+func BenchmarkVMDicts(b *testing.B)      { benchmarkVM(b, "dicts") }
+
+// Ensure every workload runs, and that both engines agree on its result.
+func TestWorkloads(t *testing.T) {
+	for _, w := range workloads {
+		program, err := parse(w.source)
+
+		if err != nil {
+			t.Fatalf("%s: %s", w.name, err)
+		}
+
+		evaluated := evaluator.Evaluate(program, object.NewEnvironment(nil))
+
+		bytecode, err := compile(w.source)
+
+		if err != nil {
+			t.Fatalf("%s: %s", w.name, err)
+		}
+
+		result, err := vm.New(bytecode).RunResult()
+
+		if err != nil {
+			t.Fatalf("%s: vm error: %s", w.name, err)
+		}
+
+		if evaluated.Type() == object.ERROR_OBJ || !object.Equals(evaluated, result) {
+			t.Errorf("%s: engines disagree. eval=%s, vm=%s",
+				w.name, evaluated.Inspect(), result.Inspect())
+		}
+	}
+}
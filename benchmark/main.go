@@ -1,66 +1,136 @@
+// Runs each workload once with both engines, printing how long each took and
+// how much it allocated as one line of JSON per workload, so that the output
+// of two commits can be compared with diff.
+//
+// The same workloads are run as Go benchmarks by `go test -bench=. ./benchmark`,
+// which repeat them enough times to be compared between commits.
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
-	"lisp/compiler"
 	"lisp/evaluator"
-	"lisp/lexer"
 	"lisp/object"
-	"lisp/parser"
 	"lisp/vm"
 	"os"
+	"runtime"
+	"runtime/debug"
 	"time"
 )
 
-var input string = `
-(def fibonacci (lambda (n)
-    (if (or (= n 0)
-            (= n 1))
-        n
-        (+ (fibonacci (- n 1))
-           (fibonacci (- n 2))))))
-(fibonacci 35)
-`
+// The measurements of a workload, written as a line of JSON.
+type report struct {
+	Workload string      `json:"workload"`
+	GOGC     int         `json:"gogc"`
+	Eval     measurement `json:"eval"`
+	VM       measurement `json:"vm"`
+}
+
+// What running a workload with one engine took.
+type measurement struct {
+	Result     string `json:"result"`
+	DurationNs int64  `json:"duration_ns"`
+	Bytes      uint64 `json:"bytes"`  // the bytes allocated
+	Allocs     uint64 `json:"allocs"` // the number of allocations
+	GCs        uint32 `json:"gcs"`    // the number of garbage collections
+}
 
 func main() {
-	var duration time.Duration
-	var result object.Object
+	gogc := flag.Int("gogc", 0, "the GOGC percentage to run the workloads with, lower values collect garbage more often, 0 leaves it unchanged")
+	flag.Parse()
 
-	fmt.Println("recursively calculating the 35th fibonacci number:")
+	if *gogc != 0 {
+		debug.SetGCPercent(*gogc)
+	}
 
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
+	// SetGCPercent returns the current percentage, which is then restored.
+	percent := debug.SetGCPercent(100)
+	debug.SetGCPercent(percent)
 
-	start := time.Now()
+	encoder := json.NewEncoder(os.Stdout)
+
+	for _, w := range workloads {
+		r, err := run(w)
 
-	env := object.NewEnvironment(nil)
-	result = evaluator.Evaluate(program, env)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", w.name, err)
+			os.Exit(1)
+		}
 
-	duration = time.Since(start)
+		r.GOGC = percent
+		encoder.Encode(r)
+	}
+}
+
+// Run the workload with the evaluator and then the VM, measuring only the
+// running of the program, not its parsing or compilation.
+func run(w workload) (report, error) {
+	r := report{Workload: w.name}
+	program, err := parse(w.source)
+
+	if err != nil {
+		return r, err
+	}
 
-	fmt.Printf("engine=%s result=%s duration=%s\n",
-		"eval", result.Inspect(), duration)
+	r.Eval, err = measure(func() (object.Object, error) {
+		result := evaluator.Evaluate(program, object.NewEnvironment(nil))
 
-	start = time.Now()
+		if err, ok := result.(*object.ErrorObject); ok {
+			return nil, fmt.Errorf("evaluator error: %w", err)
+		}
 
-	c := compiler.New()
-	err := c.Compile(program)
+		return result, nil
+	})
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "compiler error: %s", err)
+		return r, err
 	}
 
-	vm := vm.New(c.Bytecode())
-	err = vm.Run()
+	bytecode, err := compile(w.source)
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "vm error: %s", err)
+		return r, err
 	}
 
-	duration = time.Since(start)
-	result = vm.LastPoppedStackElem()
+	r.VM, err = measure(func() (object.Object, error) {
+		result, err := vm.New(bytecode).RunResult()
+
+		if err != nil {
+			return nil, fmt.Errorf("vm error: %w", err)
+		}
+
+		return result, nil
+	})
+
+	return r, err
+}
+
+// Call fn, measuring how long it takes and what it allocates from the
+// difference in the memory statistics before and after.
+func measure(fn func() (object.Object, error)) (measurement, error) {
+	var before, after runtime.MemStats
+
+	// Collect garbage first, so that garbage left by the previous run isn't
+	// collected during this one.
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	result, err := fn()
+	duration := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+
+	if err != nil {
+		return measurement{}, err
+	}
 
-	fmt.Printf("engine=%s result=%s duration=%s\n",
-		"vm", result.Inspect(), duration)
+	return measurement{
+		Result:     result.Inspect(),
+		DurationNs: duration.Nanoseconds(),
+		Bytes:      after.TotalAlloc - before.TotalAlloc,
+		Allocs:     after.Mallocs - before.Mallocs,
+		GCs:        after.NumGC - before.NumGC,
+	}, nil
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"lisp/ast"
+	"lisp/compiler"
+	"lisp/lexer"
+	"lisp/parser"
+)
+
+// A workload is a program run by both engines to compare their performance.
+type workload struct {
+	name   string
+	source string
+}
+
+// The workloads each stress a different part of the engines. Loops are
+// written as recursion no deeper than a few hundred calls, so that they fit in
+// the frames of the VM.
+var workloads = []workload{
+	{
+		name: "fibonacci",
+		source: `
+(def fibonacci (lambda (n)
+    (if (or (= n 0)
+            (= n 1))
+        n
+        (+ (fibonacci (- n 1))
+           (fibonacci (- n 2))))))
+(fibonacci 20)
+`,
+	},
+	{
+		name: "arithmetic",
+		source: `
+(def sum-to (lambda (n acc)
+    (if (= n 0)
+        acc
+        (sum-to (- n 1) (+ acc (rem (* n 3) 7))))))
+(def repeat (lambda (times acc)
+    (if (= times 0)
+        acc
+        (repeat (- times 1) (+ acc (sum-to 500 0))))))
+(repeat 20 0)
+`,
+	},
+	{
+		name: "lists",
+		source: `
+(def build (lambda (lst n)
+    (if (= n 0)
+        lst
+        (build (push lst n) (- n 1)))))
+(def reduce (lambda (lst f acc)
+    (if (= 0 (len lst))
+        acc
+        (reduce (rest lst) f (f acc (first lst))))))
+(reduce (build (list) 500) (lambda (acc n) (+ acc n)) 0)
+`,
+	},
+	{
+		name: "strings",
+		source: `
+(def build (lambda (s n)
+    (if (= n 0)
+        s
+        (build (str s "ab" n) (- n 1)))))
+(len (build "" 500))
+`,
+	},
+	{
+		name: "dicts",
+		source: `
+(def fill (lambda (d n)
+    (if (= n 0)
+        d
+        (fill (set d (str "key" n) n) (- n 1)))))
+(def total (lambda (d n acc)
+    (if (= n 0)
+        acc
+        (total d (- n 1) (+ acc (get d (str "key" n)))))))
+(total (fill (dict) 500) 500 0)
+`,
+	},
+}
+
+// Parse the source of a workload, returning an error if it isn't valid.
+func parse(source string) (*ast.Program, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	if len(p.Errors) > 0 {
+		return nil, fmt.Errorf("parser errors: %v", p.Errors)
+	}
+
+	return program, nil
+}
+
+// Compile the source of a workload to bytecode.
+func compile(source string) (*compiler.Bytecode, error) {
+	program, err := parse(source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := compiler.New()
+
+	if err := c.Compile(program); err != nil {
+		return nil, fmt.Errorf("compiler error: %w", err)
+	}
+
+	return c.Bytecode(), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"lisp/compiler"
+	"lisp/interpreter"
+	"lisp/object"
+	"lisp/vm"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The extension of files containing encoded bytecode.
+const BYTECODE_EXTENSION = ".lbc"
+
+// Compile the file at the provided path and write its encoded bytecode to the
+// output path, so that it can be run later without compiling it again. When
+// the output path is empty, the path of the file is used with its extension
+// replaced by BYTECODE_EXTENSION.
+func compileFile(path string, output string, errOut io.Writer) int {
+	contents, err := os.ReadFile(path)
+
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return exitUsage
+	}
+
+	program, ok := parse(source{name: path, contents: string(contents)}, errOut)
+
+	if !ok {
+		return exitParse
+	}
+
+	c := interpreter.NewSession(interpreter.VM_ENGINE).Compiler()
+	err = c.Compile(program)
+
+	if err != nil {
+		fmt.Fprintf(errOut, "%s: compiler error: %s\n", path, err)
+		return exitCompile
+	}
+
+	for _, warning := range c.Warnings {
+		fmt.Fprintf(errOut, "%s: warning: %s\n", path, warning)
+	}
+
+	data, err := c.Bytecode().MarshalBinary()
+
+	if err != nil {
+		fmt.Fprintf(errOut, "%s: compiler error: %s\n", path, err)
+		return exitCompile
+	}
+
+	if output == "" {
+		output = strings.TrimSuffix(path, filepath.Ext(path)) + BYTECODE_EXTENSION
+	}
+
+	err = os.WriteFile(output, data, 0644)
+
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return exitUsage
+	}
+
+	return exitOK
+}
+
+// Run bytecode written by compileFile on the VM in the same way as a program
+// compiled from source, or show its disassembly with --disassemble.
+func runBytecode(src source, opts *options, out io.Writer, errOut io.Writer) int {
+	if opts.ast {
+		fmt.Fprintf(errOut, "%s: the syntax tree of bytecode can't be shown\n", src.name)
+		return exitUsage
+	}
+
+	bytecode := &compiler.Bytecode{}
+	err := bytecode.UnmarshalBinary([]byte(src.contents))
+
+	if err != nil {
+		fmt.Fprintf(errOut, "%s: %s\n", src.name, err)
+		return exitParse
+	}
+
+	if opts.disassemble {
+		fmt.Fprint(out, compiler.Disassemble(bytecode))
+		return exitOK
+	}
+
+	globals := make([]object.Object, len(bytecode.GlobalNames))
+
+	for i, name := range bytecode.GlobalNames {
+		if name == object.ARGS_NAME {
+			globals[i] = object.ArgsList(opts.args)
+		}
+	}
+
+	v := vm.NewWithState(bytecode, globals)
+	v.SetStreams(&object.Streams{Stdout: out, Stderr: errOut})
+
+	result, err := v.RunResult()
+
+	if err != nil {
+		fmt.Fprintf(errOut, "%s: vm error: %s\n", src.name, err)
+		return exitRuntime
+	}
+
+	if opts.printResult {
+		fmt.Fprintln(out, result.Inspect())
+	}
+
+	return exitOK
+}
@@ -30,10 +30,14 @@ const (
 	OpTrue
 	// Push the value 'false' on to the top of the stack.
 	OpFalse
-	// Conditionally move the instruction pointer to the specified instruction
-	// index based on the truthiness of the value on top of the stack, removing
-	// the value from the stack in the process. Move on to the next instruction
-	// without jumping if the top value evaluates as true.
+	// Conditionally move the instruction pointer to the first specified
+	// instruction index based on the truthiness of the value on top of the
+	// stack, removing the value from the stack in the process. Move on to the
+	// next instruction without jumping if the top value evaluates as true.
+	//
+	// If the value is an error it's left on the stack and the instruction
+	// pointer moves to the second specified index, the end of the if
+	// expression, so that the error becomes the result of the expression.
 	OpJumpWhenFalse
 	// Move the instruction pointer to the specified instruction index.
 	OpJump
@@ -75,6 +79,11 @@ const (
 	// Push another instance of the currently executing closure on to the
 	// stack.
 	OpCurrentClosure
+	// Call the function in the same way as OpCall, for a call whose result is
+	// returned by the calling function. A Closure replaces the calling
+	// function's Frame rather than adding a new one, so that recursion in
+	// tail position doesn't grow the frame stack.
+	OpTailCall
 )
 
 // definitions contains a map from an Opcode to its Definition. The Definition
@@ -86,7 +95,7 @@ var definitions = map[Opcode]*Definition{
 	OpPop:            {"OpPop", []int{}},
 	OpTrue:           {"OpTrue", []int{}},
 	OpFalse:          {"OpFalse", []int{}},
-	OpJumpWhenFalse:  {"OpJumpWhenFalse", []int{2}},
+	OpJumpWhenFalse:  {"OpJumpWhenFalse", []int{2, 2}},
 	OpJump:           {"OpJump", []int{2}},
 	OpNull:           {"OpNull", []int{}},
 	OpGetGlobal:      {"OpGetGlobal", []int{2}},
@@ -100,6 +109,7 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpTailCall:       {"OpTailCall", []int{1}},
 }
 
 // Make builds an instruction from the provided Opcode and operands, using the
@@ -181,6 +191,20 @@ func (ins Instructions) String() string {
 	return out.String()
 }
 
+// Convert the single instruction at the provided position into a human
+// readable string, in the same format as String without the position.
+func (ins Instructions) FormatAt(pos int) string {
+	def, err := Lookup(ins[pos])
+
+	if err != nil {
+		return fmt.Sprintf("ERROR: %s", err)
+	}
+
+	operands, _ := ReadOperands(def, ins[pos+1:])
+
+	return ins.fmtInstruction(def, operands)
+}
+
 // ReadOperands uses an Opcode Definition to extract the operands from an
 // already encoded instruction and converts them to a human readable format.
 // Returns the decoded operands and the byte width they occupied.
@@ -3,10 +3,22 @@
 package compiler
 
 import (
+	"context"
 	"fmt"
 	"lisp/ast"
 	"lisp/code"
+	"lisp/evaluator"
 	"lisp/object"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// The largest number of local and free variables a single lambda can use, as
+// they're referred to by one byte operands.
+const (
+	maxLocals        = 255
+	maxFreeVariables = 255
 )
 
 // A representation of an instruction.
@@ -22,6 +34,8 @@ type CompilationScope struct {
 	instructions        code.Instructions //instructions generated from Compile
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	// the source of each OpCall instruction, by position
+	callSites map[int]object.CallSite
 }
 
 // The Compiler is a struct that holds the result of calls to the Compile
@@ -31,13 +45,36 @@ type Compiler struct {
 	symbolTable *SymbolTable       // a map from a source code symbol to its memory address
 	scopes      []CompilationScope // a stack of currently used scopes
 	scopeIndex  int                // the currently active scope
+	macroDepth  int                // the number of macro calls being expanded
+	// When true, each scope's instructions are rewritten by the peephole
+	// optimizer before being used as bytecode.
+	Optimize bool
+	// Problems found during compilation that don't prevent the program from
+	// running, such as unused local variables.
+	Warnings []string
 }
 
 // Bytecode is a struct containing the instructions produced by a Compiler and
 // returned by the Bytecode method.
+//
+// Bytecode shares memory with the Compiler that produced it, so use Clone to
+// keep a copy that's unaffected by further use of the Compiler.
 type Bytecode struct {
-	Instructions code.Instructions // a collection of OpCodes stored as a slice of bytes
-	Constants    []object.Object   // each of the constant values found in the program
+	Instructions code.Instructions       // a collection of OpCodes stored as a slice of bytes
+	Constants    []object.Object         // each of the constant values found in the program
+	GlobalNames  []string                // the name of each global variable, by index
+	CallSites    map[int]object.CallSite // the source of each OpCall, by position
+}
+
+// Return a copy of the Bytecode that doesn't share memory with the original.
+// The constant Objects themselves are shared, as they're never modified.
+func (b *Bytecode) Clone() *Bytecode {
+	return &Bytecode{
+		Instructions: slices.Clone(b.Instructions),
+		Constants:    slices.Clone(b.Constants),
+		GlobalNames:  slices.Clone(b.GlobalNames),
+		CallSites:    maps.Clone(b.CallSites),
+	}
 }
 
 // Return the address of a new Compiler instance.
@@ -82,11 +119,102 @@ func NewWithState(constants []object.Object, symbolTable *SymbolTable) *Compiler
 
 // Compile an AST Expression into bytecode instructions. Return an error if there is
 // a problem during the compilation step.
+//
+// Each call appends to the instructions, constants, and symbols produced by
+// previous calls. Use Reset to start a new program that keeps the symbols and
+// constants already defined.
+//
+// Compilation is transactional: if an error is returned, the Compiler and the
+// SymbolTable it uses are restored to the state they were in before the call,
+// so they can be used to compile further expressions.
 func (c *Compiler) Compile(expr ast.Expression) error {
+	state := c.saveState()
+
+	err := c.compile(expr)
+
+	if err != nil {
+		c.restoreState(state)
+	}
+
+	return err
+}
+
+// Clear the instructions and warnings produced by previous calls to Compile,
+// while keeping the defined symbols and constants. This allows a single
+// Compiler to compile a sequence of programs that share state, such as the
+// lines entered into a REPL.
+func (c *Compiler) Reset() {
+	c.scopes = []CompilationScope{
+		{
+			instructions:        code.Instructions{},
+			lastInstruction:     EmittedInstruction{},
+			previousInstruction: EmittedInstruction{},
+		},
+	}
+	c.scopeIndex = 0
+	c.Warnings = nil
+}
+
+// Return a new Compiler with copies of the symbols and constants defined by
+// this one, and no instructions. Compiling with the copy doesn't change this
+// Compiler or its SymbolTable, so it can show how an expression would compile
+// without defining anything.
+func (c *Compiler) Clone() *Compiler {
+	clone := NewWithState(slices.Clone(c.constants), c.symbolTable.clone())
+	clone.Optimize = c.Optimize
+
+	return clone
+}
+
+// The state of a Compiler before a call to Compile, used to undo any changes
+// made by compilation that failed.
+type compilerState struct {
+	mainScope   CompilationScope
+	symbolTable *SymbolTable
+	symbols     symbolTableState
+	constants   int
+	warnings    int
+}
+
+// Record the current state of the Compiler's main scope.
+func (c *Compiler) saveState() compilerState {
+	return compilerState{
+		mainScope:   c.scopes[0],
+		symbolTable: c.symbolTable,
+		symbols:     c.symbolTable.saveState(),
+		constants:   len(c.constants),
+		warnings:    len(c.Warnings),
+	}
+}
+
+// Discard everything compiled since the provided state was saved, including
+// any scopes that were entered and not left.
+func (c *Compiler) restoreState(state compilerState) {
+	mainScope := state.mainScope
+	mainScope.instructions = c.scopes[0].instructions[:len(mainScope.instructions)]
+
+	for pos := range mainScope.callSites {
+		if pos >= len(mainScope.instructions) {
+			delete(mainScope.callSites, pos)
+		}
+	}
+
+	c.scopes = []CompilationScope{mainScope}
+	c.scopeIndex = 0
+
+	c.symbolTable = state.symbolTable
+	c.symbolTable.restoreState(state.symbols)
+
+	c.constants = c.constants[:state.constants]
+	c.Warnings = c.Warnings[:state.warnings]
+}
+
+// Recursively compile an AST Expression into bytecode instructions.
+func (c *Compiler) compile(expr ast.Expression) error {
 	switch expr := expr.(type) {
 	case *ast.Program:
 		for _, e := range expr.Expressions {
-			err := c.Compile(e)
+			err := c.compile(e)
 
 			if err != nil {
 				return err
@@ -99,6 +227,10 @@ func (c *Compiler) Compile(expr ast.Expression) error {
 		// Conditionally compile an SExpression based on the first element.
 		if expr.Fn == nil {
 			c.emit(code.OpEmptyList)
+		} else if list, ok := quotedLiteral(expr); ok {
+			// Quoted lists made entirely of literals are built once at
+			// compile time instead of on every evaluation.
+			c.emit(code.OpConstant, c.addConstant(list))
 		} else {
 			var err error
 
@@ -109,8 +241,24 @@ func (c *Compiler) Compile(expr ast.Expression) error {
 				err = c.compileDefExpression(expr)
 			case "lambda":
 				err = c.compileLambdaExpression(expr)
+			case "let":
+				err = c.compileLetExpression(expr)
+			case "cond":
+				err = c.compileCondExpression(expr)
+			case "when", "unless":
+				err = c.compileWhenExpression(expr)
+			case "do":
+				err = c.compileBody(expr.Args)
+			case "while":
+				err = c.compileWhileExpression(expr)
+			case "defmacro":
+				err = c.compileDefmacroExpression(expr)
 			default:
-				err = c.compileCallExpression(expr)
+				if macro, ok := c.resolveMacro(expr); ok {
+					err = c.compileMacroCall(macro, expr)
+				} else {
+					err = c.compileCallExpression(expr)
+				}
 			}
 
 			if err != nil {
@@ -118,13 +266,21 @@ func (c *Compiler) Compile(expr ast.Expression) error {
 			}
 		}
 	case *ast.FloatLiteral:
-		float := &object.Number{Value: expr.Value}
+		float := object.NewNumber(expr.Value)
 
 		c.emit(code.OpConstant, c.addConstant(float))
 	case *ast.StringLiteral:
-		string := &object.String{Value: expr.Value}
+		string := object.NewString(expr.Value)
 
 		c.emit(code.OpConstant, c.addConstant(string))
+	case *ast.SymbolLiteral:
+		symbol := &object.Symbol{Name: expr.Token.Literal}
+
+		c.emit(code.OpConstant, c.addConstant(symbol))
+	case *ast.KeywordLiteral:
+		keyword := &object.Keyword{Name: expr.Token.Literal}
+
+		c.emit(code.OpConstant, c.addConstant(keyword))
 	case *ast.Identifier:
 		switch expr.String() {
 		case "true":
@@ -134,6 +290,14 @@ func (c *Compiler) Compile(expr ast.Expression) error {
 		case "null":
 			c.emit(code.OpNull)
 		default:
+			if ast.SpecialForms[expr.String()] {
+				return specialFormError(expr.String(), "value")
+			}
+
+			if _, ok := c.symbolTable.ResolveMacro(expr.String()); ok {
+				return object.MacroValueError(expr.String())
+			}
+
 			sym, ok := c.symbolTable.Resolve(expr.Token.Literal)
 
 			if !ok {
@@ -155,10 +319,45 @@ func (c *Compiler) currentInstructions() code.Instructions {
 // Return a Bytecode instance containing the compiled instructions along with
 // a slice of constant values.
 func (c *Compiler) Bytecode() *Bytecode {
+	ins, callSites := c.scopeOutput(c.scopes[c.scopeIndex])
+
 	return &Bytecode{
-		Instructions: c.currentInstructions(),
+		Instructions: ins,
 		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.GlobalNames(),
+		CallSites:    callSites,
+	}
+}
+
+// Return the constants of every program compiled so far.
+func (c *Compiler) Constants() []object.Object {
+	return c.constants
+}
+
+// Return the finished instructions of the provided scope, along with the
+// source of its OpCall instructions. If the optimizer is enabled, the
+// instructions are optimized and the call sites are moved to the new
+// positions of their instructions.
+func (c *Compiler) scopeOutput(scope CompilationScope) (code.Instructions, map[int]object.CallSite) {
+	if !c.Optimize {
+		return scope.instructions, scope.callSites
+	}
+
+	ins, positions := optimize(scope.instructions)
+
+	if positions == nil {
+		return ins, scope.callSites
+	}
+
+	callSites := map[int]object.CallSite{}
+
+	for pos, site := range scope.callSites {
+		if newPos, ok := positions[pos]; ok {
+			callSites[newPos] = site
+		}
 	}
+
+	return ins, callSites
 }
 
 func (c *Compiler) addConstant(obj object.Object) int {
@@ -212,14 +411,106 @@ func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
 
 // Change the operand of the instruction at the provided position to the
 // provided operand.
-func (c *Compiler) changeOperand(opPos int, operand int) {
+func (c *Compiler) changeOperand(opPos int, operands ...int) {
 	op := code.Opcode(c.currentInstructions()[opPos])
 
-	newInstruction := code.Make(op, operand)
+	newInstruction := code.Make(op, operands...)
 
 	c.replaceInstruction(opPos, newInstruction)
 }
 
+// Convert a quoted list expression into a List object if every element is a
+// literal value, or is itself a quoted list of literals. Returns false if the
+// expression isn't quoted, or contains any element that needs evaluating.
+//
+// The resulting List is stored as a constant and shared between every
+// evaluation of the expression. This is safe because it's a constant List,
+// which push! and pop! refuse to change, matching the evaluator, which makes
+// every quoted list of literals a constant.
+func quotedLiteral(expr *ast.SExpression) (*object.List, bool) {
+	if !expr.IsQuotedLiteral() {
+		return nil, false
+	}
+
+	values := make([]object.Object, len(expr.Args))
+
+	for i, arg := range expr.Args {
+		values[i], _ = literalObject(arg)
+	}
+
+	return object.NewConstantList(values), true
+}
+
+// Convert a literal expression into its Object value. Returns false if the
+// expression is not a literal.
+func literalObject(expr ast.Expression) (object.Object, bool) {
+	switch expr := expr.(type) {
+	case *ast.FloatLiteral:
+		return object.NewNumber(expr.Value), true
+	case *ast.StringLiteral:
+		return object.NewString(expr.Value), true
+	case *ast.SymbolLiteral:
+		return &object.Symbol{Name: expr.Token.Literal}, true
+	case *ast.KeywordLiteral:
+		return &object.Keyword{Name: expr.Token.Literal}, true
+	case *ast.Identifier:
+		switch expr.String() {
+		case "true":
+			return object.TRUE, true
+		case "false":
+			return object.FALSE, true
+		case "null":
+			return object.NULL, true
+		}
+	case *ast.SExpression:
+		if expr.Fn == nil {
+			return object.NewConstantList(nil), true
+		}
+
+		return quotedLiteral(expr)
+	}
+
+	return nil, false
+}
+
+// Return the type of Object the expression evaluates to if the expression is
+// a literal value. Returns false for expressions whose type can't be known
+// before execution, such as identifiers and function calls.
+func literalType(expr ast.Expression) (object.ObjectType, bool) {
+	switch expr := expr.(type) {
+	case *ast.FloatLiteral:
+		return object.NUMBER_OBJ, true
+	case *ast.StringLiteral:
+		return object.STRING_OBJ, true
+	case *ast.SymbolLiteral:
+		return object.SYMBOL_OBJ, true
+	case *ast.KeywordLiteral:
+		return object.KEYWORD_OBJ, true
+	case *ast.Identifier:
+		switch expr.String() {
+		case "true", "false":
+			return object.BOOLEAN_OBJ, true
+		case "null":
+			return object.NULL_OBJ, true
+		}
+	case *ast.SExpression:
+		if expr.Fn == nil || expr.Quoted {
+			return object.LIST_OBJ, true
+		}
+	}
+
+	return "", false
+}
+
+// Return the source representation of a literal expression.
+func literalString(expr ast.Expression) string {
+	if str, ok := expr.(*ast.StringLiteral); ok {
+		return fmt.Sprintf("%q", str.Value)
+	}
+
+	return expr.String()
+}
+
 // Compile an if expression to instructions, adding in a false path if one is
 // not provided.
 func (c *Compiler) compileIfExpression(expr *ast.SExpression) error {
@@ -230,19 +521,20 @@ func (c *Compiler) compileIfExpression(expr *ast.SExpression) error {
 
 	condition := expr.Args[0]
 
-	err := c.Compile(condition)
+	err := c.compile(condition)
 
 	if err != nil {
 		return err
 	}
 
-	// Emit conditional jump with erroneous destination, to be updated later
-	// in the function to the start of the alternative.
-	conditionalJumpPos := c.emit(code.OpJumpWhenFalse, 9999)
+	// Emit conditional jump with erroneous destinations, to be updated later
+	// in the function to the start of the alternative and the end of the
+	// if expression, where an error condition is left as the result.
+	conditionalJumpPos := c.emit(code.OpJumpWhenFalse, 9999, 9999)
 
 	consequence := expr.Args[1]
 
-	err = c.Compile(consequence)
+	err = c.compile(consequence)
 
 	if err != nil {
 		return err
@@ -252,10 +544,7 @@ func (c *Compiler) compileIfExpression(expr *ast.SExpression) error {
 	// to the end of the alternative.
 	jumpPos := c.emit(code.OpJump, 9999)
 
-	// Update the conditional jump instruction's destination to be directly
-	// after the consequence of the if expression.
 	positionAfterConsequence := len(c.currentInstructions())
-	c.changeOperand(conditionalJumpPos, positionAfterConsequence)
 
 	if len(expr.Args) < 3 {
 		// Add null as the alternative result of if expressions where no
@@ -264,7 +553,7 @@ func (c *Compiler) compileIfExpression(expr *ast.SExpression) error {
 	} else {
 		alternative := expr.Args[2]
 
-		err = c.Compile(alternative)
+		err = c.compile(alternative)
 
 		if err != nil {
 			return err
@@ -272,9 +561,207 @@ func (c *Compiler) compileIfExpression(expr *ast.SExpression) error {
 	}
 
 	// Update the jump instruction's destination to be directly after the
-	// alternative of the if expression.
+	// alternative of the if expression, and the conditional jump's
+	// destinations to be directly after the consequence and alternative.
+	positionAfterAlternative := len(c.currentInstructions())
+	c.changeOperand(jumpPos, positionAfterAlternative)
+	c.changeOperand(
+		conditionalJumpPos,
+		positionAfterConsequence,
+		positionAfterAlternative,
+	)
+
+	return nil
+}
+
+// Compile a cond expression of the form (cond (test expr) ... (else expr)) to
+// a chain of conditional jumps, in the same way as an if expression. Each test
+// jumps to the next clause when false, and each expression jumps to the end of
+// the cond expression. The result is null if no clause matches, and an error
+// if a test is an error.
+func (c *Compiler) compileCondExpression(expr *ast.SExpression) error {
+	clauses, err := ast.ParseClauses(expr.Args)
+
+	if err != nil {
+		return err
+	}
+
+	// The jumps to the end of the cond expression, and the conditional jumps
+	// whose error destination is the end, to be updated once it's known.
+	jumpsToEnd := []int{}
+	conditionalJumps := []int{}
+	matchesAll := false
+
+	for _, clause := range clauses {
+		if clause.IsDefault() {
+			// The clauses after a default clause are never reached.
+			err := c.compile(clause.Body)
+
+			if err != nil {
+				return err
+			}
+
+			matchesAll = true
+			break
+		}
+
+		err := c.compile(clause.Test)
+
+		if err != nil {
+			return err
+		}
+
+		conditionalJumpPos := c.emit(code.OpJumpWhenFalse, 9999, 9999)
+		conditionalJumps = append(conditionalJumps, conditionalJumpPos)
+
+		err = c.compile(clause.Body)
+
+		if err != nil {
+			return err
+		}
+
+		jumpsToEnd = append(jumpsToEnd, c.emit(code.OpJump, 9999))
+
+		// A false test moves on to the next clause, which starts here.
+		c.changeOperand(conditionalJumpPos, len(c.currentInstructions()), 9999)
+	}
+
+	if !matchesAll {
+		c.emit(code.OpNull)
+	}
+
+	end := len(c.currentInstructions())
+
+	for _, pos := range jumpsToEnd {
+		c.changeOperand(pos, end)
+	}
+
+	for _, pos := range conditionalJumps {
+		next := code.ReadUint16(c.currentInstructions()[pos+1:])
+		c.changeOperand(pos, int(next), end)
+	}
+
+	return nil
+}
+
+// Compile a when or unless expression of the form (when test body...), where
+// the body is evaluated when the test is true, or false for unless, and the
+// result is the value of its last expression. The result is null when the
+// body isn't evaluated, and an error if the test is an error.
+func (c *Compiler) compileWhenExpression(expr *ast.SExpression) error {
+	name := expr.Fn.String()
+
+	if len(expr.Args) < 1 {
+		return fmt.Errorf("not enough arguments for %s expression", name)
+	}
+
+	err := c.compile(expr.Args[0])
+
+	if err != nil {
+		return err
+	}
+
+	conditionalJumpPos := c.emit(code.OpJumpWhenFalse, 9999, 9999)
+
+	// The branch taken when the test is true comes first, so unless leaves
+	// null as its result there and evaluates the body when the test is false.
+	if name == "unless" {
+		c.emit(code.OpNull)
+	} else {
+		err = c.compileBody(expr.Args[1:])
+
+		if err != nil {
+			return err
+		}
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	positionAfterConsequence := len(c.currentInstructions())
+
+	if name == "unless" {
+		err = c.compileBody(expr.Args[1:])
+
+		if err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpNull)
+	}
+
 	positionAfterAlternative := len(c.currentInstructions())
 	c.changeOperand(jumpPos, positionAfterAlternative)
+	c.changeOperand(
+		conditionalJumpPos,
+		positionAfterConsequence,
+		positionAfterAlternative,
+	)
+
+	return nil
+}
+
+// Compile a while expression of the form (while test body...), which
+// evaluates the body for as long as the test is true. The value of the body is
+// popped after each iteration, and the result is null once the test is false,
+// or an error if the test is an error.
+func (c *Compiler) compileWhileExpression(expr *ast.SExpression) error {
+	if len(expr.Args) < 1 {
+		return fmt.Errorf("not enough arguments for while expression")
+	}
+
+	start := len(c.currentInstructions())
+
+	err := c.compile(expr.Args[0])
+
+	if err != nil {
+		return err
+	}
+
+	conditionalJumpPos := c.emit(code.OpJumpWhenFalse, 9999, 9999)
+
+	for _, exp := range expr.Args[1:] {
+		err := c.compile(exp)
+
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpPop)
+	}
+
+	// Jump back to test the condition again.
+	c.emit(code.OpJump, start)
+
+	positionAfterBody := len(c.currentInstructions())
+	c.emit(code.OpNull)
+
+	c.changeOperand(
+		conditionalJumpPos,
+		positionAfterBody,
+		len(c.currentInstructions()),
+	)
+
+	return nil
+}
+
+// Compile a sequence of expressions so that only the value of the last is
+// left on the stack, or null if there are none.
+func (c *Compiler) compileBody(expressions []ast.Expression) error {
+	if len(expressions) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	for i, exp := range expressions {
+		if i > 0 {
+			c.emit(code.OpPop)
+		}
+
+		err := c.compile(exp)
+
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -293,13 +780,17 @@ func (c *Compiler) compileDefExpression(expr *ast.SExpression) error {
 		return fmt.Errorf("first argument to def must be identifier")
 	}
 
+	if ast.SpecialForms[name.String()] {
+		return specialFormError(name.String(), "variable")
+	}
+
 	symbol := c.symbolTable.Define(name.Token.Literal)
 
 	if sExpr, ok := expr.Args[1].(*ast.SExpression); ok {
 		sExpr.Name = name.Token.Literal
 	}
 
-	err := c.Compile(expr.Args[1])
+	err := c.compile(expr.Args[1])
 
 	if err != nil {
 		return err
@@ -314,6 +805,59 @@ func (c *Compiler) compileDefExpression(expr *ast.SExpression) error {
 	return nil
 }
 
+// Compile the provided SExpression as a defmacro expression, which defines a
+// macro that's run on the arguments of each call to it as the call is
+// compiled. Macros are defined before any code runs, so they can only be
+// defined at the top level. The result of the expression is null.
+func (c *Compiler) compileDefmacroExpression(expr *ast.SExpression) error {
+	if c.scopeIndex != 0 {
+		return fmt.Errorf("defmacro is only allowed at the top level")
+	}
+
+	macro, err := evaluator.NewMacro(expr)
+
+	if err != nil {
+		return err
+	}
+
+	c.symbolTable.DefineMacro(macro)
+	c.emit(code.OpNull)
+
+	return nil
+}
+
+// Return the macro an SExpression calls, if it calls one.
+func (c *Compiler) resolveMacro(expr *ast.SExpression) (*object.Macro, bool) {
+	ident, ok := expr.Fn.(*ast.Identifier)
+
+	if !ok {
+		return nil, false
+	}
+
+	return c.symbolTable.ResolveMacro(ident.String())
+}
+
+// Compile the expansion of a call to a macro in place of the call. Expansions
+// that contain further macro calls are expanded in turn, up to
+// evaluator.MaxMacroExpansions deep, so that a macro that always expands into
+// itself is an error rather than a crash.
+func (c *Compiler) compileMacroCall(macro *object.Macro, expr *ast.SExpression) error {
+	c.macroDepth++
+	defer func() { c.macroDepth-- }()
+
+	if c.macroDepth > evaluator.MaxMacroExpansions {
+		return evaluator.MacroDepthError(macro.Name)
+	}
+
+	expansion, err := evaluator.ExpandMacro(context.Background(), macro, expr)
+
+	if err != nil {
+		return err
+	}
+
+	return c.compile(expansion)
+}
+
 // Compile the provided SExpression as a Lambda Expression, resulting in a
 // Closure object (all lambdas are treated as closures).
 func (c *Compiler) compileLambdaExpression(expr *ast.SExpression) error {
@@ -334,6 +878,7 @@ func (c *Compiler) compileLambdaExpression(expr *ast.SExpression) error {
 	}
 
 	params := []ast.Expression{}
+	paramNames := []string{}
 
 	if paramList.Fn != nil {
 		params = append([]ast.Expression{paramList.Fn}, paramList.Args...)
@@ -346,7 +891,29 @@ func (c *Compiler) compileLambdaExpression(expr *ast.SExpression) error {
 			return fmt.Errorf("function parameters must be identifiers, got=%T(%+v)", p, params)
 		}
 
-		c.symbolTable.Define(param.String())
+		if ast.SpecialForms[param.String()] {
+			return specialFormError(param.String(), "variable")
+		}
+
+		paramNames = append(paramNames, param.String())
+	}
+
+	paramNames, variadic, err := ast.ParseRestParameter(paramNames)
+
+	if err != nil {
+		return err
+	}
+
+	// A rest parameter is the local after the fixed parameters, holding a
+	// List of the extra arguments made by the VM when the lambda is called.
+	for _, name := range paramNames {
+		c.symbolTable.Define(name)
+	}
+
+	parameterCount := len(paramNames)
+
+	if variadic {
+		parameterCount--
 	}
 
 	expressions := expr.Args[1:]
@@ -357,7 +924,7 @@ func (c *Compiler) compileLambdaExpression(expr *ast.SExpression) error {
 		c.emit(code.OpReturn)
 	} else {
 		for _, arg := range expressions {
-			err := c.Compile(arg)
+			err := c.compile(arg)
 
 			if err != nil {
 				return err
@@ -373,16 +940,30 @@ func (c *Compiler) compileLambdaExpression(expr *ast.SExpression) error {
 		)
 	}
 
+	c.markTailCalls()
+
+	err = c.checkScopeLimits(describeLambda("function", expr.Name))
+
+	if err != nil {
+		return err
+	}
+
+	c.warnUnusedLocals(describeLambda("lambda", expr.Name), len(paramNames))
+
 	// Take free symbols found during compilation before leaving the inner scope
 	// so the values can be added to the produced Closure.
 	freeSymbols := c.symbolTable.FreeSymbols
 	localsCount := c.symbolTable.count
-	ins := c.leaveScope()
+	ins, callSites := c.leaveScope()
 
 	compiledLambda := &object.CompiledLambda{
 		Instructions:   ins,
 		LocalsCount:    localsCount,
-		ParameterCount: len(params),
+		ParameterCount: parameterCount,
+		Variadic:       variadic,
+		Parameters:     paramNames,
+		Name:           expr.Name,
+		CallSites:      callSites,
 	}
 
 	// Put values associated with free symbols on the stack in front of the
@@ -396,29 +977,218 @@ func (c *Compiler) compileLambdaExpression(expr *ast.SExpression) error {
 	return nil
 }
 
+// Compile the provided SExpression as a let expression of the form
+// (let ((name value) ...) body...).
+//
+// Each binding is a new local variable of the enclosing lambda, which can be
+// used by the bindings after it and by the body. The names are only bound
+// until the end of the body, and shadow any variable of the same name without
+// changing it.
+//
+// The main program has no local variables, so a let expression there is
+// compiled as a call to a lambda without parameters that holds its bindings.
+func (c *Compiler) compileLetExpression(expr *ast.SExpression) error {
+	if len(expr.Args) < 1 {
+		return fmt.Errorf("not enough arguments for let expression")
+	}
+
+	bindings, err := ast.ParseBindings(expr.Args[0])
+
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bindings {
+		if ast.SpecialForms[b.Name.String()] {
+			return specialFormError(b.Name.String(), "variable")
+		}
+	}
+
+	if c.symbolTable.outer != nil {
+		return c.compileLetBindings(bindings, expr.Args[1:])
+	}
+
+	c.enterScope()
+
+	err = c.compileLetBindings(bindings, expr.Args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpReturn)
+	c.markTailCalls()
+
+	err = c.checkScopeLimits("let expression")
+
+	if err != nil {
+		return err
+	}
+
+	c.warnUnusedLocals("let expression", 0)
+
+	localsCount := c.symbolTable.count
+	ins, callSites := c.leaveScope()
+
+	lambda := &object.CompiledLambda{
+		Instructions: ins,
+		LocalsCount:  localsCount,
+		Name:         "let",
+		CallSites:    callSites,
+	}
+
+	c.emit(code.OpClosure, c.addConstant(lambda), 0)
+	c.emit(code.OpCall, 0)
+
+	return nil
+}
+
+// Compile the bindings of a let expression as local variables of the current
+// scope, followed by its body. Each binding, and the body, is a block of its
+// own, so that a name can be bound more than once and what the body defines
+// is discarded along with the bindings.
+func (c *Compiler) compileLetBindings(bindings []ast.Binding, body []ast.Expression) error {
+	for _, b := range bindings {
+		err := c.compile(b.Value)
+
+		if err != nil {
+			return err
+		}
+
+		c.symbolTable.beginBlock()
+		symbol := c.symbolTable.Define(b.Name.String())
+
+		c.emit(code.OpSetLocal, symbol.Index)
+		c.emit(code.OpPop)
+	}
+
+	c.symbolTable.beginBlock()
+
+	err := c.compileBody(body)
+
+	for range len(bindings) + 1 {
+		c.symbolTable.endBlock()
+	}
+
+	return err
+}
+
+// Add a warning for each parameter and local variable of the current scope
+// that is never used. Names beginning with an underscore are exempt, so that
+// unused parameters can be marked as deliberate.
+//
+// The location describes the scope, such as "lambda 'f'", and the first
+// paramCount locals of a scope are always its parameters.
+func (c *Compiler) warnUnusedLocals(location string, paramCount int) {
+	for _, sym := range c.symbolTable.UnusedLocals() {
+		if strings.HasPrefix(sym.Name, "_") {
+			continue
+		}
+
+		kind := "local variable"
+
+		if sym.Index < paramCount {
+			kind = "parameter"
+		}
+
+		c.Warnings = append(
+			c.Warnings,
+			fmt.Sprintf("unused %s '%s' in %s", kind, sym.Name, location),
+		)
+	}
+}
+
 // Compile the provided SExpression as a call to a function, resulting in a call
 // instruction with an operand representing the number of arguments passed in,
 // which sit on the stack above the function to be called.
 func (c *Compiler) compileCallExpression(expr *ast.SExpression) error {
-	err := c.Compile(expr.Fn)
+	if objType, ok := literalType(expr.Fn); ok {
+		return fmt.Errorf("cannot call %s literal %s", objType, literalString(expr.Fn))
+	}
+
+	err := c.compile(expr.Fn)
 
 	if err != nil {
 		return err
 	}
 
 	for _, a := range expr.Args {
-		err := c.Compile(a)
+		err := c.compile(a)
 
 		if err != nil {
 			return err
 		}
 	}
 
-	c.emit(code.OpCall, len(expr.Args))
+	pos := c.emit(code.OpCall, len(expr.Args))
+
+	// Record the source of the call so that the VM can refer to it if the
+	// call fails.
+	site := object.CallSite{Line: expr.Line}
+
+	if ident, ok := expr.Fn.(*ast.Identifier); ok {
+		site.Name = ident.String()
+	}
+
+	if site != (object.CallSite{}) {
+		scope := &c.scopes[c.scopeIndex]
+
+		if scope.callSites == nil {
+			scope.callSites = map[int]object.CallSite{}
+		}
+
+		scope.callSites[pos] = site
+	}
 
 	return nil
 }
 
+// Change each OpCall of the current scope whose result is returned into an
+// OpTailCall. A call's result is returned when the instruction after it is an
+// OpReturn, or an OpJump that leads to one, such as at the end of the
+// consequence of an if expression.
+//
+// The OpReturn is kept, as it still returns the result of calling a builtin.
+func (c *Compiler) markTailCalls() {
+	ins := c.currentInstructions()
+
+	for pos := 0; pos < len(ins); {
+		op := code.Opcode(ins[pos])
+		def, err := code.Lookup(ins[pos])
+
+		if err != nil {
+			return
+		}
+
+		_, read := code.ReadOperands(def, ins[pos+1:])
+		next := pos + 1 + read
+
+		if op == code.OpCall && returnsFrom(ins, next) {
+			ins[pos] = byte(code.OpTailCall)
+		}
+
+		pos = next
+	}
+}
+
+// Report whether execution from the provided position returns without
+// executing anything but jumps.
+func returnsFrom(ins code.Instructions, pos int) bool {
+	for pos < len(ins) && code.Opcode(ins[pos]) == code.OpJump {
+		target := int(code.ReadUint16(ins[pos+1:]))
+
+		// Only forward jumps are followed, so that the loop always ends. A
+		// jump back to the start of a while loop never leads to a return.
+		if target <= pos {
+			return false
+		}
+
+		pos = target
+	}
+
+	return pos < len(ins) && code.Opcode(ins[pos]) == code.OpReturn
+}
+
 // Push a new scope into the Compiler's scope stack and use it as the active
 // scope.
 func (c *Compiler) enterScope() {
@@ -435,16 +1205,55 @@ func (c *Compiler) enterScope() {
 }
 
 // Pop the currently active scope of the Compiler's scope stack, and return
-// the popped scope's instructions,
-func (c *Compiler) leaveScope() code.Instructions {
-	ins := c.currentInstructions()
+// the popped scope's instructions, along with the source of its OpCall
+// instructions.
+func (c *Compiler) leaveScope() (code.Instructions, map[int]object.CallSite) {
+	ins, callSites := c.scopeOutput(c.scopes[c.scopeIndex])
 
 	c.scopes = c.scopes[:len(c.scopes)-1]
 	c.scopeIndex--
 
 	c.symbolTable = c.symbolTable.outer
 
-	return ins
+	return ins, callSites
+}
+
+// Return an error if the current scope has more local or free variables than
+// can be referred to by the one byte operands of the instructions that use
+// them, such as OpGetLocal and OpClosure. The function describes the scope in
+// the error, such as "function 'f'".
+func (c *Compiler) checkScopeLimits(function string) error {
+	if count := c.symbolTable.count; count > maxLocals {
+		return fmt.Errorf(
+			"too many local variables in %s (got %d, max %d)",
+			function, count, maxLocals,
+		)
+	}
+
+	if count := len(c.symbolTable.FreeSymbols); count > maxFreeVariables {
+		return fmt.Errorf(
+			"too many free variables in %s (got %d, max %d)",
+			function, count, maxFreeVariables,
+		)
+	}
+
+	return nil
+}
+
+// Describe a lambda with the provided name in the messages of the compiler,
+// as the kind of thing it is, such as "function 'f'" or "anonymous function".
+func describeLambda(kind string, name string) string {
+	if name == "" {
+		return "anonymous " + kind
+	}
+
+	return fmt.Sprintf("%s '%s'", kind, name)
+}
+
+// Create the error returned when a special form name is used as a value or
+// variable name, so that it matches the error produced by the evaluator.
+func specialFormError(name string, usage string) error {
+	return object.SpecialFormError(name, usage)
 }
 
 // Emit the correct get Opcode to retrieve the value associated with the
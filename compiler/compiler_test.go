@@ -7,6 +7,7 @@ import (
 	"lisp/lexer"
 	"lisp/object"
 	"lisp/parser"
+	"lisp/token"
 	"slices"
 	"testing"
 )
@@ -94,18 +95,18 @@ func TestConditionals(t *testing.T) {
 				// 0000
 				code.Make(code.OpTrue),
 				// 0001
-				code.Make(code.OpJumpWhenFalse, 10),
-				// 0004
+				code.Make(code.OpJumpWhenFalse, 12, 13),
+				// 0006
 				code.Make(code.OpConstant, 0),
-				// 0007
-				code.Make(code.OpJump, 11),
-				// 0010
+				// 0009
+				code.Make(code.OpJump, 13),
+				// 0012
 				code.Make(code.OpNull),
-				// 0011
+				// 0013
 				code.Make(code.OpPop),
-				// 0008
+				// 0014
 				code.Make(code.OpConstant, 1),
-				// 0011
+				// 0017
 				code.Make(code.OpPop),
 			},
 		},
@@ -116,18 +117,217 @@ func TestConditionals(t *testing.T) {
 				// 0000
 				code.Make(code.OpTrue),
 				// 0001
-				code.Make(code.OpJumpWhenFalse, 10),
-				// 0004
+				code.Make(code.OpJumpWhenFalse, 12, 15),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpJump, 15),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+				// 0016
+				code.Make(code.OpConstant, 2),
+				// 0019
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(cond (false 1) (else 2))",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpWhenFalse, 12, 15),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpJump, 15),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(cond (false 1) (true 2))",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpWhenFalse, 12, 15),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpJump, 15),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(cond (false 1) (false 2))",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpWhenFalse, 12, 25),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpJump, 25),
+				// 0012
+				code.Make(code.OpFalse),
+				// 0013
+				code.Make(code.OpJumpWhenFalse, 24, 25),
+				// 0018
+				code.Make(code.OpConstant, 1),
+				// 0021
+				code.Make(code.OpJump, 25),
+				// 0024
+				code.Make(code.OpNull),
+				// 0025
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestWhenExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "(when true 1 2)",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpWhenFalse, 16, 17),
+				// 0006
 				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpPop),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpJump, 17),
+				// 0016
+				code.Make(code.OpNull),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(unless true 1)",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpWhenFalse, 10, 13),
+				// 0006
+				code.Make(code.OpNull),
 				// 0007
 				code.Make(code.OpJump, 13),
 				// 0010
+				code.Make(code.OpConstant, 0),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(when true)",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpWhenFalse, 10, 11),
+				// 0006
+				code.Make(code.OpNull),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDoExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "(do 1 2)",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
 				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(do)",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestWhileExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "(while false 1)",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpWhenFalse, 13, 14),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpPop),
+				// 0010
+				code.Make(code.OpJump, 0),
 				// 0013
+				code.Make(code.OpNull),
+				// 0014
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 (while true)",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
 				code.Make(code.OpPop),
+				// 0004
+				code.Make(code.OpTrue),
+				// 0005
+				code.Make(code.OpJumpWhenFalse, 13, 14),
+				// 0010
+				code.Make(code.OpJump, 4),
+				// 0013
+				code.Make(code.OpNull),
 				// 0014
-				code.Make(code.OpConstant, 2),
-				// 0017
 				code.Make(code.OpPop),
 			},
 		},
@@ -136,6 +336,124 @@ func TestConditionals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+// Ensure a rest parameter is counted separately from the fixed parameters.
+func TestVariadicParameters(t *testing.T) {
+	tests := []struct {
+		input          string
+		parameterCount int
+		variadic       bool
+		parameters     []string
+	}{
+		{"(lambda (a b) a b)", 2, false, []string{"a", "b"}},
+		{"(lambda (a & rest) a rest)", 1, true, []string{"a", "rest"}},
+		{"(lambda (& rest) rest)", 0, true, []string{"rest"}},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+
+		err := compiler.Compile(parse(tt.input))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		lambda := compiler.Bytecode().Constants[0].(*object.CompiledLambda)
+
+		if lambda.ParameterCount != tt.parameterCount {
+			t.Errorf("wrong parameter count for %q. want=%d, got=%d", tt.input, tt.parameterCount, lambda.ParameterCount)
+		}
+
+		if lambda.Variadic != tt.variadic {
+			t.Errorf("wrong variadic for %q. want=%t, got=%t", tt.input, tt.variadic, lambda.Variadic)
+		}
+
+		if !slices.Equal(lambda.Parameters, tt.parameters) {
+			t.Errorf("wrong parameters for %q. want=%q, got=%q", tt.input, tt.parameters, lambda.Parameters)
+		}
+
+		if lambda.LocalsCount != len(tt.parameters) {
+			t.Errorf("wrong locals count for %q. want=%d, got=%d", tt.input, len(tt.parameters), lambda.LocalsCount)
+		}
+	}
+}
+
+// Test that a call to a macro compiles to the same instructions as the
+// expression it expands into.
+func TestMacroExpansion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(defmacro my-unless (test body) (list 'if test null body)) (my-unless false 1)", "null (if false null 1)"},
+		{"(defmacro square (x) (list '* x x)) (square 3)", "null (* 3 3)"},
+		{"(defmacro q (x) (list 'quote x)) (q (a 1))", "null '(a 1)"},
+		{"(defmacro count-down (n) (if (= n 0) 0 (list 'count-down (- n 1)))) (count-down 3)", "null 0"},
+		{"(defmacro m () 1) (lambda (m) m)", "null (lambda (m) m)"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+
+		err := compiler.Compile(parse(tt.input))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		expected := New()
+
+		err = expected.Compile(parse(tt.expected))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = testInstructions([]code.Instructions{expected.Bytecode().Instructions}, compiler.Bytecode().Instructions)
+
+		if err != nil {
+			t.Errorf("wrong instructions for %q: %s", tt.input, err)
+		}
+	}
+}
+
+func TestConditionalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(cond 1)", "expected a clause of the form (test expr), got 1"},
+		{"(cond (true))", "expected a clause of the form (test expr), got (true)"},
+		{"(cond (true 1 2))", "expected a clause of the form (test expr), got (true 1 2)"},
+		{"(cond (x 1))", "undefined variable x"},
+		{"(when)", "not enough arguments for when expression"},
+		{"(unless)", "not enough arguments for unless expression"},
+		{"(while)", "not enough arguments for while expression"},
+		{"(lambda (a &) a)", "expected one parameter after &, got 0"},
+		{"(lambda (& a b) a)", "expected one parameter after &, got 2"},
+		{"(defmacro m () 1) m", "'m' is a macro and cannot be used as a value"},
+		{"(defmacro forever () (list 'forever)) (forever)", "macro forever expanded more than 1000 times"},
+		{"(defmacro m () {}) (m)", "a macro can't expand into {}"},
+		{"(lambda () (defmacro m () 1))", "defmacro is only allowed at the top level"},
+		{"(defmacro m)", "attempted to call defmacro with incorrect number of arguments: expected at least 3, got=1"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+
+		err := compiler.Compile(program)
+
+		if err == nil {
+			t.Fatalf("expected compiler error for %q but none occurred", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error: want=%q got=%q", tt.expected, err)
+		}
+	}
+}
+
 // Test that variables defined in the global scope are compiled correctly.
 func TestGlobalDefExpressions(t *testing.T) {
 	tests := []compilerTestCase{
@@ -447,7 +765,7 @@ func TestBuiltinReferences(t *testing.T) {
 					code.Make(code.OpGetBuiltin, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpConstant, 1),
-					code.Make(code.OpCall, 2),
+					code.Make(code.OpTailCall, 2),
 					code.Make(code.OpReturn),
 				},
 			},
@@ -461,70 +779,149 @@ func TestBuiltinReferences(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-// Ensure actual closures compile as expected.
-func TestClosures(t *testing.T) {
+// Ensure calls whose result is returned from a lambda become tail calls, and
+// other calls don't.
+func TestTailCalls(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input: `
-            (lambda (a)
-              (lambda (b)
-                (+ a b)))
+            (lambda (f) (f 1) (f 2))
             `,
 			expectedConstants: []interface{}{
+				1, 2,
 				[]code.Instructions{
-					code.Make(code.OpGetBuiltin, 0),
-					code.Make(code.OpGetFree, 0),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpCall, 2),
-					code.Make(code.OpReturn),
-				},
-				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpPop),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturn),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
 		{
 			input: `
-            (lambda (a)
-              (lambda (b)
-                (lambda (c)
-                  (+ a b c))))
+            (lambda (f) (if (f) (f) (f)))
             `,
 			expectedConstants: []interface{}{
 				[]code.Instructions{
-					code.Make(code.OpGetBuiltin, 0),
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetFree, 1),
+					// 0000
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpCall, 3),
-					code.Make(code.OpReturn),
-				},
-				[]code.Instructions{
-					code.Make(code.OpGetFree, 0),
+					// 0002
+					code.Make(code.OpCall, 0),
+					// 0004
+					code.Make(code.OpJumpWhenFalse, 16, 20),
+					// 0009
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpClosure, 0, 2),
-					code.Make(code.OpReturn),
-				},
-				[]code.Instructions{
+					// 0011
+					code.Make(code.OpTailCall, 0),
+					// 0013
+					code.Make(code.OpJump, 20),
+					// 0016
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpClosure, 1, 1),
+					// 0018
+					code.Make(code.OpTailCall, 0),
+					// 0020
 					code.Make(code.OpReturn),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpPop),
 			},
 		},
 		{
 			input: `
-            (def a 1)
+            (lambda (f) (def a (f)))
+            `,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// Ensure actual closures compile as expected.
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+            (lambda (a)
+              (lambda (b)
+                (+ a b)))
+            `,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 2),
+					code.Make(code.OpReturn),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+            (lambda (a)
+              (lambda (b)
+                (lambda (c)
+                  (+ a b c))))
+            `,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 3),
+					code.Make(code.OpReturn),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 2),
+					code.Make(code.OpReturn),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+            (def a 1)
             (lambda ()
               (def b 2)
               (lambda ()
@@ -547,7 +944,7 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpGetFree, 0),
 					code.Make(code.OpGetFree, 1),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpCall, 4),
+					code.Make(code.OpTailCall, 4),
 					code.Make(code.OpReturn),
 				},
 				[]code.Instructions{
@@ -596,7 +993,7 @@ func TestRecursiveClosures(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpCall, 2),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturn),
 				},
 			},
@@ -622,7 +1019,7 @@ func TestRecursiveClosures(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpCall, 2),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturn),
 				},
 				10,
@@ -632,7 +1029,7 @@ func TestRecursiveClosures(t *testing.T) {
 					code.Make(code.OpPop),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 2),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturn),
 				},
 			},
@@ -666,30 +1063,30 @@ func TestRecursiveClosures(t *testing.T) {
 					// 0007
 					code.Make(code.OpCall, 2),
 					// 0009
-					code.Make(code.OpJumpWhenFalse, 17),
-					// 0012
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJumpWhenFalse, 19, 37),
 					// 0014
-					code.Make(code.OpJump, 35),
-					// 0017
-					code.Make(code.OpGetBuiltin, 1),
-					// 0019
 					code.Make(code.OpGetLocal, 0),
+					// 0016
+					code.Make(code.OpJump, 37),
+					// 0019
+					code.Make(code.OpGetBuiltin, 1),
 					// 0021
+					code.Make(code.OpGetLocal, 0),
+					// 0023
 					code.Make(code.OpCurrentClosure),
-					// 0022
-					code.Make(code.OpGetBuiltin, 2),
 					// 0024
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetBuiltin, 2),
 					// 0026
+					code.Make(code.OpGetLocal, 0),
+					// 0028
 					code.Make(code.OpConstant, 1),
-					// 0029
-					code.Make(code.OpCall, 2),
 					// 0031
-					code.Make(code.OpCall, 1),
-					// 0033
 					code.Make(code.OpCall, 2),
+					// 0033
+					code.Make(code.OpCall, 1),
 					// 0035
+					code.Make(code.OpTailCall, 2),
+					// 0037
 					code.Make(code.OpReturn),
 				},
 				4,
@@ -733,36 +1130,36 @@ func TestRecursiveClosures(t *testing.T) {
 					// 0011
 					code.Make(code.OpCall, 2),
 					// 0013
-					code.Make(code.OpJumpWhenFalse, 21),
-					// 0016
-					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpJumpWhenFalse, 23, 46),
 					// 0018
-					code.Make(code.OpJump, 44),
-					// 0021
+					code.Make(code.OpGetLocal, 2),
+					// 0020
+					code.Make(code.OpJump, 46),
+					// 0023
 					code.Make(code.OpCurrentClosure),
-					// 0022
-					code.Make(code.OpGetBuiltin, 14),
 					// 0024
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetBuiltin, 14),
 					// 0026
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpGetLocal, 0),
 					// 0028
-					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpCall, 1),
 					// 0030
 					code.Make(code.OpGetLocal, 1),
 					// 0032
-					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpGetLocal, 1),
 					// 0034
-					code.Make(code.OpGetBuiltin, 13),
+					code.Make(code.OpGetLocal, 2),
 					// 0036
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetBuiltin, 13),
 					// 0038
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpGetLocal, 0),
 					// 0040
-					code.Make(code.OpCall, 2),
+					code.Make(code.OpCall, 1),
 					// 0042
-					code.Make(code.OpCall, 3),
+					code.Make(code.OpCall, 2),
 					// 0044
+					code.Make(code.OpTailCall, 3),
+					// 0046
 					code.Make(code.OpReturn),
 				},
 				[]code.Instructions{
@@ -771,9 +1168,10 @@ func TestRecursiveClosures(t *testing.T) {
 					code.Make(code.OpGetFree, 0),
 					code.Make(code.OpGetLocal, 1),
 					code.Make(code.OpCall, 1),
-					code.Make(code.OpCall, 2),
+					code.Make(code.OpTailCall, 2),
 					code.Make(code.OpReturn),
 				},
+				[]interface{}{},
 				[]code.Instructions{
 					code.Make(code.OpGetLocal, 1),
 					code.Make(code.OpClosure, 2, 1),
@@ -782,20 +1180,17 @@ func TestRecursiveClosures(t *testing.T) {
 					code.Make(code.OpGetGlobal, 0),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpGetLocal, 2),
-					code.Make(code.OpGetBuiltin, 11),
-					code.Make(code.OpCall, 0),
-					code.Make(code.OpCall, 3),
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpTailCall, 3),
 					code.Make(code.OpReturn),
 				},
-				1,
-				2,
-				3,
+				[]interface{}{1, 2, 3},
 				2,
 				[]code.Instructions{
 					code.Make(code.OpGetBuiltin, 1),
-					code.Make(code.OpConstant, 7),
+					code.Make(code.OpConstant, 6),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpCall, 2),
+					code.Make(code.OpTailCall, 2),
 					code.Make(code.OpReturn),
 				},
 			},
@@ -803,19 +1198,15 @@ func TestRecursiveClosures(t *testing.T) {
 				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpPop),
-				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpClosure, 4, 0),
 				code.Make(code.OpSetGlobal, 1),
 				code.Make(code.OpPop),
-				code.Make(code.OpGetBuiltin, 11),
-				code.Make(code.OpConstant, 4),
 				code.Make(code.OpConstant, 5),
-				code.Make(code.OpConstant, 6),
-				code.Make(code.OpCall, 3),
 				code.Make(code.OpSetGlobal, 2),
 				code.Make(code.OpPop),
 				code.Make(code.OpGetGlobal, 1),
 				code.Make(code.OpGetGlobal, 2),
-				code.Make(code.OpClosure, 8, 0),
+				code.Make(code.OpClosure, 7, 0),
 				code.Make(code.OpCall, 2),
 				code.Make(code.OpPop),
 			},
@@ -847,36 +1238,36 @@ func TestRecursiveClosures(t *testing.T) {
 					// 0011
 					code.Make(code.OpCall, 2),
 					// 0013
-					code.Make(code.OpJumpWhenFalse, 21),
-					// 0016
-					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpJumpWhenFalse, 23, 46),
 					// 0018
-					code.Make(code.OpJump, 44),
-					// 0021
+					code.Make(code.OpGetLocal, 2),
+					// 0020
+					code.Make(code.OpJump, 46),
+					// 0023
 					code.Make(code.OpCurrentClosure),
-					// 0022
-					code.Make(code.OpGetBuiltin, 14),
 					// 0024
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetBuiltin, 14),
 					// 0026
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpGetLocal, 0),
 					// 0028
-					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpCall, 1),
 					// 0030
 					code.Make(code.OpGetLocal, 1),
 					// 0032
-					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpGetLocal, 1),
 					// 0034
-					code.Make(code.OpGetBuiltin, 13),
+					code.Make(code.OpGetLocal, 2),
 					// 0036
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetBuiltin, 13),
 					// 0038
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpGetLocal, 0),
 					// 0040
-					code.Make(code.OpCall, 2),
+					code.Make(code.OpCall, 1),
 					// 0042
-					code.Make(code.OpCall, 3),
+					code.Make(code.OpCall, 2),
 					// 0044
+					code.Make(code.OpTailCall, 3),
+					// 0046
 					code.Make(code.OpReturn),
 				},
 				[]code.Instructions{
@@ -885,28 +1276,26 @@ func TestRecursiveClosures(t *testing.T) {
 					code.Make(code.OpGetFree, 0),
 					code.Make(code.OpGetLocal, 1),
 					code.Make(code.OpCall, 1),
-					code.Make(code.OpCall, 2),
+					code.Make(code.OpTailCall, 2),
 					code.Make(code.OpReturn),
 				},
+				[]interface{}{},
 				[]code.Instructions{
 					code.Make(code.OpGetGlobal, 0),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpGetLocal, 1),
 					code.Make(code.OpClosure, 2, 1),
-					code.Make(code.OpGetBuiltin, 11),
-					code.Make(code.OpCall, 0),
-					code.Make(code.OpCall, 3),
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpTailCall, 3),
 					code.Make(code.OpReturn),
 				},
-				1,
-				2,
-				3,
+				[]interface{}{1, 2, 3},
 				2,
 				[]code.Instructions{
 					code.Make(code.OpGetBuiltin, 1),
-					code.Make(code.OpConstant, 7),
+					code.Make(code.OpConstant, 6),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpCall, 2),
+					code.Make(code.OpTailCall, 2),
 					code.Make(code.OpReturn),
 				},
 			},
@@ -914,19 +1303,15 @@ func TestRecursiveClosures(t *testing.T) {
 				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpPop),
-				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpClosure, 4, 0),
 				code.Make(code.OpSetGlobal, 1),
 				code.Make(code.OpPop),
-				code.Make(code.OpGetBuiltin, 11),
-				code.Make(code.OpConstant, 4),
 				code.Make(code.OpConstant, 5),
-				code.Make(code.OpConstant, 6),
-				code.Make(code.OpCall, 3),
 				code.Make(code.OpSetGlobal, 2),
 				code.Make(code.OpPop),
 				code.Make(code.OpGetGlobal, 1),
 				code.Make(code.OpGetGlobal, 2),
-				code.Make(code.OpClosure, 8, 0),
+				code.Make(code.OpClosure, 7, 0),
 				code.Make(code.OpCall, 2),
 				code.Make(code.OpPop),
 			},
@@ -936,22 +1321,661 @@ func TestRecursiveClosures(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-// Ensure that scopes are entered and exited correctly during compilation.
-func TestCompilerScopes(t *testing.T) {
-	compiler := New()
+// Ensure quoted lists are compiled into a single List constant, with names as
+// symbols, and that quoted lists containing a dict are built at runtime.
+func TestQuotedLists(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "'(1 2 3)",
+			expectedConstants: []interface{}{[]interface{}{1, 2, 3}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "'()",
+			expectedConstants: []interface{}{[]interface{}{}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `'(1 "two" '(3 ()))`,
+			expectedConstants: []interface{}{
+				[]interface{}{1, "two", []interface{}{3, []interface{}{}}},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(list 1 2)",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 11),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "(def a 1) '(a 2)",
+			expectedConstants: []interface{}{
+				1,
+				[]interface{}{&object.Symbol{Name: "a"}, 2},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "'(1 ((+ 1 2)))",
+			expectedConstants: []interface{}{
+				[]interface{}{1, []interface{}{[]interface{}{&object.Symbol{Name: "+"}, 1, 2}}},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "'a",
+			expectedConstants: []interface{}{&object.Symbol{Name: "a"}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "'(a {b 1})",
+			expectedConstants: []interface{}{&object.Symbol{Name: "a"}, &object.Symbol{Name: "b"}, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 11),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpGetBuiltin, 12),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
 
-	if compiler.scopeIndex != 0 {
-		t.Errorf("scopeIndex wrong: got=%d want=%d", compiler.scopeIndex, 0)
+	runCompilerTests(t, tests)
+}
+
+// Ensure special form names can't be used as values or variables.
+func TestSpecialFormNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(def if 5)", "'if' is a special form and cannot be used as a variable"},
+		{"(lambda (a def) a)", "'def' is a special form and cannot be used as a variable"},
+		{"(lambda (lambda) 1)", "'lambda' is a special form and cannot be used as a variable"},
+		{"if", "'if' is a special form and cannot be used as a value"},
+		{"(list 1 lambda)", "'lambda' is a special form and cannot be used as a value"},
+		{"(def f (lambda () def))", "'def' is a special form and cannot be used as a value"},
+		{"(let ((let 1)) 1)", "'let' is a special form and cannot be used as a variable"},
 	}
 
-	compiler.emit(code.OpTrue)
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
 
-	globalScope := compiler.symbolTable
+		err := compiler.Compile(program)
 
-	compiler.enterScope()
+		if err == nil {
+			t.Fatalf("expected compiler error for %q but none occurred", tt.input)
+		}
 
-	if compiler.scopeIndex != 1 {
-		t.Errorf("scopeIndex wrong: got=%d want=%d", compiler.scopeIndex, 1)
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error: want=%q got=%q", tt.expected, err)
+		}
+	}
+}
+
+// Ensure unused parameters and local variables produce warnings without
+// stopping compilation.
+func TestUnusedLocalWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			input: `
+            (def f (lambda (a b)
+                (def used 1)
+                (def unused 2)
+                (+ a used)))
+            `,
+			expected: []string{
+				"unused parameter 'b' in lambda 'f'",
+				"unused local variable 'unused' in lambda 'f'",
+			},
+		},
+		{
+			input:    "(lambda (_ _ignored) 1)",
+			expected: []string{},
+		},
+		{
+			input:    "(lambda (a) (lambda () a))",
+			expected: []string{},
+		},
+		{
+			input: "(lambda (a) (lambda (b) 1))",
+			expected: []string{
+				"unused parameter 'b' in anonymous lambda",
+				"unused parameter 'a' in anonymous lambda",
+			},
+		},
+		{
+			input:    "(def a 1)",
+			expected: []string{},
+		},
+		{
+			input: "(def f (lambda (a) (let ((x 1) (y a)) y)))",
+			expected: []string{
+				"unused local variable 'x' in lambda 'f'",
+			},
+		},
+		{
+			input: "(let ((x 1)) 2)",
+			expected: []string{
+				"unused local variable 'x' in let expression",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+
+		err := compiler.Compile(program)
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		if len(compiler.Warnings) != len(tt.expected) {
+			t.Fatalf("wrong number of warnings: want=%q got=%q",
+				tt.expected, compiler.Warnings)
+		}
+
+		for i, warning := range tt.expected {
+			if compiler.Warnings[i] != warning {
+				t.Errorf("wrong warning: want=%q got=%q",
+					warning, compiler.Warnings[i])
+			}
+		}
+	}
+}
+
+// Ensure malformed let expressions are reported by the compiler.
+func TestLetErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(let)", "not enough arguments for let expression"},
+		{"(let x 1)", "expected a list of bindings, got x"},
+		{"(let (x 1) x)", "expected a binding of the form (name value), got x"},
+		{"(let ((x 1 2)) x)", "expected a binding of the form (name value), got (x 1 2)"},
+		{"(let ((1 2)) 1)", "binding names must be identifiers, got (1 2)"},
+		{"(let ((x 1)) x) x", "undefined variable x"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+
+		err := compiler.Compile(program)
+
+		if err == nil {
+			t.Fatalf("expected compiler error for %q but none occurred", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error: want=%q got=%q", tt.expected, err)
+		}
+	}
+}
+
+// Ensure calling a literal value is rejected during compilation.
+func TestCallingLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(5 1 2)", "cannot call NUMBER literal 5"},
+		{`("hello" 1)`, `cannot call STRING literal "hello"`},
+		{"(true)", "cannot call BOOL literal true"},
+		{"(null 1)", "cannot call NULL literal null"},
+		{"('(1 2) 1)", "cannot call LIST literal (list 1 2)"},
+		{"(() 1)", "cannot call LIST literal ()"},
+		{"(lambda () (1.5))", "cannot call NUMBER literal 1.5"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+
+		err := compiler.Compile(program)
+
+		if err == nil {
+			t.Fatalf("expected compiler error for %q but none occurred", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error: want=%q got=%q", tt.expected, err)
+		}
+	}
+}
+
+// Ensure each free variable is captured once per closure, regardless of how
+// many times or by how many inner closures it is referenced.
+func TestFreeVariableCaptures(t *testing.T) {
+	tests := []struct {
+		input string
+		// For each CompiledLambda constant in order, the number of
+		// OpGetFree instructions it contains.
+		expectedGetFree []int
+		// For each OpClosure instruction in the program, in the order the
+		// lambdas are compiled, the number of free variables captured.
+		expectedCaptures []int
+	}{
+		{
+			// x is only used at the innermost level, but the middle closure
+			// has to capture it to make it available when the innermost
+			// closure is created.
+			input: `
+            (lambda (x)
+              (lambda ()
+                (lambda () x)))
+            `,
+			expectedGetFree:  []int{1, 1, 0},
+			expectedCaptures: []int{1, 1, 0},
+		},
+		{
+			input: `
+            (lambda (x)
+              (lambda ()
+                (lambda () (+ x x x))))
+            `,
+			expectedGetFree:  []int{3, 1, 0},
+			expectedCaptures: []int{1, 1, 0},
+		},
+		{
+			// Sibling closures each capture x once, and the middle closure
+			// still only captures it once.
+			input: `
+            (lambda (x)
+              (lambda ()
+                (lambda () x)
+                (lambda () (+ x x))))
+            `,
+			expectedGetFree:  []int{1, 2, 2, 0},
+			expectedCaptures: []int{1, 1, 1, 0},
+		},
+		{
+			input: `
+            (lambda (x y)
+              (lambda ()
+                (lambda () (+ y x y x))))
+            `,
+			expectedGetFree:  []int{4, 2, 0},
+			expectedCaptures: []int{2, 2, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+
+		err := compiler.Compile(program)
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		getFree := []int{}
+		captures := []int{}
+
+		for _, constant := range bytecode.Constants {
+			lambda, ok := constant.(*object.CompiledLambda)
+
+			if !ok {
+				continue
+			}
+
+			getFree = append(getFree, len(operandsOf(code.OpGetFree, lambda.Instructions)))
+
+			for _, operands := range operandsOf(code.OpClosure, lambda.Instructions) {
+				captures = append(captures, operands[1])
+			}
+		}
+
+		for _, operands := range operandsOf(code.OpClosure, bytecode.Instructions) {
+			captures = append(captures, operands[1])
+		}
+
+		if !slices.Equal(getFree, tt.expectedGetFree) {
+			t.Errorf("wrong OpGetFree counts: want=%v got=%v",
+				tt.expectedGetFree, getFree)
+		}
+
+		if !slices.Equal(captures, tt.expectedCaptures) {
+			t.Errorf("wrong OpClosure captures: want=%v got=%v",
+				tt.expectedCaptures, captures)
+		}
+	}
+}
+
+// Return the operands of every instance of the provided Opcode in the
+// instructions.
+func operandsOf(op code.Opcode, ins code.Instructions) [][]int {
+	found := [][]int{}
+
+	for i := 0; i < len(ins); {
+		def, _ := code.Lookup(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		if code.Opcode(ins[i]) == op {
+			found = append(found, operands)
+		}
+
+		i += 1 + read
+	}
+
+	return found
+}
+
+// Ensure a Compiler, and the state shared between Compilers, can be reused
+// after a compilation error without any trace of the failed compilation.
+func TestCompileAfterError(t *testing.T) {
+	failing := []string{
+		"(def a (lambda () (def b 1) undefinedVar))",
+		"(def a 5) (def b (lambda (x) (lambda () (+ x unknown))))",
+		"(def a '(1 2)) (if)",
+	}
+
+	valid := "(def c 1) (def f (lambda (n) (+ n c))) (f 2)"
+
+	fresh := New()
+
+	err := fresh.Compile(parse(valid))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := fresh.Bytecode()
+
+	for _, input := range failing {
+		// Reuse the same Compiler.
+		compiler := New()
+
+		err := compiler.Compile(parse(input))
+
+		if err == nil {
+			t.Fatalf("expected compiler error for %q but none occurred", input)
+		}
+
+		if _, ok := compiler.symbolTable.Resolve("a"); ok {
+			t.Errorf("symbol from failed compilation still defined: %q", input)
+		}
+
+		err = compiler.Compile(parse(valid))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		testSameBytecode(t, expected, compiler.Bytecode())
+
+		// Share state between Compilers, as the REPL does.
+		symbolTable := NewSymbolTable()
+
+		for i, v := range object.Builtins {
+			symbolTable.DefineBuiltin(i, v.Name)
+		}
+
+		constants := []object.Object{}
+
+		err = NewWithState(constants, symbolTable).Compile(parse(input))
+
+		if err == nil {
+			t.Fatalf("expected compiler error for %q but none occurred", input)
+		}
+
+		compiler = NewWithState(constants, symbolTable)
+
+		err = compiler.Compile(parse(valid))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		testSameBytecode(t, expected, compiler.Bytecode())
+	}
+}
+
+// Ensure two Bytecode instances have the same instructions and constants.
+func testSameBytecode(t *testing.T, expected *Bytecode, actual *Bytecode) {
+	t.Helper()
+
+	if !slices.Equal(expected.Instructions, actual.Instructions) {
+		t.Errorf("wrong instructions:\n  want=%s\n  got=%s",
+			expected.Instructions, actual.Instructions)
+	}
+
+	if len(expected.Constants) != len(actual.Constants) {
+		t.Fatalf("wrong number of constants: want=%d got=%d",
+			len(expected.Constants), len(actual.Constants))
+	}
+
+	for i, constant := range expected.Constants {
+		switch constant := constant.(type) {
+		case *object.CompiledLambda:
+			lambda, ok := actual.Constants[i].(*object.CompiledLambda)
+
+			if !ok || !slices.Equal(constant.Instructions, lambda.Instructions) {
+				t.Errorf("constant %d - wrong lambda: want=%s got=%s",
+					i, constant.Inspect(), actual.Constants[i].Inspect())
+			}
+		default:
+			if constant.Inspect() != actual.Constants[i].Inspect() {
+				t.Errorf("constant %d - wrong value: want=%s got=%s",
+					i, constant.Inspect(), actual.Constants[i].Inspect())
+			}
+		}
+	}
+}
+
+// Ensure a single Compiler can compile a series of programs, as the REPL
+// does, with symbols and constants preserved between them.
+func TestResetBetweenPrograms(t *testing.T) {
+	compiler := New()
+
+	lines := []compilerTestCase{
+		{
+			input:             "(def a 1)",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `(def b "two")`,
+			expectedConstants: []interface{}{1, "two"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(+ a 3)",
+			expectedConstants: []interface{}{1, "two", 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range lines {
+		compiler.Reset()
+
+		err := compiler.Compile(parse(tt.input))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+
+		if err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+
+		if err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+	}
+}
+
+// Ensure calls to Compile without a Reset append to the same program.
+func TestCompileAppends(t *testing.T) {
+	compiler := New()
+
+	for _, input := range []string{"(def a 1)", "a"} {
+		err := compiler.Compile(parse(input))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+	}
+
+	expected := []code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpPop),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpPop),
+	}
+
+	err := testInstructions(expected, compiler.Bytecode().Instructions)
+
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+}
+
+// Ensure a cloned Bytecode doesn't share memory with the original.
+func TestBytecodeClone(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse("(def a '(1 2)) (a 1)"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	original := compiler.Bytecode()
+	clone := original.Clone()
+
+	testSameBytecode(t, original, clone)
+
+	clone.Instructions[0] = byte(code.OpNull)
+	clone.Constants[0] = &object.Number{Value: 5}
+	clone.GlobalNames[0] = "b"
+	clone.CallSites[len(original.Instructions)-3] = object.CallSite{}
+
+	if original.Instructions[0] != byte(code.OpConstant) {
+		t.Errorf("original instructions modified: %s", original.Instructions)
+	}
+
+	if original.Constants[0].Inspect() != "(1 2)" {
+		t.Errorf("original constants modified: %s", original.Constants[0].Inspect())
+	}
+
+	if original.GlobalNames[0] != "a" {
+		t.Errorf("original global names modified: %v", original.GlobalNames)
+	}
+
+	if original.CallSites[len(original.Instructions)-3].Name != "a" {
+		t.Errorf("original call sites modified: %v", original.CallSites)
+	}
+}
+
+// Ensure that scopes are entered and exited correctly during compilation.
+func TestCompilerClone(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse("(def a 1)"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := compiler.Bytecode().Clone()
+
+	clone := compiler.Clone()
+	err = clone.Compile(parse("(def b (lambda () (+ a 2))) (b)"))
+
+	if err != nil {
+		t.Fatalf("compiler error compiling with clone: %s", err)
+	}
+
+	if _, ok := clone.symbolTable.Resolve("b"); !ok {
+		t.Errorf("clone didn't define b")
+	}
+
+	if _, ok := compiler.symbolTable.Resolve("b"); ok {
+		t.Errorf("symbol defined by clone defined in original")
+	}
+
+	testSameBytecode(t, expected, compiler.Bytecode())
+
+	if len(clone.Bytecode().Constants) <= len(expected.Constants) {
+		t.Errorf("clone didn't add constants")
+	}
+}
+
+func TestCompilerScopes(t *testing.T) {
+	compiler := New()
+
+	if compiler.scopeIndex != 0 {
+		t.Errorf("scopeIndex wrong: got=%d want=%d", compiler.scopeIndex, 0)
+	}
+
+	compiler.emit(code.OpTrue)
+
+	globalScope := compiler.symbolTable
+
+	compiler.enterScope()
+
+	if compiler.scopeIndex != 1 {
+		t.Errorf("scopeIndex wrong: got=%d want=%d", compiler.scopeIndex, 1)
 	}
 
 	compiler.emit(code.OpFalse)
@@ -1116,6 +2140,10 @@ func testConstants(
 			if err != nil {
 				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
 			}
+		case *object.Symbol:
+			if !object.Equals(constant, actual[i]) {
+				return fmt.Errorf("constant %d - not symbol %s: %T(%+v)", i, constant.Name, actual[i], actual[i])
+			}
 			// Test that the constant CompiledLambda matches the expected instructions.
 		case []code.Instructions:
 			lambda, ok := actual[i].(*object.CompiledLambda)
@@ -1129,6 +2157,19 @@ func testConstants(
 			if err != nil {
 				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
 			}
+			// Test that the constant List contains the expected values.
+		case []interface{}:
+			list, ok := actual[i].(*object.List)
+
+			if !ok {
+				return fmt.Errorf("constant %d - not a list: %T", i, actual[i])
+			}
+
+			err := testConstants(constant, list.Values)
+
+			if err != nil {
+				return fmt.Errorf("constant %d - testConstants failed: %s", i, err)
+			}
 		}
 	}
 
@@ -1176,3 +2217,127 @@ func testStringObject(expected string, actual object.Object) error {
 
 	return nil
 }
+
+// Build an Identifier node with the provided name.
+func ident(name string) *ast.Identifier {
+	return &ast.Identifier{
+		Token: token.Token{Type: token.IDENT, Literal: name},
+	}
+}
+
+// Build a lambda SExpression with the provided parameters and body.
+func lambdaExpression(params []string, body ...ast.Expression) *ast.SExpression {
+	paramList := &ast.SExpression{}
+
+	for i, param := range params {
+		if i == 0 {
+			paramList.Fn = ident(param)
+		} else {
+			paramList.Args = append(paramList.Args, ident(param))
+		}
+	}
+
+	return &ast.SExpression{
+		Fn:   ident("lambda"),
+		Args: append([]ast.Expression{paramList}, body...),
+	}
+}
+
+// Build a (def name value) SExpression.
+func defExpression(name string, value ast.Expression) *ast.SExpression {
+	return &ast.SExpression{
+		Fn:   ident("def"),
+		Args: []ast.Expression{ident(name), value},
+	}
+}
+
+// Build a call to list with each of the provided names as arguments.
+func listOf(names []string) *ast.SExpression {
+	list := &ast.SExpression{Fn: ident("list")}
+
+	for _, name := range names {
+		list.Args = append(list.Args, ident(name))
+	}
+
+	return list
+}
+
+// Generate n variable names with the provided prefix.
+func names(prefix string, n int) []string {
+	result := make([]string, n)
+
+	for i := range result {
+		result[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+
+	return result
+}
+
+func TestVariableLimits(t *testing.T) {
+	// A lambda with n parameters that are all used.
+	withParams := func(n int) ast.Expression {
+		params := names("p", n)
+
+		return defExpression("f", lambdaExpression(params, listOf(params)))
+	}
+
+	// A lambda that defines n local variables and uses them all.
+	withDefs := func(n int) ast.Expression {
+		locals := names("l", n)
+		body := []ast.Expression{}
+
+		for _, name := range locals {
+			body = append(body, defExpression(name, &ast.FloatLiteral{Value: 1}))
+		}
+
+		body = append(body, listOf(locals))
+
+		return defExpression("f", lambdaExpression(nil, body...))
+	}
+
+	// An anonymous inner lambda that uses n parameters of the outer lambda
+	// as free variables.
+	withFree := func(n int) ast.Expression {
+		params := names("p", n)
+
+		inner := lambdaExpression(nil, listOf(params))
+
+		return defExpression("outer", lambdaExpression(params, inner))
+	}
+
+	tests := []struct {
+		name     string
+		program  ast.Expression
+		expected string
+	}{
+		{"255 parameters", withParams(255), ""},
+		{"256 parameters", withParams(256), "too many local variables in function 'f' (got 256, max 255)"},
+		{"255 locals", withDefs(255), ""},
+		{"300 locals", withDefs(300), "too many local variables in function 'f' (got 300, max 255)"},
+		{"255 free variables", withFree(255), ""},
+		{"300 free variables", withFree(300), "too many free variables in anonymous function (got 300, max 255)"},
+	}
+
+	for _, tt := range tests {
+		program := &ast.Program{Expressions: []ast.Expression{tt.program}}
+
+		err := New().Compile(program)
+
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected compiler error: %s", tt.name, err)
+			}
+
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("%s: expected compiler error but none occurred", tt.name)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package compiler
+
+import (
+	"fmt"
+	"lisp/code"
+	"lisp/object"
+	"strconv"
+	"strings"
+)
+
+// Convert the Bytecode into a human readable listing of its instructions.
+//
+// The main instructions are listed first, followed by the instructions of each
+// compiled lambda they create, labelled with its constant index. Lambdas
+// created by other lambdas are listed after them. Operands that refer to
+// constants, builtins, global variables and called functions are annotated
+// with what they refer to.
+func Disassemble(bytecode *Bytecode) string {
+	d := &disassembler{
+		bytecode: bytecode,
+		listed:   map[int]bool{},
+	}
+
+	d.out.WriteString("main:\n")
+	d.instructions(bytecode.Instructions, bytecode.CallSites)
+
+	// Each listing can add more lambdas to the queue.
+	for i := 0; i < len(d.queue); i++ {
+		index := d.queue[i]
+		lambda := bytecode.Constants[index].(*object.CompiledLambda)
+		parameters := plural(lambda.ParameterCount, "parameter")
+
+		if lambda.Variadic {
+			parameters += " and a rest parameter"
+		}
+
+		fmt.Fprintf(
+			&d.out,
+			"\n%s (constant %d, %s, %s):\n",
+			lambdaName(lambda),
+			index,
+			parameters,
+			plural(lambda.LocalsCount, "local"),
+		)
+
+		d.instructions(lambda.Instructions, lambda.CallSites)
+	}
+
+	return d.out.String()
+}
+
+// The state of a call to Disassemble.
+type disassembler struct {
+	bytecode *Bytecode
+	out      strings.Builder
+	queue    []int        // the constant index of each lambda to list
+	listed   map[int]bool // the lambdas already added to the queue
+}
+
+// List the provided instructions, adding any lambdas they create to the queue.
+func (d *disassembler) instructions(ins code.Instructions, callSites map[int]object.CallSite) {
+	for pos := 0; pos < len(ins); {
+		def, err := code.Lookup(ins[pos])
+
+		if err != nil {
+			fmt.Fprintf(&d.out, "%04d ERROR: %s\n", pos, err)
+			return
+		}
+
+		operands, read := code.ReadOperands(def, ins[pos+1:])
+		text := ins.FormatAt(pos)
+
+		if note := d.annotate(code.Opcode(ins[pos]), operands, callSites[pos]); note != "" {
+			fmt.Fprintf(&d.out, "%04d %-24s ; %s\n", pos, text, note)
+		} else {
+			fmt.Fprintf(&d.out, "%04d %s\n", pos, text)
+		}
+
+		pos += 1 + read
+	}
+}
+
+// Describe what the operands of an instruction refer to, or return an empty
+// string if there's nothing to add.
+func (d *disassembler) annotate(op code.Opcode, operands []int, site object.CallSite) string {
+	switch op {
+	case code.OpConstant:
+		return d.constant(operands[0])
+	case code.OpClosure:
+		d.enqueue(operands[0])
+
+		if operands[1] > 0 {
+			return fmt.Sprintf("%s, %s", d.constant(operands[0]), plural(operands[1], "free variable"))
+		}
+
+		return d.constant(operands[0])
+	case code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return object.Builtins[operands[0]].Name
+		}
+	case code.OpGetGlobal, code.OpSetGlobal:
+		if operands[0] < len(d.bytecode.GlobalNames) {
+			return d.bytecode.GlobalNames[operands[0]]
+		}
+	case code.OpCall, code.OpTailCall:
+		switch {
+		case site.Name != "" && site.Line > 0:
+			return fmt.Sprintf("call %s, line %d", site.Name, site.Line)
+		case site.Name != "":
+			return "call " + site.Name
+		case site.Line > 0:
+			return fmt.Sprintf("line %d", site.Line)
+		}
+	}
+
+	return ""
+}
+
+// Describe the constant at the provided index.
+func (d *disassembler) constant(index int) string {
+	if index >= len(d.bytecode.Constants) {
+		return fmt.Sprintf("missing constant %d", index)
+	}
+
+	switch constant := d.bytecode.Constants[index].(type) {
+	case *object.String:
+		return strconv.Quote(constant.Value)
+	case *object.Symbol:
+		return "'" + constant.Name
+	case *object.CompiledLambda:
+		return lambdaName(constant)
+	default:
+		return constant.Inspect()
+	}
+}
+
+// Add the lambda at the provided constant index to the queue to be listed, if
+// it hasn't been already.
+func (d *disassembler) enqueue(index int) {
+	if d.listed[index] || index >= len(d.bytecode.Constants) {
+		return
+	}
+
+	if _, ok := d.bytecode.Constants[index].(*object.CompiledLambda); !ok {
+		return
+	}
+
+	d.listed[index] = true
+	d.queue = append(d.queue, index)
+}
+
+func lambdaName(lambda *object.CompiledLambda) string {
+	if lambda.Name == "" {
+		return "lambda"
+	}
+
+	return "lambda " + lambda.Name
+}
+
+// Format a count of things, such as "1 local" or "2 locals".
+func plural(count int, thing string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, thing)
+	}
+
+	return fmt.Sprintf("%d %ss", count, thing)
+}
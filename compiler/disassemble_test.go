@@ -0,0 +1,53 @@
+package compiler
+
+import "testing"
+
+func TestDisassemble(t *testing.T) {
+	input := `(def greeting "hi")
+(def make-adder (lambda (x)
+  (lambda (y) (+ x y))))
+((make-adder 1) (len greeting))`
+
+	expected := `main:
+0000 OpConstant 0             ; "hi"
+0003 OpSetGlobal 0            ; greeting
+0006 OpPop
+0007 OpClosure 2 0            ; lambda make-adder
+0011 OpSetGlobal 1            ; make-adder
+0014 OpPop
+0015 OpGetGlobal 1            ; make-adder
+0018 OpConstant 3             ; 1
+0021 OpCall 1                 ; call make-adder, line 4
+0023 OpGetBuiltin 16          ; len
+0025 OpGetGlobal 0            ; greeting
+0028 OpCall 1                 ; call len, line 4
+0030 OpCall 1                 ; line 4
+0032 OpPop
+
+lambda make-adder (constant 2, 1 parameter, 1 local):
+0000 OpGetLocal 0
+0002 OpClosure 1 1            ; lambda, 1 free variable
+0006 OpReturn
+
+lambda (constant 1, 1 parameter, 1 local):
+0000 OpGetBuiltin 0           ; +
+0002 OpGetFree 0
+0004 OpGetLocal 0
+0006 OpTailCall 2             ; call +, line 3
+0008 OpReturn
+`
+
+	compiler := New()
+
+	err := compiler.Compile(parse(input))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	output := Disassemble(compiler.Bytecode())
+
+	if output != expected {
+		t.Errorf("wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, output)
+	}
+}
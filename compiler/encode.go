@@ -0,0 +1,400 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"lisp/code"
+	"lisp/object"
+	"math"
+	"slices"
+)
+
+// The bytes every encoded Bytecode starts with, used to recognise it.
+var BYTECODE_MAGIC = []byte("LBC\x00")
+
+// The version of the encoding written by MarshalBinary. Only Bytecode encoded
+// with the same version can be decoded, since the instructions understood by
+// the VM may have changed between versions.
+const BYTECODE_VERSION = 4
+
+// ErrTruncated is returned when decoding Bytecode that ends part way through.
+var ErrTruncated = errors.New("bytecode is truncated")
+
+// Tags identifying the type of each encoded constant.
+const (
+	tagNumber byte = iota + 1
+	tagString
+	tagList
+	tagTrue
+	tagFalse
+	tagNull
+	tagLambda
+	tagSymbol
+	tagKeyword
+)
+
+// Report whether the data starts with BYTECODE_MAGIC, meaning it's encoded
+// Bytecode rather than source code.
+func IsEncodedBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, BYTECODE_MAGIC)
+}
+
+// Encode the Bytecode so that it can be saved and run later without compiling
+// the program again. The encoding starts with BYTECODE_MAGIC and
+// BYTECODE_VERSION.
+//
+// Only the constants the compiler produces can be encoded: numbers, strings,
+// booleans, null, Lists of those and CompiledLambdas.
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	var out bytes.Buffer
+
+	out.Write(BYTECODE_MAGIC)
+	writeUint(&out, BYTECODE_VERSION)
+
+	writeBytes(&out, b.Instructions)
+	writeCallSites(&out, b.CallSites)
+
+	writeUint(&out, len(b.GlobalNames))
+
+	for _, name := range b.GlobalNames {
+		writeBytes(&out, []byte(name))
+	}
+
+	writeUint(&out, len(b.Constants))
+
+	for _, constant := range b.Constants {
+		err := writeConstant(&out, constant)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// Decode Bytecode encoded by MarshalBinary, replacing the contents of b.
+// Returns an error if the data isn't encoded Bytecode, was encoded with a
+// different version, is truncated, or has instructions the VM can't run
+// safely, such as jumps outside of them or references to missing constants.
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	if !IsEncodedBytecode(data) {
+		return errors.New("data isn't encoded bytecode")
+	}
+
+	d := &decoder{data: data[len(BYTECODE_MAGIC):]}
+
+	if version := d.readUint(); d.err == nil && version != BYTECODE_VERSION {
+		return fmt.Errorf(
+			"bytecode version %d isn't supported, expected version %d",
+			version,
+			BYTECODE_VERSION,
+		)
+	}
+
+	instructions := d.readInstructions()
+	callSites := d.readCallSites()
+
+	globalNames := d.readStrings()
+
+	constants := make([]object.Object, d.readCount())
+
+	for i := range constants {
+		constants[i] = d.readConstant(0)
+	}
+
+	if d.err == nil && len(d.data) > 0 {
+		d.err = fmt.Errorf("%d unexpected bytes after the bytecode", len(d.data))
+	}
+
+	if d.err != nil {
+		return d.err
+	}
+
+	decoded := Bytecode{
+		Instructions: instructions,
+		Constants:    constants,
+		GlobalNames:  globalNames,
+		CallSites:    callSites,
+	}
+
+	err := verifyBytecode(&decoded)
+
+	if err != nil {
+		return err
+	}
+
+	*b = decoded
+
+	return nil
+}
+
+func writeUint(out *bytes.Buffer, n int) {
+	out.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+}
+
+// Write a boolean as a single byte.
+func writeBool(out *bytes.Buffer, b bool) {
+	if b {
+		out.WriteByte(1)
+	} else {
+		out.WriteByte(0)
+	}
+}
+
+// Write the length of the bytes followed by the bytes themselves.
+func writeBytes(out *bytes.Buffer, b []byte) {
+	writeUint(out, len(b))
+	out.Write(b)
+}
+
+// Write the call sites in order of their position, so that encoding the same
+// Bytecode always produces the same bytes.
+func writeCallSites(out *bytes.Buffer, callSites map[int]object.CallSite) {
+	positions := make([]int, 0, len(callSites))
+
+	for pos := range callSites {
+		positions = append(positions, pos)
+	}
+
+	slices.Sort(positions)
+
+	writeUint(out, len(positions))
+
+	for _, pos := range positions {
+		writeUint(out, pos)
+		writeBytes(out, []byte(callSites[pos].Name))
+		writeUint(out, callSites[pos].Line)
+	}
+}
+
+func writeConstant(out *bytes.Buffer, obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Number:
+		out.WriteByte(tagNumber)
+		out.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(obj.Value)))
+	case *object.String:
+		out.WriteByte(tagString)
+		writeBytes(out, []byte(obj.Value))
+	case *object.Symbol:
+		out.WriteByte(tagSymbol)
+		writeBytes(out, []byte(obj.Name))
+	case *object.Keyword:
+		out.WriteByte(tagKeyword)
+		writeBytes(out, []byte(obj.Name))
+	case *object.List:
+		out.WriteByte(tagList)
+		writeUint(out, len(obj.Values))
+
+		for _, value := range obj.Values {
+			err := writeConstant(out, value)
+
+			if err != nil {
+				return err
+			}
+		}
+	case *object.BooleanObject:
+		if obj.Value {
+			out.WriteByte(tagTrue)
+		} else {
+			out.WriteByte(tagFalse)
+		}
+	case *object.Null:
+		out.WriteByte(tagNull)
+	case *object.CompiledLambda:
+		out.WriteByte(tagLambda)
+		writeBytes(out, []byte(obj.Name))
+		writeUint(out, obj.LocalsCount)
+		writeUint(out, obj.ParameterCount)
+		writeBool(out, obj.Variadic)
+		writeUint(out, len(obj.Parameters))
+
+		for _, param := range obj.Parameters {
+			writeBytes(out, []byte(param))
+		}
+
+		writeBytes(out, obj.Instructions)
+		writeCallSites(out, obj.CallSites)
+	default:
+		return fmt.Errorf("constants of type %s can't be encoded", obj.Type())
+	}
+
+	return nil
+}
+
+// The maximum depth of nested Lists that can be decoded, which stops corrupt
+// data from exhausting the stack.
+const maxDecodeDepth = 1000
+
+// Reads the parts of encoded Bytecode in order. Once an error occurs it's
+// kept, and every later read returns a zero value.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+// Remove and return the next n bytes, or nil if there aren't enough left.
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if n > len(d.data) {
+		d.err = ErrTruncated
+		return nil
+	}
+
+	b := d.data[:n]
+	d.data = d.data[n:]
+
+	return b
+}
+
+func (d *decoder) readUint() int {
+	b := d.next(4)
+
+	if b == nil {
+		return 0
+	}
+
+	return int(binary.BigEndian.Uint32(b))
+}
+
+// Read a boolean written by writeBool.
+func (d *decoder) readBool() bool {
+	b := d.next(1)
+
+	return b != nil && b[0] != 0
+}
+
+// Read the number of items that follow, each of which takes at least one
+// byte. Counts larger than the data left can only come from truncated data.
+func (d *decoder) readCount() int {
+	n := d.readUint()
+
+	if n > len(d.data) {
+		d.err = ErrTruncated
+		return 0
+	}
+
+	return n
+}
+
+// Read a count followed by that many strings.
+func (d *decoder) readStrings() []string {
+	values := make([]string, d.readCount())
+
+	for i := range values {
+		values[i] = string(d.readBytes())
+	}
+
+	return values
+}
+
+func (d *decoder) readBytes() []byte {
+	return slices.Clone(d.next(d.readUint()))
+}
+
+// Read instructions, checking that each opcode is known and has all of its
+// operands so that the VM never reads past the end of them.
+func (d *decoder) readInstructions() code.Instructions {
+	ins := code.Instructions(d.readBytes())
+
+	for pos := 0; d.err == nil && pos < len(ins); {
+		def, err := code.Lookup(ins[pos])
+
+		if err != nil {
+			d.err = fmt.Errorf("invalid instruction at %04d: %w", pos, err)
+			return nil
+		}
+
+		width := 1
+
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+
+		if pos+width > len(ins) {
+			d.err = ErrTruncated
+			return nil
+		}
+
+		pos += width
+	}
+
+	return ins
+}
+
+func (d *decoder) readCallSites() map[int]object.CallSite {
+	count := d.readCount()
+	callSites := make(map[int]object.CallSite, count)
+
+	for range count {
+		pos := d.readUint()
+		name := string(d.readBytes())
+		line := d.readUint()
+
+		callSites[pos] = object.CallSite{Name: name, Line: line}
+	}
+
+	return callSites
+}
+
+func (d *decoder) readConstant(depth int) object.Object {
+	tag := d.next(1)
+
+	if tag == nil {
+		return nil
+	}
+
+	switch tag[0] {
+	case tagNumber:
+		b := d.next(8)
+
+		if b == nil {
+			return nil
+		}
+
+		return object.NewNumber(math.Float64frombits(binary.BigEndian.Uint64(b)))
+	case tagString:
+		return object.NewString(string(d.readBytes()))
+	case tagSymbol:
+		return &object.Symbol{Name: string(d.readBytes())}
+	case tagKeyword:
+		return &object.Keyword{Name: string(d.readBytes())}
+	case tagList:
+		if depth >= maxDecodeDepth {
+			d.err = errors.New("lists are nested too deeply")
+			return nil
+		}
+
+		values := make([]object.Object, d.readCount())
+
+		for i := range values {
+			values[i] = d.readConstant(depth + 1)
+		}
+
+		return object.NewConstantList(values)
+	case tagTrue:
+		return object.TRUE
+	case tagFalse:
+		return object.FALSE
+	case tagNull:
+		return object.NULL
+	case tagLambda:
+		return &object.CompiledLambda{
+			Name:           string(d.readBytes()),
+			LocalsCount:    d.readUint(),
+			ParameterCount: d.readUint(),
+			Variadic:       d.readBool(),
+			Parameters:     d.readStrings(),
+			Instructions:   d.readInstructions(),
+			CallSites:      d.readCallSites(),
+		}
+	default:
+		d.err = fmt.Errorf("unknown constant type %d", tag[0])
+		return nil
+	}
+}
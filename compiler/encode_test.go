@@ -0,0 +1,216 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"errors"
+	"lisp/code"
+	"lisp/object"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBytecodeEncoding(t *testing.T) {
+	input := `(def greeting "hi")
+(def items '(1 "two" true false null () a :b))
+(def make-adder (lambda (x)
+  (lambda (y) (+ x y))))
+(def collect (lambda (first & rest) rest))
+((make-adder 1.5) (len greeting))`
+
+	compiler := New()
+
+	err := compiler.Compile(parse(input))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	data, err := bytecode.MarshalBinary()
+
+	if err != nil {
+		t.Fatalf("failed to encode bytecode: %s", err)
+	}
+
+	if !IsEncodedBytecode(data) {
+		t.Fatalf("encoded bytecode isn't recognised")
+	}
+
+	if IsEncodedBytecode([]byte(input)) {
+		t.Errorf("source code recognised as bytecode")
+	}
+
+	decoded := &Bytecode{}
+	err = decoded.UnmarshalBinary(data)
+
+	if err != nil {
+		t.Fatalf("failed to decode bytecode: %s", err)
+	}
+
+	if Disassemble(decoded) != Disassemble(bytecode) {
+		t.Errorf("wrong decoded bytecode.\nwant=\n%s\ngot=\n%s", Disassemble(bytecode), Disassemble(decoded))
+	}
+
+	if strings.Join(decoded.GlobalNames, " ") != strings.Join(bytecode.GlobalNames, " ") {
+		t.Errorf("wrong global names. want=%q, got=%q", bytecode.GlobalNames, decoded.GlobalNames)
+	}
+
+	// Lambdas are compared by the disassembly, which includes their details.
+	for i, constant := range bytecode.Constants {
+		if _, ok := constant.(*object.CompiledLambda); ok {
+			continue
+		}
+
+		if decoded.Constants[i].Inspect() != constant.Inspect() {
+			t.Errorf("wrong constant %d. want=%s, got=%s", i, constant.Inspect(), decoded.Constants[i].Inspect())
+		}
+	}
+
+	again, err := decoded.MarshalBinary()
+
+	if err != nil || string(again) != string(data) {
+		t.Errorf("decoded bytecode encodes differently, err=%v", err)
+	}
+}
+
+func TestBytecodeDecodingErrors(t *testing.T) {
+	compiler := New()
+
+	err := compiler.Compile(parse(`(def f (lambda (x) (* x 2))) (f '(1 "a"))`))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	data, err := compiler.Bytecode().MarshalBinary()
+
+	if err != nil {
+		t.Fatalf("failed to encode bytecode: %s", err)
+	}
+
+	// Every truncation is reported, rather than causing a panic.
+	for n := len(BYTECODE_MAGIC); n < len(data); n++ {
+		err := (&Bytecode{}).UnmarshalBinary(data[:n])
+
+		if !errors.Is(err, ErrTruncated) {
+			t.Errorf("expected truncation error for %d of %d bytes, got=%v", n, len(data), err)
+		}
+	}
+
+	wrongVersion := append([]byte{}, data...)
+	binary.BigEndian.PutUint32(wrongVersion[len(BYTECODE_MAGIC):], BYTECODE_VERSION+1)
+
+	err = (&Bytecode{}).UnmarshalBinary(wrongVersion)
+	expected := "bytecode version 5 isn't supported, expected version 4"
+
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error for version mismatch. want=%q, got=%v", expected, err)
+	}
+
+	err = (&Bytecode{}).UnmarshalBinary([]byte("(+ 1 2)"))
+
+	if err == nil {
+		t.Errorf("expected error decoding source code")
+	}
+
+	err = (&Bytecode{}).UnmarshalBinary(append(append([]byte{}, data...), 0))
+
+	if err == nil {
+		t.Errorf("expected error for trailing data")
+	}
+}
+
+// Bytecode that decodes but can't be run safely is reported, rather than
+// being left for the VM to panic on.
+func TestBytecodeVerification(t *testing.T) {
+	lambda := func(localsCount int, instructions ...[]byte) *object.CompiledLambda {
+		return &object.CompiledLambda{
+			LocalsCount:  localsCount,
+			Instructions: slices.Concat(instructions...),
+		}
+	}
+
+	tests := []struct {
+		bytecode *Bytecode
+		expected string
+	}{
+		{
+			&Bytecode{Instructions: code.Make(code.OpConstant, 3598)},
+			"invalid bytecode in the main program: instruction at 0000: constant 3598 doesn't exist",
+		},
+		{
+			&Bytecode{
+				Instructions: slices.Concat(code.Make(code.OpTrue), code.Make(code.OpSetGlobal, 1)),
+				GlobalNames:  []string{"a"},
+			},
+			"invalid bytecode in the main program: instruction at 0001: global 1 doesn't exist",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpGetBuiltin, 200)},
+			"invalid bytecode in the main program: instruction at 0000: builtin 200 doesn't exist",
+		},
+		{
+			&Bytecode{Instructions: slices.Concat(code.Make(code.OpTrue), code.Make(code.OpJump, 2))},
+			"invalid bytecode in the main program: instruction at 0001: jump to 0002 isn't the start of an instruction",
+		},
+		{
+			&Bytecode{Instructions: slices.Concat(code.Make(code.OpTrue), code.Make(code.OpJump, 40))},
+			"invalid bytecode in the main program: instruction at 0001: jump to 0040 isn't the start of an instruction",
+		},
+		{
+			&Bytecode{Instructions: slices.Concat(code.Make(code.OpTrue), code.Make(code.OpPop), code.Make(code.OpPop))},
+			"invalid bytecode in the main program: instruction at 0002 removes 1 values from a stack of 0",
+		},
+		{
+			&Bytecode{Instructions: slices.Concat(code.Make(code.OpTrue), code.Make(code.OpReturn))},
+			"invalid bytecode in the main program: instruction at 0001: the main program can't return",
+		},
+		{
+			&Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{object.NewNumber(1)},
+			},
+			"invalid bytecode in the main program: instruction at 0000: constant 0 isn't a lambda",
+		},
+		{
+			&Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{lambda(1, code.Make(code.OpGetLocal, 1), code.Make(code.OpReturn))},
+			},
+			"invalid bytecode in constant 0: instruction at 0000: local 1 doesn't exist",
+		},
+		{
+			&Bytecode{
+				Instructions: slices.Concat(code.Make(code.OpTrue), code.Make(code.OpClosure, 0, 1)),
+				Constants:    []object.Object{lambda(0, code.Make(code.OpGetFree, 1), code.Make(code.OpReturn))},
+			},
+			"invalid bytecode in constant 0: instruction at 0000: free variable 1 doesn't exist",
+		},
+		{
+			&Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants: []object.Object{&object.CompiledLambda{
+					ParameterCount: 2,
+					LocalsCount:    1,
+					Instructions:   slices.Concat(code.Make(code.OpNull), code.Make(code.OpReturn)),
+				}},
+			},
+			"invalid bytecode in constant 0: 2 parameters don't fit in 1 locals",
+		},
+	}
+
+	for _, tt := range tests {
+		data, err := tt.bytecode.MarshalBinary()
+
+		if err != nil {
+			t.Fatalf("failed to encode bytecode: %s", err)
+		}
+
+		err = (&Bytecode{}).UnmarshalBinary(data)
+
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package compiler
+
+import (
+	"cmp"
+	"lisp/code"
+	"slices"
+)
+
+// A decoded instruction used by the peephole optimizer. Jump operands keep
+// referring to positions in the original instructions until the optimized
+// instructions are encoded, so instructions can be removed freely while
+// rewriting.
+type peepholeInstruction struct {
+	op       code.Opcode
+	operands []int
+	pos      int  // position of the instruction in the original instructions
+	removed  bool // instructions marked as removed are not encoded
+}
+
+// Opcodes that only place a value on top of the stack, and have no other side
+// effects. Pushing one of these and then immediately popping it is a no-op.
+var purePushes = map[code.Opcode]bool{
+	code.OpConstant:       true,
+	code.OpTrue:           true,
+	code.OpFalse:          true,
+	code.OpNull:           true,
+	code.OpGetLocal:       true,
+	code.OpGetBuiltin:     true,
+	code.OpGetFree:        true,
+	code.OpEmptyList:      true,
+	code.OpCurrentClosure: true,
+}
+
+// Rewrite the provided instructions using a collection of peephole rules,
+// returning new instructions with the same behaviour. Jump destinations are
+// updated to account for any instructions that were removed.
+//
+// Also returns a map from the position of each instruction that remains in the
+// original instructions to its position in the new instructions.
+//
+// The rules applied are:
+//   - jumps that land on an unconditional jump go directly to its destination
+//   - unconditional jumps to the following instruction are removed
+//   - OpTrue followed by OpJumpWhenFalse is removed, as it never jumps
+//   - OpFalse followed by OpJumpWhenFalse becomes an unconditional jump
+//   - a pure push followed by OpPop is removed
+//   - OpSetGlobal/OpSetLocal, OpPop, and a get of the same index is reduced to
+//     the set, as the set leaves the value on the stack
+func optimize(ins code.Instructions) (code.Instructions, map[int]int) {
+	decoded, ok := decodeInstructions(ins)
+
+	if !ok {
+		return ins, nil
+	}
+
+	p := &peephole{instructions: decoded, end: len(ins)}
+
+	// Each rule can create opportunities for others, so keep applying them
+	// until nothing changes.
+	for p.threadJumps() || p.removeDeadCode() {
+	}
+
+	return p.encode()
+}
+
+// Decode raw instructions into a slice of peepholeInstructions. Returns false
+// if the instructions can't be decoded, in which case they should be left
+// untouched.
+func decodeInstructions(ins code.Instructions) ([]*peepholeInstruction, bool) {
+	decoded := []*peepholeInstruction{}
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+
+		if err != nil {
+			return nil, false
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		decoded = append(decoded, &peepholeInstruction{
+			op:       code.Opcode(ins[i]),
+			operands: operands,
+			pos:      i,
+		})
+
+		i += 1 + read
+	}
+
+	return decoded, true
+}
+
+// The working state of the peephole optimizer.
+type peephole struct {
+	instructions []*peepholeInstruction
+	end          int // the length of the original instructions
+}
+
+// Return the index of the first instruction that hasn't been removed, at or
+// after the provided position in the original instructions. Returns
+// len(p.instructions) if there is no such instruction.
+func (p *peephole) resolve(pos int) int {
+	// The instructions are in order of their original positions.
+	i, _ := slices.BinarySearchFunc(p.instructions, pos, func(ins *peepholeInstruction, pos int) int {
+		return cmp.Compare(ins.pos, pos)
+	})
+
+	if i < len(p.instructions) && p.instructions[i].removed {
+		return p.next(i)
+	}
+
+	return i
+}
+
+// Return the index of the next instruction after i that hasn't been removed.
+func (p *peephole) next(i int) int {
+	for j := i + 1; j < len(p.instructions); j++ {
+		if !p.instructions[j].removed {
+			return j
+		}
+	}
+
+	return len(p.instructions)
+}
+
+// Return the original position of the instruction at the provided index.
+func (p *peephole) position(i int) int {
+	if i >= len(p.instructions) {
+		return p.end
+	}
+
+	return p.instructions[i].pos
+}
+
+// Return the set of instruction indexes that are the destination of a jump.
+func (p *peephole) jumpTargets() map[int]bool {
+	targets := map[int]bool{}
+
+	for _, ins := range p.instructions {
+		if !ins.removed && isJump(ins.op) {
+			for _, operand := range ins.operands {
+				targets[p.resolve(operand)] = true
+			}
+		}
+	}
+
+	return targets
+}
+
+// Point every jump that lands on an unconditional jump directly at the final
+// destination of the chain. Returns true if any instruction changed.
+func (p *peephole) threadJumps() bool {
+	changed := false
+
+	for _, ins := range p.instructions {
+		if ins.removed || !isJump(ins.op) {
+			continue
+		}
+
+		for i, operand := range ins.operands {
+			target := p.resolve(operand)
+
+			// Limit the steps taken so that a cycle of jumps can't loop
+			// forever.
+			for steps := 0; steps < len(p.instructions); steps++ {
+				if target >= len(p.instructions) || p.instructions[target].op != code.OpJump {
+					break
+				}
+
+				target = p.resolve(p.instructions[target].operands[0])
+			}
+
+			if pos := p.position(target); pos != operand {
+				ins.operands[i] = pos
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+// Remove instruction sequences that have no effect, or rewrite them to a
+// shorter equivalent, in a single pass over the instructions. Returns true if
+// any instruction changed.
+//
+// The destinations of jumps are found once, at the start of the pass. A
+// sequence removed during the pass only makes the instruction after it a new
+// destination, and that instruction is reached by the pass before any rule
+// can depend on it, so the destinations found stay correct.
+func (p *peephole) removeDeadCode() bool {
+	targets := p.jumpTargets()
+	changed := false
+
+	for i, ins := range p.instructions {
+		if ins.removed {
+			continue
+		}
+
+		n := p.next(i)
+
+		if ins.op == code.OpJump && p.resolve(ins.operands[0]) == n {
+			ins.removed = true
+			changed = true
+			continue
+		}
+
+		if n >= len(p.instructions) || targets[n] {
+			continue
+		}
+
+		next := p.instructions[n]
+
+		switch {
+		case ins.op == code.OpTrue && next.op == code.OpJumpWhenFalse:
+			ins.removed = true
+			next.removed = true
+			changed = true
+		case ins.op == code.OpFalse && next.op == code.OpJumpWhenFalse:
+			ins.removed = true
+			next.op = code.OpJump
+			next.operands = next.operands[:1]
+			changed = true
+		case purePushes[ins.op] && next.op == code.OpPop:
+			// The final pop of a program provides its result, so it has to
+			// stay in place.
+			if p.next(n) >= len(p.instructions) {
+				continue
+			}
+
+			ins.removed = true
+			next.removed = true
+			changed = true
+		case isSet(ins.op) && next.op == code.OpPop:
+			m := p.next(n)
+
+			if m >= len(p.instructions) || targets[m] {
+				continue
+			}
+
+			get := p.instructions[m]
+
+			if get.op == getFor(ins.op) && get.operands[0] == ins.operands[0] {
+				next.removed = true
+				get.removed = true
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+// Encode the remaining instructions, updating jump destinations to their new
+// positions. Return the encoded instructions along with a map of original
+// positions to new positions.
+func (p *peephole) encode() (code.Instructions, map[int]int) {
+	newPositions := make([]int, len(p.instructions)+1)
+	offset := 0
+
+	for i, ins := range p.instructions {
+		newPositions[i] = offset
+
+		if !ins.removed {
+			offset += len(code.Make(ins.op, ins.operands...))
+		}
+	}
+
+	newPositions[len(p.instructions)] = offset
+
+	out := code.Instructions{}
+	positions := map[int]int{}
+
+	for i, ins := range p.instructions {
+		if ins.removed {
+			continue
+		}
+
+		if isJump(ins.op) {
+			for i, operand := range ins.operands {
+				ins.operands[i] = newPositions[p.resolve(operand)]
+			}
+		}
+
+		positions[ins.pos] = newPositions[i]
+		out = append(out, code.Make(ins.op, ins.operands...)...)
+	}
+
+	return out, positions
+}
+
+func isJump(op code.Opcode) bool {
+	return op == code.OpJump || op == code.OpJumpWhenFalse
+}
+
+func isSet(op code.Opcode) bool {
+	return op == code.OpSetGlobal || op == code.OpSetLocal
+}
+
+// Return the get Opcode that reads the value written by the provided set
+// Opcode.
+func getFor(op code.Opcode) code.Opcode {
+	if op == code.OpSetGlobal {
+		return code.OpGetGlobal
+	}
+
+	return code.OpGetLocal
+}
@@ -0,0 +1,201 @@
+package compiler
+
+import (
+	"fmt"
+	"lisp/code"
+	"strings"
+	"testing"
+)
+
+// Ensure the peephole optimizer rewrites instructions as expected, and that
+// jump destinations are updated to match.
+func TestOptimizer(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// Before:
+			// 0000 OpTrue
+			// 0001 OpJumpWhenFalse 12 13
+			// 0006 OpConstant 0
+			// 0009 OpJump 13
+			// 0012 OpNull
+			// 0013 OpPop
+			// 0014 OpConstant 1
+			// 0017 OpPop
+			input:             "(if true 4) 5",
+			expectedConstants: []interface{}{4, 5},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpJump, 7),
+				// 0006
+				code.Make(code.OpNull),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpConstant, 1),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Before:
+			// 0000 OpFalse
+			// 0001 OpJumpWhenFalse 12 15
+			// 0006 OpConstant 0
+			// 0009 OpJump 15
+			// 0012 OpConstant 1
+			// 0015 OpPop
+			input:             "(if false 4 10)",
+			expectedConstants: []interface{}{4, 10},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpJump, 9),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpJump, 12),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Before:
+			// 0000 OpTrue
+			// 0001 OpSetGlobal 0
+			// 0004 OpPop
+			// 0005 OpGetGlobal 0
+			// 0008 OpJumpWhenFalse 33 36
+			// 0013 OpGetGlobal 0
+			// 0016 OpJumpWhenFalse 27 30
+			// 0021 OpConstant 0
+			// 0024 OpJump 30
+			// 0027 OpConstant 1
+			// 0030 OpJump 36
+			// 0033 OpConstant 2
+			// 0036 OpPop
+			input:             "(def x true) (if x (if x 1 2) 3)",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpSetGlobal, 0),
+				// 0004
+				code.Make(code.OpJumpWhenFalse, 29, 32),
+				// 0009
+				code.Make(code.OpGetGlobal, 0),
+				// 0012
+				code.Make(code.OpJumpWhenFalse, 23, 32),
+				// 0017
+				code.Make(code.OpConstant, 0),
+				// 0020
+				code.Make(code.OpJump, 32),
+				// 0023
+				code.Make(code.OpConstant, 1),
+				// 0026
+				code.Make(code.OpJump, 32),
+				// 0029
+				code.Make(code.OpConstant, 2),
+				// 0032
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "(lambda () 1 2)",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "(lambda () (def a 1) a)",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runOptimizedCompilerTests(t, tests)
+}
+
+// Run compiler test cases with the peephole optimizer enabled.
+func runOptimizedCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+		compiler.Optimize = true
+
+		err := compiler.Compile(program)
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+
+		if err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+
+		if err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+	}
+}
+
+// Optimize a program with many removable instructions, each if expression
+// having a constant condition and an unused result.
+func BenchmarkOptimizer(b *testing.B) {
+	var input strings.Builder
+
+	for i := range 2000 {
+		fmt.Fprintf(&input, "(if true %d) ", i)
+	}
+
+	program := parse(input.String())
+
+	for range b.N {
+		compiler := New()
+		compiler.Optimize = true
+
+		err := compiler.Compile(program)
+
+		if err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+	}
+}
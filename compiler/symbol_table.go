@@ -1,5 +1,12 @@
 package compiler
 
+import (
+	"lisp/object"
+	"maps"
+	"slices"
+	"sort"
+)
+
 // The scope which the Symbol is defined for.
 type SymbolScope string
 
@@ -33,10 +40,22 @@ type Symbol struct {
 
 // SymbolTable holds a map of identifier strings to their symbol definitions.
 type SymbolTable struct {
-	store       map[string]Symbol // maps a string to its associated Symbol
-	count       int               // the number of Symbols in the store
-	outer       *SymbolTable      // address of enclosing SymbolTable
-	FreeSymbols []Symbol          // tracks variables required from enclosing scope
+	store       map[string]Symbol        // maps a string to its associated Symbol
+	count       int                      // the number of Symbols in the store
+	outer       *SymbolTable             // address of enclosing SymbolTable
+	FreeSymbols []Symbol                 // tracks variables required from enclosing scope
+	defined     []Symbol                 // every Symbol created by Define, in order
+	resolved    map[Symbol]bool          // the Symbols in the store that have been resolved
+	macros      map[string]*object.Macro // the macros defined in this SymbolTable
+	// The names defined in each block being compiled, innermost last, along
+	// with what each name resolved to before the block began.
+	blocks []map[string]shadowedSymbol
+}
+
+// What a name resolved to before a block defined it again.
+type shadowedSymbol struct {
+	symbol  Symbol
+	defined bool // false if the name wasn't defined before the block
 }
 
 // Create a new empty SymbolTable.
@@ -44,6 +63,8 @@ func NewSymbolTable() *SymbolTable {
 	st := &SymbolTable{
 		store:       make(map[string]Symbol),
 		FreeSymbols: []Symbol{},
+		resolved:    make(map[Symbol]bool),
+		macros:      make(map[string]*object.Macro),
 	}
 
 	return st
@@ -57,7 +78,26 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 }
 
 // Define a symbol within the SymbolTable associated with the given identifier.
+// Redefining a variable of the same scope returns its existing Symbol, so that
+// the new value replaces the old one, such as when updating a counter in a
+// while loop.
+//
+// Inside a block, only variables defined in the same block are redefined.
+// Any other variable of the same name is shadowed by a new one until the
+// block ends.
 func (st *SymbolTable) Define(s string) Symbol {
+	existing, ok := st.store[s]
+
+	if ok && (existing.Scope == GlobalScope || existing.Scope == LocalScope) && !st.shadows(s) {
+		return existing
+	}
+
+	if len(st.blocks) > 0 {
+		st.blocks[len(st.blocks)-1][s] = shadowedSymbol{existing, ok}
+	}
+
+	delete(st.macros, s)
+
 	sym := Symbol{
 		Name:  s,
 		Index: st.count,
@@ -70,11 +110,46 @@ func (st *SymbolTable) Define(s string) Symbol {
 	}
 
 	st.store[s] = sym
+	st.defined = append(st.defined, sym)
 	st.count++
 
 	return sym
 }
 
+// Start a block of the scope, such as the body of a let expression, in which
+// Define creates new variables that are discarded by endBlock.
+func (st *SymbolTable) beginBlock() {
+	st.blocks = append(st.blocks, map[string]shadowedSymbol{})
+}
+
+// End the innermost block, so that each name it defined resolves to what it
+// did before the block began. Free variables found in the block are kept, as
+// they refer to the same variables outside of it.
+func (st *SymbolTable) endBlock() {
+	block := st.blocks[len(st.blocks)-1]
+	st.blocks = st.blocks[:len(st.blocks)-1]
+
+	for name, shadowed := range block {
+		if shadowed.defined {
+			st.store[name] = shadowed.symbol
+		} else {
+			delete(st.store, name)
+		}
+	}
+}
+
+// Report whether defining the name creates a new variable that shadows the
+// existing one, which is the case inside a block that hasn't defined it yet.
+func (st *SymbolTable) shadows(name string) bool {
+	if len(st.blocks) == 0 {
+		return false
+	}
+
+	_, ok := st.blocks[len(st.blocks)-1][name]
+
+	return !ok
+}
+
 // Define a symbol within the SymbolTable associated with the provided builtin
 // function name.
 func (st *SymbolTable) DefineBuiltin(index int, name string) Symbol {
@@ -89,10 +164,39 @@ func (st *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	return sym
 }
 
+// Define a macro within the SymbolTable, replacing any variable of the same
+// name.
+func (st *SymbolTable) DefineMacro(macro *object.Macro) {
+	delete(st.store, macro.Name)
+	st.macros[macro.Name] = macro
+}
+
+// Retrieve the macro associated with the given identifier, unless the
+// identifier is a variable of an enclosed scope.
+func (st *SymbolTable) ResolveMacro(s string) (*object.Macro, bool) {
+	if _, ok := st.store[s]; ok {
+		return nil, false
+	}
+
+	if macro, ok := st.macros[s]; ok {
+		return macro, true
+	}
+
+	if st.outer != nil {
+		return st.outer.ResolveMacro(s)
+	}
+
+	return nil, false
+}
+
 // Retrieve the Symbol associated with the given identifier.
 func (st *SymbolTable) Resolve(s string) (sym Symbol, ok bool) {
 	sym, ok = st.store[s]
 
+	if ok {
+		st.resolved[sym] = true
+	}
+
 	if !ok && st.outer != nil {
 		sym, ok = st.outer.Resolve(s)
 
@@ -111,6 +215,16 @@ func (st *SymbolTable) Resolve(s string) (sym Symbol, ok bool) {
 
 // Define the provided symbol in the current scope as a free Symbol, and keep
 // track of the Symbols defined this way from the enclosing scope's SymbolTable.
+//
+// The free Symbol replaces the name in the store, so later references resolve
+// to it directly and each variable is captured only once per closure.
+//
+// Closures hold copies of their free variables rather than references to the
+// enclosing frames, so a variable used by a deeply nested closure is also
+// captured by every closure between it and the variable's definition: the
+// value has to be available in the enclosing frame when the inner closure is
+// created. Resolve produces this by defining the free Symbol at each level as
+// it returns.
 func (st *SymbolTable) defineFree(original Symbol) Symbol {
 	st.FreeSymbols = append(st.FreeSymbols, original)
 
@@ -138,3 +252,97 @@ func (st *SymbolTable) DefineFunctionName(name string) Symbol {
 
 	return symbol
 }
+
+// Return the local Symbols defined in this SymbolTable that have never been
+// resolved, either directly or as a free variable of an enclosed scope. The
+// Symbols are returned in the order they were defined.
+func (st *SymbolTable) UnusedLocals() []Symbol {
+	unused := []Symbol{}
+
+	for _, sym := range st.defined {
+		if sym.Scope == LocalScope && !st.resolved[sym] {
+			unused = append(unused, sym)
+		}
+	}
+
+	return unused
+}
+
+// Return the names of the global variables defined in the outermost
+// SymbolTable, where the index of each name is the index of the variable.
+func (st *SymbolTable) GlobalNames() []string {
+	for st.outer != nil {
+		st = st.outer
+	}
+
+	names := make([]string, st.count)
+
+	for _, sym := range st.defined {
+		names[sym.Index] = sym.Name
+	}
+
+	return names
+}
+
+// Return the Symbols that names currently resolve to in this SymbolTable, not
+// including those of any enclosing SymbolTable, sorted by name. A name that
+// has been defined more than once appears only with its latest definition.
+func (st *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(st.store))
+
+	for _, sym := range st.store {
+		symbols = append(symbols, sym)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Name < symbols[j].Name
+	})
+
+	return symbols
+}
+
+// Return a copy of the SymbolTable that can be changed without affecting the
+// original. The enclosing SymbolTable, if any, is shared.
+func (st *SymbolTable) clone() *SymbolTable {
+	return &SymbolTable{
+		store:       maps.Clone(st.store),
+		count:       st.count,
+		outer:       st.outer,
+		FreeSymbols: slices.Clone(st.FreeSymbols),
+		defined:     slices.Clone(st.defined),
+		resolved:    maps.Clone(st.resolved),
+		macros:      maps.Clone(st.macros),
+	}
+}
+
+// The contents of a SymbolTable at a point in time.
+type symbolTableState struct {
+	store       map[string]Symbol
+	count       int
+	freeSymbols int
+	defined     int
+	resolved    map[Symbol]bool
+	macros      map[string]*object.Macro
+}
+
+// Take a copy of the current contents of the SymbolTable.
+func (st *SymbolTable) saveState() symbolTableState {
+	return symbolTableState{
+		store:       maps.Clone(st.store),
+		count:       st.count,
+		freeSymbols: len(st.FreeSymbols),
+		defined:     len(st.defined),
+		resolved:    maps.Clone(st.resolved),
+		macros:      maps.Clone(st.macros),
+	}
+}
+
+// Replace the contents of the SymbolTable with a previously saved state.
+func (st *SymbolTable) restoreState(state symbolTableState) {
+	st.store = state.store
+	st.count = state.count
+	st.FreeSymbols = st.FreeSymbols[:state.freeSymbols]
+	st.defined = st.defined[:state.defined]
+	st.resolved = state.resolved
+	st.macros = state.macros
+}
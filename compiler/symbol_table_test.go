@@ -1,6 +1,9 @@
 package compiler
 
-import "testing"
+import (
+	"slices"
+	"testing"
+)
 
 // Test that Symbols are defined in the correct SymbolTables with the correct
 // scope and index.
@@ -57,6 +60,34 @@ func TestDefine(t *testing.T) {
 	}
 }
 
+// Ensure that redefining a variable in the same scope reuses its Symbol, while
+// defining it in an enclosed scope shadows it.
+func TestRedefine(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+
+	if sym := global.Define("a"); sym != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("wrong redefined global. got=%+v", sym)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("f")
+	local.Define("c")
+
+	if sym := local.Define("c"); sym != (Symbol{Name: "c", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong redefined local. got=%+v", sym)
+	}
+
+	if sym := local.Define("a"); sym != (Symbol{Name: "a", Scope: LocalScope, Index: 1}) {
+		t.Errorf("wrong shadowing local. got=%+v", sym)
+	}
+
+	if sym := local.Define("f"); sym != (Symbol{Name: "f", Scope: LocalScope, Index: 2}) {
+		t.Errorf("wrong local shadowing the function name. got=%+v", sym)
+	}
+}
+
 // Ensure that global symbols can be resolved at any depth.
 func TestResolveGlobal(t *testing.T) {
 	global := NewSymbolTable()
@@ -281,3 +312,34 @@ func TestShadowFunctionName(t *testing.T) {
 			expectedSymbol, sym)
 	}
 }
+
+// Ensure Symbols returns the current Symbol for each name in a SymbolTable,
+// sorted by name.
+func TestSymbols(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("b")
+	global.Define("a")
+	global.Define("b")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("c")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 1},
+		{Name: "b", Scope: GlobalScope, Index: 0},
+		{Name: "len", Scope: BuiltinScope, Index: 0},
+	}
+
+	symbols := global.Symbols()
+
+	if !slices.Equal(symbols, expected) {
+		t.Errorf("wrong symbols. want=%+v, got=%+v", expected, symbols)
+	}
+
+	symbols = local.Symbols()
+
+	if !slices.Equal(symbols, []Symbol{{Name: "c", Scope: LocalScope, Index: 0}}) {
+		t.Errorf("wrong local symbols. got=%+v", symbols)
+	}
+}
@@ -0,0 +1,262 @@
+package compiler
+
+import (
+	"fmt"
+	"lisp/code"
+	"lisp/object"
+)
+
+// The instructions of the main program or a lambda, checked by
+// verifyBytecode.
+type verifyScope struct {
+	name         string
+	instructions code.Instructions
+	// The positions of the instructions, in order
+	positions []int
+	// The operands of each instruction, by position
+	operands map[int][]int
+	// The number of local variables the instructions can refer to
+	locals int
+	// The number of free variables every closure of the lambda captures
+	free int
+	// Whether the instructions are the main program, which can't return
+	main bool
+}
+
+// Check that decoded Bytecode can be run without the VM reading outside of
+// its instructions, constants, globals, builtins, variables or stack. The
+// encoding can't be trusted, since a file may have been corrupted after it
+// was written.
+//
+// Only lambdas that the main program can create closures from are checked,
+// as no others can be run.
+func verifyBytecode(b *Bytecode) error {
+	scopes := []*verifyScope{
+		{name: "the main program", instructions: b.Instructions, main: true},
+	}
+	// The scope of each lambda found, by constant index
+	lambdas := map[int]*verifyScope{}
+
+	for i := 0; i < len(scopes); i++ {
+		scope := scopes[i]
+		scope.positions, scope.operands = readAllOperands(scope.instructions)
+
+		for _, pos := range scope.positions {
+			if code.Opcode(scope.instructions[pos]) != code.OpClosure {
+				continue
+			}
+
+			index, free := scope.operands[pos][0], scope.operands[pos][1]
+
+			if found, ok := lambdas[index]; ok {
+				found.free = min(found.free, free)
+				continue
+			}
+
+			if index >= len(b.Constants) {
+				return fmt.Errorf("invalid bytecode in %s: instruction at %04d: constant %d doesn't exist", scope.name, pos, index)
+			}
+
+			lambda, ok := b.Constants[index].(*object.CompiledLambda)
+
+			if !ok {
+				return fmt.Errorf("invalid bytecode in %s: instruction at %04d: constant %d isn't a lambda", scope.name, pos, index)
+			}
+
+			lambdas[index] = &verifyScope{
+				name:         fmt.Sprintf("constant %d", index),
+				instructions: lambda.Instructions,
+				locals:       lambda.LocalsCount,
+				free:         free,
+			}
+			scopes = append(scopes, lambdas[index])
+
+			err := verifyParameters(lambda)
+
+			if err != nil {
+				return fmt.Errorf("invalid bytecode in constant %d: %w", index, err)
+			}
+		}
+	}
+
+	for _, scope := range scopes {
+		err := verifyInstructions(b, scope)
+
+		if err == nil {
+			err = verifyStack(scope)
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid bytecode in %s: %w", scope.name, err)
+		}
+	}
+
+	return nil
+}
+
+// Return the position of each instruction, along with the operands of each
+// instruction by position. The instructions must already be known to be
+// complete, as they are once decoded.
+func readAllOperands(ins code.Instructions) ([]int, map[int][]int) {
+	positions := []int{}
+	operands := map[int][]int{}
+
+	for pos := 0; pos < len(ins); {
+		def, _ := code.Lookup(ins[pos])
+		ops, read := code.ReadOperands(def, ins[pos+1:])
+
+		positions = append(positions, pos)
+		operands[pos] = ops
+		pos += 1 + read
+	}
+
+	return positions, operands
+}
+
+// Return an error if the parameters of the lambda don't fit in its locals.
+func verifyParameters(lambda *object.CompiledLambda) error {
+	params := lambda.ParameterCount
+
+	// The rest parameter holds a List of the remaining arguments.
+	if lambda.Variadic {
+		params++
+	}
+
+	if params > lambda.LocalsCount {
+		return fmt.Errorf("%d parameters don't fit in %d locals", params, lambda.LocalsCount)
+	}
+
+	return nil
+}
+
+// Return an error if an instruction refers to something that doesn't exist,
+// or jumps to the middle of an instruction.
+func verifyInstructions(b *Bytecode, scope *verifyScope) error {
+	for _, pos := range scope.positions {
+		ops := scope.operands[pos]
+
+		var err error
+
+		switch code.Opcode(scope.instructions[pos]) {
+		case code.OpConstant:
+			err = checkIndex("constant", ops[0], len(b.Constants))
+		case code.OpGetGlobal, code.OpSetGlobal:
+			err = checkIndex("global", ops[0], len(b.GlobalNames))
+		case code.OpGetLocal, code.OpSetLocal:
+			err = checkIndex("local", ops[0], scope.locals)
+		case code.OpGetFree:
+			err = checkIndex("free variable", ops[0], scope.free)
+		case code.OpGetBuiltin:
+			err = checkIndex("builtin", ops[0], len(object.Builtins))
+		case code.OpJump, code.OpJumpWhenFalse:
+			for _, target := range ops {
+				_, ok := scope.operands[target]
+
+				// A jump to the end finishes the instructions.
+				if !ok && target != len(scope.instructions) {
+					err = fmt.Errorf("jump to %04d isn't the start of an instruction", target)
+				}
+			}
+		case code.OpReturn, code.OpTailCall:
+			if scope.main {
+				err = fmt.Errorf("the main program can't return")
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("instruction at %04d: %w", pos, err)
+		}
+	}
+
+	return nil
+}
+
+// Return an error if the index isn't less than the number of items there are.
+func checkIndex(kind string, index int, count int) error {
+	if index >= count {
+		return fmt.Errorf("%s %d doesn't exist", kind, index)
+	}
+
+	return nil
+}
+
+// Return an error if an instruction can be reached without the values it
+// removes from the stack. Every jump is followed to find the fewest values
+// the stack can hold at each instruction.
+func verifyStack(scope *verifyScope) error {
+	ins := scope.instructions
+	depths := map[int]int{}
+	pending := []int{}
+
+	// Record that the instruction at the position can be reached with the
+	// provided number of values on the stack.
+	reach := func(pos int, depth int) {
+		if known, ok := depths[pos]; pos >= len(ins) || ok && known <= depth {
+			return
+		}
+
+		depths[pos] = depth
+		pending = append(pending, pos)
+	}
+
+	reach(0, 0)
+
+	for len(pending) > 0 {
+		pos := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		depth := depths[pos]
+		op := code.Opcode(ins[pos])
+		ops := scope.operands[pos]
+
+		// The number of values the instruction removes from the stack, and
+		// the number it adds.
+		removes, adds := 0, 1
+
+		switch op {
+		case code.OpPop, code.OpJumpWhenFalse:
+			removes, adds = 1, 0
+		case code.OpSetGlobal, code.OpSetLocal:
+			removes, adds = 1, 1
+		case code.OpCall, code.OpTailCall:
+			removes = ops[0] + 1
+		case code.OpClosure:
+			removes = ops[1]
+		case code.OpReturn:
+			removes = 1
+		case code.OpJump:
+			adds = 0
+		}
+
+		if depth < removes {
+			return fmt.Errorf(
+				"instruction at %04d removes %d values from a stack of %d",
+				pos, removes, depth,
+			)
+		}
+
+		depth += adds - removes
+		def, _ := code.Lookup(ins[pos])
+		next := pos + 1
+
+		for _, w := range def.OperandWidths {
+			next += w
+		}
+
+		switch op {
+		case code.OpReturn:
+		case code.OpJump:
+			reach(ops[0], depth)
+		case code.OpJumpWhenFalse:
+			reach(ops[0], depth)
+			// An error is left on the stack as the result of the if
+			// expression when jumping to its end.
+			reach(ops[1], depth+1)
+			reach(next, depth)
+		default:
+			reach(next, depth)
+		}
+	}
+
+	return nil
+}
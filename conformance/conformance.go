@@ -0,0 +1,114 @@
+// Runs lisp programs with both the evaluator and the VM, so that the engines
+// can be checked to behave in the same way.
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"lisp/compiler"
+	"lisp/evaluator"
+	"lisp/lexer"
+	"lisp/object"
+	"lisp/parser"
+	"lisp/vm"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// An Engine runs the source of a program, returning the result of its last
+// expression, or an error if it can't be parsed, compiled or run.
+type Engine func(source string) (object.Object, error)
+
+// The engines compared, by name.
+var Engines = map[string]Engine{
+	"eval": Evaluate,
+	"vm":   RunVM,
+}
+
+// Parse and evaluate the source with the evaluator.
+func Evaluate(source string) (object.Object, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	if len(p.Errors) > 0 {
+		return nil, fmt.Errorf("parser errors: %v", p.Errors)
+	}
+
+	result := evaluator.Evaluate(program, object.NewEnvironment(nil))
+
+	if err, ok := result.(*object.ErrorObject); ok {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Parse and compile the source, and run the bytecode with the VM.
+func RunVM(source string) (object.Object, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	if len(p.Errors) > 0 {
+		return nil, fmt.Errorf("parser errors: %v", p.Errors)
+	}
+
+	c := compiler.New()
+
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+
+	return vm.New(c.Bytecode()).RunResult()
+}
+
+// Return the kind of error, or an empty kind if it isn't an ErrorObject, such
+// as a parser error.
+func Kind(err error) object.ErrorKind {
+	var errObj *object.ErrorObject
+
+	if errors.As(err, &errObj) {
+		return errObj.Kind
+	}
+
+	return ""
+}
+
+// The functions used by Generate, with the number of arguments each is
+// called with.
+var generated = []struct {
+	name string
+	args int
+}{
+	{"+", 2}, {"-", 2}, {"*", 2}, {"/", 2}, {"rem", 2}, {"-", 1},
+	{"=", 2}, {"<", 2}, {">", 2}, {"not", 1}, {"and", 2}, {"or", 2},
+	{"if", 3}, {"list", 2}, {"first", 1}, {"rest", 1}, {"len", 1},
+	{"push", 2}, {"str", 2}, {"error?", 1},
+}
+
+// Generate the source of a random expression of numbers, booleans, lists and
+// calls, nested no deeper than depth. Many are invalid, such as dividing by 0
+// or adding lists, so that the engines are compared when they fail too.
+func Generate(r *rand.Rand, depth int) string {
+	if depth == 0 || r.Intn(4) == 0 {
+		switch r.Intn(6) {
+		case 0:
+			return []string{"true", "false", "null"}[r.Intn(3)]
+		case 1:
+			return "'(1 2)"
+		case 2:
+			return strconv.FormatFloat(float64(r.Intn(8))/2, 'f', -1, 64)
+		default:
+			return strconv.Itoa(r.Intn(10) - 2)
+		}
+	}
+
+	fn := generated[r.Intn(len(generated))]
+	args := make([]string, fn.args)
+
+	for i := range args {
+		args[i] = Generate(r, depth-1)
+	}
+
+	return fmt.Sprintf("(%s %s)", fn.name, strings.Join(args, " "))
+}
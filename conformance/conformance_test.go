@@ -0,0 +1,95 @@
+package conformance
+
+import (
+	"lisp/object"
+	"math/rand"
+	"testing"
+)
+
+// Run the source with each engine, checking that they agree with each other
+// on whether it fails, and on the result if it doesn't.
+func runEngines(t *testing.T, source string) (object.Object, error) {
+	t.Helper()
+
+	evalResult, evalErr := Evaluate(source)
+	vmResult, vmErr := RunVM(source)
+
+	if (evalErr == nil) != (vmErr == nil) {
+		t.Errorf("engines disagree on failing for %s\n  eval: %s\n  vm:   %s",
+			source, describe(evalResult, evalErr), describe(vmResult, vmErr))
+	} else if evalErr == nil && !object.Equals(evalResult, vmResult) {
+		t.Errorf("engines disagree on the result of %s\n  eval: %s\n  vm:   %s",
+			source, evalResult.Inspect(), vmResult.Inspect())
+	}
+
+	return evalResult, evalErr
+}
+
+// Describe the result of running a program, for test failures.
+func describe(result object.Object, err error) string {
+	if err != nil {
+		return "error: " + err.Error()
+	}
+
+	return result.Inspect()
+}
+
+func TestCorpus(t *testing.T) {
+	for _, tt := range Corpus {
+		if tt.Divergence != "" {
+			continue
+		}
+
+		t.Run(tt.Name, func(t *testing.T) {
+			result, err := runEngines(t, tt.Source)
+
+			if tt.Error {
+				if err == nil {
+					t.Errorf("expected an error, got=%s", result.Inspect())
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			expected, convErr := object.FromGo(tt.Expected)
+
+			if convErr != nil {
+				t.Fatalf("invalid expected value %#v: %s", tt.Expected, convErr)
+			}
+
+			if !object.Equals(expected, result) {
+				t.Errorf("wrong result. want=%s, got=%s", expected.Inspect(), result.Inspect())
+			}
+		})
+	}
+}
+
+// Ensure the known differences between the engines still exist, so that they
+// can be moved back into the corpus once they're fixed.
+func TestDivergences(t *testing.T) {
+	for _, tt := range Corpus {
+		if tt.Divergence == "" {
+			continue
+		}
+
+		evalResult, evalErr := Evaluate(tt.Source)
+		vmResult, vmErr := RunVM(tt.Source)
+
+		if (evalErr == nil) == (vmErr == nil) && (evalErr != nil || object.Equals(evalResult, vmResult)) {
+			t.Errorf("%s: the engines now agree, remove its Divergence: %s", tt.Name, tt.Divergence)
+		}
+	}
+}
+
+// Check that the engines agree on randomly generated expressions.
+func TestGenerated(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for range 2000 {
+		runEngines(t, Generate(r, 4))
+	}
+}
@@ -0,0 +1,210 @@
+package conformance
+
+// A Case is a program and the result both engines are expected to give.
+type Case struct {
+	Name   string
+	Source string
+	// The result of the program, converted with object.FromGo. Ignored when
+	// Error is true.
+	Expected interface{}
+	// Whether the program is expected to fail.
+	Error bool
+	// Why the engines are known to give different results, if they do. These
+	// cases are checked to still differ, so that they're moved back into the
+	// corpus once the engines agree.
+	Divergence string
+}
+
+// The programs both engines are expected to run in the same way.
+var Corpus = []Case{
+	// numbers
+	{Name: "addition", Source: "(+ 1 2 3)", Expected: 6},
+	{Name: "empty addition", Source: "(+)", Expected: 0},
+	{Name: "empty multiplication", Source: "(*)", Expected: 1},
+	{Name: "negation", Source: "(- 5)", Expected: -5},
+	{Name: "empty subtraction", Source: "(-)", Error: true},
+	{Name: "fractions", Source: "(/ 1 4)", Expected: 0.25},
+	{Name: "number notation", Source: "(+ .5 1e2 -2.5e-1)", Expected: 100.25},
+	{Name: "whole division", Source: "(/ 9 3)", Expected: 3},
+	{Name: "float addition", Source: "(+ 0.1 0.2)", Expected: 0.30000000000000004},
+	{Name: "divide by zero", Source: "(/ 1 0)", Error: true},
+	{Name: "remainder", Source: "(rem 7 3)", Expected: 1},
+	{Name: "negative remainder", Source: "(rem -7 2)", Expected: -1},
+	{Name: "remainder of negative", Source: "(rem 7 -2)", Expected: 1},
+	{Name: "remainder of zero", Source: "(rem 7 0)", Error: true},
+	{Name: "nested arithmetic", Source: "(* (+ 1 2) (- 10 4) (/ 8 2))", Expected: 72},
+	{Name: "adding a string", Source: `(+ 1 "a")`, Error: true},
+
+	// comparison and logic
+	{Name: "less than", Source: "(< 1 2 3)", Expected: true},
+	{Name: "not less than", Source: "(< 1 3 2)", Expected: false},
+	{Name: "greater than", Source: "(> 3 2 1)", Expected: true},
+	{Name: "equal numbers", Source: "(= 2 (/ 4 2))", Expected: true},
+	{Name: "equal lists", Source: "(= (list 1 (list 2)) (list 1 (list 2)))", Expected: true},
+	{Name: "unequal types", Source: `(= 1 "1")`, Expected: false},
+	{Name: "not", Source: "(not false)", Expected: true},
+	{Name: "and", Source: "(and true 1 false)", Expected: false},
+	{Name: "or", Source: "(or false null 1)", Expected: true},
+	{Name: "empty and", Source: "(and)", Expected: true},
+	{Name: "empty or", Source: "(or)", Expected: false},
+	{Name: "error in and", Source: "(and true (len 1))", Error: true},
+
+	// if and def
+	{Name: "if", Source: "(if (< 1 2) 1 2)", Expected: 1},
+	{Name: "if without alternative", Source: "(if false 1)", Expected: nil},
+	{Name: "if with null condition", Source: "(if null 1 2)", Expected: 2},
+	{Name: "if with error condition", Source: `(if (error "failed") 1 2)`, Error: true},
+	{Name: "if without arguments", Source: "(if)", Error: true},
+	{Name: "def", Source: "(def a 5) (* a a)", Expected: 25},
+	{Name: "redefinition", Source: "(def a 5) (def a 6) a", Expected: 6},
+	{Name: "def referring to itself", Source: "(def x 1) (def x (+ x 1)) x", Expected: 2},
+	{Name: "local redefinition", Source: "(def f (lambda (n) (def n (* n 2)) n)) (f 3)", Expected: 6},
+	{Name: "def result", Source: "(def a 5)", Expected: 5},
+	{Name: "def of special form", Source: "(def if 1)", Error: true},
+	{Name: "undefined variable", Source: "missing", Error: true},
+	{Name: "calling a number", Source: "(1 2)", Error: true},
+
+	// lambdas
+	{Name: "lambda call", Source: "((lambda (a b) (+ a b)) 1 2)", Expected: 3},
+	{Name: "named lambda", Source: "(def add (lambda (a b) (+ a b))) (add 2 3)", Expected: 5},
+	{Name: "lambda body", Source: "(def f (lambda (a) (def b (* a 2)) (+ a b))) (f 3)", Expected: 9},
+	{Name: "wrong arity", Source: "(def f (lambda (a) a)) (f)", Error: true},
+	{Name: "closure", Source: "(def adder (lambda (n) (lambda (x) (+ x n)))) ((adder 3) 4)", Expected: 7},
+	{
+		Name: "nested closures",
+		Source: `
+(def outer (lambda (x y)
+  (lambda ()
+    (lambda () (+ y x y x)))))
+(((outer 1 2)))
+`,
+		Expected: 6,
+	},
+	{
+		Name: "recursion",
+		Source: `
+(def fibonacci (lambda (n)
+    (if (< n 2)
+        n
+        (+ (fibonacci (- n 1)) (fibonacci (- n 2))))))
+(fibonacci 15)
+`,
+		Expected: 610,
+	},
+	{
+		Name: "higher order functions",
+		Source: `
+(def reduce (lambda (lst f acc)
+    (if (= 0 (len lst))
+        acc
+        (reduce (rest lst) f (f acc (first lst))))))
+(def map (lambda (lst fn)
+    (reduce lst (lambda (acc n) (push acc (fn n))) '())))
+(map '(1 2 3) (lambda (n) (* n n)))
+`,
+		Expected: []interface{}{1, 4, 9},
+	},
+	{Name: "error inside lambda", Source: "(def f (lambda () (len 1))) (f)", Error: true},
+	{Name: "shadowed builtin", Source: "(def len (lambda (x) 1)) (len 5)", Expected: 1},
+	{Name: "builtin as value", Source: "(def f (lambda (g) (g 1 2))) (f +)", Expected: 3},
+
+	// let
+	{Name: "let", Source: "(let ((x 1) (y (+ x 1))) (* x y))", Expected: 2},
+	{Name: "let shadowing", Source: "(def x 5) (let ((x 1)) x) x", Expected: 5},
+	{Name: "let scope", Source: "(let ((x 1)) x) x", Error: true},
+	{Name: "let in lambda", Source: "(def f (lambda (x) (let ((y (* x 2))) (+ x y)))) (f 3)", Expected: 9},
+	{Name: "let without body", Source: "(let ((x 1)))", Expected: nil},
+	{Name: "let shadowing in lambda", Source: "(def f (lambda (x) (let ((x 1) (x (+ x 1))) x))) (f 5)", Expected: 2},
+	{Name: "let body definitions", Source: "(def f (lambda () (def y 1) (let () (def y 2)) y)) (f)", Expected: 1},
+
+	// cond
+	{Name: "cond", Source: "(cond ((< 2 1) 1) ((= 1 1) 2) (else 3))", Expected: 2},
+	{Name: "cond without match", Source: "(cond (false 1))", Expected: nil},
+	{Name: "cond error test", Source: "(cond ((len 1) 1) (else 2))", Error: true},
+	{Name: "cond in lambda", Source: "(def sign (lambda (n) (cond ((< n 0) -1) ((= n 0) 0) (else 1)))) (list (sign -5) (sign 0) (sign 5))", Expected: []interface{}{-1, 0, 1}},
+
+	// when and unless
+	{Name: "when", Source: "(when (= 1 1) 1 2)", Expected: 2},
+	{Name: "when false", Source: "(when false 1)", Expected: nil},
+	{Name: "unless", Source: "(def x 1) (unless (= x 2) (def y 3) (* x y))", Expected: 3},
+	{Name: "unless true", Source: "(unless true 1)", Expected: nil},
+	{Name: "when error body", Source: "(when true (len 1) 2)", Error: true},
+
+	// do
+	{Name: "do", Source: "(do 1 2 3)", Expected: 3},
+	{Name: "empty do", Source: "(do)", Expected: nil},
+	{Name: "do in if", Source: "(if true (do (def y 1) (+ y 1)) 0)", Expected: 2},
+
+	// while
+	{Name: "while", Source: "(def i 0) (while (< i 10) (def i (+ i 1))) i", Expected: 10},
+	{Name: "while result", Source: "(def i 0) (while (< i 10) (def i (+ i 1)))", Expected: nil},
+	{Name: "while in lambda", Source: "(def sum (lambda (n) (def total 0) (while (> n 0) (def total (+ total n)) (def n (- n 1))) total)) (sum 10)", Expected: 55},
+	{Name: "while error", Source: "(while true (len 1))", Error: true},
+
+	// variadic lambdas
+	{Name: "rest parameter", Source: "((lambda (a & rest) (list a rest)) 1 2 3)", Expected: []interface{}{1, []interface{}{2, 3}}},
+	{Name: "empty rest parameter", Source: "((lambda (a & rest) rest) 1)", Expected: []interface{}{}},
+	{Name: "missing fixed argument", Source: "((lambda (a b & rest) a) 1)", Error: true},
+
+	// lists
+	{Name: "list", Source: "(list 1 (list 2 3) 4)", Expected: []interface{}{1, []interface{}{2, 3}, 4}},
+	{Name: "quoted list", Source: "'(1 2 3)", Expected: []interface{}{1, 2, 3}},
+	{Name: "nested quoted list", Source: "'(1 '(2 3))", Expected: []interface{}{1, []interface{}{2, 3}}},
+	{Name: "quoted names", Source: "(def a 5) (symbol? (first '(a 2)))", Expected: true},
+	{Name: "quoted symbol", Source: "(= (first '(a b)) 'a)", Expected: true},
+	{Name: "nested quoted data", Source: "(= '(a (b c) 3) (list 'a (list 'b 'c) 3))", Expected: true},
+	{Name: "quoted list with wrong closer", Source: "'(a })", Error: true},
+	{Name: "quoted dict with wrong closer", Source: "'{a )}", Error: true},
+	{Name: "first", Source: "(first (list 1 2))", Expected: 1},
+	{Name: "first of empty list", Source: "(first (list))", Expected: nil},
+	{Name: "rest", Source: "(rest (list 1 2 3))", Expected: []interface{}{2, 3}},
+	{Name: "rest of empty list", Source: "(rest (list))", Expected: nil},
+	{Name: "len", Source: "(len (list 1 2 3))", Expected: 3},
+	{Name: "push", Source: "(def l (list 1)) (push l 2) l", Expected: []interface{}{1}},
+	{Name: "push!", Source: "(def l (list 1)) (push! l 2) l", Expected: []interface{}{1, 2}},
+	{Name: "pop!", Source: "(def l (list 1 2)) (pop! l)", Expected: 2},
+	{Name: "push! of quoted list", Source: "(push! '(1 2) 3)", Error: true},
+	{Name: "slice", Source: "(slice (list 1 2 3) 1)", Expected: []interface{}{2, 3}},
+	{Name: "len of number", Source: "(len 1)", Error: true},
+
+	// macros
+	{Name: "macro", Source: "(defmacro square (x) (list '* x x)) (square (+ 1 2))", Expected: 9},
+	{Name: "macro arguments", Source: "(defmacro my-unless (test body) (list 'if test null body)) (my-unless true (len 1))", Expected: nil},
+	{Name: "recursive macro", Source: `(defmacro count-down (n) (if (= n 0) "done" (list 'count-down (- n 1)))) (count-down 3)`, Expected: "done"},
+	{Name: "endless macro", Source: "(defmacro forever () (list 'forever)) (forever)", Error: true},
+
+	// strings, dicts and other values
+	{Name: "str", Source: `(str 1.5 "a" (list 1) true)`, Expected: "1.5a(1)true"},
+	{Name: "string length", Source: `(len "hello")`, Expected: 5},
+	{Name: "dict", Source: `(get (set (dict) "a" 1) "a")`, Expected: 1},
+	{Name: "dict literal", Source: `(get (dict "a" 1 "b" 2) "b")`, Expected: 2},
+	{Name: "missing key", Source: `(get (dict) "a")`, Expected: nil},
+	{Name: "list as key", Source: `(set (dict) (list) 1)`, Error: true},
+	{Name: "bytes", Source: `(bytes->string (slice (bytes "hello") 1 3))`, Expected: "el"},
+	{Name: "symbols", Source: `(= (symbol "a") (symbol "a"))`, Expected: true},
+	{Name: "keywords", Source: `(= :a :a)`, Expected: true},
+	{Name: "keyword keys", Source: `(get {:name "ada"} :name)`, Expected: "ada"},
+	{Name: "print", Source: "(print)", Expected: nil},
+	{Name: "comments", Source: "; add\n(+ 1 ; one\n 2) ; two", Expected: 3},
+
+	// errors as values
+	{Name: "error?", Source: "(error? (len 1))", Expected: true},
+	{Name: "error? of value", Source: "(error? 1)", Expected: false},
+	{Name: "error-kind", Source: "(error-kind (/ 1 0))", Expected: "ValueError"},
+	{Name: "error-message", Source: `(error-message (error "failed"))`, Expected: "failed"},
+	{Name: "error", Source: `(error "failed")`, Error: true},
+	{Name: "error in list", Source: "(list 1 (len 1))", Error: true},
+	{Name: "error in lambda body", Source: "(def f (lambda () (/ 1 0) 5)) (f)", Error: true},
+	{Name: "error passed to builtin in lambda body", Source: "(def f (lambda () (print (len 1)) 7)) (f)", Error: true},
+	{Name: "error in do", Source: "((lambda () (do (len 1) 2)))", Error: true},
+	{Name: "error in while body", Source: "(def f (lambda () (def i 0) (while (< i 2) (len 1) (def i (+ i 1))) i)) (f)", Error: true},
+	{Name: "error? of lambda with error in body", Source: "(def f (lambda () (len 1) 5)) (error? (f))", Expected: true},
+
+	// known differences
+	{
+		Name:       "forward reference",
+		Source:     "(def f (lambda () (g))) (def g (lambda () 1)) (f)",
+		Expected:   1,
+		Divergence: "the compiler resolves globals when the lambda is compiled, so g is undefined",
+	},
+}
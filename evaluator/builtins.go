@@ -7,28 +7,41 @@ import (
 
 // A map of all the built in functions in the interpreter
 var builtins = map[string]*object.FunctionObject{
-	"+":     object.GetBuiltinByName("+"),
-	"*":     object.GetBuiltinByName("*"),
-	"-":     object.GetBuiltinByName("-"),
-	"/":     object.GetBuiltinByName("/"),
-	"rem":   object.GetBuiltinByName("rem"),
-	"=":     object.GetBuiltinByName("="),
-	"<":     object.GetBuiltinByName("<"),
-	">":     object.GetBuiltinByName(">"),
-	"not":   object.GetBuiltinByName("not"),
-	"and":   object.GetBuiltinByName("and"),
-	"or":    object.GetBuiltinByName("or"),
-	"list":  object.GetBuiltinByName("list"),
-	"dict":  object.GetBuiltinByName("dict"),
-	"first": object.GetBuiltinByName("first"),
-	"rest":  object.GetBuiltinByName("rest"),
-	"last":  object.GetBuiltinByName("last"),
-	"len":   object.GetBuiltinByName("len"),
-	"push":  object.GetBuiltinByName("push"),
-	"str":   object.GetBuiltinByName("str"),
-	"print": object.GetBuiltinByName("print"),
-	"get":   object.GetBuiltinByName("get"),
-	"set":   object.GetBuiltinByName("set"),
+	"+":             object.GetBuiltinByName("+"),
+	"*":             object.GetBuiltinByName("*"),
+	"-":             object.GetBuiltinByName("-"),
+	"/":             object.GetBuiltinByName("/"),
+	"rem":           object.GetBuiltinByName("rem"),
+	"=":             object.GetBuiltinByName("="),
+	"<":             object.GetBuiltinByName("<"),
+	">":             object.GetBuiltinByName(">"),
+	"not":           object.GetBuiltinByName("not"),
+	"and":           object.GetBuiltinByName("and"),
+	"or":            object.GetBuiltinByName("or"),
+	"list":          object.GetBuiltinByName("list"),
+	"dict":          object.GetBuiltinByName("dict"),
+	"first":         object.GetBuiltinByName("first"),
+	"rest":          object.GetBuiltinByName("rest"),
+	"last":          object.GetBuiltinByName("last"),
+	"len":           object.GetBuiltinByName("len"),
+	"push":          object.GetBuiltinByName("push"),
+	"str":           object.GetBuiltinByName("str"),
+	"print":         object.GetBuiltinByName("print"),
+	"get":           object.GetBuiltinByName("get"),
+	"set":           object.GetBuiltinByName("set"),
+	"error?":        object.GetBuiltinByName("error?"),
+	"random":        object.GetBuiltinByName("random"),
+	"symbol":        object.GetBuiltinByName("symbol"),
+	"symbol?":       object.GetBuiltinByName("symbol?"),
+	"bytes":         object.GetBuiltinByName("bytes"),
+	"bytes->string": object.GetBuiltinByName("bytes->string"),
+	"string->bytes": object.GetBuiltinByName("string->bytes"),
+	"slice":         object.GetBuiltinByName("slice"),
+	"error":         object.GetBuiltinByName("error"),
+	"error-message": object.GetBuiltinByName("error-message"),
+	"error-kind":    object.GetBuiltinByName("error-kind"),
+	"push!":         object.GetBuiltinByName("push!"),
+	"pop!":          object.GetBuiltinByName("pop!"),
 }
 
 func evalTruthy(obj object.Object) bool {
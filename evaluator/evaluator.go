@@ -2,6 +2,7 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"lisp/ast"
 	"lisp/object"
@@ -13,14 +14,40 @@ var (
 	NULL  = object.NULL
 )
 
+// The message of the ErrorObject returned when evaluation is cancelled.
+const CancelledMessage = "evaluation cancelled"
+
 // Recursively evaluate a given expression and return a final value.
 func Evaluate(e ast.Expression, env *object.Environment) object.Object {
+	return evaluate(context.Background(), e, env)
+}
+
+// Evaluate the expression in the same way as Evaluate, returning an
+// ErrorObject with the CancelledMessage if the context is cancelled before
+// evaluation completes.
+//
+// The context is checked each time a lambda is called, so evaluation that
+// doesn't call any lambdas runs to completion.
+func EvaluateContext(ctx context.Context, e ast.Expression, env *object.Environment) object.Object {
+	return evaluate(ctx, e, env)
+}
+
+// The key of the Streams stored in a context by WithStreams.
+type streamsKey struct{}
+
+// Return a copy of the context holding the Streams, which are used by the
+// builtins that read and write when evaluating with the returned context.
+func WithStreams(ctx context.Context, streams *object.Streams) context.Context {
+	return context.WithValue(ctx, streamsKey{}, streams)
+}
+
+func evaluate(ctx context.Context, e ast.Expression, env *object.Environment) object.Object {
 	switch e := e.(type) {
 	case *ast.Program:
 		var result object.Object
 
 		for _, expression := range e.Expressions {
-			result = Evaluate(expression, env)
+			result = evaluate(ctx, expression, env)
 
 			if result.Type() == object.ERROR_OBJ {
 				return result
@@ -29,65 +56,139 @@ func Evaluate(e ast.Expression, env *object.Environment) object.Object {
 
 		return result
 	case *ast.FloatLiteral:
-		return &object.Number{Value: e.Value}
+		return object.NewNumber(e.Value)
 	case *ast.StringLiteral:
-		return &object.String{Value: e.Value}
+		return object.NewString(e.Value)
 	case *ast.Identifier:
 		return evalIdentifier(e, env)
+	case *ast.SymbolLiteral:
+		return &object.Symbol{Name: e.Token.Literal}
+	case *ast.KeywordLiteral:
+		return &object.Keyword{Name: e.Token.Literal}
 	case *ast.SExpression:
-		return evaluateSExpression(e, env)
+		return evaluateSExpression(ctx, e, env)
 	default:
 		return NULL
 	}
 }
 
 // Recursively evaluate an SExpression and return the resulting object.
-func evaluateSExpression(e *ast.SExpression, env *object.Environment) object.Object {
+func evaluateSExpression(ctx context.Context, e *ast.SExpression, env *object.Environment) object.Object {
 	if e.Fn == nil {
 		return &object.List{}
 	}
 
+	// Quoted lists of literals are constants, in the same way as when they're
+	// compiled, so that push! and pop! can't change them with either engine.
+	if e.IsQuotedLiteral() {
+		values := make([]object.Object, len(e.Args))
+
+		for i, arg := range e.Args {
+			if sExpr, ok := arg.(*ast.SExpression); ok && sExpr.Fn == nil {
+				values[i] = object.NewConstantList(nil)
+			} else {
+				values[i] = evaluate(ctx, arg, env)
+			}
+		}
+
+		return object.NewConstantList(values)
+	}
+
 	// This switch covers evaluating special functions that break the standard
 	// function construction.
 	switch e.Fn.String() {
 	case "if":
-		return evaluateIfExpression(e, env)
+		return evaluateIfExpression(ctx, e, env)
 	case "def":
-		return evaluateDefExpression(e, env)
+		return evaluateDefExpression(ctx, e, env)
 	case "lambda":
 		return evaluateLambdaExpression(e, env)
+	case "let":
+		return evaluateLetExpression(ctx, e, env)
+	case "cond":
+		return evaluateCondExpression(ctx, e, env)
+	case "when", "unless":
+		return evaluateWhenExpression(ctx, e, env)
+	case "do":
+		return evaluateDoExpression(ctx, e, env)
+	case "while":
+		return evaluateWhileExpression(ctx, e, env)
+	case "defmacro":
+		return evaluateDefmacroExpression(e, env)
 	}
 
-	fnExpression := Evaluate(e.Fn, env)
+	if macro, ok := lookupMacro(e, env); ok {
+		expansion, err := expandMacroCall(ctx, macro, e, env)
+
+		if err != nil {
+			return err
+		}
+
+		return evaluate(ctx, expansion, env)
+	}
+
+	fn, args, err := evaluateCall(ctx, e, env)
+
+	if err != nil {
+		return err
+	}
+
+	return Apply(ctx, e.Fn.String(), fn, args...)
+}
+
+// Evaluate the function and arguments of a call, returning the first error
+// found instead, unless the function is a builtin that handles errors.
+func evaluateCall(ctx context.Context, e *ast.SExpression, env *object.Environment) (object.Object, []object.Object, object.Object) {
+	fnExpression := evaluate(ctx, e.Fn, env)
+
+	if fnExpression.Type() == object.ERROR_OBJ {
+		return nil, nil, fnExpression
+	}
+
+	builtin, isBuiltin := fnExpression.(*object.FunctionObject)
+	handlesErrors := isBuiltin && builtin.HandlesErrors()
 
 	args := []object.Object{}
 	for _, arg := range e.Args {
-		obj := Evaluate(arg, env)
+		obj := evaluate(ctx, arg, env)
 
-		if obj.Type() == object.ERROR_OBJ {
-			return obj
+		if obj.Type() == object.ERROR_OBJ && !handlesErrors {
+			return nil, nil, obj
 		}
 
 		args = append(args, obj)
 	}
 
-	switch fnExpression := fnExpression.(type) {
+	return fnExpression, args, nil
+}
+
+// Call the function, a builtin or a lambda, with the provided arguments that
+// have already been evaluated. The name is the name the function was called
+// by, used in errors. An error is returned if fn isn't a function.
+func Apply(ctx context.Context, name string, fn object.Object, args ...object.Object) object.Object {
+	switch fn := fn.(type) {
 	case *object.FunctionObject:
-		return fnExpression.Fn(args...)
+		if streams, ok := ctx.Value(streamsKey{}).(*object.Streams); ok {
+			fn = fn.WithStreams(streams)
+		}
+
+		return fn.Fn(args...)
 	case *object.LambdaObject:
-		return evalLambda(e.Fn.String(), fnExpression, args...)
+		return evalLambda(ctx, name, fn, args...)
 	default:
-		err := fmt.Sprintf("%s is not a function", fnExpression.Inspect())
+		err := fmt.Sprintf("%s is not a function", fn.Inspect())
 		return &object.ErrorObject{
-			Error: err,
+			Kind:    object.TYPE_ERROR,
+			Message: err,
 		}
 	}
 }
 
 // Return the object associated with the given identifier.
 //
-// Starts by checking reserved keywords (booleans, builtins),
-// if not found then retrieves the object from the environment.
+// Starts by checking reserved keywords (booleans), then the environment, so
+// that a definition can shadow a builtin in the same way as with the VM, and
+// finally the builtins.
 func evalIdentifier(i *ast.Identifier, env *object.Environment) object.Object {
 	if i.String() == "true" {
 		return TRUE
@@ -101,6 +202,18 @@ func evalIdentifier(i *ast.Identifier, env *object.Environment) object.Object {
 		return NULL
 	}
 
+	if ast.SpecialForms[i.String()] {
+		return object.SpecialFormError(i.String(), "value")
+	}
+
+	if obj, ok := env.Lookup(i.String()); ok {
+		if _, ok := obj.(*object.Macro); ok {
+			return object.MacroValueError(i.String())
+		}
+
+		return obj
+	}
+
 	fn, ok := builtins[i.String()]
 
 	if ok {
@@ -116,60 +229,364 @@ Evaluate the execution of a lambda function.
  1. Evaluate each argument passed to the lambda and add them to a new environment.
  2. Evaluate all but the last expression in the lambda, using the new environment.
  3. Evaluate the final expression and return its result.
+
+When the final expression calls another lambda, possibly from a branch of an if
+expression, the call replaces the current one rather than being evaluated
+recursively. This lets loops written as tail recursion run without growing the
+Go stack.
 */
-func evalLambda(lambdaName string, lambda *object.LambdaObject, args ...object.Object) object.Object {
-	if len(lambda.Args) != len(args) {
-		err := fmt.Sprintf("incorrect number of args for %s: expected=%d got=%d",
-			lambdaName, len(lambda.Args), len(args))
-		return &object.ErrorObject{Error: err}
+func evalLambda(ctx context.Context, lambdaName string, lambda *object.LambdaObject, args ...object.Object) object.Object {
+call:
+	for {
+		select {
+		case <-ctx.Done():
+			return &object.ErrorObject{Kind: object.CANCELLED_ERROR, Message: CancelledMessage}
+		default:
+		}
+
+		fixed := len(lambda.Args)
+
+		if lambda.Variadic {
+			fixed--
+		}
+
+		if lambda.Variadic && len(args) < fixed {
+			err := fmt.Sprintf("incorrect number of args for %s: expected=at least %d got=%d",
+				lambdaName, fixed, len(args))
+			return &object.ErrorObject{Kind: object.ARITY_ERROR, Message: err}
+		}
+
+		if !lambda.Variadic && len(args) != fixed {
+			err := fmt.Sprintf("incorrect number of args for %s: expected=%d got=%d",
+				lambdaName, fixed, len(args))
+			return &object.ErrorObject{Kind: object.ARITY_ERROR, Message: err}
+		}
+
+		lambdaEnv := object.NewEnvironment(lambda.Env)
+
+		for i, arg := range args[:fixed] {
+			lambdaEnv.Set(
+				lambda.Args[i],
+				arg,
+			)
+		}
+
+		// The rest parameter holds the arguments after the fixed ones.
+		if lambda.Variadic {
+			rest := append([]object.Object{}, args[fixed:]...)
+			lambdaEnv.Set(lambda.Args[fixed], &object.List{Values: rest})
+		}
+
+		lastIndex := len(lambda.Body) - 1
+
+		for _, exp := range lambda.Body[:lastIndex] {
+			obj := evaluate(ctx, exp, lambdaEnv)
+
+			if obj.Type() == object.ERROR_OBJ {
+				return obj
+			}
+		}
+
+		tail := lambda.Body[lastIndex]
+
+		for {
+			sExpr, ok := tail.(*ast.SExpression)
+
+			if !ok || sExpr.Fn == nil || sExpr.IsQuotedLiteral() {
+				return evaluate(ctx, tail, lambdaEnv)
+			}
+
+			switch sExpr.Fn.String() {
+			case "if":
+				branch, result := selectIfBranch(ctx, sExpr, lambdaEnv)
+
+				if branch == nil {
+					return result
+				}
+
+				tail = branch
+				continue
+			case "cond":
+				branch, result := selectCondBranch(ctx, sExpr, lambdaEnv)
+
+				if branch == nil {
+					return result
+				}
+
+				tail = branch
+				continue
+			case "when", "unless":
+				body, result := selectWhenBody(ctx, sExpr, lambdaEnv)
+
+				if result != nil {
+					return result
+				}
+
+				last, result := evaluateLeading(ctx, body, lambdaEnv)
+
+				if last == nil {
+					return result
+				}
+
+				tail = last
+				continue
+			case "do":
+				last, result := evaluateLeading(ctx, sExpr.Args, lambdaEnv)
+
+				if last == nil {
+					return result
+				}
+
+				tail = last
+				continue
+			case "let":
+				letEnv, err := bindLet(ctx, sExpr, lambdaEnv)
+
+				if err != nil {
+					return err
+				}
+
+				last, result := evaluateLeading(ctx, sExpr.Args[1:], letEnv)
+
+				if last == nil {
+					return result
+				}
+
+				tail, lambdaEnv = last, letEnv
+				continue
+			}
+
+			if ast.SpecialForms[sExpr.Fn.String()] {
+				return evaluate(ctx, tail, lambdaEnv)
+			}
+
+			// The expansion of a macro is in tail position in its place.
+			if macro, ok := lookupMacro(sExpr, lambdaEnv); ok {
+				expansion, err := expandMacroCall(ctx, macro, sExpr, lambdaEnv)
+
+				if err != nil {
+					return err
+				}
+
+				tail = expansion
+				continue
+			}
+
+			fn, fnArgs, err := evaluateCall(ctx, sExpr, lambdaEnv)
+
+			if err != nil {
+				return err
+			}
+
+			next, ok := fn.(*object.LambdaObject)
+
+			if !ok {
+				return Apply(ctx, sExpr.Fn.String(), fn, fnArgs...)
+			}
+
+			lambdaName, lambda, args = sExpr.Fn.String(), next, fnArgs
+			continue call
+		}
 	}
+}
 
-	lambdaEnv := object.NewEnvironment(lambda.Env)
+// Evaluate the condition of an if expression, then conditionally
+// evaluate either the consequence or alternative.
+func evaluateIfExpression(ctx context.Context, e *ast.SExpression, env *object.Environment) object.Object {
+	branch, result := selectIfBranch(ctx, e, env)
 
-	for i, arg := range args {
-		lambdaEnv.Set(
-			lambda.Args[i],
-			arg,
-		)
+	if branch == nil {
+		return result
 	}
 
-	lastIndex := len(lambda.Body) - 1
+	return evaluate(ctx, branch, env)
+}
 
-	for _, exp := range lambda.Body[:lastIndex] {
-		obj := Evaluate(exp, lambdaEnv)
+// Evaluate the condition of an if expression and return the branch to
+// evaluate next. If there's no branch to evaluate, because the condition is an
+// error or there's no alternative, the result of the if expression is
+// returned instead.
+func selectIfBranch(ctx context.Context, e *ast.SExpression, env *object.Environment) (ast.Expression, object.Object) {
+	if len(e.Args) < 2 || len(e.Args) > 3 {
+		return nil, object.WrongNumOfArgsError("if", "2 or 3", len(e.Args))
+	}
+
+	obj := evaluate(ctx, e.Args[0], env)
+
+	if obj.Type() == object.ERROR_OBJ {
+		return nil, obj
+	}
+
+	if evalTruthy(obj) {
+		return e.Args[1], nil
+	}
+
+	if len(e.Args) == 3 {
+		return e.Args[2], nil
+	}
+
+	return nil, NULL
+}
+
+// Evaluate the tests of a cond expression in order, then evaluate the
+// expression of the first clause whose test is true.
+func evaluateCondExpression(ctx context.Context, e *ast.SExpression, env *object.Environment) object.Object {
+	branch, result := selectCondBranch(ctx, e, env)
+
+	if branch == nil {
+		return result
+	}
+
+	return evaluate(ctx, branch, env)
+}
+
+// Evaluate the tests of a cond expression and return the expression of the
+// first clause that matches, with an else clause always matching. If there's
+// no expression to evaluate, because a test is an error or no clause matches,
+// the result of the cond expression is returned instead.
+func selectCondBranch(ctx context.Context, e *ast.SExpression, env *object.Environment) (ast.Expression, object.Object) {
+	clauses, err := ast.ParseClauses(e.Args)
+
+	if err != nil {
+		return nil, &object.ErrorObject{Kind: object.SYNTAX_ERROR, Message: err.Error()}
+	}
+
+	for _, clause := range clauses {
+		if clause.IsDefault() {
+			return clause.Body, nil
+		}
+
+		obj := evaluate(ctx, clause.Test, env)
 
 		if obj.Type() == object.ERROR_OBJ {
-			return obj
+			return nil, obj
+		}
+
+		if evalTruthy(obj) {
+			return clause.Body, nil
 		}
 	}
 
-	return Evaluate(lambda.Body[lastIndex], lambdaEnv)
+	return nil, NULL
 }
 
-// Evaluate the condition of an if expression, then conditionally
-// evaluate either the consequence or alternative.
-func evaluateIfExpression(e *ast.SExpression, env *object.Environment) object.Object {
-	if len(e.Args) < 2 || len(e.Args) > 3 {
-		return object.WrongNumOfArgsError("if", "2 or 3", len(e.Args))
+// Evaluate the test of a when or unless expression, then evaluate the body
+// if it's true, or false for unless, returning the value of its last
+// expression.
+func evaluateWhenExpression(ctx context.Context, e *ast.SExpression, env *object.Environment) object.Object {
+	body, result := selectWhenBody(ctx, e, env)
+
+	if result != nil {
+		return result
 	}
 
-	obj := Evaluate(e.Args[0], env)
+	for _, exp := range body {
+		result = evaluate(ctx, exp, env)
+
+		if result.Type() == object.ERROR_OBJ {
+			return result
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+
+	return result
+}
+
+// Evaluate the test of a when or unless expression and return the body to
+// evaluate next. If the body isn't evaluated, because the test is an error or
+// doesn't match, the result of the expression is returned instead.
+func selectWhenBody(ctx context.Context, e *ast.SExpression, env *object.Environment) ([]ast.Expression, object.Object) {
+	name := e.Fn.String()
+
+	if len(e.Args) < 1 {
+		return nil, object.WrongNumOfArgsError(name, "at least 1", len(e.Args))
+	}
+
+	obj := evaluate(ctx, e.Args[0], env)
 
 	if obj.Type() == object.ERROR_OBJ {
-		return obj
+		return nil, obj
+	}
+
+	if evalTruthy(obj) == (name == "unless") {
+		return nil, NULL
 	}
 
-	condition := evalTruthy(obj)
+	return e.Args[1:], nil
+}
+
+// Evaluate each expression of a do expression in order, in the current
+// environment, returning the value of the last, or null if there are none.
+func evaluateDoExpression(ctx context.Context, e *ast.SExpression, env *object.Environment) object.Object {
+	var result object.Object = NULL
+
+	for _, exp := range e.Args {
+		result = evaluate(ctx, exp, env)
 
-	if condition {
-		return Evaluate(e.Args[1], env)
+		if result.Type() == object.ERROR_OBJ {
+			return result
+		}
 	}
 
-	if len(e.Args) == 3 {
-		return Evaluate(e.Args[2], env)
+	return result
+}
+
+// Evaluate the body of a while expression in the current environment for as
+// long as its test is true. The result is null once the test is false, or the
+// first error from the test or body.
+func evaluateWhileExpression(ctx context.Context, e *ast.SExpression, env *object.Environment) object.Object {
+	if len(e.Args) < 1 {
+		return object.WrongNumOfArgsError("while", "at least 1", len(e.Args))
 	}
 
-	return NULL
+	for {
+		select {
+		case <-ctx.Done():
+			return &object.ErrorObject{Kind: object.CANCELLED_ERROR, Message: CancelledMessage}
+		default:
+		}
+
+		obj := evaluate(ctx, e.Args[0], env)
+
+		if obj.Type() == object.ERROR_OBJ {
+			return obj
+		}
+
+		if !evalTruthy(obj) {
+			return NULL
+		}
+
+		for _, exp := range e.Args[1:] {
+			obj := evaluate(ctx, exp, env)
+
+			if obj.Type() == object.ERROR_OBJ {
+				return obj
+			}
+		}
+	}
+}
+
+// Evaluate each expression of a body except the last, which is returned so
+// that it can be evaluated in tail position. If there's no expression left to
+// evaluate, because the body is empty or one is an error, the result of the
+// body is returned instead.
+func evaluateLeading(ctx context.Context, body []ast.Expression, env *object.Environment) (ast.Expression, object.Object) {
+	if len(body) == 0 {
+		return nil, NULL
+	}
+
+	for _, exp := range body[:len(body)-1] {
+		obj := evaluate(ctx, exp, env)
+
+		if obj.Type() == object.ERROR_OBJ {
+			return nil, obj
+		}
+	}
+
+	return body[len(body)-1], nil
 }
 
 // Add the evaluated expression to env, with the key being the provided identifier.
@@ -178,7 +595,7 @@ func evaluateIfExpression(e *ast.SExpression, env *object.Environment) object.Ob
 // identifier object and expr is any valid expression.
 //
 // Otherwise return error object.
-func evaluateDefExpression(e *ast.SExpression, env *object.Environment) object.Object {
+func evaluateDefExpression(ctx context.Context, e *ast.SExpression, env *object.Environment) object.Object {
 	if len(e.Args) != 2 {
 		return object.WrongNumOfArgsError("def", "2", len(e.Args))
 	}
@@ -187,10 +604,20 @@ func evaluateDefExpression(e *ast.SExpression, env *object.Environment) object.O
 
 	if !ok {
 		err := fmt.Sprintf("cannot assign to non-identifier %s", e.Args[0].String())
-		return &object.ErrorObject{Error: err}
+		return &object.ErrorObject{Kind: object.SYNTAX_ERROR, Message: err}
 	}
 
-	val := Evaluate(e.Args[1], env)
+	if ast.SpecialForms[ident.String()] {
+		return object.SpecialFormError(ident.String(), "variable")
+	}
+
+	// A lambda is given the name it's defined with, in the same way as the
+	// compiler names them.
+	if sExpr, ok := e.Args[1].(*ast.SExpression); ok {
+		sExpr.Name = ident.String()
+	}
+
+	val := evaluate(ctx, e.Args[1], env)
 
 	if val.Type() != object.ERROR_OBJ {
 		env.Set(ident.String(), val)
@@ -199,6 +626,64 @@ func evaluateDefExpression(e *ast.SExpression, env *object.Environment) object.O
 	return val
 }
 
+// Evaluate a let expression of the form (let ((name value) ...) body...),
+// evaluating the body in a new environment holding the bindings, and
+// returning the value of its last expression, or null if it has none.
+func evaluateLetExpression(ctx context.Context, e *ast.SExpression, env *object.Environment) object.Object {
+	letEnv, err := bindLet(ctx, e, env)
+
+	if err != nil {
+		return err
+	}
+
+	var result object.Object = NULL
+
+	for _, exp := range e.Args[1:] {
+		result = evaluate(ctx, exp, letEnv)
+
+		if result.Type() == object.ERROR_OBJ {
+			return result
+		}
+	}
+
+	return result
+}
+
+// Create the environment the body of a let expression is evaluated in,
+// enclosed by env. The bindings are evaluated in order, each in an
+// environment holding the bindings before it, so that a lambda bound by let
+// can't see the bindings after it, in the same way as when it's compiled.
+func bindLet(ctx context.Context, e *ast.SExpression, env *object.Environment) (*object.Environment, object.Object) {
+	if len(e.Args) < 1 {
+		return nil, object.WrongNumOfArgsError("let", "at least 1", len(e.Args))
+	}
+
+	bindings, err := ast.ParseBindings(e.Args[0])
+
+	if err != nil {
+		return nil, &object.ErrorObject{Kind: object.SYNTAX_ERROR, Message: err.Error()}
+	}
+
+	for _, b := range bindings {
+		if ast.SpecialForms[b.Name.String()] {
+			return nil, object.SpecialFormError(b.Name.String(), "variable")
+		}
+
+		val := evaluate(ctx, b.Value, env)
+
+		if val.Type() == object.ERROR_OBJ {
+			return nil, val
+		}
+
+		env = object.NewEnvironment(env)
+		env.Set(b.Name.String(), val)
+	}
+
+	// The body has an environment of its own, so that what it defines is
+	// discarded afterwards even when there are no bindings.
+	return object.NewEnvironment(env), nil
+}
+
 /*
 Evaluate an expression that defines a lambda.
 
@@ -218,7 +703,7 @@ func evaluateLambdaExpression(e *ast.SExpression, env *object.Environment) objec
 
 	if !ok {
 		err := fmt.Sprintf("lambda requires list of args, got %s", args[0].String())
-		return &object.ErrorObject{Error: err}
+		return &object.ErrorObject{Kind: object.SYNTAX_ERROR, Message: err}
 	}
 
 	lambdaArgs := []string{}
@@ -228,7 +713,11 @@ func evaluateLambdaExpression(e *ast.SExpression, env *object.Environment) objec
 
 		if !ok {
 			err := fmt.Sprintf("lambda function must be identifier, got %s", argsList.Fn.String())
-			return &object.ErrorObject{Error: err}
+			return &object.ErrorObject{Kind: object.SYNTAX_ERROR, Message: err}
+		}
+
+		if ast.SpecialForms[arg.String()] {
+			return object.SpecialFormError(arg.String(), "variable")
 		}
 
 		lambdaArgs = append(lambdaArgs, arg.String())
@@ -239,15 +728,27 @@ func evaluateLambdaExpression(e *ast.SExpression, env *object.Environment) objec
 
 		if !ok {
 			err := fmt.Sprintf("lambda args must be identifiers, got %s", arg)
-			return &object.ErrorObject{Error: err}
+			return &object.ErrorObject{Kind: object.SYNTAX_ERROR, Message: err}
+		}
+
+		if ast.SpecialForms[arg.String()] {
+			return object.SpecialFormError(arg.String(), "variable")
 		}
 
 		lambdaArgs = append(lambdaArgs, arg.String())
 	}
 
+	lambdaArgs, variadic, err := ast.ParseRestParameter(lambdaArgs)
+
+	if err != nil {
+		return &object.ErrorObject{Kind: object.SYNTAX_ERROR, Message: err.Error()}
+	}
+
 	return &object.LambdaObject{
-		Args: lambdaArgs,
-		Env:  env,
-		Body: args[1:],
+		Args:     lambdaArgs,
+		Variadic: variadic,
+		Env:      env,
+		Body:     args[1:],
+		Name:     e.Name,
 	}
 }
@@ -1,10 +1,12 @@
 package evaluator
 
 import (
+	"context"
 	"lisp/lexer"
 	"lisp/object"
 	"lisp/parser"
 	"testing"
+	"time"
 )
 
 type evaluatorTest struct {
@@ -168,6 +170,22 @@ func TestEvaluateBooleanLiteral(t *testing.T) {
 			input:    "(= 1 1)",
 			expected: true,
 		},
+		{
+			input:    "(= (list 1 (list 2)) (list 1.0 '(2)))",
+			expected: true,
+		},
+		{
+			input:    "(= (list 1 2) (list 2 1))",
+			expected: false,
+		},
+		{
+			input:    `(= (set (dict) "a" 1) (set (dict) "a" 1))`,
+			expected: true,
+		},
+		{
+			input:    "(= (if false 1) (if false 2))",
+			expected: true,
+		},
 		{
 			input:    "(not false)",
 			expected: true,
@@ -321,6 +339,447 @@ func TestDefineExpression(t *testing.T) {
 	}
 }
 
+func TestSpecialFormNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(def if 5)", "'if' is a special form and cannot be used as a variable"},
+		{"((lambda (a def) a) 1 2)", "'def' is a special form and cannot be used as a variable"},
+		{"(lambda (lambda) 1)", "'lambda' is a special form and cannot be used as a variable"},
+		{"if", "'if' is a special form and cannot be used as a value"},
+		{"(list 1 lambda)", "'lambda' is a special form and cannot be used as a value"},
+		{"(def f (lambda () def)) (f)", "'def' is a special form and cannot be used as a value"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		env := object.NewEnvironment(nil)
+
+		result := Evaluate(program, env)
+
+		err, ok := result.(*object.ErrorObject)
+
+		if !ok {
+			t.Fatalf("expected error for %q, got %T(%+v)", tt.input, result, result)
+		}
+
+		if err.Message != tt.expected {
+			t.Errorf("wrong error: want=%q got=%q", tt.expected, err.Message)
+		}
+	}
+}
+
+func TestErrorPredicate(t *testing.T) {
+	tests := []evaluatorTest{
+		{
+			input:    "(error? (len 1))",
+			expected: true,
+		},
+		{
+			input:    `(error? (len "abc"))`,
+			expected: false,
+		},
+		{
+			input:    `(if (error? (get 1 "key")) 0 1)`,
+			expected: float64(0),
+		},
+		{
+			input:    "(error? (+ 1 (len 1)))",
+			expected: true,
+		},
+		{
+			input:    "(def f (lambda () (len 1) 5)) (error? (f))",
+			expected: true,
+		},
+		{
+			input:    "(def f (lambda () (print (len 1)) 7)) (error? (f))",
+			expected: true,
+		},
+		{
+			input:    "(def f (lambda (x) (def result (len x)) 7)) (error? (f 1))",
+			expected: true,
+		},
+		{
+			input:    "(error? ((lambda () (do (len 1) 2))))",
+			expected: true,
+		},
+		{
+			input:    "(def f (lambda () (def i 0) (while (< i 2) (len 1) (def i (+ i 1))) i)) (error? (f))",
+			expected: true,
+		},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestSymbols(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(symbol? (symbol "a"))`, expected: true},
+		{input: `(symbol? "a")`, expected: false},
+		{input: `(= (symbol "a") (symbol "a"))`, expected: true},
+		{input: `(= (symbol "a") "a")`, expected: false},
+		{input: `(str (symbol "a") "b")`, expected: "ab", expectedType: "string"},
+		{input: `(get (set (dict) (symbol "a") 1) (symbol "a"))`, expected: float64(1)},
+		{input: `(get (set (dict) (symbol "a") 1) "a")`, expected: nil},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestBytes(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(len (bytes "abc"))`, expected: float64(3)},
+		{input: `(len (bytes 4))`, expected: float64(4)},
+		{input: `(get (bytes "abc") 1)`, expected: float64(98)},
+		{input: `(get (bytes 2) 0)`, expected: float64(0)},
+		{input: `(def b (bytes "abc")) (set b 0 65) (bytes->string b)`, expected: "Abc", expectedType: "string"},
+		{input: `(bytes->string (string->bytes "text"))`, expected: "text", expectedType: "string"},
+		{input: `(bytes->string (slice (bytes "hello") 1 3))`, expected: "el", expectedType: "string"},
+		{input: `(slice "hello" 3)`, expected: "lo", expectedType: "string"},
+		{input: `(len (slice (list 1 2 3) 0 2))`, expected: float64(2)},
+		{input: `(def b (bytes "ab")) (def c (slice b 0)) (set c 0 0) (get b 0)`, expected: float64(97)},
+		{input: `(= (bytes "ab") (string->bytes "ab"))`, expected: true},
+		{input: `(= (bytes "ab") "ab")`, expected: false},
+		{input: `(error? (get (bytes 3) 3))`, expected: true},
+		{input: `(error? (set (bytes 3) -1 0))`, expected: true},
+		{input: `(error? (set (bytes 3) 0 256))`, expected: true},
+		{input: `(error? (slice (bytes 3) 2 1))`, expected: true},
+		{input: `(error? (bytes 1.5))`, expected: true},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestPushInPlace(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(def l (list 1 2)) (push! l 3) (len l)`, expected: float64(3)},
+		{input: `(def l (list 1 2)) (pop! l)`, expected: float64(2)},
+		{input: `(def l (list 1 2)) (pop! l) (len l)`, expected: float64(1)},
+		{input: `(pop! (list))`, expected: nil},
+		{input: `(def l (list 1 2 3)) (def r (rest l)) (push! l 4) (len r)`, expected: float64(2)},
+		{input: `(def l (list 1 2 3)) (def r (rest l)) (pop! l) (push! l 9) (first (rest r))`, expected: float64(3)},
+		{input: `(def l (list 1)) (def m (push l 2)) (push! l 3) (first (rest m))`, expected: float64(2)},
+		{input: `(error-kind (push! '(1 2) 3))`, expected: "ValueError", expectedType: "string"},
+		{input: `(error-kind (pop! '(1 2)))`, expected: "ValueError", expectedType: "string"},
+		{input: `(def r (rest '(1 2))) (push! r 3) (len r)`, expected: float64(2)},
+		{input: `(error? (push! 1 2))`, expected: true},
+	}
+
+	runEvalTests(t, tests)
+}
+
+// Ensure lambdas calling lambdas in tail position don't grow the Go stack.
+func TestTailCalls(t *testing.T) {
+	tests := []evaluatorTest{
+		{
+			input:    `(def count (lambda (n) (if (= n 0) 0 (count (- n 1))))) (count 200000)`,
+			expected: float64(0),
+		},
+		{
+			input:    `(def sum (lambda (n acc) (if (= n 0) acc (sum (- n 1) (+ acc n))))) (sum 100000 0)`,
+			expected: float64(5000050000),
+		},
+		{
+			input: `
+            (def even? (lambda (n) (if (= n 0) true (odd? (- n 1)))))
+            (def odd? (lambda (n) (if (= n 0) false (even? (- n 1)))))
+            (even? 100001)
+            `,
+			expected: false,
+		},
+		{
+			input:        `(def f (lambda (n) (if (= n 0) (len 1) (f (- n 1))))) (error-kind (f 10000))`,
+			expected:     "TypeError",
+			expectedType: "string",
+		},
+		{
+			input:        `(def f (lambda (n) (if (< n 3) (str n) (f (- n 1))))) (f 10)`,
+			expected:     "2",
+			expectedType: "string",
+		},
+		{
+			input:    `(def f (lambda (n) (if (= n 0) (lambda () 1) (f (- n 1))))) ((f 3))`,
+			expected: float64(1),
+		},
+		{
+			input:    `(def f (lambda (n) (if (= n 1) 1))) (f 0)`,
+			expected: nil,
+		},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestLetExpression(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(let ((x 1) (y 2)) (+ x y))`, expected: float64(3)},
+		{input: `(let ((x 1) (y (+ x 1))) y)`, expected: float64(2)},
+		{input: `(let () 5)`, expected: float64(5)},
+		{input: `(let ((x 1)))`, expected: nil},
+		{input: `(let ((x 1)) (def y 2) (+ x y))`, expected: float64(3)},
+		{input: `(def x 5) (let ((x 1)) x) x`, expected: float64(5)},
+		{input: `(def x 5) (let ((x (+ x 1))) x)`, expected: float64(6)},
+		{input: `(let ((x 1)) (def y 2)) y`, expected: "No such item: y", expectedType: "error"},
+		{input: `(let ((x 1)) x) x`, expected: "No such item: x", expectedType: "error"},
+		{input: `(def f (lambda (x) (let ((x (* x 2))) x) x)) (f 3)`, expected: float64(3)},
+		{input: `((let ((n 10)) (lambda (x) (+ x n))) 5)`, expected: float64(15)},
+		{
+			input:    `(def loop (lambda (n) (let ((m (- n 1))) (if (= m 0) m (loop m))))) (loop 100000)`,
+			expected: float64(0),
+		},
+		{input: `(let ((x (len 1))) x)`, expected: "attempted to call len with unsupported type NUMBER (1)", expectedType: "error"},
+		{input: `(let)`, expected: "attempted to call let with incorrect number of arguments: expected at least 1, got=0", expectedType: "error"},
+		{input: `(let (x 1) x)`, expected: "expected a binding of the form (name value), got x", expectedType: "error"},
+		{input: `(let ((1 2)) 1)`, expected: "binding names must be identifiers, got (1 2)", expectedType: "error"},
+		{input: `(let ((if 2)) 1)`, expected: "'if' is a special form and cannot be used as a variable", expectedType: "error"},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestCondExpression(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(cond (true 1) (else 2))`, expected: float64(1)},
+		{input: `(cond (false 1) (else 2))`, expected: float64(2)},
+		{input: `(cond (false 1) (true 2))`, expected: float64(2)},
+		{input: `(cond ((< 2 1) 1) ((= 1 1) 2) (else 3))`, expected: float64(2)},
+		{input: `(cond (false 1))`, expected: nil},
+		{input: `(cond)`, expected: nil},
+		{input: `(cond (1 "a") (else "b"))`, expected: "a", expectedType: "string"},
+		{input: `(cond (false (len 1)) (else 2))`, expected: float64(2)},
+		{
+			input:    `(def loop (lambda (n) (cond ((= n 0) n) (else (loop (- n 1)))))) (loop 100000)`,
+			expected: float64(0),
+		},
+		{input: `(cond ((len 1) 1) (else 2))`, expected: "attempted to call len with unsupported type NUMBER (1)", expectedType: "error"},
+		{input: `(cond 1)`, expected: "expected a clause of the form (test expr), got 1", expectedType: "error"},
+		{input: `(cond (true 1 2))`, expected: "expected a clause of the form (test expr), got (true 1 2)", expectedType: "error"},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestWhenExpression(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(when true 1 2)`, expected: float64(2)},
+		{input: `(when false 1 2)`, expected: nil},
+		{input: `(when true)`, expected: nil},
+		{input: `(unless false 1 2)`, expected: float64(2)},
+		{input: `(unless true 1 2)`, expected: nil},
+		{input: `(def x 1) (when (= x 1) (def y 2) (+ x y))`, expected: float64(3)},
+		{input: `(def x 1) (unless (= x 1) (def y 2)) x`, expected: float64(1)},
+		{
+			input:    `(def loop (lambda (n) (unless (= n 0) (def m (- n 1)) (loop m)))) (loop 100000)`,
+			expected: nil,
+		},
+		{input: `(when (len 1) 1)`, expected: "attempted to call len with unsupported type NUMBER (1)", expectedType: "error"},
+		{input: `(when true (len 1) 2)`, expected: "attempted to call len with unsupported type NUMBER (1)", expectedType: "error"},
+		{input: `(unless)`, expected: "attempted to call unless with incorrect number of arguments: expected at least 1, got=0", expectedType: "error"},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestDoExpression(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(do 1 2 3)`, expected: float64(3)},
+		{input: `(do)`, expected: nil},
+		{input: `(do (def x 2) (* x 3))`, expected: float64(6)},
+		{input: `(do (def x 2)) x`, expected: float64(2)},
+		{input: `(if true (do (def y 1) (+ y 1)) 0)`, expected: float64(2)},
+		{
+			input:    `(def loop (lambda (n) (if (= n 0) n (do (def m (- n 1)) (loop m))))) (loop 100000)`,
+			expected: float64(0),
+		},
+		{input: `(do (len 1) 2)`, expected: "attempted to call len with unsupported type NUMBER (1)", expectedType: "error"},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestWhileExpression(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(while false 1)`, expected: nil},
+		{input: `(def i 0) (while (< i 10) (def i (+ i 1)))`, expected: nil},
+		{input: `(def i 0) (while (< i 100000) (def i (+ i 1)) i) i`, expected: float64(100000)},
+		{
+			input:    `(def sum (lambda (n) (def total 0) (while (> n 0) (def total (+ total n)) (def n (- n 1))) total)) (sum 100)`,
+			expected: float64(5050),
+		},
+		{input: `(while (len 1) 1)`, expected: "attempted to call len with unsupported type NUMBER (1)", expectedType: "error"},
+		{input: `(while true (len 1))`, expected: "attempted to call len with unsupported type NUMBER (1)", expectedType: "error"},
+		{input: `(while)`, expected: "attempted to call while with incorrect number of arguments: expected at least 1, got=0", expectedType: "error"},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestVariadicLambdas(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `((lambda (a & rest) a) 1 2 3)`, expected: float64(1)},
+		{input: `((lambda (a & rest) (len rest)) 1 2 3)`, expected: float64(2)},
+		{input: `((lambda (a & rest) (len rest)) 1)`, expected: float64(0)},
+		{input: `((lambda (& xs) (first xs)) 4 5)`, expected: float64(4)},
+		{input: `(def f (lambda (a & rest) (let ((n (len rest))) (+ a n)))) (f 10 1 1 1)`, expected: float64(13)},
+		{
+			input:    `(def count (lambda (n & seen) (if (= n 0) (len seen) (count (- n 1) n n)))) (count 100000)`,
+			expected: float64(2),
+		},
+		{input: `(def f (lambda (a b & rest) a)) (f 1)`, expected: "incorrect number of args for f: expected=at least 2 got=1", expectedType: "error"},
+		{input: `(lambda (a &) a)`, expected: "expected one parameter after &, got 0", expectedType: "error"},
+		{input: `(lambda (& a b) a)`, expected: "expected one parameter after &, got 2", expectedType: "error"},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestQuoting(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(symbol? 'a)`, expected: true},
+		{input: `(= 'a (symbol "a"))`, expected: true},
+		{input: `(= (first '(a b c)) 'a)`, expected: true},
+		{input: `(symbol? (first '(missing)))`, expected: true},
+		{input: `(def a 5) (symbol? (first '(a 2)))`, expected: true},
+		{input: `(len (first (rest '(a (b c) 3))))`, expected: float64(2)},
+		{input: `(= '(a (b c) 3) (list 'a (list 'b 'c) 3))`, expected: true},
+		{input: `(= ''a 'a)`, expected: true},
+		{input: `'5`, expected: float64(5)},
+		{input: `(first '(true))`, expected: true},
+		{input: `(str '(a "b" 1))`, expected: "(a b 1)", expectedType: "string"},
+		{input: `(get '{a 1} 'a)`, expected: float64(1)},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestKeywords(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(str :name)`, expected: ":name", expectedType: "string"},
+		{input: `(= :a :a)`, expected: true},
+		{input: `(= :a :b)`, expected: false},
+		{input: `(= :a 'a)`, expected: false},
+		{input: `(= :a "a")`, expected: false},
+		{input: `(get {:name "ada"} :name)`, expected: "ada", expectedType: "string"},
+		{input: `(get {:name "ada"} "name")`, expected: nil},
+		{input: `(str {:a 1})`, expected: "{:a: 1}", expectedType: "string"},
+		{input: `(= (first '(:a)) :a)`, expected: true},
+		{input: `(defmacro k (x) x) (= (k :a) :a)`, expected: true},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestMacros(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(defmacro my-unless (test body) (list 'if test null body)) (my-unless false 1)`, expected: float64(1)},
+		{input: `(defmacro my-unless (test body) (list 'if test null body)) (my-unless true (len 1))`, expected: nil},
+		{input: `(defmacro square (x) (list '* x x)) (square (+ 1 2))`, expected: float64(9)},
+		{input: `(defmacro swap (form) (list (first (rest form)) (first form) (last form))) (swap (1 - 3))`, expected: float64(-2)},
+		{input: `(defmacro q (x) (list 'quote x)) (= (q a) 'a)`, expected: true},
+		{input: `(defmacro q (x) (list 'quote x)) (str (q (a 1 "s")))`, expected: "(a 1 s)", expectedType: "string"},
+		{input: `(defmacro id (x) x) (= (id 'a) 'a)`, expected: true},
+		{input: `(defmacro count-down (n) (if (= n 0) "done" (list 'count-down (- n 1)))) (count-down 5)`, expected: "done", expectedType: "string"},
+		{input: `(defmacro my-unless (test body) (list 'if test null body)) (defmacro my-when (test body) (list 'my-unless (list 'not test) body)) (my-when true 2)`, expected: float64(2)},
+		{input: `(defmacro my-unless (test body) (list 'if test null body)) (def f (lambda (n) (my-unless (= n 0) (f (- n 1))))) (f 10000)`, expected: nil},
+		{input: `(defmacro m () 1) (def m 2) m`, expected: float64(2)},
+		{input: `(defmacro m () 1) m`, expected: "'m' is a macro and cannot be used as a value", expectedType: "error"},
+		{input: `(defmacro forever () (list 'forever)) (forever)`, expected: "macro forever expanded more than 1000 times", expectedType: "error"},
+		{input: `(defmacro m () {}) (m)`, expected: "a macro can't expand into {}", expectedType: "error"},
+		{input: `(def f (lambda () (defmacro m () 1))) (f)`, expected: "defmacro is only allowed at the top level", expectedType: "error"},
+		{input: `(defmacro if () 1)`, expected: "'if' is a special form and cannot be used as a macro", expectedType: "error"},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: `(error-kind (len 1))`, expected: "TypeError", expectedType: "string"},
+		{input: `(error-kind (len))`, expected: "ArityError", expectedType: "string"},
+		{input: `(error-kind (/ 1 0))`, expected: "ValueError", expectedType: "string"},
+		{input: `(error-kind (set (dict) (list) 1))`, expected: "KeyError", expectedType: "string"},
+		{input: `(error-kind missing)`, expected: "NameError", expectedType: "string"},
+		{input: `(error-kind (error "failed"))`, expected: "UserError", expectedType: "string"},
+		{input: `(error-message (error "failed"))`, expected: "failed", expectedType: "string"},
+		{input: `(error-message (len 1 2))`, expected: "attempted to call len with incorrect number of arguments: expected 1, got=2", expectedType: "string"},
+		{input: `(error? (error "failed"))`, expected: true},
+		{input: `(error? (error-kind 1))`, expected: true},
+	}
+
+	runEvalTests(t, tests)
+}
+
+// Ensure an error used as a condition is the result of the if expression, and
+// that the boolean builtins propagate errors in the same way.
+func TestErrorConditions(t *testing.T) {
+	tests := []evaluatorTest{
+		{input: "(error? (if (len 1) 1 2))", expected: true},
+		{input: "(error? (if (len 1) 1))", expected: true},
+		{input: "(def f (lambda () (if (len 1) 1 2))) (error? (f))", expected: true},
+		{input: "(error? (not (len 1)))", expected: true},
+		{input: "(error? (and (len 1) false))", expected: true},
+		{input: "(error? (or true (len 1)))", expected: true},
+	}
+
+	runEvalTests(t, tests)
+
+	l := lexer.New("(if (len 1) 1 2)")
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	result := Evaluate(program, object.NewEnvironment(nil))
+
+	err, ok := result.(*object.ErrorObject)
+
+	if !ok {
+		t.Fatalf("expected error, got %T(%+v)", result, result)
+	}
+
+	expected := "attempted to call len with unsupported type NUMBER (1)"
+
+	if err.Message != expected {
+		t.Errorf("wrong error: want=%q got=%q", expected, err.Message)
+	}
+}
+
+func TestEvaluateContextCancellation(t *testing.T) {
+	inputs := []string{`
+(def fib (lambda (n) (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2))))))
+(fib 40)`,
+		`(while true 1)`,
+	}
+
+	for _, input := range inputs {
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+		start := time.Now()
+		result := EvaluateContext(ctx, program, object.NewEnvironment(nil))
+		elapsed := time.Since(start)
+		cancel()
+
+		err, ok := result.(*object.ErrorObject)
+
+		if !ok {
+			t.Fatalf("expected error, got %T(%+v)", result, result)
+		}
+
+		if err.Message != CancelledMessage {
+			t.Errorf("wrong error: want=%q got=%q", CancelledMessage, err.Message)
+		}
+
+		if elapsed > 100*time.Millisecond {
+			t.Errorf("cancellation took too long: %s", elapsed)
+		}
+	}
+}
+
 func runEvalTests(t *testing.T, tests []evaluatorTest) {
 	t.Helper()
 
@@ -341,6 +800,8 @@ func runEvalTests(t *testing.T, tests []evaluatorTest) {
 			switch tt.expectedType {
 			case "string":
 				testStringLiteral(t, result, expected)
+			case "error":
+				testErrorMessage(t, result, expected)
 			default:
 				t.Errorf("invalid expected type %s", tt.expectedType)
 			}
@@ -354,6 +815,21 @@ func runEvalTests(t *testing.T, tests []evaluatorTest) {
 	}
 }
 
+func testErrorMessage(t *testing.T, obj object.Object, expected string) {
+	t.Helper()
+
+	err, ok := obj.(*object.ErrorObject)
+
+	if !ok {
+		t.Errorf("expected error %q, got=%T(%+v)", expected, obj, obj)
+		return
+	}
+
+	if err.Message != expected {
+		t.Errorf("wrong error message. want=%q, got=%q", expected, err.Message)
+	}
+}
+
 func testStringLiteral(t *testing.T, obj object.Object, expected string) {
 	t.Helper()
 
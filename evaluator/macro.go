@@ -0,0 +1,295 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"lisp/ast"
+	"lisp/object"
+	"lisp/token"
+)
+
+// The number of times a macro call can expand into another macro call before
+// expansion fails, so that a macro that always expands into itself ends.
+const MaxMacroExpansions = 1000
+
+// Create the macro defined by a defmacro expression of the form
+// (defmacro name (params) body...).
+//
+// A macro is run before the code it's called from, when that code is
+// compiled, so its body can only use its parameters and the builtins. Both
+// engines give it an environment of its own for this reason.
+func NewMacro(e *ast.SExpression) (*object.Macro, *object.ErrorObject) {
+	if len(e.Args) < 3 {
+		return nil, object.WrongNumOfArgsError("defmacro", "at least 3", len(e.Args))
+	}
+
+	name, ok := e.Args[0].(*ast.Identifier)
+
+	if !ok {
+		err := fmt.Sprintf("cannot define a macro named %s", e.Args[0].String())
+		return nil, &object.ErrorObject{Kind: object.SYNTAX_ERROR, Message: err}
+	}
+
+	if ast.SpecialForms[name.String()] {
+		return nil, object.SpecialFormError(name.String(), "macro")
+	}
+
+	lambda := &ast.SExpression{Fn: e.Fn, Args: e.Args[1:], Name: name.String(), Line: e.Line}
+	obj := evaluateLambdaExpression(lambda, object.NewEnvironment(nil))
+
+	if errObj, ok := obj.(*object.ErrorObject); ok {
+		return nil, errObj
+	}
+
+	return &object.Macro{Name: name.String(), Lambda: obj.(*object.LambdaObject)}, nil
+}
+
+// Expand a call to a macro once, by calling it with the arguments of the call
+// as data, and converting the data it returns back into an expression.
+func ExpandMacro(ctx context.Context, macro *object.Macro, call *ast.SExpression) (ast.Expression, *object.ErrorObject) {
+	args := make([]object.Object, len(call.Args))
+
+	for i, arg := range call.Args {
+		args[i] = quoteExpression(arg)
+	}
+
+	result := evalLambda(ctx, macro.Name, macro.Lambda, args...)
+
+	if errObj, ok := result.(*object.ErrorObject); ok {
+		return nil, errObj
+	}
+
+	return toExpression(result, call.Line)
+}
+
+// Report that a macro has expanded into macro calls too many times.
+func MacroDepthError(name string) *object.ErrorObject {
+	err := fmt.Sprintf("macro %s expanded more than %d times", name, MaxMacroExpansions)
+	return &object.ErrorObject{Kind: object.SYNTAX_ERROR, Message: err}
+}
+
+// Add the macro defined by a defmacro expression to env, which has to be the
+// global Environment, as in the compiler. The result of the defmacro
+// expression is null.
+func evaluateDefmacroExpression(e *ast.SExpression, env *object.Environment) object.Object {
+	if !env.IsGlobal() {
+		return &object.ErrorObject{Kind: object.SYNTAX_ERROR, Message: "defmacro is only allowed at the top level"}
+	}
+
+	macro, err := NewMacro(e)
+
+	if err != nil {
+		return err
+	}
+
+	env.Set(macro.Name, macro)
+
+	return NULL
+}
+
+// Return the macro an SExpression calls, if it calls one.
+func lookupMacro(e *ast.SExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := e.Fn.(*ast.Identifier)
+
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Lookup(ident.String())
+
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+
+	return macro, ok
+}
+
+// Expand a call to a macro, along with any macro call it expands into, and
+// return the expression to evaluate in its place.
+func expandMacroCall(ctx context.Context, macro *object.Macro, e *ast.SExpression, env *object.Environment) (ast.Expression, object.Object) {
+	for range MaxMacroExpansions {
+		expansion, err := ExpandMacro(ctx, macro, e)
+
+		if err != nil {
+			return nil, err
+		}
+
+		call, ok := expansion.(*ast.SExpression)
+
+		if !ok || call.Fn == nil || call.Quoted {
+			return expansion, nil
+		}
+
+		next, ok := lookupMacro(call, env)
+
+		if !ok {
+			return expansion, nil
+		}
+
+		macro, e = next, call
+	}
+
+	return nil, MacroDepthError(macro.Name)
+}
+
+// Convert an expression into the data a macro is called with. Numbers,
+// strings, keywords, true, false and null are themselves, names are symbols, and
+// SExpressions are lists. A quoted expression, such as 'a, is the list
+// (quote a).
+func quoteExpression(expr ast.Expression) object.Object {
+	switch expr := expr.(type) {
+	case *ast.SymbolLiteral:
+		return quoted(&object.Symbol{Name: expr.Token.Literal})
+	case *ast.SExpression:
+		if expr.Fn == nil {
+			return &object.List{}
+		}
+
+		if expr.Quoted {
+			return quoted(datum(expr))
+		}
+
+		values := []object.Object{quoteExpression(expr.Fn)}
+
+		for _, arg := range expr.Args {
+			values = append(values, quoteExpression(arg))
+		}
+
+		return &object.List{Values: values}
+	default:
+		return datum(expr)
+	}
+}
+
+// Convert an expression that's already data, such as the contents of a quoted
+// list, into the value it represents.
+func datum(expr ast.Expression) object.Object {
+	switch expr := expr.(type) {
+	case *ast.FloatLiteral:
+		return object.NewNumber(expr.Value)
+	case *ast.StringLiteral:
+		return object.NewString(expr.Value)
+	case *ast.SymbolLiteral:
+		return &object.Symbol{Name: expr.Token.Literal}
+	case *ast.KeywordLiteral:
+		return &object.Keyword{Name: expr.Token.Literal}
+	case *ast.Identifier:
+		switch expr.String() {
+		case "true":
+			return TRUE
+		case "false":
+			return FALSE
+		case "null":
+			return NULL
+		}
+
+		return &object.Symbol{Name: expr.String()}
+	case *ast.SExpression:
+		if expr.Fn == nil || !expr.Quoted {
+			return quoteExpression(expr)
+		}
+
+		values := make([]object.Object, len(expr.Args))
+
+		for i, arg := range expr.Args {
+			values[i] = datum(arg)
+		}
+
+		return &object.List{Values: values}
+	default:
+		return NULL
+	}
+}
+
+// Return the list (quote obj).
+func quoted(obj object.Object) object.Object {
+	return &object.List{Values: []object.Object{&object.Symbol{Name: "quote"}, obj}}
+}
+
+// Convert the data returned by a macro back into an expression on the
+// provided line, reversing quoteExpression. Returns an error if the data holds
+// a value that isn't part of an expression, such as a dict.
+func toExpression(obj object.Object, line int) (ast.Expression, *object.ErrorObject) {
+	switch obj := obj.(type) {
+	case *object.Symbol:
+		return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: obj.Name, Line: line}}, nil
+	case *object.List:
+		if len(obj.Values) == 0 {
+			return &ast.SExpression{Line: line}, nil
+		}
+
+		if isQuoted(obj) {
+			return toDatum(obj.Values[1], line)
+		}
+
+		exprs := make([]ast.Expression, len(obj.Values))
+
+		for i, value := range obj.Values {
+			expr, err := toExpression(value, line)
+
+			if err != nil {
+				return nil, err
+			}
+
+			exprs[i] = expr
+		}
+
+		return &ast.SExpression{Fn: exprs[0], Args: exprs[1:], Line: line}, nil
+	default:
+		return toLiteral(obj, line)
+	}
+}
+
+// Convert data back into the expression it's the value of when quoted.
+func toDatum(obj object.Object, line int) (ast.Expression, *object.ErrorObject) {
+	switch obj := obj.(type) {
+	case *object.Symbol:
+		return &ast.SymbolLiteral{Token: token.Token{Type: token.IDENT, Literal: obj.Name, Line: line}}, nil
+	case *object.List:
+		list := &ast.SExpression{
+			Fn:     &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: "list", Line: line}},
+			Quoted: true,
+			Line:   line,
+		}
+
+		for _, value := range obj.Values {
+			expr, err := toDatum(value, line)
+
+			if err != nil {
+				return nil, err
+			}
+
+			list.Args = append(list.Args, expr)
+		}
+
+		return list, nil
+	default:
+		return toLiteral(obj, line)
+	}
+}
+
+// Convert a value into the literal expression it's the value of.
+func toLiteral(obj object.Object, line int) (ast.Expression, *object.ErrorObject) {
+	switch obj := obj.(type) {
+	case *object.Number:
+		return &ast.FloatLiteral{Token: token.Token{Type: token.NUM, Literal: obj.Inspect(), Line: line}, Value: obj.Value}, nil
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: obj.Value, Line: line}, Value: obj.Value}, nil
+	case *object.Keyword:
+		return &ast.KeywordLiteral{Token: token.Token{Type: token.KEYWORD, Literal: obj.Name, Line: line}}, nil
+	case *object.BooleanObject, *object.Null:
+		return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: obj.Inspect(), Line: line}}, nil
+	default:
+		err := fmt.Sprintf("a macro can't expand into %s", obj.Inspect())
+		return nil, &object.ErrorObject{Kind: object.SYNTAX_ERROR, Message: err}
+	}
+}
+
+// Report whether the list is of the form (quote x).
+func isQuoted(list *object.List) bool {
+	symbol, ok := list.Values[0].(*object.Symbol)
+
+	return ok && symbol.Name == "quote" && len(list.Values) == 2
+}
@@ -1,3 +1,3 @@
 module lisp
 
-go 1.21.2
+go 1.22
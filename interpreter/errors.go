@@ -0,0 +1,68 @@
+package interpreter
+
+import (
+	"errors"
+	"lisp/vm"
+	"strings"
+)
+
+// An error that stopped source code from being parsed, holding every problem
+// found in it.
+type ParseError struct {
+	Errors []string
+}
+
+// Each problem is shown on a line of its own.
+func (e *ParseError) Error() string {
+	return strings.Join(e.Errors, "\n")
+}
+
+// An error that stopped a program from being compiled.
+type CompileError struct {
+	Err error
+}
+
+func (e *CompileError) Error() string {
+	return "compiler error: " + e.Err.Error()
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+// An error that stopped a program while it was running.
+type RuntimeError struct {
+	// The engine the program was running with.
+	Engine Engine
+	Err    error
+	// The functions that were executing when the error occurred, innermost
+	// first. Only the VM keeps a trace, and only for errors inside a function.
+	Trace []vm.TraceFrame
+}
+
+// Errors from the VM are distinguished from those of the compiler, while the
+// evaluator's errors are shown as they are.
+func (e *RuntimeError) Error() string {
+	if e.Engine == VM_ENGINE {
+		return "vm error: " + e.Err.Error()
+	}
+
+	return e.Err.Error()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// Return a RuntimeError for an error from the VM, keeping its trace.
+func vmRuntimeError(err error) *RuntimeError {
+	runtimeErr := &RuntimeError{Engine: VM_ENGINE, Err: err}
+
+	var vmErr *vm.RuntimeError
+
+	if errors.As(err, &vmErr) {
+		runtimeErr.Trace = vmErr.Trace
+	}
+
+	return runtimeErr
+}
@@ -0,0 +1,55 @@
+package interpreter
+
+// A fixed number of Sessions that can be shared by goroutines, each taking a
+// Session with Get and returning it with Put when it's done.
+//
+// The state shared by every Session is never changed once the process has
+// started: the builtins, the TRUE, FALSE and NULL Objects, and the special
+// forms. Registered functions belong to a single Session rather than being
+// added to the builtins, and each Session has its own streams and source of
+// random numbers, so Sessions taken from a Pool can run programs at the same
+// time.
+type Pool struct {
+	sessions chan *Session
+}
+
+// Create a Pool of Sessions that run programs with the provided engine. Each
+// Session is created up front and passed to setup, which can register the
+// functions that programs use. setup can be nil.
+//
+// Returns the first error from setup.
+func NewPool(engine Engine, size int, setup func(s *Session) error) (*Pool, error) {
+	p := &Pool{sessions: make(chan *Session, size)}
+
+	for i := 0; i < size; i++ {
+		s := NewSession(engine)
+
+		if setup != nil {
+			err := setup(s)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		p.sessions <- s
+	}
+
+	return p, nil
+}
+
+// Take a Session from the Pool, waiting until one is returned if they're all
+// in use. The Session mustn't be used by other goroutines until it's Put back.
+func (p *Pool) Get() *Session {
+	return <-p.sessions
+}
+
+// Return a Session taken with Get to the Pool. Everything defined by the
+// programs it ran is discarded, and its streams are cleared, so the next
+// goroutine to take it starts afresh with only the registered functions.
+func (p *Pool) Put(s *Session) {
+	s.Reset()
+	s.Stdin, s.Stdout, s.Stderr = nil, nil, nil
+
+	p.sessions <- s
+}
@@ -0,0 +1,95 @@
+package interpreter
+
+import (
+	"bytes"
+	"fmt"
+	"lisp/object"
+	"sync"
+	"testing"
+)
+
+// Run with -race to check that Sessions from a Pool share no state.
+func TestPoolConcurrentSessions(t *testing.T) {
+	for _, engine := range testEngines {
+		pool, err := NewPool(engine, 4, func(s *Session) error {
+			return s.Register("double", func(args ...object.Object) object.Object {
+				return &object.Number{Value: args[0].(*object.Number).Value * 2}
+			})
+		})
+
+		if err != nil {
+			t.Fatalf("%s: failed to create the pool: %s", engine, err)
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 50)
+
+		for i := range 50 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for range 20 {
+					err := runPooled(pool, i)
+
+					if err != nil {
+						errs <- fmt.Errorf("%s: %w", engine, err)
+						return
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+// Take a Session from the Pool, and run a program in it that defines a global,
+// prints and uses random.
+func runPooled(pool *Pool, i int) error {
+	s := pool.Get()
+	defer pool.Put(s)
+
+	if _, ok := s.Get("n"); ok {
+		return fmt.Errorf("n is defined by a previous program")
+	}
+
+	var out bytes.Buffer
+	s.Stdout = &out
+
+	result, err := s.Eval(fmt.Sprintf(`
+        (def n %d)
+        (print (double n))
+        (def roll (random 6))
+        (if (< roll 6) n -1)`, i))
+
+	if err != nil {
+		return err
+	}
+
+	if expected := fmt.Sprint(i); result.Inspect() != expected {
+		return fmt.Errorf("wrong result. want=%s, got=%s", expected, result.Inspect())
+	}
+
+	if expected := fmt.Sprintf("%d\n", i*2); out.String() != expected {
+		return fmt.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+
+	return nil
+}
+
+func TestPoolSetupError(t *testing.T) {
+	_, err := NewPool(VM_ENGINE, 2, func(s *Session) error {
+		return s.Register("print", nil)
+	})
+
+	if err == nil {
+		t.Fatal("expected an error from setup")
+	}
+}
@@ -0,0 +1,118 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"lisp/compiler"
+	"lisp/object"
+	"lisp/vm"
+	"math/rand"
+	"slices"
+)
+
+// A program compiled once, to be run many times on the VM without parsing or
+// compiling it again. Each run has its own globals, so nothing defined by one
+// run is seen by another.
+//
+// A Program is never changed once it's compiled, so it can be run by several
+// goroutines at once. The Objects passed to a run in RunOptions are shared
+// with it though, and a dict passed to runs at the same time can be changed by
+// each of them with set.
+type Program struct {
+	bytecode *compiler.Bytecode
+	// The names of the globals given values by each run
+	inputs []string
+}
+
+// The settings for a single run of a Program.
+type RunOptions struct {
+	// The values of the globals named when the Program was compiled. Globals
+	// that aren't given a value are null.
+	Globals map[string]object.Object
+	// The arguments available to the program as *args*.
+	Args []string
+	// The streams used by the builtins that read and write. When nil, the
+	// streams of the process are used.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// The source of the numbers returned by random. When nil, the source of
+	// the process is used, which can be shared by runs at the same time.
+	Rand *rand.Rand
+	// Stops the run early when cancelled. When nil, the run can't be
+	// cancelled.
+	Context context.Context
+}
+
+// Parse and compile the source code into a Program. The names of the globals
+// that are given values by each run are provided, so that the program can
+// refer to them. The error is a *ParseError or *CompileError if the source
+// can't be compiled.
+func Compile(source string, globals ...string) (*Program, error) {
+	program, err := Parse(source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewSession(VM_ENGINE)
+
+	for _, name := range globals {
+		s.Set(name, object.NULL)
+	}
+
+	c := s.compiler
+	err = c.Compile(program)
+
+	if err != nil {
+		return nil, &CompileError{Err: err}
+	}
+
+	return &Program{bytecode: c.Bytecode(), inputs: slices.Clone(globals)}, nil
+}
+
+// Run the Program on a new VM, returning the result of its last expression.
+// The error is a *RuntimeError if it fails while running.
+//
+// Returns an error without running the Program if a global in the options
+// wasn't named when it was compiled.
+func (p *Program) Run(opts RunOptions) (object.Object, error) {
+	for name := range opts.Globals {
+		if !slices.Contains(p.inputs, name) {
+			return nil, fmt.Errorf("the program has no global named '%s'", name)
+		}
+	}
+
+	globals := make([]object.Object, len(p.bytecode.GlobalNames))
+
+	for i, name := range p.bytecode.GlobalNames {
+		switch {
+		case name == object.ARGS_NAME:
+			globals[i] = object.ArgsList(opts.Args)
+		case slices.Contains(p.inputs, name):
+			globals[i] = object.NULL
+
+			if value, ok := opts.Globals[name]; ok {
+				globals[i] = value
+			}
+		}
+	}
+
+	ctx := opts.Context
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	v := vm.NewWithState(p.bytecode, globals)
+	v.SetStreams(&object.Streams{Stdin: opts.Stdin, Stdout: opts.Stdout, Stderr: opts.Stderr, Rand: opts.Rand})
+
+	result, err := v.RunResultContext(ctx)
+
+	if err != nil {
+		return nil, vmRuntimeError(err)
+	}
+
+	return result, nil
+}
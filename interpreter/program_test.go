@@ -0,0 +1,148 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"lisp/object"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const scoreSource = `
+(def weight 3)
+(def score (lambda (x) (+ (* x weight) bonus)))
+(print "scoring" name)
+(score (len *args*))
+`
+
+func TestProgramRun(t *testing.T) {
+	program, err := Compile(scoreSource, "bonus", "name")
+
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+
+	var out strings.Builder
+
+	result, err := program.Run(RunOptions{
+		Globals: map[string]object.Object{
+			"bonus": &object.Number{Value: 1},
+			"name":  &object.String{Value: "a"},
+		},
+		Args:   []string{"x", "y"},
+		Stdout: &out,
+	})
+
+	if err != nil {
+		t.Fatalf("failed to run: %s", err)
+	}
+
+	if result.Inspect() != "7" || out.String() != "scoring a\n" {
+		t.Errorf("wrong result, got=%s, output=%q", result.Inspect(), out.String())
+	}
+
+	// Globals that aren't given a value are null.
+	out.Reset()
+
+	_, err = program.Run(RunOptions{Globals: map[string]object.Object{"bonus": &object.Number{Value: 1}}, Stdout: &out})
+
+	if err != nil || out.String() != "scoring null\n" {
+		t.Errorf("wrong output without a name, got=%q, %v", out.String(), err)
+	}
+
+	if _, err := program.Run(RunOptions{Globals: map[string]object.Object{"weight": object.NULL}}); err == nil {
+		t.Errorf("expected an error for a global that isn't an input")
+	}
+
+	var runtimeErr *RuntimeError
+
+	if _, err := program.Run(RunOptions{Stdout: &out}); !errors.As(err, &runtimeErr) {
+		t.Errorf("expected a RuntimeError adding null, got=%v", err)
+	}
+
+	var compileErr *CompileError
+
+	if _, err := Compile(scoreSource); !errors.As(err, &compileErr) {
+		t.Errorf("expected a CompileError without the inputs, got=%v", err)
+	}
+}
+
+func TestProgramConcurrentRuns(t *testing.T) {
+	program, err := Compile("(def total (* seed 2))\n(def seed (+ total 1))\nseed", "seed")
+
+	if err != nil {
+		t.Fatalf("failed to compile: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+
+	for i := range 100 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range 50 {
+				result, err := program.Run(RunOptions{
+					Globals: map[string]object.Object{"seed": &object.Number{Value: float64(i)}},
+				})
+
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if expected := fmt.Sprint(i*2 + 1); result.Inspect() != expected {
+					errs <- fmt.Errorf("seed %d: want=%s, got=%s", i, expected, result.Inspect())
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// Compare running a program with a new Session each time, which parses and
+// compiles it, with running it precompiled.
+func BenchmarkFullPipeline(b *testing.B) {
+	for i := range b.N {
+		s := NewSession(VM_ENGINE)
+		s.Stdout = &strings.Builder{}
+		s.Set("bonus", &object.Number{Value: float64(i)})
+		s.Set("name", &object.String{Value: "a"})
+
+		if _, err := s.Eval(scoreSource); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPrecompiled(b *testing.B) {
+	program, err := Compile(scoreSource, "bonus", "name")
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for i := range b.N {
+		_, err := program.Run(RunOptions{
+			Globals: map[string]object.Object{
+				"bonus": &object.Number{Value: float64(i)},
+				"name":  &object.String{Value: "a"},
+			},
+			Stdout: &strings.Builder{},
+		})
+
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
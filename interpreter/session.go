@@ -0,0 +1,390 @@
+// interpreter runs programs with either engine, keeping the state they define
+// in a Session, so that the interpreter can be embedded in other programs.
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"lisp/ast"
+	"lisp/code"
+	"lisp/compiler"
+	"lisp/evaluator"
+	"lisp/lexer"
+	"lisp/object"
+	"lisp/parser"
+	"lisp/vm"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// The name of an engine that programs can be run with.
+type Engine string
+
+const (
+	// The tree walking evaluator.
+	EVAL_ENGINE Engine = "eval"
+	// Compiles programs to bytecode and runs them on the VM.
+	VM_ENGINE Engine = "vm"
+)
+
+// An ongoing run of the interpreter, where each program run can use the
+// variables defined by the programs run before it.
+//
+// *args* is always defined, as an empty List until it's Set.
+type Session struct {
+	// The streams used by the builtins that read and write, such as print.
+	// When nil, the streams of the process are used.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// The source of the numbers returned by random. Each Session has a source
+	// of its own, so that Sessions used by different goroutines don't share
+	// one, and it can be replaced with a seeded source to repeat a run.
+	Rand *rand.Rand
+
+	engine Engine
+
+	// The Environment programs are evaluated in by the evaluator.
+	env *object.Environment
+
+	// The state of the VM. A single Compiler is used for the whole session,
+	// so that symbols and constants are kept between programs.
+	symbolTable *compiler.SymbolTable
+	compiler    *compiler.Compiler
+	globals     []object.Object
+
+	// The functions registered by the host, which are kept when the Session
+	// is Reset.
+	registered []*object.FunctionObject
+
+	timing   Timing
+	warnings []string
+}
+
+// The time taken to run the last program.
+type Timing struct {
+	Compile time.Duration // the time spent compiling, zero for the evaluator
+	Run     time.Duration // the time spent running
+}
+
+// Create a Session that runs programs with the provided engine.
+func NewSession(engine Engine) *Session {
+	s := &Session{
+		Rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		engine: engine,
+	}
+	s.Reset()
+
+	return s
+}
+
+// Return the engine the Session runs programs with.
+func (s *Session) Engine() Engine {
+	return s.engine
+}
+
+// Discard everything defined by previous programs. Registered functions are
+// kept.
+func (s *Session) Reset() {
+	if s.engine == EVAL_ENGINE {
+		s.env = object.NewEnvironment(nil)
+	} else {
+		s.symbolTable = compiler.NewSymbolTable()
+
+		for i, v := range object.Builtins {
+			s.symbolTable.DefineBuiltin(i, v.Name)
+		}
+
+		s.compiler = compiler.NewWithState([]object.Object{}, s.symbolTable)
+		s.globals = []object.Object{}
+	}
+
+	s.Set(object.ARGS_NAME, object.ArgsList(nil))
+
+	for _, fn := range s.registered {
+		s.Set(fn.Name, fn)
+	}
+}
+
+// Make the Go function available to programs run in the Session, called with
+// the provided name. Registering a name again replaces the function.
+//
+// Registered functions are global variables of the Session rather than
+// builtins, so they don't change the builtins known to other Sessions, and
+// can be registered after programs have been compiled. Programs compiled
+// before a function is registered can't use it, and fail to compile instead.
+//
+// Returns an error if the name is that of a builtin or special form.
+func (s *Session) Register(name string, fn object.Function) error {
+	if object.GetBuiltinByName(name) != nil || ast.SpecialForms[name] {
+		return fmt.Errorf("can't register '%s', it's already a builtin", name)
+	}
+
+	registered := &object.FunctionObject{Name: name, Fn: fn}
+
+	s.registered = slices.DeleteFunc(s.registered, func(f *object.FunctionObject) bool {
+		return f.Name == name
+	})
+	s.registered = append(s.registered, registered)
+
+	s.Set(name, registered)
+
+	return nil
+}
+
+// Convert the source code into an AST. The error is a *ParseError holding
+// every problem found if it can't be parsed.
+func Parse(source string) (*ast.Program, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	if len(p.Errors) > 0 {
+		return nil, &ParseError{Errors: p.Errors}
+	}
+
+	return program, nil
+}
+
+// Parse and run the source code, returning the result of its last expression.
+// The error is a *ParseError if it can't be parsed, otherwise it's the same as
+// for Run.
+func (s *Session) Eval(source string) (object.Object, error) {
+	program, err := Parse(source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Run(context.Background(), program)
+}
+
+// Run the program, returning the result of its last expression. The error is
+// a *CompileError if the program couldn't be compiled, or a *RuntimeError if
+// it failed while running. Running stops early if the context is cancelled.
+func (s *Session) Run(ctx context.Context, program *ast.Program) (object.Object, error) {
+	s.timing = Timing{}
+	s.warnings = nil
+
+	if s.engine == EVAL_ENGINE {
+		start := time.Now()
+		result := evaluator.EvaluateContext(evaluator.WithStreams(ctx, s.streams()), program, s.env)
+
+		s.timing.Run = time.Since(start)
+
+		// Errors are values in the evaluator, but are still returned as
+		// errors so that both engines fail in the same way.
+		if err, ok := result.(*object.ErrorObject); ok {
+			return nil, &RuntimeError{Engine: s.engine, Err: err}
+		}
+
+		return result, nil
+	}
+
+	start := time.Now()
+
+	s.compiler.Reset()
+	err := s.compiler.Compile(program)
+
+	s.timing.Compile = time.Since(start)
+
+	if err != nil {
+		return nil, &CompileError{Err: err}
+	}
+
+	s.warnings = s.compiler.Warnings
+
+	start = time.Now()
+
+	v := vm.NewWithState(s.compiler.Bytecode(), s.globals)
+	v.SetStreams(s.streams())
+	result, err := v.RunResultContext(ctx)
+
+	s.timing.Run = time.Since(start)
+
+	// The VM grows the globals when new variables are defined.
+	s.globals = v.Globals()
+
+	if err != nil {
+		return nil, vmRuntimeError(err)
+	}
+
+	return result, nil
+}
+
+// The most arguments a function can be passed by Call with the VM, as they're
+// counted by a one byte operand.
+const maxCallArgs = 255
+
+// Call the function with the provided name, which is a builtin or a global
+// variable holding a lambda, with the provided arguments. The error is a
+// *RuntimeError if the call fails.
+//
+// Nothing is compiled or defined to make the call, so a function can be
+// called repeatedly without the Session growing.
+func (s *Session) Call(name string, args ...object.Object) (object.Object, error) {
+	fn, ok := s.Get(name)
+
+	if builtin := object.GetBuiltinByName(name); !ok && builtin != nil {
+		fn, ok = builtin, true
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("no function named '%s'", name)
+	}
+
+	if s.engine == EVAL_ENGINE {
+		ctx := evaluator.WithStreams(context.Background(), s.streams())
+		result := evaluator.Apply(ctx, name, fn, args...)
+
+		if err, ok := result.(*object.ErrorObject); ok {
+			return nil, &RuntimeError{Engine: s.engine, Err: err}
+		}
+
+		return result, nil
+	}
+
+	// The call is made by a program that pushes the function and arguments
+	// as constants, then calls the function with them. The constants of the
+	// Session are kept, since the function refers to them, but are copied so
+	// that the call doesn't add to them.
+	if len(args) > maxCallArgs {
+		return nil, fmt.Errorf("can't call %s with %d arguments, the limit is %d", name, len(args), maxCallArgs)
+	}
+
+	// A builtin has to use the Session's streams, as it would if the
+	// program had referred to it by name.
+	if builtin, ok := fn.(*object.FunctionObject); ok {
+		fn = builtin.WithStreams(s.streams())
+	}
+
+	constants := slices.Clone(s.compiler.Constants())
+	first := len(constants)
+	constants = append(constants, fn)
+	constants = append(constants, args...)
+
+	instructions := code.Instructions{}
+
+	for i := first; i < len(constants); i++ {
+		instructions = append(instructions, code.Make(code.OpConstant, i)...)
+	}
+
+	callPos := len(instructions)
+	instructions = append(instructions, code.Make(code.OpCall, len(args))...)
+	instructions = append(instructions, code.Make(code.OpPop)...)
+
+	bytecode := &compiler.Bytecode{
+		Instructions: instructions,
+		Constants:    constants,
+		GlobalNames:  s.symbolTable.GlobalNames(),
+		CallSites:    map[int]object.CallSite{callPos: {Name: name}},
+	}
+
+	v := vm.NewWithState(bytecode, s.globals)
+	v.SetStreams(s.streams())
+	result, err := v.RunResult()
+
+	s.globals = v.Globals()
+
+	if err != nil {
+		return nil, vmRuntimeError(err)
+	}
+
+	return result, nil
+}
+
+// Return the Streams used by builtins, taken from the fields of the Session.
+func (s *Session) streams() *object.Streams {
+	return &object.Streams{Stdin: s.Stdin, Stdout: s.Stdout, Stderr: s.Stderr, Rand: s.Rand}
+}
+
+// Return the time taken to run the last program.
+func (s *Session) Timing() Timing {
+	return s.timing
+}
+
+// Return the warnings produced when compiling the last program.
+func (s *Session) Warnings() []string {
+	return s.warnings
+}
+
+// Return the value of the global variable with the provided name, and whether
+// it's defined.
+func (s *Session) Get(name string) (object.Object, bool) {
+	if s.engine == EVAL_ENGINE {
+		value := s.env.Get(name)
+		return value, value.Type() != object.ERROR_OBJ
+	}
+
+	sym, ok := s.symbolTable.Resolve(name)
+
+	if !ok || sym.Scope != compiler.GlobalScope || sym.Index >= len(s.globals) {
+		return nil, false
+	}
+
+	// A variable whose definition failed has no value.
+	value := s.globals[sym.Index]
+
+	return value, value != nil
+}
+
+// Define the global variable with the provided name, or change its value if
+// it's already defined, so that later programs can use it.
+func (s *Session) Set(name string, value object.Object) {
+	if s.engine == EVAL_ENGINE {
+		s.env.Set(name, value)
+		return
+	}
+
+	sym, ok := s.symbolTable.Resolve(name)
+
+	if !ok || sym.Scope != compiler.GlobalScope {
+		sym = s.symbolTable.Define(name)
+	}
+
+	for len(s.globals) <= sym.Index {
+		s.globals = append(s.globals, nil)
+	}
+
+	s.globals[sym.Index] = value
+}
+
+// Return the names of the global variables that are defined, sorted by name.
+func (s *Session) Names() []string {
+	if s.engine == EVAL_ENGINE {
+		return s.env.Names()
+	}
+
+	names := []string{}
+
+	for _, sym := range s.symbolTable.Symbols() {
+		if _, ok := s.Get(sym.Name); ok {
+			names = append(names, sym.Name)
+		}
+	}
+
+	return names
+}
+
+// Return a Compiler that knows the builtins and the global variables defined
+// in the Session. Using it doesn't change the Session.
+func (s *Session) Compiler() *compiler.Compiler {
+	if s.engine == VM_ENGINE {
+		return s.compiler.Clone()
+	}
+
+	// The evaluator doesn't compile programs, so the Compiler is given a
+	// global variable for each of the variables defined in the Environment.
+	symbolTable := compiler.NewSymbolTable()
+
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	for _, name := range s.env.Names() {
+		symbolTable.Define(name)
+	}
+
+	return compiler.NewWithState([]object.Object{}, symbolTable)
+}
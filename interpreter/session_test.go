@@ -0,0 +1,393 @@
+package interpreter
+
+import (
+	"errors"
+	"lisp/object"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var testEngines = []Engine{EVAL_ENGINE, VM_ENGINE}
+
+func TestSessionState(t *testing.T) {
+	snippets := []struct {
+		source   string
+		expected string
+	}{
+		{"(def base 20)", "20"},
+		{"(def double (lambda (x) (* x 2)))", ""},
+		{"(def total (+ base 1))", "21"},
+		{"(double total)", "42"},
+		{"(len *args*)", "0"},
+	}
+
+	for _, engine := range testEngines {
+		s := NewSession(engine)
+
+		for _, snippet := range snippets {
+			result, err := s.Eval(snippet.source)
+
+			if err != nil {
+				t.Fatalf("%s: failed to run %q: %s", engine, snippet.source, err)
+			}
+
+			if snippet.expected != "" && result.Inspect() != snippet.expected {
+				t.Errorf("%s: wrong result for %q. want=%s, got=%s",
+					engine, snippet.source, snippet.expected, result.Inspect())
+			}
+		}
+
+		if names := s.Names(); !slices.Equal(names, []string{"*args*", "base", "double", "total"}) {
+			t.Errorf("%s: wrong names, got=%q", engine, names)
+		}
+
+		s.Reset()
+
+		if _, ok := s.Get("base"); ok {
+			t.Errorf("%s: base still defined after reset", engine)
+		}
+
+		if _, err := s.Eval("base"); err == nil {
+			t.Errorf("%s: base can be used after reset", engine)
+		}
+	}
+}
+
+func TestSessionSet(t *testing.T) {
+	for _, engine := range testEngines {
+		s := NewSession(engine)
+		s.Set("name", &object.String{Value: "lisp"})
+		s.Set(object.ARGS_NAME, object.ArgsList([]string{"a", "b"}))
+
+		result, err := s.Eval("(str name (len *args*))")
+
+		if err != nil {
+			t.Fatalf("%s: failed to run: %s", engine, err)
+		}
+
+		if result.Inspect() != "lisp2" {
+			t.Errorf("%s: wrong result, got=%s", engine, result.Inspect())
+		}
+
+		// Values set by programs can be read back.
+		s.Eval("(def name \"go\")")
+
+		if value, ok := s.Get("name"); !ok || value.Inspect() != "go" {
+			t.Errorf("%s: wrong value for name, got=%v", engine, value)
+		}
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	s := NewSession(VM_ENGINE)
+
+	var compileErr *CompileError
+	var runtimeErr *RuntimeError
+
+	if _, err := s.Eval("(+ 1 z)"); !errors.As(err, &compileErr) {
+		t.Errorf("expected a CompileError, got=%v", err)
+	}
+
+	if _, err := s.Eval("(len 1)"); !errors.As(err, &runtimeErr) {
+		t.Errorf("vm: expected a RuntimeError, got=%v", err)
+	}
+
+	if _, err := NewSession(EVAL_ENGINE).Eval("(len 1)"); !errors.As(err, &runtimeErr) {
+		t.Errorf("eval: expected a RuntimeError, got=%v", err)
+	}
+
+	if _, err := s.Eval("(+ 1"); err == nil {
+		t.Errorf("expected a parse error")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	lookups := 0
+	lookup := func(args ...object.Object) object.Object {
+		lookups++
+
+		name, ok := args[0].(*object.String)
+
+		if !ok {
+			return object.BadTypeError("lookup", args[0])
+		}
+
+		return &object.Number{Value: float64(len(name.Value) * 10)}
+	}
+
+	for _, engine := range testEngines {
+		s := NewSession(engine)
+
+		// Programs compiled before the function is registered fail loudly.
+		if _, err := s.Eval("(lookup \"abc\")"); err == nil {
+			t.Errorf("%s: lookup used before it was registered", engine)
+		}
+
+		s.Eval("(def double (lambda (x) (* x 2)))")
+
+		if err := s.Register("lookup", lookup); err != nil {
+			t.Fatalf("%s: failed to register: %s", engine, err)
+		}
+
+		result, err := s.Eval("(double (lookup \"abcd\"))")
+
+		if err != nil {
+			t.Fatalf("%s: failed to call lookup: %s", engine, err)
+		}
+
+		if result.Inspect() != "80" {
+			t.Errorf("%s: wrong result, got=%s", engine, result.Inspect())
+		}
+
+		// Registrations are kept when the Session is reset.
+		s.Reset()
+
+		if result, err := s.Eval("(lookup \"a\")"); err != nil || result.Inspect() != "10" {
+			t.Errorf("%s: lookup not kept after reset, got=%v, %v", engine, result, err)
+		}
+
+		if _, err := s.Eval("(lookup 1)"); err == nil {
+			t.Errorf("%s: expected an error from lookup", engine)
+		}
+
+		if err := s.Register("+", lookup); err == nil {
+			t.Errorf("%s: registered over a builtin", engine)
+		}
+
+		if err := s.Register("def", lookup); err == nil {
+			t.Errorf("%s: registered over a special form", engine)
+		}
+
+		// Other Sessions don't know the function.
+		if _, err := NewSession(engine).Eval("(lookup \"a\")"); err == nil {
+			t.Errorf("%s: lookup registered in another Session", engine)
+		}
+	}
+
+	if lookups != 6 {
+		t.Errorf("wrong number of calls to lookup. want=6, got=%d", lookups)
+	}
+}
+
+func TestSessionGoValues(t *testing.T) {
+	config, err := object.FromGo(map[string]interface{}{
+		"name":  "lisp",
+		"sizes": []interface{}{1, 2, 3},
+	})
+
+	if err != nil {
+		t.Fatalf("failed to convert config: %s", err)
+	}
+
+	for _, engine := range testEngines {
+		s := NewSession(engine)
+		s.Set("config", config)
+
+		result, err := s.Eval("(list (get config \"name\") (len (get config \"sizes\")))")
+
+		if err != nil {
+			t.Fatalf("%s: failed to run: %s", engine, err)
+		}
+
+		value, err := object.ToGo(result)
+
+		if err != nil {
+			t.Fatalf("%s: failed to convert result: %s", engine, err)
+		}
+
+		if !reflect.DeepEqual(value, []interface{}{"lisp", 3.0}) {
+			t.Errorf("%s: wrong result, got=%#v", engine, value)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	for _, engine := range testEngines {
+		s := NewSession(engine)
+
+		_, err := s.Eval(`
+(def bonus 1)
+(def make-scorer (lambda (weight) (lambda (x) (+ (* x weight) bonus))))
+(def score (make-scorer 3))
+(def add (lambda (a b) (+ a b)))
+`)
+
+		if err != nil {
+			t.Fatalf("%s: failed to define functions: %s", engine, err)
+		}
+
+		names := s.Names()
+
+		for i := range 1000 {
+			result, err := s.Call("score", &object.Number{Value: float64(i)})
+
+			if err != nil {
+				t.Fatalf("%s: call %d failed: %s", engine, i, err)
+			}
+
+			if expected := float64(i*3 + 1); result.(*object.Number).Value != expected {
+				t.Fatalf("%s: wrong result for call %d. want=%v, got=%s", engine, i, expected, result.Inspect())
+			}
+		}
+
+		if !slices.Equal(s.Names(), names) {
+			t.Errorf("%s: calls defined variables. before=%q, after=%q", engine, names, s.Names())
+		}
+
+		tests := []struct {
+			name     string
+			args     []object.Object
+			expected string
+		}{
+			{"score", []object.Object{&object.Number{Value: 1}}, "4"},
+			{"add", []object.Object{&object.Number{Value: 1}, &object.Number{Value: 2}}, "3"},
+			{"+", []object.Object{&object.Number{Value: 1}, &object.Number{Value: 2}}, "3"},
+			{"str", []object.Object{&object.String{Value: "a"}, object.TRUE}, "atrue"},
+		}
+
+		for _, tt := range tests {
+			result, err := s.Call(tt.name, tt.args...)
+
+			if err != nil {
+				t.Errorf("%s: failed to call %s: %s", engine, tt.name, err)
+				continue
+			}
+
+			if result.Inspect() != tt.expected {
+				t.Errorf("%s: wrong result from %s. want=%s, got=%s", engine, tt.name, tt.expected, result.Inspect())
+			}
+		}
+
+		var runtimeErr *RuntimeError
+
+		if _, err := s.Call("add", &object.Number{Value: 1}); !errors.As(err, &runtimeErr) {
+			t.Errorf("%s: expected a RuntimeError for the wrong number of args, got=%v", engine, err)
+		}
+
+		if _, err := s.Call("bonus"); err == nil {
+			t.Errorf("%s: expected an error calling a number", engine)
+		}
+
+		if _, err := s.Call("missing"); err == nil {
+			t.Errorf("%s: expected an error calling an undefined function", engine)
+		}
+
+		if result, err := s.Eval("(score 2)"); err != nil || result.Inspect() != "7" {
+			t.Errorf("%s: session broken after calls, got=%v, %v", engine, result, err)
+		}
+	}
+}
+
+func TestSessionStreams(t *testing.T) {
+	program := `
+(def shout (lambda (n) (print "line" n (list n "x") {"k" n})))
+(shout 1)
+(print)
+(print "a" true null)
+(shout 2)
+`
+	expected := "line 1 (1 x) {k: 1}\n\na true null\nline 2 (2 x) {k: 2}\n"
+
+	for _, engine := range testEngines {
+		var out strings.Builder
+
+		s := NewSession(engine)
+		s.Stdout = &out
+
+		if _, err := s.Eval(program); err != nil {
+			t.Fatalf("%s: failed to run: %s", engine, err)
+		}
+
+		if _, err := s.Call("shout", &object.Number{Value: 3}); err != nil {
+			t.Fatalf("%s: failed to call shout: %s", engine, err)
+		}
+
+		// Builtins called directly write to the Session's streams too.
+		if _, err := s.Call("print", &object.String{Value: "called"}); err != nil {
+			t.Fatalf("%s: failed to call print: %s", engine, err)
+		}
+
+		if out.String() != expected+"line 3 (3 x) {k: 3}\ncalled\n" {
+			t.Errorf("%s: wrong output. want=%q, got=%q", engine, expected, out.String())
+		}
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	for _, engine := range testEngines {
+		s := NewSession(engine)
+
+		var parseErr *ParseError
+
+		_, err := s.Eval("(+ 1 2))\n(def a (+ 1")
+
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("%s: expected a ParseError, got=%T %v", engine, err, err)
+		}
+
+		if len(parseErr.Errors) == 0 {
+			t.Errorf("%s: ParseError has no messages", engine)
+		}
+
+		var runtimeErr *RuntimeError
+
+		_, err = s.Eval("(def f (lambda (x) (x 1)))\n(f 2)")
+
+		if !errors.As(err, &runtimeErr) {
+			t.Fatalf("%s: expected a RuntimeError, got=%T %v", engine, err, err)
+		}
+
+		if runtimeErr.Engine != engine {
+			t.Errorf("%s: wrong engine for RuntimeError, got=%s", engine, runtimeErr.Engine)
+		}
+
+		// Only the VM keeps a trace of the functions being called.
+		if engine == VM_ENGINE && (len(runtimeErr.Trace) == 0 || runtimeErr.Trace[0].Name != "f") {
+			t.Errorf("%s: wrong trace, got=%+v", engine, runtimeErr.Trace)
+		}
+
+		var errObj *object.ErrorObject
+
+		_, err = s.Eval(`(get (dict) (list))`)
+
+		if !errors.As(err, &errObj) {
+			t.Fatalf("%s: expected an ErrorObject, got=%T %v", engine, err, err)
+		}
+
+		if errObj.Kind != object.KEY_ERROR {
+			t.Errorf("%s: wrong kind of error. want=%s, got=%s", engine, object.KEY_ERROR, errObj.Kind)
+		}
+	}
+
+	var compileErr *CompileError
+
+	if _, err := NewSession(VM_ENGINE).Eval("(def a (+ 1 z))"); !errors.As(err, &compileErr) {
+		t.Errorf("expected a CompileError, got=%T %v", err, err)
+	}
+}
+
+func TestSessionRand(t *testing.T) {
+	for _, engine := range testEngines {
+		results := []string{}
+
+		for range 2 {
+			s := NewSession(engine)
+			s.Rand = rand.New(rand.NewSource(42))
+
+			result, err := s.Eval("(list (random 1000) (random 1000) (random))")
+
+			if err != nil {
+				t.Fatalf("%s: failed to run: %s", engine, err)
+			}
+
+			results = append(results, result.Inspect())
+		}
+
+		if results[0] != results[1] {
+			t.Errorf("%s: seeded sessions differ. first=%s, second=%s", engine, results[0], results[1])
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package interpreter
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// The semantic version of the interpreter. Release builds set it with
+//
+//	go build -ldflags "-X lisp/interpreter.ReleaseVersion=1.2.3"
+var ReleaseVersion = "dev"
+
+// Information identifying a build of the interpreter.
+type BuildInfo struct {
+	Version   string // the value of ReleaseVersion
+	GoVersion string // the version of Go the interpreter was built with
+	Revision  string // the revision of the source that was built, if known
+	Time      string // the time of the revision, if known
+	Modified  bool   // true if the source had uncommitted changes
+}
+
+// Return the information identifying this build of the interpreter. The
+// revision is only known when built from a version control checkout.
+func Build() BuildInfo {
+	info := BuildInfo{
+		Version:   ReleaseVersion,
+		GoVersion: runtime.Version(),
+	}
+
+	build, ok := debug.ReadBuildInfo()
+
+	if !ok {
+		return info
+	}
+
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.Time = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+
+	return info
+}
+
+// Return a single line describing the build of the interpreter, such as
+// "lisp 1.2.3 (go1.22.0, revision 0de082e 2024-01-02T15:04:05Z)".
+func Version() string {
+	return Build().String()
+}
+
+func (b BuildInfo) String() string {
+	details := []string{b.GoVersion}
+
+	if b.Revision != "" {
+		revision := "revision " + b.Revision[:min(len(b.Revision), 7)]
+
+		if b.Time != "" {
+			revision += " " + b.Time
+		}
+
+		if b.Modified {
+			revision += " modified"
+		}
+
+		details = append(details, revision)
+	}
+
+	return fmt.Sprintf("lisp %s (%s)", b.Version, strings.Join(details, ", "))
+}
@@ -0,0 +1,37 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	defer func(v string) { ReleaseVersion = v }(ReleaseVersion)
+
+	ReleaseVersion = "1.2.3"
+
+	if !strings.HasPrefix(Version(), "lisp 1.2.3 (go") {
+		t.Errorf("wrong version, got=%q", Version())
+	}
+
+	tests := []struct {
+		info     BuildInfo
+		expected string
+	}{
+		{BuildInfo{Version: "1.0.0", GoVersion: "go1.22.0"}, "lisp 1.0.0 (go1.22.0)"},
+		{
+			BuildInfo{Version: "1.0.0", GoVersion: "go1.22.0", Revision: "0de082e8f1c2", Time: "2024-01-02T15:04:05Z"},
+			"lisp 1.0.0 (go1.22.0, revision 0de082e 2024-01-02T15:04:05Z)",
+		},
+		{
+			BuildInfo{Version: "dev", GoVersion: "go1.22.0", Revision: "0de082e", Modified: true},
+			"lisp dev (go1.22.0, revision 0de082e modified)",
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.info.String() != tt.expected {
+			t.Errorf("wrong description. want=%q, got=%q", tt.expected, tt.info.String())
+		}
+	}
+}
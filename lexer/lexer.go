@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"lisp/token"
+	"strings"
 )
 
 const EOF byte = 0
@@ -16,18 +17,30 @@ type Lexer struct {
 	pos     int    // The current character position in the text.
 	readPos int    // The position of the next character.
 	ch      byte   // The currently highlighted character.
+	line    int    // The line of the current character.
+	start   int    // The position of the first character of the line.
 }
 
 // Create a new lexer object that will tokenize the given
 // input text.
+//
+// If the input starts with a shebang line, such as
+// #!/usr/bin/env lisp, the line is skipped so that scripts
+// can be executable. It still counts as the first line.
 func New(input string) *Lexer {
 	l := &Lexer{
 		Input: input,
+		line:  1,
+		pos:   -1,
 	}
 
-	l.pos = 0
-	l.readPos = 1
-	l.ch = l.Input[l.pos]
+	l.readChar()
+
+	if strings.HasPrefix(input, "#!") {
+		for l.ch != '\n' && l.ch != EOF {
+			l.readChar()
+		}
+	}
 
 	return l
 }
@@ -39,6 +52,8 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.skipWhitespace()
 
+	line, column := l.line, l.pos-l.start+1
+
 	switch {
 	case l.ch == '(':
 		tok.Type = token.LPAREN
@@ -61,16 +76,20 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = string(l.ch)
 		l.readChar()
 	case l.ch == '-':
-		if isNumber(l.peekChar()) {
+		if l.isNumberAt(1) {
 			l.readChar()
 			tok = l.readNumber()
 			tok.Literal = "-" + tok.Literal
 		} else {
 			tok = l.readIdent()
 		}
+	case l.ch == ':' && isValidIdentChar(l.peekChar()):
+		l.readChar()
+		tok = l.readIdent()
+		tok.Type = token.KEYWORD
 	case l.ch == '"':
 		tok = l.readString()
-	case isNumber(l.ch):
+	case l.isNumberAt(0):
 		tok = l.readNumber()
 	case isValidIdentChar(l.ch):
 		tok = l.readIdent()
@@ -82,6 +101,9 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = string(l.ch)
 	}
 
+	tok.Line = line
+	tok.Column = column
+
 	return tok
 }
 
@@ -91,6 +113,11 @@ func (l *Lexer) NextToken() token.Token {
 // If the read position is beyond the end of
 // the input, return EOF.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.start = l.pos + 1
+	}
+
 	l.pos++
 	l.readPos = l.pos + 1
 
@@ -106,13 +133,29 @@ func (l *Lexer) readChar() {
 // If the read position is beyond the end of
 // the input, return EOF.
 func (l *Lexer) peekChar() byte {
-	if l.readPos >= len(l.Input)+1 {
+	if l.readPos >= len(l.Input) {
 		return EOF
 	}
 
 	return l.Input[l.readPos]
 }
 
+// Report whether a number starts at the offset from the current character,
+// either with a digit or with a dot followed by a digit, such as .5.
+func (l *Lexer) isNumberAt(offset int) bool {
+	pos := l.pos + offset
+
+	if pos >= len(l.Input) {
+		return false
+	}
+
+	if isNumber(l.Input[pos]) {
+		return true
+	}
+
+	return l.Input[pos] == '.' && pos+1 < len(l.Input) && isNumber(l.Input[pos+1])
+}
+
 // Read characters until either reaching whitespace or
 // a reserved character. Return a Token of type number
 // with the literal value of a string of the read characters.
@@ -171,8 +214,17 @@ func (l *Lexer) readString() token.Token {
 	}
 }
 
+// Skip whitespace and comments, which run from a ; to the end of the line.
 func (l *Lexer) skipWhitespace() {
-	for isWhitespace(l.ch) {
+	for isWhitespace(l.ch) || l.ch == ';' {
+		if l.ch == ';' {
+			for l.ch != '\n' && l.ch != EOF {
+				l.readChar()
+			}
+
+			continue
+		}
+
 		l.readChar()
 	}
 }
@@ -190,6 +242,7 @@ func isReservedChar(ch byte) bool {
 		')': true,
 		'{': true,
 		'}': true,
+		';': true,
 		EOF: true,
 	}
 
@@ -18,94 +18,140 @@ func TestLexer(t *testing.T) {
 		{
 			Type:    token.LPAREN,
 			Literal: "(",
+			Line:    2,
+			Column:  5,
 		},
 		{
 			Type:    token.IDENT,
 			Literal: "add",
+			Line:    2,
+			Column:  6,
 		},
 		{
 			Type:    token.LPAREN,
 			Literal: "(",
+			Line:    3,
+			Column:  9,
 		},
 		{
 			Type:    token.IDENT,
 			Literal: "+",
+			Line:    3,
+			Column:  10,
 		},
 		{
 			Type:    token.NUM,
 			Literal: "1",
+			Line:    3,
+			Column:  12,
 		},
 		{
 			Type:    token.NUM,
 			Literal: "2",
+			Line:    3,
+			Column:  14,
 		},
 		{
 			Type:    token.RPAREN,
 			Literal: ")",
+			Line:    3,
+			Column:  15,
 		},
 		{
 			Type:    token.LPAREN,
 			Literal: "(",
+			Line:    4,
+			Column:  9,
 		},
 		{
 			Type:    token.IDENT,
 			Literal: "-",
+			Line:    4,
+			Column:  10,
 		},
 		{
 			Type:    token.NUM,
 			Literal: "18",
+			Line:    4,
+			Column:  12,
 		},
 		{
 			Type:    token.NUM,
 			Literal: "-1",
+			Line:    4,
+			Column:  15,
 		},
 		{
 			Type:    token.NUM,
 			Literal: "2",
+			Line:    4,
+			Column:  18,
 		},
 		{
 			Type:    token.RPAREN,
 			Literal: ")",
+			Line:    4,
+			Column:  19,
 		},
 		{
 			Type:    token.RPAREN,
 			Literal: ")",
+			Line:    4,
+			Column:  20,
 		},
 		{
 			Type:    token.QUOTE,
 			Literal: "'",
+			Line:    5,
+			Column:  5,
 		},
 		{
 			Type:    token.LPAREN,
 			Literal: "(",
+			Line:    5,
+			Column:  6,
 		},
 		{
 			Type:    token.IDENT,
 			Literal: "list",
+			Line:    5,
+			Column:  7,
 		},
 		{
 			Type:    token.RPAREN,
 			Literal: ")",
+			Line:    5,
+			Column:  11,
 		},
 		{
 			Type:    token.STRING,
 			Literal: "hello (string)",
+			Line:    6,
+			Column:  5,
 		},
 		{
 			Type:    token.LBRACE,
 			Literal: "{",
+			Line:    7,
+			Column:  5,
 		},
 		{
 			Type:    token.NUM,
 			Literal: "12.4",
+			Line:    7,
+			Column:  6,
 		},
 		{
 			Type:    token.RBRACE,
 			Literal: "}",
+			Line:    7,
+			Column:  10,
 		},
 		{
 			Type:    token.EOF,
 			Literal: "",
+			Line:    7,
+			Column:  11,
 		},
 	}
 
@@ -119,3 +165,178 @@ func TestLexer(t *testing.T) {
 		}
 	}
 }
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected token.Token
+	}{
+		{"1e6", token.Token{Type: token.NUM, Literal: "1e6", Line: 1, Column: 1}},
+		{"2.5e-3", token.Token{Type: token.NUM, Literal: "2.5e-3", Line: 1, Column: 1}},
+		{"-1e-3", token.Token{Type: token.NUM, Literal: "-1e-3", Line: 1, Column: 1}},
+		{".5", token.Token{Type: token.NUM, Literal: ".5", Line: 1, Column: 1}},
+		{"-.5", token.Token{Type: token.NUM, Literal: "-.5", Line: 1, Column: 1}},
+		{".", token.Token{Type: token.IDENT, Literal: ".", Line: 1, Column: 1}},
+		{"-.", token.Token{Type: token.IDENT, Literal: "-.", Line: 1, Column: 1}},
+		{"a.5", token.Token{Type: token.IDENT, Literal: "a.5", Line: 1, Column: 1}},
+	}
+
+	for _, tt := range tests {
+		if tok := New(tt.input).NextToken(); tok != tt.expected {
+			t.Errorf("wrong token for %q. expected %q, got %q", tt.input, tt.expected, tok)
+		}
+	}
+}
+
+// Ensure a program with comments produces the same tokens as the program
+// without them. Only the columns differ, where comments were removed.
+func TestComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(+ 1 2) ; add", "(+ 1 2)"},
+		{"; a full line\n(+ 1 2)\n", "\n(+ 1 2)\n"},
+		{"(list 1 ; \"(\" ) ' {\n 2)", "(list 1\n 2)"},
+		{"(def x 1)\n; the end", "(def x 1)\n"},
+		{"x;comment", "x"},
+		{"\"a ; b\"", "\"a ; b\""},
+		{";", ""},
+	}
+
+	for _, tt := range tests {
+		commented := New(tt.input)
+		plain := New(tt.expected)
+
+		for {
+			want := plain.NextToken()
+			got := commented.NextToken()
+
+			got.Column, want.Column = 0, 0
+
+			if got != want {
+				t.Errorf("wrong token for %q. expected %q, got %q", tt.input, want, got)
+				break
+			}
+
+			if want.Type == token.EOF {
+				break
+			}
+		}
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{
+			"(get p :name)",
+			[]token.Token{
+				{Type: token.LPAREN, Literal: "(", Line: 1, Column: 1},
+				{Type: token.IDENT, Literal: "get", Line: 1, Column: 2},
+				{Type: token.IDENT, Literal: "p", Line: 1, Column: 6},
+				{Type: token.KEYWORD, Literal: "name", Line: 1, Column: 8},
+				{Type: token.RPAREN, Literal: ")", Line: 1, Column: 13},
+			},
+		},
+		{
+			"{:a-b 1}",
+			[]token.Token{
+				{Type: token.LBRACE, Literal: "{", Line: 1, Column: 1},
+				{Type: token.KEYWORD, Literal: "a-b", Line: 1, Column: 2},
+				{Type: token.NUM, Literal: "1", Line: 1, Column: 7},
+				{Type: token.RBRACE, Literal: "}", Line: 1, Column: 8},
+			},
+		},
+		// A colon without a name after it is an identifier.
+		{
+			": (:)",
+			[]token.Token{
+				{Type: token.IDENT, Literal: ":", Line: 1, Column: 1},
+				{Type: token.LPAREN, Literal: "(", Line: 1, Column: 3},
+				{Type: token.IDENT, Literal: ":", Line: 1, Column: 4},
+				{Type: token.RPAREN, Literal: ")", Line: 1, Column: 5},
+			},
+		},
+		{
+			"a:b",
+			[]token.Token{{Type: token.IDENT, Literal: "a:b", Line: 1, Column: 1}},
+		},
+		// A colon at the end of the input is also an identifier.
+		{
+			":",
+			[]token.Token{
+				{Type: token.IDENT, Literal: ":", Line: 1, Column: 1},
+				{Type: token.EOF, Literal: "", Line: 1, Column: 2},
+			},
+		},
+		{
+			"x :",
+			[]token.Token{
+				{Type: token.IDENT, Literal: "x", Line: 1, Column: 1},
+				{Type: token.IDENT, Literal: ":", Line: 1, Column: 3},
+				{Type: token.EOF, Literal: "", Line: 1, Column: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		for _, expectedToken := range tt.expected {
+			tok := l.NextToken()
+
+			if tok != expectedToken {
+				t.Errorf("wrong token for %q. expected %q, got %q", tt.input, expectedToken, tok)
+			}
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{
+			"#!/usr/bin/env lisp\n(x)",
+			[]token.Token{
+				{Type: token.LPAREN, Literal: "(", Line: 2, Column: 1},
+				{Type: token.IDENT, Literal: "x", Line: 2, Column: 2},
+				{Type: token.RPAREN, Literal: ")", Line: 2, Column: 3},
+				{Type: token.EOF, Literal: "", Line: 2, Column: 4},
+			},
+		},
+		{
+			"#!/usr/bin/env lisp",
+			[]token.Token{{Type: token.EOF, Literal: "", Line: 1, Column: 20}},
+		},
+		{
+			"",
+			[]token.Token{{Type: token.EOF, Literal: "", Line: 1, Column: 1}},
+		},
+		// Only the first line can be a shebang.
+		{
+			"x\n#!y",
+			[]token.Token{
+				{Type: token.IDENT, Literal: "x", Line: 1, Column: 1},
+				{Type: token.IDENT, Literal: "#!y", Line: 2, Column: 1},
+				{Type: token.EOF, Literal: "", Line: 2, Column: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		for _, expectedToken := range tt.expected {
+			tok := l.NextToken()
+
+			if tok != expectedToken {
+				t.Errorf("wrong token for %q. expected %q, got %q", tt.input, expectedToken, tok)
+			}
+		}
+	}
+}
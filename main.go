@@ -2,102 +2,384 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"lisp/ast"
 	"lisp/compiler"
-	"lisp/evaluator"
-	"lisp/lexer"
+	"lisp/interpreter"
 	"lisp/object"
-	"lisp/parser"
 	"lisp/repl"
-	"lisp/vm"
 	"os"
+	"strings"
 )
 
-var engine *string = flag.String("engine", "vm", "enter 'vm' or 'eval'")
+// The status the interpreter exits with, which shows the stage that failed.
+const (
+	exitOK      = 0
+	exitUsage   = 1 // the command line arguments are invalid
+	exitParse   = 2 // a program couldn't be parsed
+	exitCompile = 3 // a program couldn't be compiled
+	exitRuntime = 4 // a program failed while running
+)
 
 func main() {
-	flag.Parse()
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// The settings for a run of the interpreter, taken from the command line.
+type options struct {
+	engine      string
+	expressions expressionList
+	interactive bool     // start the repl after running any files, even when input isn't a terminal
+	disassemble bool     // show the bytecode of the programs instead of running them
+	ast         bool     // show the syntax trees of the programs instead of running them
+	compile     string   // the file to compile to bytecode instead of running
+	output      string   // the file the bytecode is written to
+	printResult bool     // print the result of the last program that's run
+	version     bool     // print the version of the interpreter instead of running anything
+	paths       []string // the files to run
+	args        []string // the arguments passed to the program as *args*
+}
+
+// The expressions passed with -e, in the order they were provided.
+type expressionList []string
+
+func (e *expressionList) String() string {
+	return strings.Join(*e, " ")
+}
+
+func (e *expressionList) Set(value string) error {
+	*e = append(*e, value)
+	return nil
+}
+
+// Parse the command line arguments, not including the name of the program.
+// Errors are reported to errOut, and flag.ErrHelp is returned if help was
+// requested.
+func parseOptions(arguments []string, errOut io.Writer) (*options, error) {
+	opts := &options{}
+
+	flags := flag.NewFlagSet("lisp", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.StringVar(&opts.engine, "engine", "vm", "enter 'vm' or 'eval'")
+	flags.Var(&opts.expressions, "e", "evaluate an expression after any files, can be repeated")
+	flags.BoolVar(&opts.interactive, "i", false, "start the repl after running any files, even when input isn't a terminal")
+	flags.BoolVar(&opts.disassemble, "disassemble", false, "show the bytecode of the programs without running them")
+	flags.BoolVar(&opts.ast, "ast", false, "show the syntax trees of the programs without running them")
+	flags.BoolVar(&opts.printResult, "print-result", false, "print the result of the last program run")
+	flags.BoolVar(&opts.version, "version", false, "print the version of the interpreter and exit")
+	flags.StringVar(&opts.compile, "c", "", "compile the file to bytecode instead of running it")
+	flags.StringVar(&opts.output, "o", "", "the file to write bytecode to with -c, the file's name ending in .lbc by default")
+
+	if err := flags.Parse(arguments); err != nil {
+		return nil, err
+	}
+
+	if opts.engine != "vm" && opts.engine != "eval" {
+		err := fmt.Errorf("unknown engine '%s', enter 'vm' or 'eval'", opts.engine)
+		fmt.Fprintln(errOut, err)
+		return nil, err
+	}
+
+	// Any arguments after -- are passed to the program. Parse consumes a --
+	// that comes before any files, in which case every remaining argument is
+	// passed to the program.
+	opts.paths, opts.args = splitArgs(flags.Args())
+
+	if parsed := arguments[:len(arguments)-flags.NArg()]; len(parsed) > 0 && parsed[len(parsed)-1] == "--" {
+		opts.paths, opts.args = []string{}, flags.Args()
+	}
+
+	return opts, nil
+}
+
+// Run the interpreter with the provided command line arguments, not including
+// the name of the program, returning the status to exit with.
+//
+// Without any files or expressions to run, the repl is started using in and
+// out. If in isn't a terminal, it's run as a program instead, unless -i is
+// passed. Otherwise every file provided, then every expression, is run in
+// order, sharing global state. With -i, the repl is then started with that
+// state. A file of bytecode written with -c is run directly on the VM.
+func run(arguments []string, in io.Reader, out io.Writer, errOut io.Writer) int {
+	opts, err := parseOptions(arguments, errOut)
+
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+
+	if err != nil {
+		return exitUsage
+	}
+
+	if opts.version {
+		fmt.Fprintln(out, interpreter.Version())
+		return exitOK
+	}
+
+	if opts.compile != "" {
+		return compileFile(opts.compile, opts.output, errOut)
+	}
+
+	var sources []source
 
-	switch len(flag.Args()) {
-	// if there are no args provided, evaluate from stdin
-	case 0:
-		if *engine == "eval" {
-			repl.Start(os.Stdin, os.Stdout)
+	switch {
+	case len(opts.paths) == 0 && len(opts.expressions) == 0 && (opts.interactive || isTerminal(in)):
+		if opts.engine == "eval" {
+			repl.Start(in, out)
 		} else {
-			repl.StartCompiled(os.Stdin, os.Stdout)
+			repl.StartCompiled(in, out)
 		}
-		// if a filename is provided, evaluate the code within the file
-	case 1:
-		// Currently, execution of only one file is supported.
-		// There are also no command options.
-		fileContents, err := os.ReadFile(flag.Arg(0))
+
+		return exitOK
+	case len(opts.paths) == 0 && len(opts.expressions) == 0:
+		contents, err := io.ReadAll(in)
 
 		if err != nil {
-			fmt.Fprintf(os.Stderr, err.Error())
-			return
+			fmt.Fprintln(errOut, err)
+			return exitUsage
 		}
 
-		if *engine == "eval" {
-			runFile(string(fileContents))
-		} else {
-			runCompiled(string(fileContents))
-		}
+		sources = []source{{name: "<stdin>", contents: string(contents)}}
 	default:
-		fmt.Fprintf(os.Stderr, "expected only 1 filename")
+		sources, err = readSources(opts.paths, opts.expressions)
+
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return exitUsage
+		}
 	}
-}
 
-// Convert the provided program into an AST, then evluate it.
-func runFile(source string) {
-	l := lexer.New(source)
-	p := parser.New(l)
-	program := p.ParseProgram()
+	for _, src := range sources {
+		if !compiler.IsEncodedBytecode([]byte(src.contents)) {
+			continue
+		}
 
-	if len(p.Errors) > 0 {
-		for _, err := range p.Errors {
-			fmt.Fprintf(os.Stderr, err)
+		if len(sources) > 1 {
+			fmt.Fprintf(errOut, "%s: bytecode can't be run with other programs\n", src.name)
+			return exitUsage
 		}
 
-		return
+		return runBytecode(src, opts, out, errOut)
 	}
 
-	env := object.NewEnvironment(nil)
-	result := evaluator.Evaluate(program, env)
+	if opts.ast || opts.disassemble {
+		return inspect(sources, opts, out, errOut)
+	}
 
-	fmt.Println(result.Inspect())
+	if opts.interactive {
+		return runInteractive(sources, opts, in, out, errOut)
+	}
+
+	return runSources(sources, opts, out, errOut)
 }
 
-// Compile the expressions in the provided program into bytecode, then
-// execute the bytecode on a VM.
-func runCompiled(source string) {
-	l := lexer.New(source)
-	p := parser.New(l)
-	program := p.ParseProgram()
+// Report whether the Reader is a terminal, rather than a file or pipe.
+func isTerminal(r io.Reader) bool {
+	file, ok := r.(*os.File)
 
-	if len(p.Errors) > 0 {
-		for _, err := range p.Errors {
-			fmt.Fprintf(os.Stderr, err)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Split the arguments into the paths of the files to run and the arguments
+// passed to the program, which follow the first --.
+//
+// Without a --, every argument is the path of a file, rather than the first
+// being the script and the rest its arguments, as several files can be run
+// in order. Programs that take arguments are run with a -- before them.
+func splitArgs(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
 		}
+	}
 
-		return
+	return args, []string{}
+}
+
+// Return the sources of the files at the provided paths, followed by the
+// expressions passed with -e.
+func readSources(paths []string, expressions []string) ([]source, error) {
+	sources := []source{}
+
+	for _, path := range paths {
+		fileContents, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, source{name: path, contents: string(fileContents)})
 	}
 
-	c := compiler.New()
-	err := c.Compile(program)
+	for _, expression := range expressions {
+		sources = append(sources, source{name: "-e", contents: expression})
+	}
+
+	return sources, nil
+}
+
+// The source code of a program, along with the name used to report its
+// errors, such as the file it was read from.
+type source struct {
+	name     string
+	contents string
+}
+
+// Convert the source into an AST, reporting any errors prefixed with its name.
+// Returns false if there were errors.
+func parse(src source, errOut io.Writer) (*ast.Program, bool) {
+	program, err := interpreter.Parse(src.contents)
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "compiler error: %s\n", err)
-		return
+		reportError(src, err, errOut)
+		return nil, false
 	}
 
-	v := vm.New(c.Bytecode())
-	err = v.Run()
+	return program, true
+}
+
+// Write the error prefixed with the name of the source it came from. Each
+// problem that stopped the source being parsed is written on its own line.
+func reportError(src source, err error, errOut io.Writer) {
+	var parseErr *interpreter.ParseError
+
+	if errors.As(err, &parseErr) {
+		for _, message := range parseErr.Errors {
+			fmt.Fprintf(errOut, "%s: %s\n", src.name, message)
+		}
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "vm error: %s\n", err)
 		return
 	}
 
-	fmt.Println(v.LastPoppedStackElem().Inspect())
+	fmt.Fprintf(errOut, "%s: %s\n", src.name, err)
+}
+
+// Return the status to exit with after the error, which shows the stage that
+// failed.
+func exitStatus(err error) int {
+	var parseErr *interpreter.ParseError
+	var compileErr *interpreter.CompileError
+
+	switch {
+	case errors.As(err, &parseErr):
+		return exitParse
+	case errors.As(err, &compileErr):
+		return exitCompile
+	default:
+		return exitRuntime
+	}
+}
+
+// Run each of the sources in order in a single Session, so that later sources
+// can use what earlier ones define. Stops at the first source that fails,
+// returning the status to exit with. The result of the last source is only
+// printed with -print-result, so that programs control their output.
+func runSources(sources []source, opts *options, out io.Writer, errOut io.Writer) int {
+	result, status := runInSession(newSession(opts, out, errOut), sources, errOut)
+
+	if status == exitOK && opts.printResult {
+		fmt.Fprintln(out, result.Inspect())
+	}
+
+	return status
+}
+
+// Return a Session using the engine from the options, where the arguments are
+// available to programs as a List of Strings named *args*. Programs print to
+// out and errOut.
+func newSession(opts *options, out io.Writer, errOut io.Writer) *interpreter.Session {
+	session := interpreter.NewSession(interpreter.Engine(opts.engine))
+	session.Set(object.ARGS_NAME, object.ArgsList(opts.args))
+	session.Stdout = out
+	session.Stderr = errOut
+
+	return session
+}
+
+// Run each of the sources in order in the Session, stopping at the first that
+// fails. Returns the result of the last source, along with the status to exit
+// with.
+func runInSession(session *interpreter.Session, sources []source, errOut io.Writer) (object.Object, int) {
+	var result object.Object = object.NULL
+
+	for _, src := range sources {
+		var err error
+		result, err = session.Eval(src.contents)
+
+		if err != nil {
+			reportError(src, err, errOut)
+			return nil, exitStatus(err)
+		}
+
+		for _, warning := range session.Warnings() {
+			fmt.Fprintf(errOut, "%s: warning: %s\n", src.name, warning)
+		}
+	}
+
+	return result, exitOK
+}
+
+// Run the sources, then start the repl with the same Session, so that
+// everything they defined can be used. Errors in the sources are reported,
+// but the repl is still started.
+func runInteractive(sources []source, opts *options, in io.Reader, out io.Writer, errOut io.Writer) int {
+	session := newSession(opts, out, errOut)
+	runInSession(session, sources, errOut)
+
+	repl.Start(in, out, repl.WithSession(session))
+
+	return exitOK
+}
+
+// Show what each of the sources is parsed to with --ast, and the disassembly
+// of the bytecode it compiles to with --disassemble, instead of running it.
+// Sources are compiled in order in the same way as they're run. When there's
+// more than one source, what's shown for each is headed by its name.
+func inspect(sources []source, opts *options, out io.Writer, errOut io.Writer) int {
+	c := interpreter.NewSession(interpreter.VM_ENGINE).Compiler()
+
+	for i, src := range sources {
+		program, ok := parse(src, errOut)
+
+		if !ok {
+			return exitParse
+		}
+
+		if len(sources) > 1 {
+			if i > 0 {
+				fmt.Fprintln(out)
+			}
+
+			fmt.Fprintf(out, "-- %s --\n", src.name)
+		}
+
+		if opts.ast {
+			fmt.Fprint(out, ast.Dump(program))
+		}
+
+		if !opts.disassemble {
+			continue
+		}
+
+		c.Reset()
+		err := c.Compile(program)
+
+		if err != nil {
+			fmt.Fprintf(errOut, "%s: compiler error: %s\n", src.name, err)
+			return exitCompile
+		}
+
+		fmt.Fprint(out, compiler.Disassemble(c.Bytecode()))
+	}
+
+	return exitOK
 }
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"io"
+	"lisp/compiler"
+	"lisp/interpreter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The engines that sources can be run with.
+var engineNames = []string{"eval", "vm"}
+
+func TestRunMultipleFiles(t *testing.T) {
+	tests := []struct {
+		sources   []source
+		ok        bool
+		expected  string
+		errPrefix string
+	}{
+		{
+			sources: []source{
+				{"lib.lisp", "(def double (lambda (x) (* x 2)))\n(def base 20)\n"},
+				{"main.lisp", "(double (+ base 1))\n"},
+			},
+			ok:       true,
+			expected: "42\n",
+		},
+		{
+			sources: []source{
+				{"lib.lisp", "(def double (lambda (x) (* x 2))\n"},
+				{"main.lisp", "(double 21)\n"},
+			},
+			ok:        false,
+			errPrefix: "lib.lisp: ",
+		},
+		{
+			sources: []source{
+				{"lib.lisp", "(def double (lambda (x) (* x 2)))\n"},
+				{"main.lisp", "(double 1 2)\n"},
+				{"never.lisp", "(undefined)\n"},
+			},
+			ok:        false,
+			errPrefix: "main.lisp: ",
+		},
+		{
+			sources: []source{
+				{"main.lisp", "(triple 1)\n"},
+			},
+			ok:        false,
+			errPrefix: "main.lisp: ",
+		},
+	}
+
+	for _, engine := range engineNames {
+		for _, tt := range tests {
+			var out, errOut strings.Builder
+
+			ok := runSources(tt.sources, &options{engine: engine, printResult: true}, &out, &errOut) == exitOK
+
+			if ok != tt.ok {
+				t.Errorf("%s: wrong success for %v. want=%t, got=%t (%q)",
+					engine, tt.sources, tt.ok, ok, errOut.String())
+			}
+
+			if out.String() != tt.expected {
+				t.Errorf("%s: wrong output for %v. want=%q, got=%q",
+					engine, tt.sources, tt.expected, out.String())
+			}
+
+			if tt.errPrefix == "" && errOut.Len() > 0 {
+				t.Errorf("%s: unexpected errors for %v: %q", engine, tt.sources, errOut.String())
+			}
+
+			if tt.errPrefix != "" && !strings.HasPrefix(errOut.String(), tt.errPrefix) {
+				t.Errorf("%s: wrong errors for %v. want prefix %q, got=%q",
+					engine, tt.sources, tt.errPrefix, errOut.String())
+			}
+
+			if strings.Contains(errOut.String(), "never.lisp") {
+				t.Errorf("%s: ran sources after a failure: %q", engine, errOut.String())
+			}
+		}
+	}
+}
+
+func TestExpressionFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.lisp")
+	err := os.WriteFile(path, []byte("(def double (lambda (x) (* x 2)))\n"), 0600)
+
+	if err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-print-result", "-e", "(* 6 7)"}, "42\n"},
+		{[]string{"-print-result", "-e", "(def a 6)", "-e", "(* a 7)"}, "42\n"},
+		{[]string{"-print-result", "-e", "(double 21)", path}, "42\n"},
+		{[]string{"-e", "(* 6 7)"}, ""},
+	}
+
+	for _, engine := range engineNames {
+		for _, tt := range tests {
+			opts, err := parseOptions(tt.args, io.Discard)
+
+			if err != nil {
+				t.Fatalf("failed to parse %q: %s", tt.args, err)
+			}
+
+			sources, err := readSources(opts.paths, opts.expressions)
+
+			if err != nil {
+				t.Fatalf("failed to read sources for %q: %s", tt.args, err)
+			}
+
+			var out, errOut strings.Builder
+
+			opts.engine = engine
+
+			if runSources(sources, opts, &out, &errOut) != exitOK {
+				t.Errorf("%s: failed to run %q: %s", engine, tt.args, errOut.String())
+			}
+
+			if out.String() != tt.expected {
+				t.Errorf("%s: wrong output for %q. want=%q, got=%q",
+					engine, tt.args, tt.expected, out.String())
+			}
+		}
+	}
+}
+
+func TestScriptArgs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.lisp")
+	err := os.WriteFile(path, []byte("(str (len *args*) \" \" (first *args*))\n"), 0600)
+
+	if err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+
+	opts, err := parseOptions([]string{path, "--", "one", "two"}, io.Discard)
+
+	if err != nil {
+		t.Fatalf("failed to parse arguments: %s", err)
+	}
+
+	if !slices.Equal(opts.paths, []string{path}) || !slices.Equal(opts.args, []string{"one", "two"}) {
+		t.Fatalf("wrong split: paths=%q args=%q", opts.paths, opts.args)
+	}
+
+	opts, err = parseOptions([]string{"-e", "*args*", "--", "one"}, io.Discard)
+
+	if err != nil {
+		t.Fatalf("failed to parse arguments: %s", err)
+	}
+
+	if len(opts.paths) != 0 || !slices.Equal(opts.args, []string{"one"}) {
+		t.Fatalf("wrong split: paths=%q args=%q", opts.paths, opts.args)
+	}
+
+	// Without --, every argument is a file to run.
+	opts, err = parseOptions([]string{path, "one"}, io.Discard)
+
+	if err != nil {
+		t.Fatalf("failed to parse arguments: %s", err)
+	}
+
+	if !slices.Equal(opts.paths, []string{path, "one"}) || len(opts.args) != 0 {
+		t.Fatalf("wrong split: paths=%q args=%q", opts.paths, opts.args)
+	}
+
+	sources, err := readSources([]string{path}, nil)
+
+	if err != nil {
+		t.Fatalf("failed to read sources: %s", err)
+	}
+
+	args := []string{"one", "two"}
+
+	for _, engine := range engineNames {
+		var out, errOut strings.Builder
+
+		if runSources(sources, &options{engine: engine, args: args, printResult: true}, &out, &errOut) != exitOK {
+			t.Errorf("%s: failed to run script: %s", engine, errOut.String())
+		}
+
+		if out.String() != "2 one\n" {
+			t.Errorf("%s: wrong output. want=%q, got=%q", engine, "2 one\n", out.String())
+		}
+
+		out.Reset()
+		runSources([]source{{"-e", "(len *args*)"}}, &options{engine: engine, printResult: true}, &out, &errOut)
+
+		if out.String() != "0\n" {
+			t.Errorf("%s: expected no arguments, got=%q", engine, out.String())
+		}
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.lisp")
+	err := os.WriteFile(path, []byte("(def a (+ 1 2)\n"), 0600)
+
+	if err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"-e", "(+ 1 2)"}, exitOK},
+		{[]string{"-engine", "eval", "-e", "(+ 1 2)"}, exitOK},
+		{[]string{"-h"}, exitOK},
+		{[]string{"-engine", "jit", "-e", "(+ 1 2)"}, exitUsage},
+		{[]string{"-unknown"}, exitUsage},
+		{[]string{filepath.Join(filepath.Dir(path), "missing.lisp")}, exitUsage},
+		{[]string{path}, exitParse},
+		{[]string{"-engine", "eval", path}, exitParse},
+		{[]string{"-e", "(+ 1"}, exitParse},
+		{[]string{"-e", "(+ 1 z)"}, exitCompile},
+		{[]string{"-e", "(len 1)"}, exitRuntime},
+		{[]string{"-engine", "eval", "-e", "(len 1)"}, exitRuntime},
+		{[]string{"-engine", "eval", "-e", "(+ 1 z)"}, exitRuntime},
+	}
+
+	for _, tt := range tests {
+		var out, errOut strings.Builder
+
+		status := run(tt.args, strings.NewReader(""), &out, &errOut)
+
+		if status != tt.expected {
+			t.Errorf("wrong status for %q. want=%d, got=%d (%q)", tt.args, tt.expected, status, errOut.String())
+		}
+
+		if status != exitOK && errOut.Len() == 0 {
+			t.Errorf("no error reported for %q", tt.args)
+		}
+	}
+}
+
+func TestPipedInput(t *testing.T) {
+	tests := []struct {
+		args     []string
+		input    string
+		expected string
+		status   int
+	}{
+		{[]string{"-print-result"}, "(def a 2)\n(* a 21)\n", "42\n", exitOK},
+		{[]string{"-engine", "eval", "-print-result"}, "(def a 2)\n(* a 21)\n", "42\n", exitOK},
+		{nil, "(def a 2)\n(print a)\n", "2\n", exitOK},
+		{nil, "(+ 1\n", "", exitParse},
+		{[]string{"-engine", "eval"}, "(len 1)\n", "", exitRuntime},
+		{nil, "(+ 1 z)\n", "", exitCompile},
+		// The repl can still be used with a pipe.
+		{[]string{"-i"}, "(def a 2)\n(* a 21)\n", ">>> 2\n>>> 42\n>>> ", exitOK},
+		{[]string{"-i", "-engine", "eval"}, "(def a 2)\n(* a 21)\n", ">>> 2\n>>> 42\n>>> ", exitOK},
+	}
+
+	for _, tt := range tests {
+		var out, errOut strings.Builder
+
+		status := run(tt.args, strings.NewReader(tt.input), &out, &errOut)
+
+		if status != tt.status {
+			t.Errorf("wrong status for %q with %q. want=%d, got=%d (%q)",
+				tt.args, tt.input, tt.status, status, errOut.String())
+		}
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q with %q. want=%q, got=%q",
+				tt.args, tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	expected, err := os.ReadFile(filepath.Join("testdata", "disassemble.golden"))
+
+	if err != nil {
+		t.Fatalf("failed to read golden file: %s", err)
+	}
+
+	var out, errOut strings.Builder
+
+	status := run([]string{"--disassemble", filepath.Join("testdata", "disassemble.lsp")}, nil, &out, &errOut)
+
+	if status != exitOK {
+		t.Fatalf("wrong status. want=%d, got=%d (%q)", exitOK, status, errOut.String())
+	}
+
+	if out.String() != string(expected) {
+		t.Errorf("wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+
+	// Nothing is run, and errors stop the disassembly.
+	tests := []struct {
+		args   []string
+		status int
+	}{
+		{[]string{"--disassemble", "-e", "(+ 1"}, exitParse},
+		{[]string{"--disassemble", "-e", "(+ 1 z)"}, exitCompile},
+		{[]string{"--disassemble", "-e", "(len 1)"}, exitOK},
+	}
+
+	for _, tt := range tests {
+		var out, errOut strings.Builder
+
+		status := run(tt.args, nil, &out, &errOut)
+
+		if status != tt.status {
+			t.Errorf("wrong status for %q. want=%d, got=%d", tt.args, tt.status, status)
+		}
+	}
+}
+
+func TestAst(t *testing.T) {
+	expected, err := os.ReadFile(filepath.Join("testdata", "ast.golden"))
+
+	if err != nil {
+		t.Fatalf("failed to read golden file: %s", err)
+	}
+
+	var out, errOut strings.Builder
+
+	status := run([]string{"--ast", filepath.Join("testdata", "ast.lsp")}, nil, &out, &errOut)
+
+	if status != exitOK {
+		t.Fatalf("wrong status. want=%d, got=%d (%q)", exitOK, status, errOut.String())
+	}
+
+	if out.String() != string(expected) {
+		t.Errorf("wrong syntax tree.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+
+	tests := []struct {
+		args     []string
+		expected string
+		status   int
+	}{
+		{[]string{"--ast", "-e", "(len 1)"}, "Program\n  SExpression line 1\n    Identifier len line 1\n    FloatLiteral 1 line 1\n", exitOK},
+		{[]string{"--ast", "-e", "(+ 1"}, "", exitParse},
+		// Undefined variables aren't reported, since nothing is compiled.
+		{[]string{"--ast", "-e", "z"}, "Program\n  Identifier z line 1\n", exitOK},
+		{
+			[]string{"--ast", "--disassemble", "-e", "1"},
+			"Program\n  FloatLiteral 1 line 1\nmain:\n0000 OpConstant 0             ; 1\n0003 OpPop\n",
+			exitOK,
+		},
+	}
+
+	for _, tt := range tests {
+		var out, errOut strings.Builder
+
+		status := run(tt.args, nil, &out, &errOut)
+
+		if status != tt.status {
+			t.Errorf("wrong status for %q. want=%d, got=%d", tt.args, tt.status, status)
+		}
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.args, tt.expected, out.String())
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script")
+	err := os.WriteFile(path, []byte("#!/usr/bin/env lisp\n(def a 6)\n(print (* a 7))\n"), 0700)
+
+	if err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+
+	broken := filepath.Join(t.TempDir(), "broken")
+	err = os.WriteFile(broken, []byte("#!/usr/bin/env lisp\n(len 1)\n"), 0700)
+
+	if err != nil {
+		t.Fatalf("failed to write %s: %s", broken, err)
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		var out, errOut strings.Builder
+
+		status := run([]string{"-engine", engine, path}, nil, &out, &errOut)
+
+		if status != exitOK || out.String() != "42\n" || errOut.Len() > 0 {
+			t.Errorf("%s: script with a shebang failed. status=%d, out=%q, errOut=%q",
+				engine, status, out.String(), errOut.String())
+		}
+	}
+
+	// The shebang still counts as the first line.
+	var out, errOut strings.Builder
+
+	if status := run([]string{broken}, nil, &out, &errOut); status != exitRuntime {
+		t.Errorf("wrong status. want=%d, got=%d", exitRuntime, status)
+	}
+
+	if !strings.Contains(errOut.String(), "at line 2") {
+		t.Errorf("wrong line in error: %q", errOut.String())
+	}
+}
+
+func TestBytecodeFiles(t *testing.T) {
+	dir := t.TempDir()
+	fixture := filepath.Join("testdata", "bytecode.lsp")
+	output := filepath.Join(dir, "program.lbc")
+
+	var out, errOut strings.Builder
+
+	if status := run([]string{"-c", fixture, "-o", output}, nil, &out, &errOut); status != exitOK {
+		t.Fatalf("failed to compile %s: status=%d %q", fixture, status, errOut.String())
+	}
+
+	var sourceOut, bytecodeOut strings.Builder
+
+	run([]string{"-print-result", fixture, "--", "x"}, nil, &sourceOut, &errOut)
+	status := run([]string{"-print-result", output, "--", "x"}, nil, &bytecodeOut, &errOut)
+
+	if status != exitOK || errOut.Len() > 0 {
+		t.Fatalf("failed to run %s: status=%d %q", output, status, errOut.String())
+	}
+
+	if bytecodeOut.String() != sourceOut.String() || sourceOut.String() != "(610 3 1)\n" {
+		t.Errorf("wrong output running bytecode. want=%q, got=%q", sourceOut.String(), bytecodeOut.String())
+	}
+
+	// Without -o, the bytecode is written next to the source.
+	source := filepath.Join(dir, "script.lsp")
+	writeTestFile(t, source, "(+ 1 2)\n")
+
+	if status := run([]string{"-c", source}, nil, &out, &errOut); status != exitOK {
+		t.Fatalf("failed to compile %s: status=%d %q", source, status, errOut.String())
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "script.lbc")); err != nil {
+		t.Errorf("bytecode not written to the default path: %s", err)
+	}
+
+	data, err := os.ReadFile(output)
+
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", output, err)
+	}
+
+	truncated := filepath.Join(dir, "truncated.lbc")
+	writeTestFile(t, truncated, string(data[:len(data)/2]))
+
+	wrongVersion := filepath.Join(dir, "version.lbc")
+	data[len(compiler.BYTECODE_MAGIC)+3]++
+	writeTestFile(t, wrongVersion, string(data))
+
+	tests := []struct {
+		args     []string
+		status   int
+		expected string
+	}{
+		{[]string{truncated}, exitParse, truncated + ": bytecode is truncated\n"},
+		{[]string{wrongVersion}, exitParse, wrongVersion + ": bytecode version 5 isn't supported, expected version 4\n"},
+		{[]string{"-e", "1", output}, exitUsage, output + ": bytecode can't be run with other programs\n"},
+		{[]string{"-c", filepath.Join(dir, "missing.lsp")}, exitUsage, ""},
+		{[]string{"-c", fixture, "-o", filepath.Join(dir, "missing", "out.lbc")}, exitUsage, ""},
+	}
+
+	for _, tt := range tests {
+		var out, errOut strings.Builder
+
+		status := run(tt.args, nil, &out, &errOut)
+
+		if status != tt.status {
+			t.Errorf("wrong status for %q. want=%d, got=%d (%q)", tt.args, tt.status, status, errOut.String())
+		}
+
+		if tt.expected != "" && errOut.String() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.args, tt.expected, errOut.String())
+		}
+	}
+}
+
+func writeTestFile(t *testing.T, path string, contents string) {
+	t.Helper()
+
+	err := os.WriteFile(path, []byte(contents), 0600)
+
+	if err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+}
+
+func TestPrintResult(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-e", "(def a (+ 1 2))"}, ""},
+		{[]string{"-e", "(def a (+ 1 2)) (print a)"}, "3\n"},
+		{[]string{"-print-result", "-e", "(def a (+ 1 2))"}, "3\n"},
+		{[]string{"-print-result", "-e", "(def a (+ 1 2)) (print a)"}, "3\nnull\n"},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		for _, tt := range tests {
+			var out, errOut strings.Builder
+
+			args := append([]string{"-engine", engine}, tt.args...)
+			status := run(args, nil, &out, &errOut)
+
+			if status != exitOK {
+				t.Errorf("%s: failed to run %q: %q", engine, tt.args, errOut.String())
+			}
+
+			if out.String() != tt.expected {
+				t.Errorf("%s: wrong output for %q. want=%q, got=%q", engine, tt.args, tt.expected, out.String())
+			}
+		}
+	}
+}
+
+func TestVersionFlag(t *testing.T) {
+	defer func(v string) { interpreter.ReleaseVersion = v }(interpreter.ReleaseVersion)
+
+	interpreter.ReleaseVersion = "1.2.3"
+
+	var out, errOut strings.Builder
+
+	// Nothing is run when the version is requested.
+	status := run([]string{"--version", "-e", "(print 1)"}, nil, &out, &errOut)
+
+	if status != exitOK {
+		t.Fatalf("wrong status, got=%d: %q", status, errOut.String())
+	}
+
+	if !strings.HasPrefix(out.String(), "lisp 1.2.3 (go") || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("wrong output for --version, got=%q", out.String())
+	}
+}
+
+func TestInteractiveAfterFiles(t *testing.T) {
+	dir := t.TempDir()
+	defs := filepath.Join(dir, "defs.lisp")
+	broken := filepath.Join(dir, "broken.lisp")
+
+	writeTestFile(t, defs, "(def double (lambda (x) (* x 2)))\n(def base 20)\n")
+	writeTestFile(t, broken, "(def half (lambda (x) (/ x 2)))\n(len 1)\n")
+
+	tests := []struct {
+		args     []string
+		input    string
+		expected string
+		errors   string
+	}{
+		{
+			[]string{"-i", defs},
+			"(double (+ base 1))\n",
+			">>> 42\n>>> ",
+			"",
+		},
+		{
+			[]string{"-i", "-e", "(def base 1)", defs, "--", "a"},
+			"(double base)\n(first *args*)\n",
+			">>> 2\n>>> a\n>>> ",
+			"",
+		},
+		// What's defined before the error is still available.
+		{
+			[]string{"-i", broken},
+			"(half 8)\n",
+			">>> 4\n>>> ",
+			broken + ": ",
+		},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		for _, tt := range tests {
+			var out, errOut strings.Builder
+
+			args := append([]string{"-engine", engine}, tt.args...)
+			status := run(args, strings.NewReader(tt.input), &out, &errOut)
+
+			if status != exitOK {
+				t.Errorf("%s: wrong status for %q, got=%d", engine, tt.args, status)
+			}
+
+			if out.String() != tt.expected {
+				t.Errorf("%s: wrong output for %q. want=%q, got=%q", engine, tt.args, tt.expected, out.String())
+			}
+
+			if !strings.HasPrefix(errOut.String(), tt.errors) || (tt.errors == "") != (errOut.Len() == 0) {
+				t.Errorf("%s: wrong errors for %q. want prefix %q, got=%q", engine, tt.args, tt.errors, errOut.String())
+			}
+		}
+	}
+}
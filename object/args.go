@@ -0,0 +1,16 @@
+package object
+
+// The name of the global variable holding the arguments passed to a program.
+const ARGS_NAME = "*args*"
+
+// Return a List of Strings holding the provided arguments, to be defined as
+// ARGS_NAME.
+func ArgsList(args []string) *List {
+	values := []Object{}
+
+	for _, arg := range args {
+		values = append(values, &String{Value: arg})
+	}
+
+	return &List{Values: values}
+}
@@ -3,7 +3,7 @@ package object
 import (
 	"bytes"
 	"fmt"
-	"strings"
+	"math"
 )
 
 var TRUE = &BooleanObject{Value: true}
@@ -11,7 +11,10 @@ var FALSE = &BooleanObject{Value: false}
 var NULL = &Null{}
 
 // A map of all the built in functions in the interpreter
-
+//
+// The builtins are shared by every program running at once, and are never
+// changed after the program starts. Compiled bytecode refers to them by their
+// index, so they mustn't be reordered.
 var Builtins = []*FunctionObject{
 	{
 		"+",
@@ -28,7 +31,7 @@ var Builtins = []*FunctionObject{
                 result += num.Value
 			}
 
-			return &Number{Value: result}
+			return NewNumber(result)
 		},
 	},
 	{
@@ -40,13 +43,13 @@ var Builtins = []*FunctionObject{
                 num, ok := arg.(*Number)
 
                 if !ok {
-					return BadTypeError("+", arg)
+					return BadTypeError("*", arg)
                 }
 
                 result *= num.Value
 			}
 
-			return &Number{Value: result}
+			return NewNumber(result)
 		},
 	},
 	{
@@ -62,14 +65,14 @@ var Builtins = []*FunctionObject{
                 num, ok := arg.(*Number)
 
                 if !ok {
-					return BadTypeError("+", arg)
+					return BadTypeError("-", arg)
                 }
 
 				nums = append(nums, num.Value)
 			}
 
 			if len(nums) == 1 {
-				return &Number{Value: -nums[0]}
+				return NewNumber(-nums[0])
 			} else {
 				result := nums[0]
 
@@ -77,7 +80,7 @@ var Builtins = []*FunctionObject{
 					result -= num
 				}
 
-				return &Number{Value: result}
+				return NewNumber(result)
 			}
 		},
 	},
@@ -94,26 +97,27 @@ var Builtins = []*FunctionObject{
                 num, ok := arg.(*Number)
 
                 if !ok {
-					return BadTypeError("/", num)
+					return BadTypeError("/", arg)
                 }
                 nums = append(nums, num.Value)
 			}
 
 			if len(nums) == 1 {
-				return &Number{Value: 1 / nums[0]}
+				return NewNumber(1 / nums[0])
 			} else {
 				result := nums[0]
 
 				for _, num := range nums[1:] {
 					if num == 0 {
 						return &ErrorObject{
-							Error: "Attempted to divide by 0",
+							Kind:    VALUE_ERROR,
+							Message: "Attempted to divide by 0",
 						}
 					}
 					result /= num
 				}
 
-				return &Number{Value: result}
+				return NewNumber(result)
 			}
 		},
 	},
@@ -128,7 +132,7 @@ var Builtins = []*FunctionObject{
             num, ok := args[0].(*Number)
 
             if !ok {
-                return BadTypeError("rem", num)
+                return BadTypeError("rem", args[0])
             }
 
             top := num.Value
@@ -136,22 +140,20 @@ var Builtins = []*FunctionObject{
             num, ok = args[1].(*Number)
 
             if !ok {
-                return BadTypeError("rem", num)
+                return BadTypeError("rem", args[1])
             }
 
             bottom := num.Value
 
 			if bottom == 0 {
 				return &ErrorObject{
-					Error: "Attempted rem of 0",
+					Kind:    VALUE_ERROR,
+					Message: "Attempted rem of 0",
 				}
 			}
 
-            for (top >= bottom) {
-                top -= bottom
-            }
-
-            return &Number{Value: top}
+            // The remainder has the sign of top, in the same way as Go's %.
+            return NewNumber(math.Mod(top, bottom))
 		},
 	},
 	// Analogous to `==` in other languages, but with any amount of arguments
@@ -162,22 +164,13 @@ var Builtins = []*FunctionObject{
 				return TRUE
 			}
 
-			obj := args[0]
-
-			switch obj := obj.(type) {
-			case *Number:
-				return numsEqual(obj.Value, args[1:]...)
-			case *String:
-				return stringsEqual(obj, args[1:]...)
-			case *BooleanObject:
-				return boolEqual(obj, args[1:]...)
-			case *LambdaObject:
-				return lambdasEqual(obj, args[1:]...)
-			case *FunctionObject:
-				return functionsEqual(obj, args[1:]...)
-			default:
-				return BadTypeError("=", obj)
+			for _, arg := range args[1:] {
+				if !Equals(args[0], arg) {
+					return FALSE
+				}
 			}
+
+			return TRUE
 		},
 	},
 	{
@@ -363,15 +356,7 @@ var Builtins = []*FunctionObject{
 				return BadTypeError("rest", args[0])
 			}
 
-			list := args[0].(*List)
-
-			if len(list.Values) == 0 {
-				return NULL
-			}
-
-			return &List{
-				Values: list.Values[1:],
-			}
+			return args[0].(*List).Rest()
 		},
 	},
 	{
@@ -404,10 +389,13 @@ var Builtins = []*FunctionObject{
 			switch args[0].Type() {
 			case LIST_OBJ:
 				list := args[0].(*List)
-				return &Number{Value: float64(len(list.Values))}
+				return NewNumber(float64(len(list.Values)))
 			case STRING_OBJ:
 				str := args[0].(*String)
-				return &Number{Value: float64(len(str.Value))}
+				return NewNumber(float64(len(str.Value)))
+			case BYTES_OBJ:
+				data := args[0].(*Bytes)
+				return NewNumber(float64(len(data.Value)))
 			default:
 				return BadTypeError("len", args[0])
 			}
@@ -426,19 +414,13 @@ var Builtins = []*FunctionObject{
 
 			if args[0].Type() != LIST_OBJ {
 				return &ErrorObject{
-					Error: fmt.Sprintf("first argument to push should be list. got=%T(%+v)",
+					Kind: TYPE_ERROR,
+					Message: fmt.Sprintf("first argument to push should be list. got=%T(%+v)",
 						args[0], args[0]),
 				}
 			}
 
-			list := args[0].(*List)
-
-			newList := make([]Object, len(list.Values))
-			copy(newList, list.Values)
-
-			newList = append(newList, args[1])
-
-			return &List{Values: newList}
+			return args[0].(*List).Push(args[1])
 		},
 	},
 	// string representation of any object
@@ -451,23 +433,13 @@ var Builtins = []*FunctionObject{
 				result.WriteString(arg.Inspect())
 			}
 
-			return &String{
-				Value: result.String(),
-			}
+			return NewString(result.String())
 		},
 	},
 	{
 		"print",
 		func(args ...Object) Object {
-			objects := []string{}
-
-			for _, arg := range args {
-				objects = append(objects, arg.Inspect())
-			}
-
-			fmt.Println(strings.Join(objects, " "))
-
-			return NULL
+			return printValues(nil, args...)
 		},
 	},
 	// Used to retrieve an item from a dictionary.
@@ -478,7 +450,11 @@ var Builtins = []*FunctionObject{
 		"get",
 		func(args ...Object) Object {
 			if len(args) != 2 {
-				WrongNumOfArgsError("get", "2", len(args))
+				return WrongNumOfArgsError("get", "2", len(args))
+			}
+
+			if data, ok := args[0].(*Bytes); ok {
+				return getByte(data, args[1])
 			}
 
 			dictObj := args[0]
@@ -487,14 +463,15 @@ var Builtins = []*FunctionObject{
 			if dictObj.Type() != DICT_OBJ {
 				err := fmt.Sprintf("attempted to get from %s(%s) instead of dict", dictObj.Type(), dictObj.Inspect())
 				return &ErrorObject{
-					Error: err,
+					Kind:    TYPE_ERROR,
+					Message: err,
 				}
 			}
 			dict := dictObj.(*Dictionary)
 
 			key, ok := keyObj.(Hashable)
 			if !ok {
-				BadKeyError(keyObj)
+				return BadKeyError(keyObj)
 			}
 
 			result, ok := dict.Values[key.HashKey()]
@@ -514,7 +491,11 @@ var Builtins = []*FunctionObject{
 		"set",
 		func(args ...Object) Object {
 			if len(args) != 3 {
-				WrongNumOfArgsError("get", "3", len(args))
+				return WrongNumOfArgsError("set", "3", len(args))
+			}
+
+			if data, ok := args[0].(*Bytes); ok {
+				return setByte(data, args[1], args[2])
 			}
 
 			dictObj := args[0]
@@ -524,14 +505,15 @@ var Builtins = []*FunctionObject{
 			if dictObj.Type() != DICT_OBJ {
 				err := fmt.Sprintf("attempted to get from %s(%s) instead of dict", dictObj.Type(), dictObj.Inspect())
 				return &ErrorObject{
-					Error: err,
+					Kind:    TYPE_ERROR,
+					Message: err,
 				}
 			}
 
 			key, ok := keyObj.(Hashable)
 
 			if !ok {
-				BadKeyError(keyObj)
+				return BadKeyError(keyObj)
 			}
 
 			dict := dictObj.(*Dictionary)
@@ -543,6 +525,275 @@ var Builtins = []*FunctionObject{
 			return dict
 		},
 	},
+	// Used to check whether a value is an error, so that a program can
+	// recover from a failed call.
+	//
+	// `(error? (get 1 "key"))` is true, where `(get 1 "key")` would otherwise
+	// stop the program.
+	{
+		"error?",
+		func(args ...Object) Object {
+			if len(args) != 1 {
+				return WrongNumOfArgsError("error?", "1", len(args))
+			}
+
+			if args[0].Type() == ERROR_OBJ {
+				return TRUE
+			}
+
+			return FALSE
+		},
+	},
+	// `(random)` is a Number from 0 up to 1, and `(random 6)` is one of the
+	// whole Numbers from 0 to 5.
+	{
+		"random",
+		func(args ...Object) Object {
+			return randomNumber(nil, args...)
+		},
+	},
+	// `(symbol "name")` is the Symbol with the name, which is equal to every
+	// other Symbol with that name.
+	{
+		"symbol",
+		func(args ...Object) Object {
+			if len(args) != 1 {
+				return WrongNumOfArgsError("symbol", "1", len(args))
+			}
+
+			str, ok := args[0].(*String)
+
+			if !ok {
+				return BadTypeError("symbol", args[0])
+			}
+
+			return &Symbol{Name: str.Value}
+		},
+	},
+	{
+		"symbol?",
+		func(args ...Object) Object {
+			if len(args) != 1 {
+				return WrongNumOfArgsError("symbol?", "1", len(args))
+			}
+
+			if args[0].Type() == SYMBOL_OBJ {
+				return TRUE
+			}
+
+			return FALSE
+		},
+	},
+	// `(bytes "text")` is the Bytes of the string, and `(bytes 3)` is three
+	// zero bytes.
+	{
+		"bytes",
+		func(args ...Object) Object {
+			if len(args) != 1 {
+				return WrongNumOfArgsError("bytes", "1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *String:
+				return &Bytes{Value: []byte(arg.Value)}
+			case *Number:
+				if !isInt(arg.Value) || arg.Value < 0 {
+					return &ErrorObject{
+						Kind:    VALUE_ERROR,
+						Message: fmt.Sprintf("attempted to call bytes with %s, expected a whole number of bytes", arg.Inspect()),
+					}
+				}
+
+				return &Bytes{Value: make([]byte, int(arg.Value))}
+			default:
+				return BadTypeError("bytes", arg)
+			}
+		},
+	},
+	{
+		"bytes->string",
+		func(args ...Object) Object {
+			if len(args) != 1 {
+				return WrongNumOfArgsError("bytes->string", "1", len(args))
+			}
+
+			data, ok := args[0].(*Bytes)
+
+			if !ok {
+				return BadTypeError("bytes->string", args[0])
+			}
+
+			return NewString(string(data.Value))
+		},
+	},
+	{
+		"string->bytes",
+		func(args ...Object) Object {
+			if len(args) != 1 {
+				return WrongNumOfArgsError("string->bytes", "1", len(args))
+			}
+
+			str, ok := args[0].(*String)
+
+			if !ok {
+				return BadTypeError("string->bytes", args[0])
+			}
+
+			return &Bytes{Value: []byte(str.Value)}
+		},
+	},
+	// `(slice value start end)` is a copy of the part of a list, string or
+	// bytes from start up to end. Without an end, it's the rest of the value.
+	{
+		"slice",
+		func(args ...Object) Object {
+			if len(args) != 2 && len(args) != 3 {
+				return WrongNumOfArgsError("slice", "2 or 3", len(args))
+			}
+
+			var length int
+
+			switch arg := args[0].(type) {
+			case *List:
+				length = len(arg.Values)
+			case *String:
+				length = len(arg.Value)
+			case *Bytes:
+				length = len(arg.Value)
+			default:
+				return BadTypeError("slice", arg)
+			}
+
+			start, err := index("slice", args[1], length+1)
+
+			if err != nil {
+				return err
+			}
+
+			end := length
+
+			if len(args) == 3 {
+				end, err = index("slice", args[2], length+1)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			if end < start {
+				return &ErrorObject{
+					Kind:    VALUE_ERROR,
+					Message: fmt.Sprintf("attempted to slice from %d to %d, the end is before the start", start, end),
+				}
+			}
+
+			switch arg := args[0].(type) {
+			case *List:
+				return &List{Values: append([]Object{}, arg.Values[start:end]...)}
+			case *String:
+				return NewString(arg.Value[start:end])
+			default:
+				return &Bytes{Value: append([]byte{}, arg.(*Bytes).Value[start:end]...)}
+			}
+		},
+	},
+	// `(error "message")` is an error with the message, which stops the
+	// program unless it's handled in the same way as the errors of builtins.
+	{
+		"error",
+		func(args ...Object) Object {
+			if len(args) != 1 {
+				return WrongNumOfArgsError("error", "1", len(args))
+			}
+
+			return &ErrorObject{Kind: USER_ERROR, Message: args[0].Inspect()}
+		},
+	},
+	// `(error-message (len 1))` is the message of the error, and
+	// `(error-kind (len 1))` is the kind of error it is, "TypeError".
+	{
+		"error-message",
+		func(args ...Object) Object {
+			if len(args) != 1 {
+				return WrongNumOfArgsError("error-message", "1", len(args))
+			}
+
+			err, ok := args[0].(*ErrorObject)
+
+			if !ok {
+				return BadTypeError("error-message", args[0])
+			}
+
+			return NewString(err.Message)
+		},
+	},
+	{
+		"error-kind",
+		func(args ...Object) Object {
+			if len(args) != 1 {
+				return WrongNumOfArgsError("error-kind", "1", len(args))
+			}
+
+			err, ok := args[0].(*ErrorObject)
+
+			if !ok {
+				return BadTypeError("error-kind", args[0])
+			}
+
+			return NewString(string(err.Kind))
+		},
+	},
+	// `(push! l 1)` adds 1 to the end of l, changing it in place, and
+	// `(pop! l)` removes the last value of l and returns it. Lists made from
+	// l before it changed, such as by rest, stay as they were.
+	{
+		"push!",
+		func(args ...Object) Object {
+			if len(args) != 2 {
+				return WrongNumOfArgsError("push!", "2", len(args))
+			}
+
+			list, ok := args[0].(*List)
+
+			if !ok {
+				return BadTypeError("push!", args[0])
+			}
+
+			if list.Constant() {
+				return ConstantListError("push!", list)
+			}
+
+			list.PushInPlace(args[1])
+
+			return list
+		},
+	},
+	{
+		"pop!",
+		func(args ...Object) Object {
+			if len(args) != 1 {
+				return WrongNumOfArgsError("pop!", "1", len(args))
+			}
+
+			list, ok := args[0].(*List)
+
+			if !ok {
+				return BadTypeError("pop!", args[0])
+			}
+
+			if list.Constant() {
+				return ConstantListError("pop!", list)
+			}
+
+			return list.Pop()
+		},
+	},
+}
+
+// Report whether the builtin function accepts errors as arguments. Errors
+// passed to any other builtin are returned in place of the call's result.
+func (f *FunctionObject) HandlesErrors() bool {
+	return f.Name == "error?" || f.Name == "error-message" || f.Name == "error-kind"
 }
 
 func GetBuiltinByName(name string) *FunctionObject {
@@ -567,6 +818,62 @@ func evalTruthy(obj Object) bool {
 	return true
 }
 
+// Return the byte of the Bytes at the index.
+func getByte(data *Bytes, i Object) Object {
+	n, err := index("get", i, len(data.Value))
+
+	if err != nil {
+		return err
+	}
+
+	return NewNumber(float64(data.Value[n]))
+}
+
+// Change the byte of the Bytes at the index, returning the Bytes.
+func setByte(data *Bytes, i Object, value Object) Object {
+	n, err := index("set", i, len(data.Value))
+
+	if err != nil {
+		return err
+	}
+
+	num, ok := value.(*Number)
+
+	if !ok {
+		return BadTypeError("set", value)
+	}
+
+	if !isInt(num.Value) || num.Value < 0 || num.Value > 255 {
+		return &ErrorObject{
+			Kind:    VALUE_ERROR,
+			Message: fmt.Sprintf("attempted to set a byte to %s, expected a whole number from 0 to 255", num.Inspect()),
+		}
+	}
+
+	data.Value[n] = byte(num.Value)
+
+	return data
+}
+
+// Convert the Object into an index of a value with the length, returning an
+// error if it isn't a whole number from 0 up to the length.
+func index(fn string, obj Object, length int) (int, *ErrorObject) {
+	num, ok := obj.(*Number)
+
+	if !ok {
+		return 0, BadTypeError(fn, obj)
+	}
+
+	if !isInt(num.Value) || num.Value < 0 || num.Value >= float64(length) {
+		return 0, &ErrorObject{
+			Kind:    VALUE_ERROR,
+			Message: fmt.Sprintf("attempted to call %s with index %s, which is out of range", fn, num.Inspect()),
+		}
+	}
+
+	return int(num.Value), nil
+}
+
 func isInt(num float64) bool {
 	return num == float64(int64(num))
 }
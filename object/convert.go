@@ -0,0 +1,182 @@
+package object
+
+import "fmt"
+
+// Convert a Go value into an Object, so that it can be used by programs.
+//
+// Integers and floats become Numbers, strings become Strings, bools become
+// Booleans and nil becomes NULL. Byte slices are copied into Bytes. Slices of
+// interface{} become Lists, and maps with string or interface{} keys become
+// Dictionaries, with their values converted recursively. Objects are returned
+// as they are.
+//
+// Returns an error for any other type, or for a map key that can't be used as
+// a Dictionary key.
+func FromGo(v interface{}) (Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return NULL, nil
+	case Object:
+		return v, nil
+	case bool:
+		if v {
+			return TRUE, nil
+		}
+
+		return FALSE, nil
+	case string:
+		return NewString(v), nil
+	case int:
+		return NewNumber(float64(v)), nil
+	case int8:
+		return NewNumber(float64(v)), nil
+	case int16:
+		return NewNumber(float64(v)), nil
+	case int32:
+		return NewNumber(float64(v)), nil
+	case int64:
+		return NewNumber(float64(v)), nil
+	case uint:
+		return NewNumber(float64(v)), nil
+	case uint8:
+		return NewNumber(float64(v)), nil
+	case uint16:
+		return NewNumber(float64(v)), nil
+	case uint32:
+		return NewNumber(float64(v)), nil
+	case uint64:
+		return NewNumber(float64(v)), nil
+	case float32:
+		return NewNumber(float64(v)), nil
+	case float64:
+		return NewNumber(v), nil
+	case []byte:
+		return &Bytes{Value: append([]byte{}, v...)}, nil
+	case []interface{}:
+		values := make([]Object, len(v))
+
+		for i, value := range v {
+			obj, err := FromGo(value)
+
+			if err != nil {
+				return nil, err
+			}
+
+			values[i] = obj
+		}
+
+		return &List{Values: values}, nil
+	case map[string]interface{}:
+		dict := &Dictionary{Values: map[HashKey]DictPair{}}
+
+		for key, value := range v {
+			err := setFromGo(dict, key, value)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return dict, nil
+	case map[interface{}]interface{}:
+		dict := &Dictionary{Values: map[HashKey]DictPair{}}
+
+		for key, value := range v {
+			err := setFromGo(dict, key, value)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("can't convert a value of type %T to an Object", v)
+	}
+}
+
+// Convert the key and value into Objects and add them to the Dictionary.
+func setFromGo(dict *Dictionary, key interface{}, value interface{}) error {
+	keyObj, err := FromGo(key)
+
+	if err != nil {
+		return err
+	}
+
+	hashable, ok := keyObj.(Hashable)
+
+	if !ok {
+		return fmt.Errorf("can't use a value of type %s as a dict key", keyObj.Type())
+	}
+
+	valueObj, err := FromGo(value)
+
+	if err != nil {
+		return err
+	}
+
+	dict.Values[hashable.HashKey()] = DictPair{Key: keyObj, Value: valueObj}
+
+	return nil
+}
+
+// Convert an Object into a Go value, the inverse of FromGo.
+//
+// Numbers become float64s, Strings become strings, Booleans become bools and
+// NULL becomes nil. Bytes become a copy of their []byte. Lists become
+// []interface{}, and Dictionaries become map[interface{}]interface{} keyed by
+// the Go value of each key, with their values converted recursively.
+//
+// Returns an error for any other Object, such as a lambda.
+func ToGo(o Object) (interface{}, error) {
+	switch o := o.(type) {
+	case *Null:
+		return nil, nil
+	case *BooleanObject:
+		return o.Value, nil
+	case *String:
+		return o.Value, nil
+	case *Number:
+		return o.Value, nil
+	case *Bytes:
+		return append([]byte{}, o.Value...), nil
+	case *List:
+		values := make([]interface{}, len(o.Values))
+
+		for i, value := range o.Values {
+			v, err := ToGo(value)
+
+			if err != nil {
+				return nil, err
+			}
+
+			values[i] = v
+		}
+
+		return values, nil
+	case *Dictionary:
+		values := make(map[interface{}]interface{}, len(o.Values))
+
+		for _, pair := range o.Values {
+			key, err := ToGo(pair.Key)
+
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := ToGo(pair.Value)
+
+			if err != nil {
+				return nil, err
+			}
+
+			values[key] = value
+		}
+
+		return values, nil
+	case nil:
+		return nil, fmt.Errorf("can't convert a nil Object to a Go value")
+	default:
+		return nil, fmt.Errorf("can't convert an Object of type %s to a Go value", o.Type())
+	}
+}
@@ -0,0 +1,115 @@
+package object
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{"lisp", "lisp"},
+		{42, "42"},
+		{int64(-3), "-3"},
+		{uint8(7), "7"},
+		{1.5, "1.5"},
+		{[]byte("ab"), "#bytes(2)[61 62]"},
+		{[]interface{}{1, "a", []interface{}{false, nil}}, "(1 a (false null))"},
+		{map[string]interface{}{"a": []interface{}{1, 2}}, "{a: (1 2)}"},
+		{map[interface{}]interface{}{true: "yes"}, "{true: yes}"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.value)
+
+		if err != nil {
+			t.Errorf("failed to convert %#v: %s", tt.value, err)
+			continue
+		}
+
+		if obj.Inspect() != tt.expected {
+			t.Errorf("wrong Object for %#v. want=%s, got=%s", tt.value, tt.expected, obj.Inspect())
+		}
+	}
+
+	for _, value := range []interface{}{
+		struct{}{},
+		[]interface{}{1, make(chan int)},
+		map[interface{}]interface{}{1: "one"},
+		map[string]interface{}{"a": map[string]int{}},
+	} {
+		if _, err := FromGo(value); err == nil {
+			t.Errorf("expected an error converting %#v", value)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{nil, nil},
+		{false, false},
+		{"lisp", "lisp"},
+		{3, 3.0},
+		{2.5, 2.5},
+		{[]byte{0, 255}, []byte{0, 255}},
+		{
+			[]interface{}{1, "a", []interface{}{true, nil}},
+			[]interface{}{1.0, "a", []interface{}{true, nil}},
+		},
+		{
+			map[string]interface{}{
+				"name":   "lisp",
+				"scores": []interface{}{1, 2},
+				"nested": map[string]interface{}{"ok": true},
+			},
+			map[interface{}]interface{}{
+				"name":   "lisp",
+				"scores": []interface{}{1.0, 2.0},
+				"nested": map[interface{}]interface{}{"ok": true},
+			},
+		},
+		{
+			map[interface{}]interface{}{true: []interface{}{}, "b": nil},
+			map[interface{}]interface{}{true: []interface{}{}, "b": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.value)
+
+		if err != nil {
+			t.Fatalf("failed to convert %#v: %s", tt.value, err)
+		}
+
+		value, err := ToGo(obj)
+
+		if err != nil {
+			t.Fatalf("failed to convert %s back: %s", obj.Inspect(), err)
+		}
+
+		if !reflect.DeepEqual(value, tt.expected) {
+			t.Errorf("wrong value. want=%#v, got=%#v", tt.expected, value)
+		}
+	}
+}
+
+func TestToGoErrors(t *testing.T) {
+	for _, obj := range []Object{
+		&LambdaObject{},
+		&Closure{},
+		&List{Values: []Object{&Number{Value: 1}, &CompiledLambda{}}},
+		&ErrorObject{Message: "failed"},
+		nil,
+	} {
+		if _, err := ToGo(obj); err == nil {
+			t.Errorf("expected an error converting %#v", obj)
+		}
+	}
+}
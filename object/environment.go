@@ -1,7 +1,10 @@
 // Definition of the Environment type.
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 // Environment is the data structure which holds values
 // that are used during program evaluation.
@@ -19,18 +22,24 @@ type Environment struct {
 // If there is no enclosing Environment and the identifier isn't
 // found, an Error Object is returned.
 func (e *Environment) Get(ident string) Object {
-	result, ok := e.values[ident]
-
-	if ok {
+	if result, ok := e.Lookup(ident); ok {
 		return result
 	}
 
-	if e.outer != nil {
-		return e.outer.Get(ident)
+	err := fmt.Sprintf("No such item: %s", ident)
+	return &ErrorObject{Kind: NAME_ERROR, Message: err}
+}
+
+// Return the object associated with the identifier in the Environment or an
+// enclosing Environment, and whether it was found.
+func (e *Environment) Lookup(ident string) (Object, bool) {
+	result, ok := e.values[ident]
+
+	if !ok && e.outer != nil {
+		return e.outer.Lookup(ident)
 	}
 
-	err := fmt.Sprintf("No such item: %s", ident)
-	return &ErrorObject{Error: err}
+	return result, ok
 }
 
 // Store the provided Object in the Environment, with its key
@@ -39,6 +48,26 @@ func (e *Environment) Set(ident string, obj Object) {
 	e.values[ident] = obj
 }
 
+// Report whether the Environment is the outermost one, where global variables
+// are defined.
+func (e *Environment) IsGlobal() bool {
+	return e.outer == nil
+}
+
+// Return the identifiers defined directly in the Environment, not including
+// those of any enclosing Environment, in alphabetical order.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.values))
+
+	for name := range e.values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
 // Create a new Environment object and return its address.
 //
 // If an outer Environment is provided, use it to enclose the
@@ -1,95 +1,101 @@
 // A collection of functions for calculating equality between objects.
 package object
 
-// Compare list of objects to ensure all have
-// the same value as the initially given number.
-func numsEqual(first float64, rest ...Object) *BooleanObject {
-	for _, arg := range rest {
-		var num float64
-
-		switch obj := arg.(type) {
-		case *Number:
-			num = obj.Value
-		default:
-			return FALSE
-		}
-
-		if num != first {
-			return FALSE
-		}
-	}
-
-	return TRUE
+import "bytes"
+
+// Report whether the two Objects have the same value. This is the equality
+// used by = and anything else comparing values.
+//
+// Numbers, Strings, Symbols, Keywords, Booleans and Bytes are equal when their values
+// are. Lists are equal when their items are, in order, and Dictionaries when
+// they have the same keys with equal values. Builtins are equal when they have the same
+// name, since the copies bound to a Session's streams are the same function.
+// Lambdas and closures are only equal to themselves, and errors are equal
+// when their kinds and messages are.
+func Equals(a, b Object) bool {
+	return equals(a, b, map[pair]bool{})
 }
 
-// Compare list of objects to ensure all have
-// the same value as the initially given string.
-func stringsEqual(first *String, rest ...Object) *BooleanObject {
-	for _, arg := range rest {
-		str, ok := arg.(*String)
+// A pair of Objects being compared, used to stop comparing Dictionaries that
+// contain themselves.
+type pair struct {
+	a, b Object
+}
 
-		if !ok {
-			return FALSE
+func equals(a, b Object, comparing map[pair]bool) bool {
+	switch a := a.(type) {
+	case *Number:
+		b, ok := b.(*Number)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Symbol:
+		b, ok := b.(*Symbol)
+		return ok && a.Name == b.Name
+	case *Keyword:
+		b, ok := b.(*Keyword)
+		return ok && a.Name == b.Name
+	case *BooleanObject:
+		b, ok := b.(*BooleanObject)
+		return ok && a.Value == b.Value
+	case *Bytes:
+		b, ok := b.(*Bytes)
+		return ok && bytes.Equal(a.Value, b.Value)
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *FunctionObject:
+		b, ok := b.(*FunctionObject)
+		return ok && a.Name == b.Name
+	case *ErrorObject:
+		b, ok := b.(*ErrorObject)
+		return ok && a.Kind == b.Kind && a.Message == b.Message
+	case *List:
+		b, ok := b.(*List)
+
+		if !ok || len(a.Values) != len(b.Values) {
+			return false
 		}
 
-		if str.Value != first.Value {
-			return FALSE
+		if a == b || comparing[pair{a, b}] {
+			return true
 		}
-	}
-
-	return TRUE
-}
 
-// Compare list of objects to ensure all have
-// the same value as the initially given bool.
-func boolEqual(first *BooleanObject, rest ...Object) *BooleanObject {
-	for _, arg := range rest {
-		boolean, ok := arg.(*BooleanObject)
+		comparing[pair{a, b}] = true
 
-		if !ok {
-			return FALSE
+		for i, value := range a.Values {
+			if !equals(value, b.Values[i], comparing) {
+				return false
+			}
 		}
 
-		if boolean.Value != first.Value {
-			return FALSE
-		}
-	}
-
-	return TRUE
-}
-
-// Compare list of objects to ensure all have
-// the same value as the initially given lambda.
-func lambdasEqual(first *LambdaObject, rest ...Object) *BooleanObject {
-	for _, arg := range rest {
-		lambda, ok := arg.(*LambdaObject)
+		return true
+	case *Dictionary:
+		b, ok := b.(*Dictionary)
 
-		if !ok {
-			return FALSE
+		if !ok || len(a.Values) != len(b.Values) {
+			return false
 		}
 
-		if lambda != first {
-			return FALSE
+		// Dictionaries that contain themselves are equal if they're equal
+		// everywhere else, so a pair already being compared is assumed to be.
+		if a == b || comparing[pair{a, b}] {
+			return true
 		}
-	}
 
-	return TRUE
-}
+		comparing[pair{a, b}] = true
 
-// Compare list of objects to ensure all have
-// the same value as the initially given function.
-func functionsEqual(first *FunctionObject, rest ...Object) *BooleanObject {
-	for _, arg := range rest {
-		function, ok := arg.(*FunctionObject)
+		for key, entry := range a.Values {
+			other, ok := b.Values[key]
 
-		if !ok {
-			return FALSE
+			if !ok || !equals(entry.Value, other.Value, comparing) {
+				return false
+			}
 		}
 
-		if function.Name != first.Name {
-			return FALSE
-		}
+		return true
+	default:
+		return a == b
 	}
-
-	return TRUE
 }
@@ -0,0 +1,95 @@
+package object
+
+import "testing"
+
+func TestEquals(t *testing.T) {
+	lambda := &LambdaObject{Args: []string{"x"}}
+	closure := &Closure{Lambda: &CompiledLambda{}}
+
+	list := func(values ...Object) *List {
+		return &List{Values: values}
+	}
+	num := func(value float64) *Number {
+		return &Number{Value: value}
+	}
+	str := func(value string) *String {
+		return &String{Value: value}
+	}
+	dict := func(pairs ...Object) *Dictionary {
+		d := &Dictionary{Values: map[HashKey]DictPair{}}
+
+		for i := 0; i < len(pairs); i += 2 {
+			d.Values[pairs[i].(Hashable).HashKey()] = DictPair{Key: pairs[i], Value: pairs[i+1]}
+		}
+
+		return d
+	}
+
+	// Dictionaries that contain themselves.
+	selfA := dict(str("n"), num(1))
+	selfA.Values[str("self").HashKey()] = DictPair{Key: str("self"), Value: selfA}
+	selfB := dict(str("n"), num(1))
+	selfB.Values[str("self").HashKey()] = DictPair{Key: str("self"), Value: selfB}
+	selfC := dict(str("n"), num(2))
+	selfC.Values[str("self").HashKey()] = DictPair{Key: str("self"), Value: selfC}
+
+	tests := []struct {
+		name     string
+		a, b     Object
+		expected bool
+	}{
+		{"same numbers", num(1), num(1), true},
+		{"whole and float numbers", num(1), num(1.0), true},
+		{"different numbers", num(1), num(1.5), false},
+		{"number and string", num(1), str("1"), false},
+		{"same strings", str("a"), str("a"), true},
+		{"different strings", str("a"), str("b"), false},
+		{"same symbols", &Symbol{Name: "a"}, &Symbol{Name: "a"}, true},
+		{"symbol and string", &Symbol{Name: "a"}, str("a"), false},
+		{"same booleans", TRUE, &BooleanObject{Value: true}, true},
+		{"different booleans", TRUE, FALSE, false},
+		{"boolean and null", FALSE, NULL, false},
+		{"nulls", NULL, &Null{}, true},
+		{"null and empty list", NULL, list(), false},
+		{"same builtin", GetBuiltinByName("+"), GetBuiltinByName("+"), true},
+		{"bound builtin", GetBuiltinByName("print"), GetBuiltinByName("print").WithStreams(&Streams{}), true},
+		{"different builtins", GetBuiltinByName("+"), GetBuiltinByName("-"), false},
+		{"same lambda", lambda, lambda, true},
+		{"identical lambdas", lambda, &LambdaObject{Args: []string{"x"}}, false},
+		{"same closure", closure, closure, true},
+		{"closures of the same lambda", closure, &Closure{Lambda: closure.Lambda}, false},
+		{"same errors", &ErrorObject{Message: "a"}, &ErrorObject{Message: "a"}, true},
+		{"different errors", &ErrorObject{Message: "a"}, &ErrorObject{Message: "b"}, false},
+		{"errors of different kinds", &ErrorObject{Kind: TYPE_ERROR, Message: "a"}, &ErrorObject{Kind: VALUE_ERROR, Message: "a"}, false},
+		{"same bytes", &Bytes{Value: []byte("ab")}, &Bytes{Value: []byte("ab")}, true},
+		{"different bytes", &Bytes{Value: []byte("ab")}, &Bytes{Value: []byte("ba")}, false},
+		{"bytes and string", &Bytes{Value: []byte("ab")}, str("ab"), false},
+		{"empty lists", list(), list(), true},
+		{"equal lists", list(num(1), str("a")), list(num(1), str("a")), true},
+		{"lists in a different order", list(num(1), num(2)), list(num(2), num(1)), false},
+		{"lists of different lengths", list(num(1)), list(num(1), num(1)), false},
+		{"nested lists", list(list(num(1)), NULL), list(list(num(1.0)), NULL), true},
+		{"different nested lists", list(list(num(1))), list(list(num(2))), false},
+		{"empty dicts", dict(), dict(), true},
+		{"equal dicts", dict(str("a"), num(1), TRUE, list()), dict(TRUE, list(), str("a"), num(1)), true},
+		{"dicts with different values", dict(str("a"), num(1)), dict(str("a"), num(2)), false},
+		{"dicts with different keys", dict(str("a"), num(1)), dict(&Symbol{Name: "a"}, num(1)), false},
+		{"dicts of different sizes", dict(str("a"), num(1)), dict(), false},
+		{"dict and list", dict(), list(), false},
+		{"dict containing itself", selfA, selfA, true},
+		{"equal dicts containing themselves", selfA, selfB, true},
+		{"different dicts containing themselves", selfA, selfC, false},
+	}
+
+	for _, tt := range tests {
+		if result := Equals(tt.a, tt.b); result != tt.expected {
+			t.Errorf("%s: wrong result for %s and %s. want=%t, got=%t",
+				tt.name, tt.a.Type(), tt.b.Type(), tt.expected, result)
+		}
+
+		if result := Equals(tt.b, tt.a); result != tt.expected {
+			t.Errorf("%s: wrong result with the arguments swapped. want=%t, got=%t",
+				tt.name, tt.expected, result)
+		}
+	}
+}
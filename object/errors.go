@@ -9,23 +9,39 @@ func BadTypeError(fn string, obj Object) *ErrorObject {
 	err := fmt.Sprintf("attempted to call %s with unsupported type %s (%s)",
 		fn, obj.Type(), obj.Inspect())
 
-	return &ErrorObject{Error: err}
+	return &ErrorObject{Kind: TYPE_ERROR, Message: err}
 }
 
 func BadKeyError(obj Object) *ErrorObject {
 	err := fmt.Sprintf("attempted to use unsupported type as dict key %s (%s)",
 		obj.Type(), obj.Inspect())
 
-	return &ErrorObject{Error: err}
+	return &ErrorObject{Kind: KEY_ERROR, Message: err}
 }
 
 func NoArgsError(fn string) *ErrorObject {
 	err := fmt.Sprintf("attempted to call %s with no arguments", fn)
-	return &ErrorObject{Error: err}
+	return &ErrorObject{Kind: ARITY_ERROR, Message: err}
 }
 
 func WrongNumOfArgsError(fn string, expected string, got int) *ErrorObject {
 	err := fmt.Sprintf("attempted to call %s with incorrect number of arguments: expected %s, got=%d",
 		fn, expected, got)
-	return &ErrorObject{Error: err}
+	return &ErrorObject{Kind: ARITY_ERROR, Message: err}
+}
+
+func SpecialFormError(name string, usage string) *ErrorObject {
+	err := fmt.Sprintf("'%s' is a special form and cannot be used as a %s", name, usage)
+	return &ErrorObject{Kind: SYNTAX_ERROR, Message: err}
+}
+
+func MacroValueError(name string) *ErrorObject {
+	err := fmt.Sprintf("'%s' is a macro and cannot be used as a value", name)
+	return &ErrorObject{Kind: SYNTAX_ERROR, Message: err}
+}
+
+func ConstantListError(fn string, list *List) *ErrorObject {
+	err := fmt.Sprintf("attempted to call %s with the quoted list %s, which can't be changed, copy it with slice first",
+		fn, list.Inspect())
+	return &ErrorObject{Kind: VALUE_ERROR, Message: err}
 }
@@ -0,0 +1,46 @@
+package object
+
+import "math"
+
+// The range of whole Numbers that are created once and shared, as they're
+// the results of most counting and arithmetic.
+const (
+	minCachedNumber = -128
+	maxCachedNumber = 1024
+)
+
+var cachedNumbers = func() []*Number {
+	numbers := make([]*Number, maxCachedNumber-minCachedNumber+1)
+
+	for i := range numbers {
+		numbers[i] = &Number{Value: float64(i + minCachedNumber)}
+	}
+
+	return numbers
+}()
+
+var emptyString = &String{}
+
+// Return a Number with the value. Small whole Numbers are shared rather than
+// allocated each time, so Numbers are never changed once created and mustn't
+// be compared by identity.
+func NewNumber(value float64) *Number {
+	cached := value >= minCachedNumber && value <= maxCachedNumber && isInt(value)
+
+	// -0 is whole but isn't shared, so that its sign is kept.
+	if cached && !(value == 0 && math.Signbit(value)) {
+		return cachedNumbers[int(value)-minCachedNumber]
+	}
+
+	return &Number{Value: value}
+}
+
+// Return a String with the value. The empty String is shared rather than
+// allocated each time.
+func NewString(value string) *String {
+	if value == "" {
+		return emptyString
+	}
+
+	return &String{Value: value}
+}
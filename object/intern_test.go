@@ -0,0 +1,70 @@
+package object
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewNumber(t *testing.T) {
+	tests := []struct {
+		value  float64
+		shared bool
+	}{
+		{0, true},
+		{1, true},
+		{-128, true},
+		{1024, true},
+		{-129, false},
+		{1025, false},
+		{1.5, false},
+		{math.Copysign(0, -1), false},
+		{math.NaN(), false},
+		{math.Inf(1), false},
+	}
+
+	for _, tt := range tests {
+		num := NewNumber(tt.value)
+
+		if math.Float64bits(num.Value) != math.Float64bits(tt.value) {
+			t.Errorf("wrong value. want=%v, got=%v", tt.value, num.Value)
+		}
+
+		if shared := NewNumber(tt.value) == num; shared != tt.shared {
+			t.Errorf("wrong sharing for %v. want=%t, got=%t", tt.value, tt.shared, shared)
+		}
+	}
+}
+
+func TestNewString(t *testing.T) {
+	if NewString("") != NewString("") {
+		t.Errorf("empty strings aren't shared")
+	}
+
+	if str := NewString("lisp"); str.Value != "lisp" {
+		t.Errorf("wrong value. want=lisp, got=%s", str.Value)
+	}
+}
+
+// Measure the allocations made by arithmetic on small whole Numbers, which
+// are shared, and on fractions, which aren't.
+func BenchmarkArithmetic(b *testing.B) {
+	add := GetBuiltinByName("+").Fn
+
+	inputs := []struct {
+		name string
+		args []Object
+	}{
+		{"whole", []Object{NewNumber(20), NewNumber(22)}},
+		{"fraction", []Object{NewNumber(0.5), NewNumber(0.25)}},
+	}
+
+	for _, input := range inputs {
+		b.Run(input.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				add(input.args...)
+			}
+		})
+	}
+}
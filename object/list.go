@@ -0,0 +1,110 @@
+package object
+
+import "sync/atomic"
+
+// The array backing the Values of Lists that were made from one another by
+// push and rest.
+//
+// Lists only read the part of the array within their own Values, so a push
+// can add a value to the end of the array without copying it, as long as no
+// other List has already claimed the slot after its Values. The claimed slots
+// are counted by used, so that the first push from the end of the array takes
+// the slot, and any later push from the same position copies the list instead.
+type listArray struct {
+	size int          // the capacity of the array
+	used atomic.Int64 // the number of slots belonging to a List
+}
+
+// Create a List that can't be changed by push! or pop!, such as a quoted list
+// of literals, which is shared by every evaluation of it.
+func NewConstantList(values []Object) *List {
+	return &List{Values: values, constant: true}
+}
+
+// Report whether the List is a constant, which can't be changed in place.
+func (l *List) Constant() bool {
+	return l.constant
+}
+
+// Return a new List with the value added to the end, without changing the
+// List. Pushing onto the last List pushed onto doesn't copy the values, so
+// building a List one value at a time takes linear time.
+func (l *List) Push(value Object) *List {
+	if values, ok := l.claim(value); ok {
+		return &List{Values: values, array: l.array}
+	}
+
+	values, array := grow(l.Values, value)
+
+	return &List{Values: values, array: array}
+}
+
+// Add the value to the end of the List, changing it in place. Lists that
+// share its values, such as those made from it by rest, don't change.
+func (l *List) PushInPlace(value Object) {
+	if values, ok := l.claim(value); ok {
+		l.Values = values
+		return
+	}
+
+	l.Values, l.array = grow(l.Values, value)
+}
+
+// Remove the last value of the List, changing it in place, and return it.
+// Returns NULL if the List is empty.
+func (l *List) Pop() Object {
+	if len(l.Values) == 0 {
+		return NULL
+	}
+
+	last := l.Values[len(l.Values)-1]
+
+	// The slot stays claimed, so that a later push copies the List rather
+	// than writing over a value other Lists can still see.
+	l.Values = l.Values[:len(l.Values)-1]
+
+	return last
+}
+
+// Return a List of every value but the first, sharing the values of the List.
+// The List returned can be changed in place even if the List is a constant.
+// Returns NULL if the List is empty.
+func (l *List) Rest() Object {
+	if len(l.Values) == 0 {
+		return NULL
+	}
+
+	return &List{Values: l.Values[1:], array: l.array}
+}
+
+// Try to add the value to the slot of the array after the values of the List,
+// returning the values including it. Returns false if the List has no array
+// with room, or another List has already claimed the slot.
+func (l *List) claim(value Object) ([]Object, bool) {
+	if l.array == nil || len(l.Values) == cap(l.Values) {
+		return nil, false
+	}
+
+	// The capacity of the values is what's left of the array after their
+	// start, which gives the position of their end in the array.
+	end := int64(l.array.size - cap(l.Values) + len(l.Values))
+
+	if !l.array.used.CompareAndSwap(end, end+1) {
+		return nil, false
+	}
+
+	return append(l.Values, value), true
+}
+
+// Copy the values into a new array with room for more to be pushed, followed
+// by the value.
+func grow(values []Object, value Object) ([]Object, *listArray) {
+	grown := make([]Object, len(values)+1, max(2*(len(values)+1), 4))
+	copy(grown, values)
+	grown[len(values)] = value
+
+	array := &listArray{size: cap(grown)}
+	array.used.Store(int64(len(grown)))
+
+	return grown, array
+}
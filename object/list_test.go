@@ -0,0 +1,145 @@
+package object
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Build a List by pushing the numbers one at a time.
+func buildList(nums ...float64) *List {
+	list := &List{}
+
+	for _, n := range nums {
+		list = list.Push(NewNumber(n))
+	}
+
+	return list
+}
+
+func testList(t *testing.T, name string, list Object, expected string) {
+	t.Helper()
+
+	if list.Inspect() != expected {
+		t.Errorf("wrong %s. want=%s, got=%s", name, expected, list.Inspect())
+	}
+}
+
+func TestPushSharing(t *testing.T) {
+	base := buildList(1, 2)
+	first := base.Push(NewNumber(3))
+	second := base.Push(NewNumber(4))
+	third := first.Push(NewNumber(5))
+
+	testList(t, "base", base, "(1 2)")
+	testList(t, "first", first, "(1 2 3)")
+	testList(t, "second", second, "(1 2 4)")
+	testList(t, "third", third, "(1 2 3 5)")
+}
+
+// Ensure changing a List in place never changes the Lists made from it.
+func TestRestAliasing(t *testing.T) {
+	list := buildList(1, 2, 3)
+	rest := list.Rest()
+
+	list.PushInPlace(NewNumber(4))
+	testList(t, "list after push!", list, "(1 2 3 4)")
+	testList(t, "rest after push!", rest, "(2 3)")
+
+	if popped := list.Pop(); popped.Inspect() != "4" {
+		t.Errorf("wrong value popped. want=4, got=%s", popped.Inspect())
+	}
+
+	list.Pop()
+	list.PushInPlace(NewNumber(9))
+	testList(t, "list after pop! and push!", list, "(1 2 9)")
+	testList(t, "rest after pop! and push!", rest, "(2 3)")
+
+	grown := rest.(*List).Push(NewNumber(5))
+	list.PushInPlace(NewNumber(6))
+	testList(t, "rest pushed onto", grown, "(2 3 5)")
+	testList(t, "list after pushing onto rest", list, "(1 2 9 6)")
+
+	if (&List{}).Pop() != NULL || (&List{}).Rest() != NULL {
+		t.Errorf("expected NULL from an empty list")
+	}
+}
+
+func TestConstantLists(t *testing.T) {
+	constant := NewConstantList([]Object{NewNumber(1), NewNumber(2)})
+
+	for _, fn := range []string{"push!", "pop!"} {
+		args := []Object{constant}
+
+		if fn == "push!" {
+			args = append(args, NewNumber(3))
+		}
+
+		result := GetBuiltinByName(fn).Fn(args...)
+
+		if err, ok := result.(*ErrorObject); !ok || err.Kind != VALUE_ERROR {
+			t.Errorf("%s: expected a ValueError, got=%s", fn, result.Inspect())
+		}
+	}
+
+	testList(t, "constant", constant, "(1 2)")
+	testList(t, "pushed constant", constant.Push(NewNumber(3)), "(1 2 3)")
+
+	rest := constant.Rest().(*List)
+	rest.PushInPlace(NewNumber(4))
+	testList(t, "rest of constant", rest, "(2 4)")
+	testList(t, "constant after push! of its rest", constant, "(1 2)")
+}
+
+// Run with -race to check that pushing onto a shared List from several
+// goroutines doesn't change the Lists any of them see.
+func TestConcurrentPush(t *testing.T) {
+	base := buildList(1, 2, 3)
+
+	var wg sync.WaitGroup
+
+	for i := range 50 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			list := base
+
+			for range 100 {
+				list = list.Push(NewNumber(float64(i)))
+			}
+
+			for j, value := range list.Values[3:] {
+				if value.Inspect() != fmt.Sprint(i) {
+					t.Errorf("goroutine %d: wrong value at %d, got=%s", i, j, value.Inspect())
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	testList(t, "base", base, "(1 2 3)")
+}
+
+// Measure building a list by pushing onto the previous list each time, as a
+// program folding over a range would.
+func BenchmarkPush(b *testing.B) {
+	push := GetBuiltinByName("push").Fn
+
+	for _, size := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				var list Object = &List{}
+
+				for n := 0; n < size; n++ {
+					list = push(list, NewNumber(float64(n)))
+				}
+			}
+		})
+	}
+}
@@ -23,6 +23,10 @@ const (
 	ERROR_OBJ             = "ERROR"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 	CLOSURE_OBJ           = "CLOSURE"
+	SYMBOL_OBJ            = "SYMBOL"
+	KEYWORD_OBJ           = "KEYWORD"
+	BYTES_OBJ             = "BYTES"
+	MACRO_OBJ             = "MACRO"
 )
 
 // The Function type is the definition of a builtin function.
@@ -78,9 +82,90 @@ func (s *String) Inspect() string {
 	return s.Value
 }
 
+// Symbol is an Object that holds a name, such as a variable name that's been
+// quoted rather than evaluated. Symbols with the same name are equal.
+type Symbol struct {
+	Name string
+}
+
+func (s *Symbol) Type() ObjectType {
+	return SYMBOL_OBJ
+}
+
+// Return the name of the Symbol, without quotes.
+func (s *Symbol) Inspect() string {
+	return s.Name
+}
+
+// Keyword is an Object that holds a name written with a leading colon, such as
+// :name, which evaluates to itself. Keywords with the same name are equal, and
+// are intended as dict keys.
+type Keyword struct {
+	Name string
+}
+
+func (k *Keyword) Type() ObjectType {
+	return KEYWORD_OBJ
+}
+
+// Return the name of the Keyword with its leading colon.
+func (k *Keyword) Inspect() string {
+	return ":" + k.Name
+}
+
+// Macro is a lambda that's called with the unevaluated arguments of an
+// SExpression as data, and returns the code that replaces the SExpression.
+type Macro struct {
+	Name   string
+	Lambda *LambdaObject
+}
+
+func (m *Macro) Type() ObjectType {
+	return MACRO_OBJ
+}
+
+func (m *Macro) Inspect() string {
+	return fmt.Sprintf("#<macro %s>", m.Name)
+}
+
+// Bytes is an Object that holds binary data, such as the contents of a file
+// that isn't text. Unlike the other Objects, its bytes can be changed with set.
+type Bytes struct {
+	Value []byte
+}
+
+func (b *Bytes) Type() ObjectType {
+	return BYTES_OBJ
+}
+
+// The most bytes shown by Inspect.
+const bytesPreview = 16
+
+// Return the length of the Bytes and the first of its bytes in hex, such as
+// #bytes(3)[61 62 63].
+func (b *Bytes) Inspect() string {
+	shown := min(len(b.Value), bytesPreview)
+	preview := fmt.Sprintf("% x", b.Value[:shown])
+
+	if shown < len(b.Value) {
+		preview += " ..."
+	}
+
+	return fmt.Sprintf("#bytes(%d)[%s]", len(b.Value), preview)
+}
+
 // The List Object wraps an Object slice.
+//
+// Lists made by push and rest share their Values with the List they're made
+// from, so the Values of a List mustn't be changed in place. push! and pop!
+// change a List without changing the Lists that share its Values.
 type List struct {
 	Values []Object
+
+	// The array that Values is a slice of, when it can be shared by push.
+	array *listArray
+	// Whether the List is a constant that can't be changed by push! or pop!.
+	constant bool
 }
 
 func (l *List) Type() ObjectType {
@@ -157,48 +242,97 @@ type LambdaObject struct {
 	Args []string         // The Arguments passed to the function.
 	Env  *Environment     // The Environment in which the lambda was defined, allowing for closures.
 	Body []ast.Expression // The SExpressions defined by the user, which are evaluated when the lambda is called.
+	Name string           // The name the lambda was defined with, if any.
+	// Whether the last of Args collects any extra arguments into a List.
+	Variadic bool
 }
 
 func (l *LambdaObject) Type() ObjectType {
 	return LAMBDA_OBJ
 }
 
-// Return a string representation of the defined lambda.
-// Essentially recreating the source code that defined the lambda.
+// Return a short description of the lambda, such as #<lambda add (a b)>.
 func (l *LambdaObject) Inspect() string {
-	var result bytes.Buffer
+	arity := len(l.Args)
+
+	if l.Variadic {
+		arity--
+	}
 
-	result.WriteString("(lambda (")
-	result.WriteString(
-		strings.Join(l.Args, " "),
-	)
-	result.WriteString(") ")
+	return inspectLambda(l.Name, l.Args, arity, l.Variadic)
+}
 
-	body := []string{}
+// Describe a lambda by its name and parameters, or by its number of
+// parameters if it has no name, such as #<lambda anonymous/2>.
+//
+// A variadic lambda shows its rest parameter after &, or a + after its number
+// of parameters, such as #<lambda anonymous/1+>.
+func inspectLambda(name string, params []string, arity int, variadic bool) string {
+	if name == "" {
+		if variadic {
+			return fmt.Sprintf("#<lambda anonymous/%d+>", arity)
+		}
+
+		return fmt.Sprintf("#<lambda anonymous/%d>", arity)
+	}
 
-	for _, exp := range l.Body {
-		body = append(body, exp.String())
+	if variadic && len(params) > 0 {
+		last := len(params) - 1
+		params = append(params[:last:last], "&", params[last])
 	}
-	result.WriteString(
-		strings.Join(body, " "),
-	)
-	result.WriteString(")")
 
-	return result.String()
+	return fmt.Sprintf("#<lambda %s (%s)>", name, strings.Join(params, " "))
 }
 
 // An object type used to store returned errors for when evaluation
 // goes wrong.
+//
+// ErrorObject is also a Go error, so that an error that stops a program can be
+// found with errors.As.
 type ErrorObject struct {
-	Error string
+	Kind    ErrorKind // what went wrong, such as a TYPE_ERROR
+	Message string
+	Line    int // the line of the call that failed, zero if unknown
+	// The functions that were executing when the error occurred, innermost
+	// first, such as "f at line 3".
+	Trace []string
 }
 
+// The kind of problem an ErrorObject describes, which programs can check with
+// error-kind.
+type ErrorKind string
+
+const (
+	TYPE_ERROR      ErrorKind = "TypeError"      // a value of the wrong type
+	ARITY_ERROR     ErrorKind = "ArityError"     // the wrong number of arguments
+	KEY_ERROR       ErrorKind = "KeyError"       // a value that can't be a dict key
+	VALUE_ERROR     ErrorKind = "ValueError"     // a value out of range, such as dividing by 0
+	NAME_ERROR      ErrorKind = "NameError"      // a variable that isn't defined
+	SYNTAX_ERROR    ErrorKind = "SyntaxError"    // a special form used incorrectly
+	USER_ERROR      ErrorKind = "UserError"      // an error created by a program with error
+	CANCELLED_ERROR ErrorKind = "CancelledError" // evaluation was cancelled
+)
+
 func (e *ErrorObject) Type() ObjectType {
 	return ERROR_OBJ
 }
 
 func (e *ErrorObject) Inspect() string {
-	return fmt.Sprintf("ERROR: %s", e.Error)
+	return fmt.Sprintf("ERROR: %s", e.Error())
+}
+
+// Return the message, followed by the functions that were executing.
+func (e *ErrorObject) Error() string {
+	var result bytes.Buffer
+
+	result.WriteString(e.Message)
+
+	for _, frame := range e.Trace {
+		result.WriteString("\n    in ")
+		result.WriteString(frame)
+	}
+
+	return result.String()
 }
 
 // The HashKey Object stores a hashed value of a Hashable Object so
@@ -235,6 +369,26 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: STRING_OBJ, Value: h.Sum64()}
 }
 
+// Create a HashKey object that represents a Symbol from its name. The Type
+// differs from that of a String, so a Symbol and a String with the same name
+// are different keys.
+func (s *Symbol) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Name))
+
+	return HashKey{Type: SYMBOL_OBJ, Value: h.Sum64()}
+}
+
+// Create a HashKey object that represents a Keyword from its name. The Type
+// differs from that of a String or Symbol with the same name, so they're
+// different keys.
+func (k *Keyword) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(k.Name))
+
+	return HashKey{Type: KEYWORD_OBJ, Value: h.Sum64()}
+}
+
 // The DictPair type represents both the key and value
 // to be stored in a Dictionary.
 type DictPair struct {
@@ -278,17 +432,30 @@ func (d *Dictionary) Inspect() string {
 type CompiledLambda struct {
 	Instructions   code.Instructions
 	LocalsCount    int
-	ParameterCount int
+	ParameterCount int      // the number of parameters, not counting a rest parameter
+	Variadic       bool     // whether the last parameter collects extra arguments
+	Parameters     []string // the names of the parameters
+	Name           string   // the name the lambda was defined with, if any
+	// The source of each OpCall instruction, by position, used to describe
+	// failed calls.
+	CallSites map[int]CallSite
+}
+
+// The source of a function call, recorded by the compiler for use in error
+// messages.
+type CallSite struct {
+	Name string // the name of the variable called, if any
+	Line int    // the line of the source the call is on, zero if unknown
 }
 
 func (cl *CompiledLambda) Type() ObjectType {
 	return COMPILED_FUNCTION_OBJ
 }
 
-// Provide a string representation of the compiled lambda, providing its
-// pointer as a means to distinguish between inspected lambdas.
+// Return a short description of the lambda, in the same form as a
+// LambdaObject.
 func (cl *CompiledLambda) Inspect() string {
-	return fmt.Sprintf("CompiledLambda[%p]", cl)
+	return inspectLambda(cl.Name, cl.Parameters, cl.ParameterCount, cl.Variadic)
 }
 
 // Closure is a wrapper around a CompiledFunction instance that allows it to
@@ -303,6 +470,7 @@ func (cl *Closure) Type() ObjectType {
 	return COMPILED_FUNCTION_OBJ
 }
 
+// Closures are described by the lambda they wrap.
 func (cl *Closure) Inspect() string {
-	return fmt.Sprintf("Closure[%p]", cl)
+	return cl.Lambda.Inspect()
 }
@@ -0,0 +1,180 @@
+package object
+
+import "testing"
+
+func TestSymbolHashKey(t *testing.T) {
+	symbol := &Symbol{Name: "name"}
+
+	if symbol.HashKey() != (&Symbol{Name: "name"}).HashKey() {
+		t.Errorf("symbols with the same name have different keys")
+	}
+
+	if symbol.HashKey() == (&Symbol{Name: "other"}).HashKey() {
+		t.Errorf("symbols with different names have the same key")
+	}
+
+	if symbol.HashKey() == (&String{Value: "name"}).HashKey() {
+		t.Errorf("a symbol has the same key as a string with its name")
+	}
+}
+
+func TestSymbolDictKeys(t *testing.T) {
+	set := GetBuiltinByName("set").Fn
+	get := GetBuiltinByName("get").Fn
+
+	dict := &Dictionary{Values: map[HashKey]DictPair{}}
+	set(dict, &Symbol{Name: "name"}, &String{Value: "symbol"})
+	set(dict, &String{Value: "name"}, &String{Value: "string"})
+
+	if len(dict.Values) != 2 {
+		t.Fatalf("wrong number of keys. want=2, got=%d", len(dict.Values))
+	}
+
+	tests := []struct {
+		key      Object
+		expected string
+	}{
+		{&Symbol{Name: "name"}, "symbol"},
+		{&String{Value: "name"}, "string"},
+	}
+
+	for _, tt := range tests {
+		value := get(dict, tt.key)
+
+		if value.Inspect() != tt.expected {
+			t.Errorf("wrong value for %s key. want=%s, got=%s",
+				tt.key.Type(), tt.expected, value.Inspect())
+		}
+	}
+
+	for _, pair := range dict.Values {
+		if symbol, ok := pair.Key.(*Symbol); ok && symbol.Name != "name" {
+			t.Errorf("wrong symbol key. want=name, got=%s", symbol.Name)
+		}
+	}
+}
+
+func TestSymbolEquality(t *testing.T) {
+	equals := GetBuiltinByName("=").Fn
+
+	tests := []struct {
+		args     []Object
+		expected Object
+	}{
+		{[]Object{&Symbol{Name: "a"}, &Symbol{Name: "a"}}, TRUE},
+		{[]Object{&Symbol{Name: "a"}, &Symbol{Name: "b"}}, FALSE},
+		{[]Object{&Symbol{Name: "a"}, &String{Value: "a"}}, FALSE},
+		{[]Object{&String{Value: "a"}, &Symbol{Name: "a"}}, FALSE},
+	}
+
+	for _, tt := range tests {
+		if result := equals(tt.args...); result != tt.expected {
+			t.Errorf("wrong result for %v. want=%s, got=%s",
+				tt.args, tt.expected.Inspect(), result.Inspect())
+		}
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	keyword := &Keyword{Name: "name"}
+
+	if keyword.Inspect() != ":name" {
+		t.Errorf("wrong inspect. want=:name, got=%s", keyword.Inspect())
+	}
+
+	if keyword.HashKey() != (&Keyword{Name: "name"}).HashKey() {
+		t.Errorf("keywords with the same name have different keys")
+	}
+
+	for _, other := range []Hashable{&Keyword{Name: "other"}, &Symbol{Name: "name"}, &String{Value: "name"}} {
+		if keyword.HashKey() == other.HashKey() {
+			t.Errorf("a keyword has the same key as %s %s", other.(Object).Type(), other.(Object).Inspect())
+		}
+	}
+
+	if !Equals(keyword, &Keyword{Name: "name"}) {
+		t.Errorf("keywords with the same name aren't equal")
+	}
+
+	if Equals(keyword, &Symbol{Name: "name"}) {
+		t.Errorf("a keyword is equal to a symbol with its name")
+	}
+}
+
+// Ensure every builtin has a Usage, and that there's no Usage for a builtin
+// that doesn't exist.
+func TestBuiltinUsage(t *testing.T) {
+	for _, builtin := range Builtins {
+		usage, ok := BuiltinUsage(builtin.Name)
+
+		if !ok || usage.Form == "" || usage.Doc == "" {
+			t.Errorf("no usage for builtin %s", builtin.Name)
+		}
+	}
+
+	for name := range builtinUsage {
+		if GetBuiltinByName(name) == nil {
+			t.Errorf("usage for missing builtin %s", name)
+		}
+	}
+}
+
+func TestBytesInspect(t *testing.T) {
+	tests := []struct {
+		value    []byte
+		expected string
+	}{
+		{[]byte{}, "#bytes(0)[]"},
+		{[]byte("abc"), "#bytes(3)[61 62 63]"},
+		{make([]byte, 16), "#bytes(16)[00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00]"},
+		{make([]byte, 1000), "#bytes(1000)[00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 ...]"},
+	}
+
+	for _, tt := range tests {
+		result := (&Bytes{Value: tt.value}).Inspect()
+
+		if result != tt.expected {
+			t.Errorf("wrong result. want=%q, got=%q", tt.expected, result)
+		}
+	}
+}
+
+func TestErrorObjectError(t *testing.T) {
+	var err error = &ErrorObject{
+		Kind:    TYPE_ERROR,
+		Message: "failed",
+		Trace:   []string{"f at line 2", "<main> at line 3"},
+	}
+
+	expected := "failed\n    in f at line 2\n    in <main> at line 3"
+
+	if err.Error() != expected {
+		t.Errorf("wrong message. want=%q, got=%q", expected, err.Error())
+	}
+
+	if inspected := err.(*ErrorObject).Inspect(); inspected != "ERROR: "+expected {
+		t.Errorf("wrong Inspect. want=%q, got=%q", "ERROR: "+expected, inspected)
+	}
+}
+
+func TestLambdaInspect(t *testing.T) {
+	tests := []struct {
+		lambda   Object
+		expected string
+	}{
+		{&LambdaObject{Name: "add", Args: []string{"a", "b"}}, "#<lambda add (a b)>"},
+		{&LambdaObject{Args: []string{"a", "b"}}, "#<lambda anonymous/2>"},
+		{&CompiledLambda{Name: "none", ParameterCount: 0}, "#<lambda none ()>"},
+		{&CompiledLambda{ParameterCount: 1, Parameters: []string{"x"}}, "#<lambda anonymous/1>"},
+		{&CompiledLambda{ParameterCount: 2}, "#<lambda anonymous/2>"},
+		{&Closure{Lambda: &CompiledLambda{Name: "f", Parameters: []string{"x"}}}, "#<lambda f (x)>"},
+		{&LambdaObject{Name: "f", Args: []string{"a", "rest"}, Variadic: true}, "#<lambda f (a & rest)>"},
+		{&CompiledLambda{ParameterCount: 1, Variadic: true, Parameters: []string{"a", "rest"}}, "#<lambda anonymous/1+>"},
+	}
+
+	for _, tt := range tests {
+		if result := tt.lambda.Inspect(); result != tt.expected {
+			t.Errorf("wrong result. want=%q, got=%q", tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// The streams that builtins read from and write to, and the source of the
+// numbers returned by random. A nil field means the stream or source of the
+// process is used, such as os.Stdout.
+//
+// A Rand can't be used by several goroutines at once, so each goroutine
+// running programs needs Streams of its own when one is set.
+type Streams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	Rand   *rand.Rand
+}
+
+func (s *Streams) stdout() io.Writer {
+	if s == nil || s.Stdout == nil {
+		return os.Stdout
+	}
+
+	return s.Stdout
+}
+
+func (s *Streams) intn(n int64) int64 {
+	if s == nil || s.Rand == nil {
+		return rand.Int63n(n)
+	}
+
+	return s.Rand.Int63n(n)
+}
+
+func (s *Streams) float64() float64 {
+	if s == nil || s.Rand == nil {
+		return rand.Float64()
+	}
+
+	return s.Rand.Float64()
+}
+
+// The builtins that use Streams, by name. The versions in Builtins use the
+// streams of the process.
+var streamsBuiltins = map[string]func(streams *Streams, args ...Object) Object{
+	"print":  printValues,
+	"random": randomNumber,
+}
+
+// Return a copy of the builtin that uses the provided Streams, or the builtin
+// itself if it doesn't read or write.
+func (f *FunctionObject) WithStreams(streams *Streams) *FunctionObject {
+	fn, ok := streamsBuiltins[f.Name]
+
+	if !ok {
+		return f
+	}
+
+	return &FunctionObject{
+		Name: f.Name,
+		Fn: func(args ...Object) Object {
+			return fn(streams, args...)
+		},
+	}
+}
+
+// Write the values separated by spaces on a line of their own.
+func printValues(streams *Streams, args ...Object) Object {
+	objects := []string{}
+
+	for _, arg := range args {
+		objects = append(objects, arg.Inspect())
+	}
+
+	fmt.Fprintln(streams.stdout(), strings.Join(objects, " "))
+
+	return NULL
+}
+
+// Return a random Number from 0 up to 1, or a random whole Number from 0 up
+// to the argument when one is provided.
+func randomNumber(streams *Streams, args ...Object) Object {
+	if len(args) == 0 {
+		return NewNumber(streams.float64())
+	}
+
+	if len(args) != 1 {
+		return WrongNumOfArgsError("random", "0 or 1", len(args))
+	}
+
+	num, ok := args[0].(*Number)
+
+	if !ok {
+		return BadTypeError("random", args[0])
+	}
+
+	if !isInt(num.Value) || num.Value < 1 {
+		return &ErrorObject{
+			Kind:    VALUE_ERROR,
+			Message: fmt.Sprintf("attempted to call random with %s, expected a whole number above 0", num.Inspect()),
+		}
+	}
+
+	return NewNumber(float64(streams.intn(int64(num.Value))))
+}
@@ -0,0 +1,55 @@
+package object
+
+// How a builtin is called and what it does, shown by the repl's :help
+// command.
+type Usage struct {
+	Form string // the form of a call, such as (len value)
+	Doc  string // a short description of the result
+}
+
+// The Usage of each builtin, by name.
+var builtinUsage = map[string]Usage{
+	"+":             {"(+ numbers...)", "the sum of the numbers, 0 without any"},
+	"*":             {"(* numbers...)", "the product of the numbers, 1 without any"},
+	"-":             {"(- number numbers...)", "the first number minus the others, or the negative of a single number"},
+	"/":             {"(/ number numbers...)", "the first number divided by the others, or 1 divided by a single number"},
+	"rem":           {"(rem number divisor)", "the remainder of dividing the number by the divisor"},
+	"=":             {"(= values...)", "true if every value is equal to the first"},
+	"<":             {"(< numbers...)", "true if each number is less than the next"},
+	">":             {"(> numbers...)", "true if each number is greater than the next"},
+	"not":           {"(not value)", "true if the value is false or null"},
+	"and":           {"(and values...)", "true if none of the values are false or null"},
+	"or":            {"(or values...)", "true if any of the values aren't false or null"},
+	"list":          {"(list values...)", "a list of the values"},
+	"dict":          {"(dict key value...)", "a dict of the keys and values, the same as {key value...}"},
+	"first":         {"(first list)", "the first value of the list, or null if it's empty"},
+	"rest":          {"(rest list)", "a list of the values after the first"},
+	"last":          {"(last list)", "the last value of the list, or null if it's empty"},
+	"len":           {"(len value)", "the number of values in a list, or bytes in a string or bytes"},
+	"push":          {"(push list value)", "a copy of the list with the value added to the end"},
+	"push!":         {"(push! list value)", "add the value to the end of the list, changing it"},
+	"pop!":          {"(pop! list)", "remove the last value of the list and return it"},
+	"str":           {"(str values...)", "a string of the values joined together"},
+	"print":         {"(print values...)", "write the values separated by spaces, and return null"},
+	"get":           {"(get dict key)", "the value of the key in a dict, or the byte at an index of bytes"},
+	"set":           {"(set dict key value)", "set the value of the key in a dict, or the byte at an index of bytes"},
+	"error?":        {"(error? value)", "true if the value is an error"},
+	"error":         {"(error message)", "an error with the message, which stops the program unless handled"},
+	"error-message": {"(error-message error)", "the message of the error"},
+	"error-kind":    {"(error-kind error)", "the kind of the error, such as \"TypeError\""},
+	"random":        {"(random [number])", "a random number from 0 up to 1, or a whole number from 0 up to the number"},
+	"symbol":        {"(symbol string)", "the symbol named by the string"},
+	"symbol?":       {"(symbol? value)", "true if the value is a symbol"},
+	"bytes":         {"(bytes string-or-size)", "the bytes of a string, or a number of zero bytes"},
+	"bytes->string": {"(bytes->string bytes)", "the string the bytes encode"},
+	"string->bytes": {"(string->bytes string)", "the bytes of the string"},
+	"slice":         {"(slice value start [end])", "a copy of part of a list, string or bytes, from start up to end"},
+}
+
+// Return the Usage of the builtin with the provided name, and whether there's
+// a builtin of that name.
+func BuiltinUsage(name string) (Usage, bool) {
+	usage, ok := builtinUsage[name]
+
+	return usage, ok
+}
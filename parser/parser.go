@@ -16,6 +16,9 @@ type Parser struct {
 	curToken  token.Token  // The Token currently added to the AST.
 	peekToken token.Token  // The next Token to be parsed, used for look-ahead.
 	Errors    []string     // A collection of Errors encountered during parsing.
+	// Whether an error has been reported at the end of the input, so that
+	// the lists left open by it aren't reported as well.
+	reachedEOF bool
 }
 
 // Create a new Parser instance that uses the provided Lexer.
@@ -30,12 +33,19 @@ func New(l *lexer.Lexer) *Parser {
 
 // Transform the supplied Token list into an AST representing the program.
 //
-// This also populates the Errors field with parser errors encountered.
+// This also populates the Errors field with parser errors encountered. After
+// an error, parsing resumes at the next expression, so that each problem in
+// the input is reported once and later ones are still found.
 func (p *Parser) ParseProgram() *ast.Program {
 	expressions := []ast.Expression{}
 
 	p.readToken()
 	for p.curToken.Type != token.EOF {
+		if p.isClosingDelimiter() {
+			p.skipClosingDelimiters()
+			continue
+		}
+
 		expressions = append(expressions, p.parseExpression())
 	}
 
@@ -59,8 +69,7 @@ func (p *Parser) parseExpression() ast.Expression {
 			}
 		}
 
-		errMsg := fmt.Sprintf("%s is invalid number", p.curToken.Literal)
-		p.Errors = append(p.Errors, errMsg)
+		p.errorAt(p.curToken, "%s is invalid number", p.curToken.Literal)
 		p.readToken()
 		return nil
 	case token.STRING:
@@ -74,21 +83,27 @@ func (p *Parser) parseExpression() ast.Expression {
 		ident := &ast.Identifier{Token: p.curToken}
 		p.readToken()
 		return ident
+	case token.KEYWORD:
+		keyword := &ast.KeywordLiteral{Token: p.curToken}
+		p.readToken()
+		return keyword
 	case token.LPAREN:
 		return p.parseSExpression()
 	case token.LBRACE:
-		return p.parseDictLiteral()
+		return p.parseDictLiteral(p.parseExpression)
 	case token.QUOTE:
 		return p.parseQuoteExpression()
 	case token.EOF:
 		return nil
 	case token.ILLEGAL:
-		p.Errors = append(p.Errors, p.curToken.Literal)
+		// Only an unterminated string is illegal, and it runs to the end
+		// of the input.
+		p.errorAt(p.curToken, "%s", p.curToken.Literal)
+		p.reachedEOF = true
 		p.readToken()
 		return nil
 	default:
-		errorMessage := fmt.Sprintf("should not reach here:\n\treceived: %+v\n\tpeek: %s", p.curToken, p.peekToken)
-		p.Errors = append(p.Errors, errorMessage)
+		p.errorAt(p.curToken, "unexpected '%s'", p.curToken.Literal)
 		p.readToken()
 		return nil
 	}
@@ -98,7 +113,7 @@ func (p *Parser) parseExpression() ast.Expression {
 //
 //	(f a b c)
 func (p *Parser) parseSExpression() ast.Expression {
-	sExpression := &ast.SExpression{}
+	sExpression := &ast.SExpression{Line: p.curToken.Line, Column: p.curToken.Column}
 
 	p.readToken()
 
@@ -118,10 +133,7 @@ func (p *Parser) parseSExpression() ast.Expression {
 
 	for p.curToken.Type != token.RPAREN {
 		if p.curToken.Type == token.EOF {
-			p.Errors = append(
-				p.Errors,
-				"Reached EOF before ')'",
-			)
+			p.errorAt(p.curToken, "Reached EOF before ')'")
 			return sExpression
 		}
 		args = append(args, p.parseExpression())
@@ -135,12 +147,17 @@ func (p *Parser) parseSExpression() ast.Expression {
 // Parse a dictionary literal of the form:
 //
 //	{ arg1 arg2 arg3 arg4 }
-func (p *Parser) parseDictLiteral() ast.Expression {
-	sExpression := &ast.SExpression{}
+//
+// Each key and value is parsed with parseElement, so that a quoted dict holds
+// data.
+func (p *Parser) parseDictLiteral(parseElement func() ast.Expression) ast.Expression {
+	sExpression := &ast.SExpression{Line: p.curToken.Line, Column: p.curToken.Column}
 	sExpression.Fn = &ast.Identifier{
 		Token: token.Token{
 			Type:    token.IDENT,
 			Literal: "dict",
+			Line:    p.curToken.Line,
+			Column:  p.curToken.Column,
 		},
 	}
 
@@ -155,13 +172,10 @@ func (p *Parser) parseDictLiteral() ast.Expression {
 
 	for p.curToken.Type != token.RBRACE {
 		if p.curToken.Type == token.EOF {
-			p.Errors = append(
-				p.Errors,
-				"Reached EOF before '}'",
-			)
+			p.errorAt(p.curToken, "Reached EOF before '}'")
 			return sExpression
 		}
-		args = append(args, p.parseExpression())
+		args = append(args, parseElement())
 	}
 
 	p.readToken()
@@ -169,28 +183,62 @@ func (p *Parser) parseDictLiteral() ast.Expression {
 	return sExpression
 }
 
-// Parse an SExpression that begins with a quote.
-//
-// Currently this only parses lists of the form '(a b c).
-// This is shorthand for (list a b c).
+// Parse an expression that begins with a quote, which is data rather than
+// code.
 func (p *Parser) parseQuoteExpression() ast.Expression {
-	sExpression := &ast.SExpression{}
-
 	p.readToken()
 
-	if p.curToken.Type != token.LPAREN {
-		p.Errors = append(
-			p.Errors,
-			"' not followed by (",
-		)
-		return sExpression
+	switch p.curToken.Type {
+	case token.RPAREN, token.RBRACE, token.EOF:
+		// The closing delimiter is left for whatever the quote is part of.
+		p.errorAt(p.curToken, "' not followed by an expression")
+		return nil
 	}
+
+	return p.parseDatum()
+}
+
+// Parse an expression as data. A name, such as a, is a SymbolLiteral, and a
+// list of the form (a b c) is shorthand for (list 'a 'b 'c), where each element
+// is also data, so that nested lists are quoted too. Other literals, such as
+// numbers and true, are the same as when they aren't quoted.
+func (p *Parser) parseDatum() ast.Expression {
+	switch p.curToken.Type {
+	case token.QUOTE:
+		// Quoting data again leaves it unchanged.
+		return p.parseQuoteExpression()
+	case token.IDENT:
+		switch p.curToken.Literal {
+		case "true", "false", "null":
+			return p.parseExpression()
+		}
+
+		symbol := &ast.SymbolLiteral{Token: p.curToken}
+		p.readToken()
+		return symbol
+	case token.LPAREN:
+		return p.parseQuotedList()
+	case token.LBRACE:
+		return p.parseDictLiteral(p.parseDatum)
+	default:
+		// A closing delimiter that doesn't end a list or dict is reported
+		// and skipped by parseExpression.
+		return p.parseExpression()
+	}
+}
+
+// Parse a quoted list of the form (a b c), whose elements are data.
+func (p *Parser) parseQuotedList() ast.Expression {
+	sExpression := &ast.SExpression{Quoted: true, Line: p.curToken.Line, Column: p.curToken.Column}
+
 	p.readToken()
 
 	sExpression.Fn = &ast.Identifier{
 		Token: token.Token{
 			Type:    token.IDENT,
 			Literal: "list",
+			Line:    sExpression.Line,
+			Column:  sExpression.Column,
 		},
 	}
 
@@ -203,13 +251,10 @@ func (p *Parser) parseQuoteExpression() ast.Expression {
 
 	for p.curToken.Type != token.RPAREN {
 		if p.curToken.Type == token.EOF {
-			p.Errors = append(
-				p.Errors,
-				"Reached EOF before ')'",
-			)
+			p.errorAt(p.curToken, "Reached EOF before ')'")
 			return sExpression
 		}
-		args = append(args, p.parseExpression())
+		args = append(args, p.parseDatum())
 	}
 
 	p.readToken()
@@ -227,3 +272,36 @@ func (p *Parser) readToken() token.Token {
 
 	return p.curToken
 }
+
+// Report whether the current Token closes a list or dict.
+func (p *Parser) isClosingDelimiter() bool {
+	return p.curToken.Type == token.RPAREN || p.curToken.Type == token.RBRACE
+}
+
+// Record an error for a closing delimiter outside of any list or dict, and
+// skip any that directly follow it, so that a run of them such as ))) is a
+// single error.
+func (p *Parser) skipClosingDelimiters() {
+	p.errorAt(p.curToken, "unexpected '%s'", p.curToken.Literal)
+
+	for p.isClosingDelimiter() {
+		p.readToken()
+	}
+}
+
+// Record an error found at the position of the provided Token, in the form
+// line:column: message. Only the first error at the end of the input is
+// recorded, since the lists enclosing it are all left open by the same
+// problem.
+func (p *Parser) errorAt(tok token.Token, format string, args ...any) {
+	if tok.Type == token.EOF {
+		if p.reachedEOF {
+			return
+		}
+
+		p.reachedEOF = true
+	}
+
+	message := fmt.Sprintf(format, args...)
+	p.Errors = append(p.Errors, fmt.Sprintf("%d:%d: %s", tok.Line, tok.Column, message))
+}
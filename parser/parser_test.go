@@ -1,8 +1,10 @@
 package parser
 
 import (
+	"fmt"
 	"lisp/ast"
 	"lisp/lexer"
+	"slices"
 	"testing"
 )
 
@@ -49,11 +51,52 @@ func TestParseFloat(t *testing.T) {
 			input:    "-5.2",
 			expected: float64(-5.2),
 		},
+		{
+			input:    ".5",
+			expected: float64(0.5),
+		},
+		{
+			input:    "-.5",
+			expected: float64(-0.5),
+		},
+		{
+			input:    "1e6",
+			expected: float64(1e6),
+		},
+		{
+			input:    "1E3",
+			expected: float64(1000),
+		},
+		{
+			input:    "2.5e-3",
+			expected: float64(2.5e-3),
+		},
+		{
+			input:    "-1e-3",
+			expected: float64(-1e-3),
+		},
+		{
+			input:    ".5e+2",
+			expected: float64(50),
+		},
 	}
 
 	runParserTests(t, tests)
 }
 
+func TestParseInvalidNumber(t *testing.T) {
+	for _, input := range []string{"1e", "1e-", "1.2.3", ".5.", "2x"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		expected := fmt.Sprintf("1:1: %s is invalid number", input)
+
+		if len(p.Errors) != 1 || p.Errors[0] != expected {
+			t.Errorf("wrong errors for %q. want=[%s], got=%v", input, expected, p.Errors)
+		}
+	}
+}
+
 func TestParseString(t *testing.T) {
 	tests := []parserTest{
 		{
@@ -194,6 +237,90 @@ func TestSExpression(t *testing.T) {
 	runParserTests(t, tests)
 }
 
+// Ensure quoted expressions are parsed as data, with names as symbols and
+// nested lists quoted too.
+func TestParseKeyword(t *testing.T) {
+	p := New(lexer.New(`(get p :name)`))
+	program := p.ParseProgram()
+
+	if len(p.Errors) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors)
+	}
+
+	sExpr := program.Expressions[0].(*ast.SExpression)
+	keyword, ok := sExpr.Args[1].(*ast.KeywordLiteral)
+
+	if !ok {
+		t.Fatalf("expression is not a KeywordLiteral: %T", sExpr.Args[1])
+	}
+
+	if keyword.Token.Literal != "name" {
+		t.Errorf("wrong keyword name. want=name, got=%s", keyword.Token.Literal)
+	}
+
+	if keyword.String() != ":name" {
+		t.Errorf("wrong keyword string. want=:name, got=%s", keyword.String())
+	}
+}
+
+func TestParseQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`'a`, `'a`},
+		{`''a`, `'a`},
+		{`'1`, `1`},
+		{`'"a"`, `a`},
+		{`'true`, `true`},
+		{`'(a 1)`, `(list 'a 1)`},
+		{`'(a (b c) 3)`, `(list 'a (list 'b 'c) 3)`},
+		{`'(a '(b) ())`, `(list 'a (list 'b) (list))`},
+		{`'{a 1}`, `(dict 'a 1)`},
+		{`'(null false)`, `(list null false)`},
+		{`':a`, `:a`},
+		{`'(:a b)`, `(list :a 'b)`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		if len(p.Errors) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors)
+		}
+
+		if len(program.Expressions) != 1 {
+			t.Fatalf("Wrong number of expressions. expected=%d, got=%d", 1, len(program.Expressions))
+		}
+
+		if result := program.Expressions[0].String(); result != tt.expected {
+			t.Errorf("wrong quoted expression for %q. want=%s, got=%s", tt.input, tt.expected, result)
+		}
+	}
+
+	if _, ok := New(lexer.New(`'a`)).ParseProgram().Expressions[0].(*ast.SymbolLiteral); !ok {
+		t.Errorf("quoted name isn't a SymbolLiteral")
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`'`, "1:2: ' not followed by an expression"},
+		{`(list ')`, "1:8: ' not followed by an expression"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors) == 0 || p.Errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%s, got=%v", tt.input, tt.expected, p.Errors)
+		}
+	}
+}
+
 func TestParseMultipleExpressions(t *testing.T) {
 	input := `
     (def one 1)
@@ -216,6 +343,133 @@ func TestParseMultipleExpressions(t *testing.T) {
 	}
 }
 
+func TestSExpressionPositions(t *testing.T) {
+	input := `(def a 1)
+
+(def b
+  (+ a
+     '(1 2)
+     {"k" 1}))`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(program.Expressions) != 2 {
+		t.Fatalf("Wrong number of expressions. expected=%d, got=%d", 2, len(program.Expressions))
+	}
+
+	first := program.Expressions[0].(*ast.SExpression)
+	second := program.Expressions[1].(*ast.SExpression)
+	add := second.Args[1].(*ast.SExpression)
+
+	tests := []struct {
+		expr   *ast.SExpression
+		line   int
+		column int
+	}{
+		{first, 1, 1},
+		{second, 3, 1},
+		{add, 4, 3},
+		{add.Args[1].(*ast.SExpression), 5, 7},
+		{add.Args[2].(*ast.SExpression), 6, 6},
+	}
+
+	for _, tt := range tests {
+		if tt.expr.Line != tt.line {
+			t.Errorf("wrong line for %s. expected=%d, got=%d", tt.expr, tt.line, tt.expr.Line)
+		}
+
+		if tt.expr.Column != tt.column {
+			t.Errorf("wrong column for %s. expected=%d, got=%d", tt.expr, tt.column, tt.expr.Column)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"(+ 1 2))", []string{"1:8: unexpected ')'"}},
+		{"(def a 1)\n  }", []string{"2:3: unexpected '}'"}},
+		{"{1 2", []string{"1:5: Reached EOF before '}'"}},
+		{"(a\n  \"b", []string{"2:3: unterminated string: \"b"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if !slices.Equal(p.Errors, tt.expected) {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, p.Errors)
+		}
+	}
+}
+
+// Ensure each problem in the input is reported once, and that parsing resumes
+// after it so that later problems are found.
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"(+ 1 2)))\n(def a 1e)",
+			[]string{"1:8: unexpected ')'", "2:8: 1e is invalid number"},
+		},
+		{
+			"}\n(def a 1)\n(print ')",
+			[]string{"1:1: unexpected '}'", "3:9: ' not followed by an expression"},
+		},
+		{
+			"(def f (lambda (x)\n  (if (= x 0) 1 2",
+			[]string{"2:18: Reached EOF before ')'"},
+		},
+		{
+			"{1 (2 '(3",
+			[]string{"1:10: Reached EOF before ')'"},
+		},
+		{
+			"(print \"a)\n(def b (+ 1 2))",
+			[]string{"1:8: unterminated string: \"a)\n(def b (+ 1 2))"},
+		},
+		{
+			"(a } b)\n(c 1.2.3)",
+			[]string{"1:4: unexpected '}'", "2:4: 1.2.3 is invalid number"},
+		},
+		{
+			"'(a })\n(b 1.2.3)",
+			[]string{"1:5: unexpected '}'", "2:4: 1.2.3 is invalid number"},
+		},
+		{
+			"'{a )}",
+			[]string{"1:5: unexpected ')'"},
+		},
+		{
+			"'(a '})",
+			[]string{"1:6: ' not followed by an expression", "1:6: unexpected '}'"},
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if !slices.Equal(p.Errors, tt.expected) {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, p.Errors)
+		}
+	}
+
+	// The expressions around an error are still parsed.
+	p := New(lexer.New("(a))\n(b 1)"))
+	program := p.ParseProgram()
+
+	if program.String() != "(a)(b 1)" {
+		t.Errorf("wrong program after error. want=(a)(b 1), got=%s", program.String())
+	}
+}
+
 func runParserTests(t *testing.T, tests []parserTest) {
 	t.Helper()
 
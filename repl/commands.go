@@ -0,0 +1,275 @@
+package repl
+
+import (
+	"fmt"
+	"lisp/ast"
+	"lisp/compiler"
+	"lisp/object"
+	"os"
+	"strings"
+)
+
+// A command that can be entered at the REPL prompt instead of an expression.
+// Commands start with a colon, such as :help.
+type command struct {
+	name string // the name of the command, without the colon
+	args string // a description of the arguments, shown by :help
+	help string // a short description of the command, shown by :help
+	// Run the command with the text entered after its name. Returns false if
+	// the session should end.
+	run func(s *session, args string) bool
+}
+
+// Return the commands available in a session, in the order they're listed by
+// :help.
+func (s *session) commands() []command {
+	return []command{
+		{"help", "[NAME]", "list the available commands, or show how to use a command or builtin", (*session).help},
+		{"builtins", "", "list the builtin functions", (*session).builtins},
+		{"quit", "", "end the session", (*session).quit},
+		{"reset", "", "discard every variable defined in the session", (*session).reset},
+		{"engine", "[eval|vm]", "switch engine, or show the engine in use", (*session).setEngine},
+		{"env", "", "list the variables defined in the session", (*session).env},
+		{"ast", "EXPR", "show the syntax tree of an expression", (*session).ast},
+		{"bytecode", "EXPR", "show the bytecode an expression compiles to", (*session).bytecode},
+		{"load", "[PATH]", "run a file in the session, or the last file loaded", (*session).load},
+		{"time", "EXPR", "run an expression and show how long it took", (*session).time},
+		{"timing", "[on|off]", "show how long every input takes", (*session).setTiming},
+	}
+}
+
+// Find the command entered, which is the input without its leading colon,
+// returning it along with the text after its name. Returns false if no
+// command has the name, so the input can be run as an expression instead.
+func (s *session) findCommand(input string) (command, string, bool) {
+	name, args, _ := strings.Cut(strings.TrimSpace(input), " ")
+
+	for _, cmd := range s.commands() {
+		if cmd.name == name {
+			return cmd, strings.TrimSpace(args), true
+		}
+	}
+
+	return command{}, "", false
+}
+
+// List the commands, or show how to use the command or builtin named after
+// :help.
+func (s *session) help(args string) bool {
+	if args != "" {
+		s.helpFor(args)
+		return true
+	}
+
+	for _, cmd := range s.commands() {
+		fmt.Fprintf(s.out, "  %-18s %s\n", cmd.usage(), cmd.help)
+	}
+
+	return true
+}
+
+// Show how to use the builtin or command with the provided name. The colon
+// of a command's name is optional.
+func (s *session) helpFor(name string) {
+	if usage, ok := object.BuiltinUsage(name); ok {
+		fmt.Fprintf(s.out, "%s\n  %s\n", usage.Form, usage.Doc)
+		return
+	}
+
+	for _, cmd := range s.commands() {
+		if cmd.name == strings.TrimPrefix(name, ":") {
+			fmt.Fprintf(s.out, "%s\n  %s\n", cmd.usage(), cmd.help)
+			return
+		}
+	}
+
+	s.errorf("no command or builtin named '%s', enter :builtins to list the builtins\n", name)
+}
+
+// Return how the command is entered, such as :load [PATH].
+func (cmd command) usage() string {
+	usage := ":" + cmd.name
+
+	if cmd.args != "" {
+		usage += " " + cmd.args
+	}
+
+	return usage
+}
+
+// List every builtin function, with how it's called.
+func (s *session) builtins(args string) bool {
+	for _, builtin := range object.Builtins {
+		usage, _ := object.BuiltinUsage(builtin.Name)
+		fmt.Fprintf(s.out, "  %-26s %s\n", usage.Form, usage.Doc)
+	}
+
+	return true
+}
+
+func (s *session) quit(args string) bool {
+	return false
+}
+
+// Discard the variables defined with every engine, not only the one in use.
+func (s *session) reset(args string) bool {
+	for _, e := range s.engines {
+		e.Reset()
+	}
+
+	return true
+}
+
+func (s *session) env(args string) bool {
+	globals := globals(s.engine)
+
+	if len(globals) == 0 {
+		fmt.Fprintln(s.out, "no variables defined")
+	}
+
+	for _, g := range globals {
+		fmt.Fprintf(s.out, "%s: %s\n", g.name, g.value.Inspect())
+	}
+
+	return true
+}
+
+// Show the syntax tree that the expressions entered after :ast are parsed to.
+func (s *session) ast(args string) bool {
+	program, ok := s.parseArgs(args)
+
+	if ok {
+		for _, expr := range program.Expressions {
+			fmt.Fprint(s.out, ast.Dump(expr))
+		}
+	}
+
+	return true
+}
+
+// Show the bytecode that the expressions entered after :bytecode compile to,
+// without running it or defining anything in the session.
+func (s *session) bytecode(args string) bool {
+	program, ok := s.parseArgs(args)
+
+	if !ok {
+		return true
+	}
+
+	c := s.engine.Compiler()
+	err := c.Compile(program)
+
+	if err != nil {
+		s.errorf("compiler error: %s\n", err)
+		return true
+	}
+
+	fmt.Fprint(s.out, compiler.Disassemble(c.Bytecode()))
+
+	return true
+}
+
+// Parse the arguments of a command as a program, reporting any errors. Returns
+// false if there are no expressions or they can't be parsed.
+func (s *session) parseArgs(args string) (*ast.Program, bool) {
+	if args == "" {
+		s.errorf("expected an expression\n")
+		return nil, false
+	}
+
+	return s.parse(args, "")
+}
+
+// Run the file at the provided path in the session, so that the variables it
+// defines can be used in later inputs. Without a path, the last file loaded
+// is run again.
+func (s *session) load(path string) bool {
+	if path == "" {
+		path = s.lastLoaded
+	}
+
+	if path == "" {
+		s.errorf("expected a file to load\n")
+		return true
+	}
+
+	s.lastLoaded = path
+
+	contents, err := os.ReadFile(path)
+
+	if err != nil {
+		s.errorf("%s\n", err)
+		return true
+	}
+
+	if program, ok := s.parseFile(path, contents); ok {
+		s.evaluate(program, path, s.timing)
+	}
+
+	return true
+}
+
+// Parse the contents of the file at the provided path, reporting any errors
+// prefixed with the path. Returns false if the file is empty or can't be
+// parsed.
+func (s *session) parseFile(path string, contents []byte) (*ast.Program, bool) {
+	if strings.TrimSpace(string(contents)) == "" {
+		return nil, false
+	}
+
+	return s.parse(string(contents), path)
+}
+
+// Run the expressions entered after :time, showing how long they took.
+func (s *session) time(args string) bool {
+	program, ok := s.parseArgs(args)
+
+	if ok {
+		s.evaluate(program, "", true)
+	}
+
+	return true
+}
+
+// Turn showing the time taken by each input on or off, or show whether it's
+// on when no argument is provided.
+func (s *session) setTiming(args string) bool {
+	switch args {
+	case "on":
+		s.timing = true
+	case "off":
+		s.timing = false
+	case "":
+	default:
+		s.errorf("expected on or off, got '%s'\n", args)
+		return true
+	}
+
+	if s.timing {
+		fmt.Fprintln(s.out, "timing is on")
+	} else {
+		fmt.Fprintln(s.out, "timing is off")
+	}
+
+	return true
+}
+
+// Switch to the engine with the provided name, or show the engine in use when
+// no name is provided. Each engine keeps the variables defined with it, so
+// they're available again after switching back.
+func (s *session) setEngine(args string) bool {
+	if args != "" {
+		e := s.findEngine(args)
+
+		if e == nil {
+			s.errorf("expected eval or vm, got '%s'\n", args)
+			return true
+		}
+
+		s.engine = e
+	}
+
+	fmt.Fprintf(s.out, "engine is %s\n", s.engine.Engine())
+
+	return true
+}
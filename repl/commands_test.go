@@ -0,0 +1,308 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Run the provided input through each engine's REPL, checking the output
+// contains and doesn't contain the provided strings.
+func runReplContains(t *testing.T, input string, contains []string, excludes []string) {
+	t.Helper()
+
+	for _, engine := range engines {
+		var out strings.Builder
+
+		engine.start(strings.NewReader(input), &out)
+
+		for _, expected := range contains {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("%s: output for %q doesn't contain %q\ngot=%q",
+					engine.name, input, expected, out.String())
+			}
+		}
+
+		for _, unexpected := range excludes {
+			if strings.Contains(out.String(), unexpected) {
+				t.Errorf("%s: output for %q contains %q\ngot=%q",
+					engine.name, input, unexpected, out.String())
+			}
+		}
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	runReplContains(t, ":help\n", []string{
+		":help",
+		":quit",
+		":reset",
+		":env",
+	}, nil)
+}
+
+func TestHelpForName(t *testing.T) {
+	runReplContains(t, ":help len\n:help :load\n:help env\n:help nothing\n", []string{
+		"(len value)\n  the number of values",
+		":load [PATH]\n  run a file",
+		":env\n  list the variables",
+		"no command or builtin named 'nothing'",
+	}, nil)
+}
+
+func TestBuiltinsCommand(t *testing.T) {
+	runReplContains(t, ":builtins\n", []string{
+		"(+ numbers...)",
+		"(slice value start [end])",
+		"(pop! list)",
+	}, nil)
+}
+
+func TestQuitCommand(t *testing.T) {
+	runReplTests(t, "(+ 1 2)\n:quit\n(+ 3 4)\n", ">>> 3\n>>> ")
+}
+
+func TestEnvCommand(t *testing.T) {
+	runReplContains(
+		t,
+		":env\n(def total (+ 1 2))\n(def name \"lisp\")\n(def total 5)\n:env\n",
+		[]string{
+			"no variables defined\n",
+			"name: lisp\ntotal: 5\n",
+		},
+		[]string{"total: 3"},
+	)
+}
+
+func TestResetCommand(t *testing.T) {
+	runReplContains(
+		t,
+		"(def a 5)\na\n:reset\n:env\na\n(def a 6)\na\n",
+		[]string{
+			">>> 5\n",
+			"no variables defined\n",
+			">>> 6\n",
+		},
+		nil,
+	)
+
+	// After the reset a is undefined, which each engine reports differently.
+	runReplTests(t, "(def a 5)\n:reset\n:quit\n", ">>> 5\n>>> >>> ")
+
+	var out strings.Builder
+	Start(strings.NewReader("(def a 5)\n:reset\na\n"), &out)
+
+	if !strings.Contains(out.String(), "error: No such item: a") {
+		t.Errorf("eval: a still defined after reset: %q", out.String())
+	}
+
+	out.Reset()
+	StartCompiled(strings.NewReader("(def a 5)\n:reset\na\n"), &out)
+
+	if !strings.Contains(out.String(), "error: compiler error: undefined variable a") {
+		t.Errorf("vm: a still defined after reset: %q", out.String())
+	}
+}
+
+// A line starting with a colon that isn't a command is run as an expression.
+func TestKeywordInput(t *testing.T) {
+	runReplTests(
+		t,
+		":name\n:frobnicate\n(+ 1 2)\n*2\n",
+		">>> :name\n>>> :frobnicate\n>>> 3\n>>> :frobnicate\n>>> ",
+	)
+}
+
+func TestAstCommand(t *testing.T) {
+	runReplContains(
+		t,
+		":ast (def a '(1 \"b\"))\n",
+		[]string{
+			"SExpression line 1\n" +
+				"  Identifier def line 1\n" +
+				"  Identifier a line 1\n" +
+				"  SExpression quoted line 1\n" +
+				"    Identifier list line 1\n" +
+				"    FloatLiteral 1 line 1\n" +
+				"    StringLiteral \"b\" line 1\n",
+		},
+		nil,
+	)
+
+	runReplContains(t, ":ast\n", []string{"expected an expression\n"}, nil)
+}
+
+func TestBytecodeCommand(t *testing.T) {
+	runReplContains(
+		t,
+		":bytecode (+ 1 2)\n",
+		[]string{
+			"OpGetBuiltin 0           ; +\n",
+			"OpCall 2                 ; call +, line 1\n",
+		},
+		nil,
+	)
+
+	// Variables defined in the session can be used, but nothing is defined
+	// by the command itself. The index of x depends on the engine, since the
+	// VM defines the result variables first.
+	runReplContains(
+		t,
+		"(def x 5)\n:bytecode (def y (lambda () x))\n:env\n",
+		[]string{
+			"OpGetGlobal ",
+			"; x\n",
+			"lambda y (constant",
+			"x: 5\n",
+		},
+		[]string{"y: "},
+	)
+
+	runReplContains(
+		t,
+		":bytecode (+ 1 z)\n",
+		[]string{"error: compiler error: undefined variable z\n"},
+		nil,
+	)
+}
+
+func TestLoadCommand(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "double.lisp")
+	broken := filepath.Join(dir, "broken.lisp")
+
+	writeFile(t, path, "(def double (lambda (x)\n  (* x 2)))\n(double 2)\n")
+	writeFile(t, broken, "(def f (lambda (x) x)\n")
+
+	runReplContains(
+		t,
+		":load "+path+"\n(double 21)\n",
+		[]string{">>> 4\n>>> 42\n"},
+		nil,
+	)
+
+	runReplContains(
+		t,
+		":load "+broken+"\n:load\n",
+		[]string{"error: " + broken + ": 2:1: Reached EOF before ')'\n>>> error: " + broken + ": 2:1: Reached EOF"},
+		nil,
+	)
+
+	runReplContains(
+		t,
+		":load\n:load "+filepath.Join(dir, "missing.lisp")+"\n",
+		[]string{"expected a file to load\n", "missing.lisp: no such file or directory\n"},
+		nil,
+	)
+
+	// Without a path the last file is loaded again.
+	total := filepath.Join(dir, "total.lisp")
+	writeFile(t, total, "(def total (+ base 1))\n")
+
+	runReplTests(
+		t,
+		"(def base 1)\n:load "+total+"\n(def base 10)\n:load\ntotal\n",
+		">>> 1\n>>> 2\n>>> 10\n>>> 11\n>>> 11\n>>> ",
+	)
+}
+
+func writeFile(t *testing.T, path string, contents string) {
+	t.Helper()
+
+	err := os.WriteFile(path, []byte(contents), 0600)
+
+	if err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	evalTiming := regexp.MustCompile(`>>> 3\nduration=[0-9.]+[µnm]?s\n>>> $`)
+	vmTiming := regexp.MustCompile(
+		`>>> 3\nduration=[0-9.]+[µnm]?s \(compile=[0-9.]+[µnm]?s run=[0-9.]+[µnm]?s\)\n>>> $`,
+	)
+
+	var out strings.Builder
+
+	Start(strings.NewReader(":time (+ 1 2)\n"), &out)
+
+	if !evalTiming.MatchString(out.String()) {
+		t.Errorf("eval: wrong output for :time: %q", out.String())
+	}
+
+	out.Reset()
+	StartCompiled(strings.NewReader(":time (+ 1 2)\n"), &out)
+
+	if !vmTiming.MatchString(out.String()) {
+		t.Errorf("vm: wrong output for :time: %q", out.String())
+	}
+
+	// Programs that fail to run are shown without a duration.
+	out.Reset()
+	StartCompiled(strings.NewReader(":time (+ 1 z)\n"), &out)
+
+	if strings.Contains(out.String(), "duration=") {
+		t.Errorf("vm: duration shown for failed program: %q", out.String())
+	}
+}
+
+func TestTimingCommand(t *testing.T) {
+	for _, engine := range engines {
+		var out strings.Builder
+
+		engine.start(
+			strings.NewReader(":timing\n:timing on\n(+ 1 2)\n(+ 3 4)\n:timing off\n(+ 5 6)\n:timing maybe\n"),
+			&out,
+		)
+
+		output := out.String()
+
+		for _, expected := range []string{
+			">>> timing is off\n>>> timing is on\n>>> 3\nduration=",
+			">>> 7\nduration=",
+			">>> timing is off\n>>> 11\n>>> error: expected on or off, got 'maybe'\n>>> ",
+		} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("%s: output doesn't contain %q\ngot=%q", engine.name, expected, output)
+			}
+		}
+
+		if count := strings.Count(output, "duration="); count != 2 {
+			t.Errorf("%s: expected 2 durations, got %d", engine.name, count)
+		}
+	}
+}
+
+func TestEngineCommand(t *testing.T) {
+	input := `(def a 1)
+:engine
+:engine vm
+(def a 2)
+(+ a 1)
+:engine eval
+(+ a 1)
+:engine vm
+a
+:engine lisp
+`
+	expected := ">>> 1\n>>> engine is eval\n>>> engine is vm\n>>> 2\n>>> 3\n" +
+		">>> engine is eval\n>>> 2\n>>> engine is vm\n>>> 2\n" +
+		">>> error: expected eval or vm, got 'lisp'\n>>> "
+
+	var out strings.Builder
+
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong output\nwant=%q\ngot= %q", expected, out.String())
+	}
+
+	out.Reset()
+	StartCompiled(strings.NewReader(":engine\n"), &out)
+
+	if out.String() != ">>> engine is vm\n>>> " {
+		t.Errorf("wrong engine for StartCompiled, got=%q", out.String())
+	}
+}
@@ -0,0 +1,51 @@
+package repl
+
+import (
+	"lisp/ast"
+	"lisp/object"
+	"slices"
+	"strings"
+)
+
+// Names that are always available, other than builtins and special forms.
+var literalNames = []string{"true", "false", "null"}
+
+// Return the names that start with the provided prefix, in alphabetical order.
+// Names are taken from the builtins, special forms and literals, along with the
+// variables defined in the session. A prefix starting with a colon completes
+// the names of commands instead.
+func (s *session) complete(prefix string) []string {
+	names := []string{}
+
+	if strings.HasPrefix(prefix, ":") {
+		for _, cmd := range s.commands() {
+			names = append(names, ":"+cmd.name)
+		}
+	} else {
+		for _, builtin := range object.Builtins {
+			names = append(names, builtin.Name)
+		}
+
+		for form := range ast.SpecialForms {
+			names = append(names, form)
+		}
+
+		names = append(names, literalNames...)
+
+		for _, g := range globals(s.engine) {
+			names = append(names, g.name)
+		}
+	}
+
+	candidates := []string{}
+
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			candidates = append(candidates, name)
+		}
+	}
+
+	slices.Sort(candidates)
+
+	return slices.Compact(candidates)
+}
@@ -0,0 +1,45 @@
+package repl
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"le", []string{"len", "let"}},
+		{"f", []string{"false", "first", "fizz", "fizzbuzz"}},
+		{"fizz", []string{"fizz", "fizzbuzz"}},
+		{"la", []string{"lambda", "last"}},
+		{"tr", []string{"true"}},
+		{"error", []string{"error", "error-kind", "error-message", "error?"}},
+		{"zzz", []string{}},
+		{":h", []string{":help"}},
+		{":ti", []string{":time", ":timing"}},
+	}
+
+	for _, engine := range engines {
+		var out strings.Builder
+
+		s := newSession(strings.NewReader(""), &out, engine.name, newConfig(nil))
+
+		_, err := s.engine.Eval("(def fizz 1) (def fizzbuzz 2)")
+
+		if err != nil {
+			t.Fatalf("failed to run definitions: %s", err)
+		}
+
+		for _, tt := range tests {
+			candidates := s.complete(tt.prefix)
+
+			if !slices.Equal(candidates, tt.expected) {
+				t.Errorf("%s: wrong completions for %q. want=%q, got=%q",
+					engine.name, tt.prefix, tt.expected, candidates)
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Control characters understood by the editor.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// An editor provides emacs style line editing and history navigation. It
+// reads key presses from a terminal in raw mode and redraws the line after
+// each one, but doesn't change the mode of the terminal itself.
+//
+// The supported keys are:
+//   - left/right arrows, Ctrl-B and Ctrl-F move the cursor
+//   - Home, End, Ctrl-A and Ctrl-E move to the start or end of the line
+//   - up/down arrows, Ctrl-P and Ctrl-N move through the history
+//   - Backspace, Delete and Ctrl-D remove a character
+//   - Ctrl-K and Ctrl-U remove the text after or before the cursor
+//   - Ctrl-W removes the word before the cursor
+//   - Tab completes the word before the cursor, or lists the possibilities
+//   - Ctrl-C abandons the line, and Ctrl-D on an empty line ends input
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  []string
+	complete Completer // used to complete words, if not nil
+}
+
+func newEditor(in io.Reader, out io.Writer) *editor {
+	return &editor{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+}
+
+// The state of the line being edited.
+type editLine struct {
+	text []rune
+	pos  int // the position of the cursor in text
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	line := &editLine{}
+
+	// The position in the history being shown. Equal to the length of the
+	// history when the new line is shown, which is kept in draft.
+	historyIndex := len(e.history)
+	draft := ""
+
+	showHistory := func(index int) {
+		if index < 0 || index > len(e.history) {
+			return
+		}
+
+		if historyIndex == len(e.history) {
+			draft = string(line.text)
+		}
+
+		historyIndex = index
+
+		if index == len(e.history) {
+			line.text = []rune(draft)
+		} else {
+			line.text = []rune(e.history[index])
+		}
+
+		line.pos = len(line.text)
+	}
+
+	e.refresh(prompt, line)
+
+	for {
+		r, _, err := e.in.ReadRune()
+
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(line.text), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(line.text) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+
+			line.deleteAt(line.pos)
+		case keyCtrlA:
+			line.pos = 0
+		case keyCtrlE:
+			line.pos = len(line.text)
+		case keyCtrlB:
+			line.move(-1)
+		case keyCtrlF:
+			line.move(1)
+		case keyCtrlH, keyBackspace:
+			if line.pos > 0 {
+				line.pos--
+				line.deleteAt(line.pos)
+			}
+		case keyCtrlK:
+			line.text = line.text[:line.pos]
+		case keyCtrlU:
+			line.text = line.text[line.pos:]
+			line.pos = 0
+		case keyCtrlW:
+			line.deleteWord()
+		case keyTab:
+			e.completeWord(line)
+		case keyCtrlP:
+			showHistory(historyIndex - 1)
+		case keyCtrlN:
+			showHistory(historyIndex + 1)
+		case keyEscape:
+			switch e.readEscape() {
+			case 'A':
+				showHistory(historyIndex - 1)
+			case 'B':
+				showHistory(historyIndex + 1)
+			case 'C':
+				line.move(1)
+			case 'D':
+				line.move(-1)
+			case 'H':
+				line.pos = 0
+			case 'F':
+				line.pos = len(line.text)
+			case '3':
+				line.deleteAt(line.pos)
+			}
+		default:
+			if r >= ' ' {
+				line.insert(r)
+			}
+		}
+
+		e.refresh(prompt, line)
+	}
+}
+
+// Complete the word before the cursor as far as every possible completion
+// agrees. If it can't be extended and there's more than one possibility, the
+// possibilities are listed below the line.
+func (e *editor) completeWord(line *editLine) {
+	start := line.pos
+
+	for start > 0 && isWordRune(line.text[start-1]) {
+		start--
+	}
+
+	prefix := string(line.text[start:line.pos])
+
+	if e.complete == nil || prefix == "" {
+		return
+	}
+
+	candidates := e.complete(prefix)
+
+	if len(candidates) == 0 {
+		return
+	}
+
+	common := []rune(commonPrefix(candidates))
+
+	if len(common) > line.pos-start {
+		text := append([]rune{}, line.text[:start]...)
+		text = append(text, common...)
+		line.text = append(text, line.text[line.pos:]...)
+		line.pos = start + len(common)
+		return
+	}
+
+	if len(candidates) > 1 {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+// Report whether the character can be part of a word that's completed, which
+// is any character that can be part of an identifier.
+func isWordRune(r rune) bool {
+	return !strings.ContainsRune(" \t()'{}\"", r)
+}
+
+// Return the longest prefix shared by every string provided.
+func commonPrefix(words []string) string {
+	prefix := words[0]
+
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+
+	return prefix
+}
+
+// Add a line to the history, unless it's empty or the same as the most recent
+// entry.
+func (e *editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+
+	e.history = append(e.history, line)
+}
+
+// Read the rest of an escape sequence, returning the byte that identifies it.
+// Arrow keys, Home and End are identified by their final letter, and Delete
+// by the '3' in ESC [ 3 ~. Returns 0 for sequences that aren't recognised.
+func (e *editor) readEscape() byte {
+	b, err := e.in.ReadByte()
+
+	if err != nil || (b != '[' && b != 'O') {
+		return 0
+	}
+
+	b, err = e.in.ReadByte()
+
+	if err != nil {
+		return 0
+	}
+
+	if b == '3' {
+		if next, err := e.in.ReadByte(); err != nil || next != '~' {
+			return 0
+		}
+	}
+
+	return b
+}
+
+// Redraw the prompt and line, then place the cursor.
+func (e *editor) refresh(prompt string, line *editLine) {
+	var out strings.Builder
+
+	out.WriteString("\r")
+	out.WriteString(prompt)
+	out.WriteString(string(line.text))
+	// Clear anything left over from a longer line.
+	out.WriteString("\x1b[K")
+	out.WriteString("\r")
+
+	if column := len([]rune(prompt)) + line.pos; column > 0 {
+		fmt.Fprintf(&out, "\x1b[%dC", column)
+	}
+
+	fmt.Fprint(e.out, out.String())
+}
+
+func (l *editLine) insert(r rune) {
+	l.text = append(l.text, 0)
+	copy(l.text[l.pos+1:], l.text[l.pos:])
+	l.text[l.pos] = r
+	l.pos++
+}
+
+// Remove the character at the provided position, if there is one.
+func (l *editLine) deleteAt(pos int) {
+	if pos < 0 || pos >= len(l.text) {
+		return
+	}
+
+	l.text = append(l.text[:pos], l.text[pos+1:]...)
+}
+
+// Move the cursor by the provided number of characters, staying within the
+// line.
+func (l *editLine) move(by int) {
+	l.pos = min(max(l.pos+by, 0), len(l.text))
+}
+
+// Remove the word before the cursor, along with any spaces after it.
+func (l *editLine) deleteWord() {
+	start := l.pos
+
+	for start > 0 && l.text[start-1] == ' ' {
+		start--
+	}
+
+	for start > 0 && l.text[start-1] != ' ' {
+		start--
+	}
+
+	l.text = append(l.text[:start], l.text[l.pos:]...)
+	l.pos = start
+}
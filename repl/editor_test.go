@@ -0,0 +1,157 @@
+package repl
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEditorKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{"typing", "(+ 1 2)\r", "(+ 1 2)"},
+		{"backspace", "(+ 1 3\x7f2)\r", "(+ 1 2)"},
+		{"left arrow and insert", "(+ 1 )\x1b[D2\r", "(+ 1 2)"},
+		{"right arrow", "(+ 1 )\x1b[D\x1b[C2\r", "(+ 1 )2"},
+		{"start and end of line", "+ 1 2\x01(\x05)\r", "(+ 1 2)"},
+		{"home and end keys", "+ 1 2\x1b[H(\x1b[F)\r", "(+ 1 2)"},
+		{"cursor stays in line", "\x02\x02ab\x06\x06c\r", "abc"},
+		{"delete key", "(+ 1 22)\x1b[D\x1b[D\x1b[3~\r", "(+ 1 2)"},
+		{"delete with ctrl-d", "(+ 1 22)\x1b[D\x1b[D\x04\r", "(+ 1 2)"},
+		{"kill to end", "(+ 1 2) junk\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x0b\r", "(+ 1 2)"},
+		{"kill to start", "junk (+ 1 2)\x01\x06\x06\x06\x06\x06\x15\r", "(+ 1 2)"},
+		{"delete word", "(+ 1 2) junk  \x17\r", "(+ 1 2) "},
+		{"ignore unknown escapes", "a\x1b[Zb\r", "ab"},
+		{"unicode", "\"hé\x7fe\"\r", "\"he\""},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+
+		e := newEditor(strings.NewReader(tt.keys), &out)
+
+		line, err := e.ReadLine(PROMPT)
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+
+		if line != tt.expected {
+			t.Errorf("%s: wrong line. want=%q, got=%q", tt.name, tt.expected, line)
+		}
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{"previous entry", "\x1b[A\r", "(+ 3 4)"},
+		{"oldest entry", "\x1b[A\x1b[A\x1b[A\x1b[A\r", "(+ 1 2)"},
+		{"back to newer entry", "\x1b[A\x1b[A\x1b[B\r", "(+ 3 4)"},
+		{"back to draft", "(f\x1b[A\x1b[B)\r", "(f)"},
+		{"ctrl-p and ctrl-n", "\x10\x10\x0e\r", "(+ 3 4)"},
+		{"edit recalled entry", "\x1b[A\x1b[D\x7f5\r", "(+ 3 5)"},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+
+		e := newEditor(strings.NewReader(tt.keys), &out)
+
+		e.AddHistory("(+ 1 2)")
+		e.AddHistory("")
+		e.AddHistory("(+ 3 4)")
+		e.AddHistory("(+ 3 4)")
+
+		line, err := e.ReadLine(PROMPT)
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+
+		if line != tt.expected {
+			t.Errorf("%s: wrong line. want=%q, got=%q", tt.name, tt.expected, line)
+		}
+	}
+}
+
+func TestEditorEndOfInput(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected error
+	}{
+		{"\x04", io.EOF},
+		{"abc", io.EOF},
+		{"abc\x03", ErrInterrupted},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+
+		e := newEditor(strings.NewReader(tt.keys), &out)
+
+		_, err := e.ReadLine(PROMPT)
+
+		if err != tt.expected {
+			t.Errorf("wrong error for %q. want=%v, got=%v", tt.keys, tt.expected, err)
+		}
+	}
+}
+
+func TestEditorCompletion(t *testing.T) {
+	complete := func(prefix string) []string {
+		candidates := []string{}
+
+		for _, name := range []string{"first", "fizz", "fizzbuzz", "len"} {
+			if strings.HasPrefix(name, prefix) {
+				candidates = append(candidates, name)
+			}
+		}
+
+		return candidates
+	}
+
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+		listed   string
+	}{
+		{"single candidate", "(le\t 1)\r", "(len 1)", ""},
+		{"common prefix", "(fiz\t\r", "(fizz", ""},
+		{"list candidates", "(fizz\t\r", "(fizz", "fizz  fizzbuzz"},
+		{"mid expression", "(+ (fi 1))\x1b[D\x1b[D\x1b[D\x1b[Dz\t\r", "(+ (fizz 1))", ""},
+		{"no candidates", "(xyz\t)\r", "(xyz)", ""},
+		{"empty word", "(\t)\r", "()", ""},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+
+		e := newEditor(strings.NewReader(tt.keys), &out)
+		e.complete = complete
+
+		line, err := e.ReadLine(PROMPT)
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+
+		if line != tt.expected {
+			t.Errorf("%s: wrong line. want=%q, got=%q", tt.name, tt.expected, line)
+		}
+
+		if tt.listed != "" && !strings.Contains(out.String(), "\r\n"+tt.listed+"\r\n") {
+			t.Errorf("%s: candidates not listed in %q", tt.name, out.String())
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"lisp/ast"
+	"lisp/interpreter"
+	"lisp/object"
+	"time"
+)
+
+// The time taken to run a program.
+type timing struct {
+	compiled bool          // true if the program was compiled before running
+	compile  time.Duration // the time spent compiling
+	run      time.Duration // the time spent running
+}
+
+// Format the total duration, along with the time spent in each stage for
+// compiled programs.
+func (t timing) String() string {
+	if !t.compiled {
+		return fmt.Sprintf("duration=%s", t.run)
+	}
+
+	return fmt.Sprintf("duration=%s (compile=%s run=%s)", t.compile+t.run, t.compile, t.run)
+}
+
+// The names of the variables holding the results of the last inputs, most
+// recent first.
+var resultNames = []string{"*1", "*2", "*3"}
+
+// A global variable defined in a REPL session.
+type global struct {
+	name  string
+	value object.Object
+}
+
+// Run the program with the engine in use, returning its result and how long it
+// took. Warnings from compiling the program are written with the errors.
+func (s *session) runProgram(ctx context.Context, program *ast.Program) (object.Object, timing, error) {
+	e := s.engine
+	result, err := e.Run(ctx, program)
+
+	for _, warning := range e.Warnings() {
+		fmt.Fprintf(s.errOut, "warning: %s\n", warning)
+	}
+
+	t := e.Timing()
+
+	return result, timing{compiled: e.Engine() == interpreter.VM_ENGINE, compile: t.Compile, run: t.Run}, err
+}
+
+// Set *1 to the result of an input, moving the previous results to *2 and *3.
+func recordResult(e *interpreter.Session, result object.Object) {
+	for i := len(resultNames) - 1; i > 0; i-- {
+		if previous, ok := e.Get(resultNames[i-1]); ok {
+			e.Set(resultNames[i], previous)
+		}
+	}
+
+	e.Set(resultNames[0], result)
+}
+
+// Return the global variables defined by previous programs, sorted by name.
+// *args* isn't included, since it's always defined.
+func globals(e *interpreter.Session) []global {
+	globals := []global{}
+
+	for _, name := range e.Names() {
+		if name == object.ARGS_NAME {
+			continue
+		}
+
+		value, _ := e.Get(name)
+		globals = append(globals, global{name, value})
+	}
+
+	return globals
+}
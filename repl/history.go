@@ -0,0 +1,165 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The environment variable that sets the location of the history file.
+const HISTORY_ENV = "LISP_HISTORY"
+
+// The name of the history file in the user's home directory, used when no
+// other location is provided.
+const HISTORY_FILE = ".lisp_history"
+
+// Return the location of the history file from the environment, or the
+// default location in the home directory. Returns an empty string if neither
+// is available.
+func defaultHistoryFile() string {
+	if path := os.Getenv(HISTORY_ENV); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, HISTORY_FILE)
+}
+
+// A LineReader that saves each entry added to its history in a file, so that
+// it's available to later sessions.
+//
+// If the file can't be written, a warning is shown once and the session
+// continues without saving history.
+type persistentHistory struct {
+	LineReader
+	path    string
+	limit   int
+	entries []string // the entries currently in the file
+	out     io.Writer
+	failed  bool
+}
+
+// Wrap the LineReader so that its history is saved to the file at the
+// provided path, first adding the entries already in the file.
+func newPersistentHistory(
+	lines LineReader,
+	path string,
+	limit int,
+	out io.Writer,
+) *persistentHistory {
+	h := &persistentHistory{
+		LineReader: lines,
+		path:       path,
+		limit:      limit,
+		out:        out,
+	}
+
+	entries, err := readHistory(path)
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		h.warn(err)
+		return h
+	}
+
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	for _, entry := range entries {
+		lines.AddHistory(entry)
+	}
+
+	h.entries = entries
+
+	return h
+}
+
+func (h *persistentHistory) AddHistory(line string) {
+	h.LineReader.AddHistory(line)
+
+	if h.failed || strings.TrimSpace(line) == "" {
+		return
+	}
+
+	h.entries = append(h.entries, line)
+
+	var err error
+
+	if len(h.entries) > h.limit {
+		h.entries = h.entries[len(h.entries)-h.limit:]
+		err = writeHistory(h.path, h.entries)
+	} else {
+		err = appendHistory(h.path, line)
+	}
+
+	if err != nil {
+		h.warn(err)
+	}
+}
+
+// Report that history can't be saved, then stop trying to save it.
+func (h *persistentHistory) warn(err error) {
+	fmt.Fprintf(h.out, "warning: history will not be saved: %s\n", err)
+	h.failed = true
+}
+
+// Return each line of the history file.
+func readHistory(path string) ([]string, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	entries := []string{}
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			entries = append(entries, line)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// Add a single entry to the end of the history file, creating it if needed.
+func appendHistory(path string, entry string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(file, entry)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Replace the contents of the history file with the provided entries.
+func writeHistory(path string, entries []string) error {
+	var contents strings.Builder
+
+	for _, entry := range entries {
+		contents.WriteString(entry)
+		contents.WriteString("\n")
+	}
+
+	return os.WriteFile(path, []byte(contents.String()), 0600)
+}
@@ -0,0 +1,91 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	for _, engine := range engines {
+		os.Remove(path)
+
+		var out strings.Builder
+
+		input := "(+ 1 2)\n\n(+ 3\n   4)\n(def a 5)\n"
+
+		engine.start(
+			strings.NewReader(input),
+			&out,
+			WithHistoryFile(path),
+			WithHistoryLimit(2),
+		)
+
+		testHistoryEntries(t, engine.name, path, []string{"(+ 3 4)", "(def a 5)"})
+
+		// Entries are added to those saved by earlier sessions.
+		engine.start(
+			strings.NewReader("a\n"),
+			&out,
+			WithHistoryFile(path),
+			WithHistoryLimit(2),
+		)
+
+		testHistoryEntries(t, engine.name, path, []string{"(def a 5)", "a"})
+	}
+}
+
+func TestHistoryFileLoaded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	err := os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0600)
+
+	if err != nil {
+		t.Fatalf("failed to write history: %s", err)
+	}
+
+	var out strings.Builder
+
+	editor := newEditor(strings.NewReader(""), &out)
+	newPersistentHistory(editor, path, 2, &out)
+
+	if !slices.Equal(editor.history, []string{"two", "three"}) {
+		t.Errorf("wrong history loaded. got=%q", editor.history)
+	}
+}
+
+func TestHistoryFileUnwritable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "history")
+
+	var out strings.Builder
+
+	Start(strings.NewReader("1\n2\n"), &out, WithHistoryFile(path))
+
+	warnings := strings.Count(out.String(), "warning: history will not be saved")
+
+	if warnings != 1 {
+		t.Errorf("expected 1 warning, got %d in %q", warnings, out.String())
+	}
+
+	if !strings.HasSuffix(out.String(), "2\n>>> ") {
+		t.Errorf("session didn't continue after warning: %q", out.String())
+	}
+}
+
+func testHistoryEntries(t *testing.T, engine string, path string, expected []string) {
+	t.Helper()
+
+	entries, err := readHistory(path)
+
+	if err != nil {
+		t.Fatalf("%s: failed to read history: %s", engine, err)
+	}
+
+	if !slices.Equal(entries, expected) {
+		t.Errorf("%s: wrong history entries. want=%q, got=%q", engine, expected, entries)
+	}
+}
@@ -0,0 +1,190 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The default prompt shown while the input so far is an unfinished form.
+const CONTINUATION_PROMPT = "... "
+
+// A formReader reads input a line at a time until it contains only complete
+// forms, so that a form can be split across several lines.
+type formReader struct {
+	lines              LineReader
+	out                io.Writer
+	prompt             string
+	continuationPrompt string
+	// Report an error in the input, in the same way as fmt.Printf.
+	errorf func(format string, args ...any)
+}
+
+func newFormReader(in io.Reader, out io.Writer, cfg *config, complete Completer) *formReader {
+	lines := newLineReader(in, out, complete)
+	path := cfg.historyFile
+
+	// History is only saved by default for interactive sessions, so that
+	// piping a file in doesn't fill it.
+	if _, ok := lines.(*terminalReader); ok && path == "" {
+		path = defaultHistoryFile()
+	}
+
+	if path != "" {
+		lines = newPersistentHistory(lines, path, cfg.historyLimit, out)
+	}
+
+	return &formReader{
+		lines:              lines,
+		out:                out,
+		prompt:             cfg.prompt,
+		continuationPrompt: cfg.continuationPrompt,
+	}
+}
+
+// Prompt for and return the next complete input, which may span several
+// lines. Returns false once the input is exhausted, or the user interrupts
+// input twice in a row at an empty prompt.
+//
+// If the input ends part way through a form, the unfinished input is returned
+// so that the parser can report what's missing.
+func (r *formReader) read() (string, bool) {
+	var buffer strings.Builder
+
+	prompt := r.prompt
+	// Whether the previous line was interrupted with nothing entered.
+	interrupted := false
+
+	for {
+		line, err := r.lines.ReadLine(prompt)
+
+		if err == ErrInterrupted {
+			// Interrupting twice in a row without entering anything ends
+			// the session, while interrupting an unfinished form discards it.
+			if buffer.Len() == 0 && interrupted {
+				return "", false
+			}
+
+			if buffer.Len() == 0 {
+				fmt.Fprintln(r.out, "press Ctrl-C again to exit")
+			}
+
+			interrupted = buffer.Len() == 0
+			buffer.Reset()
+			prompt = r.prompt
+			continue
+		}
+
+		interrupted = false
+
+		if err != nil {
+			break
+		}
+
+		if buffer.Len() == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		buffer.WriteString(line)
+		buffer.WriteString("\n")
+
+		depth, inString := balance(buffer.String())
+
+		switch {
+		case depth < 0:
+			r.errorf("unexpected closing delimiter, input discarded\n")
+			buffer.Reset()
+			prompt = r.prompt
+		case depth > 0 || inString:
+			prompt = r.continuationPrompt
+		default:
+			r.lines.AddHistory(historyEntry(buffer.String()))
+			return buffer.String(), true
+		}
+	}
+
+	if buffer.Len() > 0 {
+		return buffer.String(), true
+	}
+
+	return "", false
+}
+
+// Join the lines of an input so that it can be recalled and edited as a single
+// line. Comments are removed, since they would hide the lines after them.
+func historyEntry(input string) string {
+	lines := strings.Split(strings.TrimSpace(withoutComments(input)), "\n")
+
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+
+	return strings.Join(lines, " ")
+}
+
+// Return the input without the comments that run from a ; outside of a string
+// to the end of the line.
+func withoutComments(input string) string {
+	var output strings.Builder
+	inString := false
+	inComment := false
+
+	for i := 0; i < len(input); i++ {
+		ch := input[i]
+
+		switch {
+		case inComment:
+			if ch != '\n' {
+				continue
+			}
+
+			inComment = false
+		case ch == '"':
+			inString = !inString
+		case ch == ';' && !inString:
+			inComment = true
+			continue
+		}
+
+		output.WriteByte(ch)
+	}
+
+	return output.String()
+}
+
+// Return how many more opening parens and braces than closing ones the input
+// contains, and whether it ends inside a string. The depth is negative if at
+// any point there are more closing delimiters than opening ones. Delimiters in
+// strings and comments aren't counted.
+func balance(input string) (int, bool) {
+	depth := 0
+	inString := false
+	input = withoutComments(input)
+
+	for i := 0; i < len(input); i++ {
+		ch := input[i]
+
+		if inString {
+			if ch == '"' {
+				inString = false
+			}
+
+			continue
+		}
+
+		switch ch {
+		case '"':
+			inString = true
+		case '(', '{':
+			depth++
+		case ')', '}':
+			depth--
+
+			if depth < 0 {
+				return depth, false
+			}
+		}
+	}
+
+	return depth, inString
+}
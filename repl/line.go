@@ -0,0 +1,100 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrInterrupted is returned by a LineReader when the user interrupts input,
+// conventionally by pressing Ctrl-C.
+var ErrInterrupted = errors.New("interrupted")
+
+// A LineReader reads single lines of input for the REPL. Any line editing
+// library can be used by the REPL by implementing this interface.
+type LineReader interface {
+	// Show the prompt and return the next line of input, without its line
+	// ending. Returns io.EOF once there's no more input.
+	ReadLine(prompt string) (string, error)
+	// Record a complete input so that it can be recalled later.
+	AddHistory(line string)
+}
+
+// Return the possible completions of the partial word provided.
+type Completer func(prefix string) []string
+
+// Return a line editor if both the Reader and Writer are a terminal, otherwise
+// a LineReader that reads lines without any editing. The Completer is used by
+// the line editor to complete words when Tab is pressed.
+func newLineReader(in io.Reader, out io.Writer, complete Completer) LineReader {
+	if isTerminalFile(in) && isTerminalFile(out) {
+		inFile := in.(*os.File)
+		editor := newEditor(inFile, out)
+		editor.complete = complete
+
+		return &terminalReader{
+			fd:     inFile.Fd(),
+			editor: editor,
+		}
+	}
+
+	return &scannerReader{
+		scanner: bufio.NewScanner(in),
+		out:     out,
+	}
+}
+
+// Report whether the Reader or Writer is a file that's a terminal.
+func isTerminalFile(rw any) bool {
+	file, ok := rw.(*os.File)
+
+	return ok && isTerminal(file.Fd())
+}
+
+// A LineReader for input that isn't a terminal, such as a file or pipe.
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (s *scannerReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(s.out, prompt)
+
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+
+		return "", io.EOF
+	}
+
+	return s.scanner.Text(), nil
+}
+
+// History isn't kept when input can't be edited.
+func (s *scannerReader) AddHistory(line string) {}
+
+// A LineReader that puts the terminal into raw mode while each line is edited,
+// restoring it afterwards so that programs can print normally.
+type terminalReader struct {
+	fd     uintptr
+	editor *editor
+}
+
+func (t *terminalReader) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(t.fd)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer restore()
+
+	return t.editor.ReadLine(prompt)
+}
+
+func (t *terminalReader) AddHistory(line string) {
+	t.editor.AddHistory(line)
+}
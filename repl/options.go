@@ -0,0 +1,101 @@
+package repl
+
+import (
+	"io"
+	"lisp/interpreter"
+)
+
+// The settings of a REPL session, changed by passing Options to Start or
+// StartCompiled.
+type config struct {
+	// The file history is loaded from and saved to. When empty, history is
+	// only kept when running in a terminal, in the default location.
+	historyFile string
+	// The number of entries kept in the history file.
+	historyLimit int
+	// The prompt shown when waiting for a new input.
+	prompt string
+	// The prompt shown while the input so far is an unfinished form.
+	continuationPrompt string
+	// Whether errors are shown in colour when output is to a terminal.
+	color bool
+	// The Writer errors are written to. When nil, errors are written with
+	// the rest of the output.
+	errorWriter io.Writer
+	// The Session the REPL starts with, when not nil.
+	session *interpreter.Session
+}
+
+func newConfig(options []Option) *config {
+	c := &config{
+		historyLimit:       1000,
+		prompt:             PROMPT,
+		continuationPrompt: CONTINUATION_PROMPT,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// An Option changes the behaviour of a REPL session.
+type Option func(*config)
+
+// Load history from, and save history to, the file at the provided path. This
+// takes precedence over the LISP_HISTORY environment variable, and history is
+// saved even when input isn't read from a terminal.
+func WithHistoryFile(path string) Option {
+	return func(c *config) {
+		c.historyFile = path
+	}
+}
+
+// Keep at most the provided number of entries in the history file, discarding
+// the oldest first.
+func WithHistoryLimit(limit int) Option {
+	return func(c *config) {
+		c.historyLimit = limit
+	}
+}
+
+// Show the provided prompt when waiting for a new input, instead of PROMPT.
+func WithPrompt(prompt string) Option {
+	return func(c *config) {
+		c.prompt = prompt
+	}
+}
+
+// Show the provided prompt while the input so far is an unfinished form,
+// instead of CONTINUATION_PROMPT.
+func WithContinuationPrompt(prompt string) Option {
+	return func(c *config) {
+		c.continuationPrompt = prompt
+	}
+}
+
+// Show errors in red when enabled. Colour is only used when the Writer is a
+// terminal, so output to a file or pipe never contains escape codes.
+func WithColor(enabled bool) Option {
+	return func(c *config) {
+		c.color = enabled
+	}
+}
+
+// Write errors to the provided Writer instead of the Writer passed to Start or
+// StartCompiled, so that they can be separated from results.
+func WithErrorWriter(w io.Writer) Option {
+	return func(c *config) {
+		c.errorWriter = w
+	}
+}
+
+// Start with the provided Session instead of a new one, so that everything
+// already defined in it can be used. The REPL starts with the engine of the
+// Session, rather than the engine of the function it's passed to.
+func WithSession(session *interpreter.Session) Option {
+	return func(c *config) {
+		c.session = session
+	}
+}
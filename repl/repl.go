@@ -2,111 +2,274 @@
 package repl
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"lisp/compiler"
-	"lisp/evaluator"
-	"lisp/lexer"
+	"lisp/ast"
+	"lisp/interpreter"
 	"lisp/object"
-	"lisp/parser"
-	"lisp/vm"
+	"os"
+	"os/signal"
+	"strings"
 )
 
+// The default prompt shown when waiting for a new input.
 const PROMPT = ">>> "
 
 // Starts an interactive interpreter, conventionally in the terminal
 // with stdin and stdout as the Reader and Writer.
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment(nil)
+//
+// Input is read until every form in it is complete, so a form can span
+// several lines. The session can be configured by passing Options.
+//
+// The results of the last three inputs are available as *1, *2 and *3, with
+// *1 being the most recent.
+//
+// Before the first prompt, the startup file is run so that it can define
+// variables for the session. It's found at the path in the LISP_RC environment
+// variable, or at ~/.lisprc for interactive sessions.
+//
+// Lines starting with the name of a command and a colon are commands rather
+// than expressions, enter :help to list them. Any other line starting with a
+// colon is run as an expression, so a keyword such as :name can be entered on
+// its own.
+//
+// Pressing Ctrl-C while an input is running stops it and returns to the
+// prompt. Pressing it twice at the prompt ends the session.
+//
+// Start uses the evaluator, and :engine switches between it and the VM.
+func Start(in io.Reader, out io.Writer, options ...Option) {
+	newSession(in, out, "eval", newConfig(options)).run()
+}
 
-	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
+// Starts an interactive interpreter in the same way as Start, but using the
+// VM.
+func StartCompiled(in io.Reader, out io.Writer, options ...Option) {
+	newSession(in, out, "vm", newConfig(options)).run()
+}
 
-		if !scanned {
-			return
-		}
+// The state of an interactive session.
+type session struct {
+	reader *formReader
+	out    io.Writer
+	// The Writer errors are written to, which may be out
+	errOut io.Writer
+	// The engine running inputs, which is one of engines
+	engine *interpreter.Session
+	// Every engine available, each keeping its own state
+	engines []*interpreter.Session
+	// The path of the last file run by :load
+	lastLoaded string
+	// Whether the time taken by each input is shown
+	timing bool
+	// Whether errors are shown in colour
+	color bool
+	// Whether input and output are both a terminal
+	interactive bool
+	// Return a context that's cancelled when the user interrupts the input
+	// being run, along with a function to call once it has finished.
+	interruptible func() (context.Context, context.CancelFunc)
+}
 
-		if len(scanner.Text()) == 0 {
-			continue
-		}
+// Create a session that starts with the engine with the provided name.
+func newSession(in io.Reader, out io.Writer, engineName string, cfg *config) *session {
+	s := &session{
+		out:         out,
+		errOut:      out,
+		interactive: isTerminalFile(in) && isTerminalFile(out),
+		engines: []*interpreter.Session{
+			interpreter.NewSession(interpreter.EVAL_ENGINE),
+			interpreter.NewSession(interpreter.VM_ENGINE),
+		},
+		interruptible: notifyInterrupt,
+	}
 
-		l := lexer.New(scanner.Text())
-		p := parser.New(l)
-		program := p.ParseProgram()
+	if cfg.errorWriter != nil {
+		s.errOut = cfg.errorWriter
+	}
+
+	s.color = cfg.color && isTerminalFile(s.errOut)
 
-		if len(p.Errors) > 0 {
-			for _, err := range p.Errors {
-				fmt.Fprintf(out, err)
+	if cfg.session != nil {
+		engineName = string(cfg.session.Engine())
+
+		for i, e := range s.engines {
+			if e.Engine() == cfg.session.Engine() {
+				s.engines[i] = cfg.session
 			}
+		}
+	}
 
-			return
+	// Printed output is written with the results, so that they appear in
+	// order.
+	for _, e := range s.engines {
+		if e.Stdout == nil {
+			e.Stdout = out
 		}
 
-		result := evaluator.Evaluate(program, env)
-		fmt.Fprintln(out, result.Inspect())
+		if e.Stderr == nil {
+			e.Stderr = s.errOut
+		}
 	}
+
+	s.engine = s.findEngine(engineName)
+
+	s.reader = newFormReader(in, out, cfg, s.complete)
+	s.reader.errorf = s.errorf
+
+	return s
 }
 
-// Starts an interactive interpreter, conventionally in the terminal
-// with stdin and stdout as the Reader and Writer.
-func StartCompiled(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalSize)
-	symbolTable := compiler.NewSymbolTable()
+// Return the engine with the provided name, or nil if there isn't one.
+func (s *session) findEngine(name string) *interpreter.Session {
+	for _, e := range s.engines {
+		if string(e.Engine()) == name {
+			return e
+		}
+	}
+
+	return nil
+}
 
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
+// Read and run inputs until the input ends or the session is quit.
+func (s *session) run() {
+	if s.interactive {
+		fmt.Fprintln(s.out, banner(s.engine))
+	}
+
+	if path := startupFile(s.interactive); path != "" {
+		s.runStartupFile(path)
 	}
 
 	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
+		input, ok := s.reader.read()
 
-		if !scanned {
+		if !ok {
 			return
 		}
 
-		if len(scanner.Text()) == 0 {
-			continue
-		}
-
-		l := lexer.New(scanner.Text())
-		p := parser.New(l)
-		program := p.ParseProgram()
+		if name, ok := strings.CutPrefix(strings.TrimSpace(input), ":"); ok {
+			if cmd, args, ok := s.findCommand(name); ok {
+				if !cmd.run(s, args) {
+					return
+				}
 
-		if len(p.Errors) > 0 {
-			for _, err := range p.Errors {
-				fmt.Fprintf(out, err)
+				continue
 			}
-
-			return
 		}
 
-		c := compiler.NewWithState(constants, symbolTable)
-		err := c.Compile(program)
+		program, ok := s.parse(input, "")
 
-		if err != nil {
-			fmt.Fprintf(out, "compiler error: %s\n", err)
+		// An input with only comments has nothing to run, and mustn't replace
+		// the results of earlier inputs.
+		if !ok || len(program.Expressions) == 0 {
 			continue
 		}
 
-		// preserve constants between commands
-		constants = c.Bytecode().Constants
+		if result := s.evaluate(program, "", s.timing); result != nil {
+			recordResult(s.engine, result)
+		}
+	}
+}
 
-		v := vm.NewWithState(c.Bytecode(), globals)
-		err = v.Run()
+// Run the program and show its result, or the error that stopped it. Errors
+// are prefixed with the source of the program, if provided. When timed is
+// true, the time taken is shown after the result.
+//
+// If the user interrupts the program, it's stopped and "interrupted" is shown
+// instead. The result is returned if the program succeeded, otherwise nil.
+func (s *session) evaluate(program *ast.Program, source string, timed bool) object.Object {
+	ctx, stop := s.interruptible()
+	defer stop()
 
-		if err != nil {
-			fmt.Fprintf(out, "vm error: %s\n", err)
-			continue
+	result, t, err := s.runProgram(ctx, program)
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(s.out, "interrupted")
+		return nil
+	}
+
+	if err != nil {
+		s.reportError(source, err)
+		return nil
+	}
+
+	fmt.Fprintln(s.out, result.Inspect())
+
+	if timed {
+		fmt.Fprintln(s.out, t)
+	}
+
+	return result
+}
+
+// Convert the input into an AST, reporting any errors prefixed with its source,
+// if provided. Returns false if it can't be parsed.
+func (s *session) parse(input string, source string) (*ast.Program, bool) {
+	program, err := interpreter.Parse(input)
+
+	if err != nil {
+		s.reportError(source, err)
+		return nil, false
+	}
+
+	return program, true
+}
+
+// Show the error, prefixed with the source of the program it came from, if
+// provided. Each problem that stopped a program being parsed is shown as an
+// error of its own.
+func (s *session) reportError(source string, err error) {
+	messages := []string{err.Error()}
+
+	var parseErr *interpreter.ParseError
+
+	if errors.As(err, &parseErr) {
+		messages = parseErr.Errors
+	}
+
+	for _, message := range messages {
+		if source != "" {
+			s.errorf("%s: %s\n", source, message)
+		} else {
+			s.errorf("%s\n", message)
 		}
+	}
+}
 
-		result := v.LastPoppedStackElem()
+// ANSI escape codes used to colour output.
+const (
+	colorRed   = "\x1b[31m"
+	colorReset = "\x1b[0m"
+)
+
+// The prefix of every error shown, so that errors can be told apart from
+// results.
+const ERROR_PREFIX = "error: "
+
+// Write an error in the same way as fmt.Fprintf, prefixed with ERROR_PREFIX
+// and in red if colour is enabled. A trailing newline is written after the
+// colour is reset.
+func (s *session) errorf(format string, args ...any) {
+	message := ERROR_PREFIX + fmt.Sprintf(format, args...)
+
+	if !s.color {
+		fmt.Fprint(s.errOut, message)
+		return
+	}
+
+	text, newline := strings.CutSuffix(message, "\n")
+	fmt.Fprint(s.errOut, colorRed+text+colorReset)
 
-		fmt.Fprintln(out, result.Inspect())
+	if newline {
+		fmt.Fprintln(s.errOut)
 	}
 }
+
+// Return a context that's cancelled when the process receives an interrupt
+// signal. The signal is only caught until the returned function is called, so
+// that an interrupt while waiting for input has its usual effect.
+func notifyInterrupt() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
@@ -0,0 +1,419 @@
+package repl
+
+import (
+	"context"
+	"io"
+	"lisp/interpreter"
+	"lisp/object"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The REPL entry points, so that each test can run against both engines.
+var engines = []struct {
+	name  string
+	start func(io.Reader, io.Writer, ...Option)
+}{
+	{"eval", Start},
+	{"vm", StartCompiled},
+}
+
+// Run the provided input through each engine's REPL, checking the full
+// output matches what's expected.
+func runReplTests(t *testing.T, input string, expected string) {
+	t.Helper()
+
+	for _, engine := range engines {
+		var out strings.Builder
+
+		engine.start(strings.NewReader(input), &out)
+
+		if out.String() != expected {
+			t.Errorf("%s: wrong output for %q\nwant=%q\ngot= %q",
+				engine.name, input, expected, out.String())
+		}
+	}
+}
+
+func TestMultilineInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"(def double (lambda (x)\n  (* x 2))) (double\n  21)\n",
+			">>> ... ... 42\n>>> ",
+		},
+		{
+			"(+ 1\n\n2)\n",
+			">>> ... ... 3\n>>> ",
+		},
+		{
+			"(str \"a\n(b\")\n",
+			">>> ... a\n(b\n>>> ",
+		},
+		{
+			"{\"a\"\n1}\n",
+			">>> ... {a: 1}\n>>> ",
+		},
+		{
+			"1)\n(+ 1 2)\n",
+			">>> error: unexpected closing delimiter, input discarded\n>>> 3\n>>> ",
+		},
+		{
+			"\n(+ 1 2) (+ 3\n4)\n",
+			">>> >>> ... 7\n>>> ",
+		},
+	}
+
+	for _, tt := range tests {
+		runReplTests(t, tt.input, tt.expected)
+	}
+}
+
+// Check that an input which can't be parsed is reported, and that the session
+// carries on with the inputs after it.
+func TestParseErrorContinues(t *testing.T) {
+	runReplTests(t, "(def x 1)\n1.2.3\n(+ x 2)\n",
+		">>> 1\n>>> error: 1:1: 1.2.3 is invalid number\n>>> 3\n>>> ")
+}
+
+func TestBalance(t *testing.T) {
+	tests := []struct {
+		input    string
+		depth    int
+		inString bool
+	}{
+		{"(+ 1 2)", 0, false},
+		{"(def f (lambda (x)", 2, false},
+		{"{1 (2", 2, false},
+		{"(print \"(\"", 1, false},
+		{"(print \"abc", 1, true},
+		{"1)", -1, false},
+		{") (", -1, false},
+		{"(print 1) ; (", 0, false},
+		{"(print \";\" ; \"\n", 1, false},
+	}
+
+	for _, tt := range tests {
+		depth, inString := balance(tt.input)
+
+		if depth != tt.depth || inString != tt.inString {
+			t.Errorf("balance(%q) = (%d, %t), want (%d, %t)",
+				tt.input, depth, inString, tt.depth, tt.inString)
+		}
+	}
+}
+
+func TestHistoryEntry(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(+ 1 2)\n", "(+ 1 2)"},
+		{"(def f (lambda (x)\n  (+ x 1)))\n", "(def f (lambda (x) (+ x 1)))"},
+		{"(def f ; add one\n  1)\n", "(def f 1)"},
+		{"(print \";\") ; done\n", "(print \";\")"},
+	}
+
+	for _, tt := range tests {
+		if entry := historyEntry(tt.input); entry != tt.expected {
+			t.Errorf("historyEntry(%q) = %q, want %q", tt.input, entry, tt.expected)
+		}
+	}
+}
+
+// Simulate the user interrupting a long running input, checking that it's
+// stopped and that the session carries on.
+func TestInterruptEvaluation(t *testing.T) {
+	input := `(def fib (lambda (n) (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2))))))
+(fib 40)
+(fib 10)
+`
+	// The definition is shown differently by each engine, so only the
+	// output after it is checked.
+	expected := "\n>>> interrupted\n>>> 55\n>>> "
+
+	for _, engine := range engines {
+		var out strings.Builder
+
+		s := newSession(strings.NewReader(input), &out, engine.name, newConfig(nil))
+
+		// Only the second input is interrupted, shortly after it starts.
+		calls := 0
+		s.interruptible = func() (context.Context, context.CancelFunc) {
+			calls++
+
+			if calls == 2 {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			}
+
+			return context.WithCancel(context.Background())
+		}
+
+		start := time.Now()
+		s.run()
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: interrupting took too long: %s", engine.name, elapsed)
+		}
+
+		if !strings.HasSuffix(out.String(), expected) {
+			t.Errorf("%s: wrong output\nwant suffix=%q\ngot= %q", engine.name, expected, out.String())
+		}
+	}
+}
+
+// A LineReader that returns each of its lines in turn, where a nil error is
+// ErrInterrupted, followed by io.EOF.
+type scriptedReader struct {
+	lines []*string
+}
+
+func (r *scriptedReader) ReadLine(prompt string) (string, error) {
+	if len(r.lines) == 0 {
+		return "", io.EOF
+	}
+
+	line := r.lines[0]
+	r.lines = r.lines[1:]
+
+	if line == nil {
+		return "", ErrInterrupted
+	}
+
+	return *line, nil
+}
+
+func (r *scriptedReader) AddHistory(line string) {}
+
+func TestInterruptPrompt(t *testing.T) {
+	text := func(s string) *string { return &s }
+
+	tests := []struct {
+		name     string
+		lines    []*string
+		expected []string
+		output   string
+	}{
+		{
+			"a single interrupt is ignored",
+			[]*string{nil, text("(+ 1 2)")},
+			[]string{"(+ 1 2)\n"},
+			"press Ctrl-C again to exit\n",
+		},
+		{
+			"a second interrupt ends input",
+			[]*string{nil, nil, text("(+ 1 2)")},
+			[]string{},
+			"press Ctrl-C again to exit\n",
+		},
+		{
+			"an interrupt discards an unfinished form",
+			[]*string{text("(+ 1"), nil, text("(+ 3 4)")},
+			[]string{"(+ 3 4)\n"},
+			"",
+		},
+		{
+			"input between interrupts keeps the session going",
+			[]*string{nil, text("1"), nil, text("2")},
+			[]string{"1\n", "2\n"},
+			"press Ctrl-C again to exit\npress Ctrl-C again to exit\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+
+		r := &formReader{lines: &scriptedReader{tt.lines}, out: &out}
+		inputs := []string{}
+
+		for {
+			input, ok := r.read()
+
+			if !ok {
+				break
+			}
+
+			inputs = append(inputs, input)
+		}
+
+		if !slices.Equal(inputs, tt.expected) {
+			t.Errorf("%s: wrong inputs. want=%q, got=%q", tt.name, tt.expected, inputs)
+		}
+
+		if out.String() != tt.output {
+			t.Errorf("%s: wrong output. want=%q, got=%q", tt.name, tt.output, out.String())
+		}
+	}
+}
+
+func TestResultHistory(t *testing.T) {
+	runReplTests(t, "(+ 1 2)\n(* *1 2)\n", ">>> 3\n>>> 6\n>>> ")
+	runReplTests(t, "1\n2\n3\n4\n(list *1 *2 *3)\n", ">>> 1\n>>> 2\n>>> 3\n>>> 4\n>>> (4 3 2)\n>>> ")
+
+	// Neither errors nor commands change the results.
+	runReplContains(t, "1\n2\n(len 1)\n:timing\n3\n(list *1 *2 *3)\n", []string{"(3 2 1)"}, nil)
+
+	// Comments have no result, so they're skipped without changing the results.
+	runReplTests(t, "1\n2\n; a comment\n(list *1 *2)\n", ">>> 1\n>>> 2\n>>> >>> (2 1)\n>>> ")
+}
+
+func TestPromptOptions(t *testing.T) {
+	for _, engine := range engines {
+		var out strings.Builder
+
+		engine.start(
+			strings.NewReader("(+ 1\n2)\n"),
+			&out,
+			WithPrompt("lisp> "),
+			WithContinuationPrompt("....> "),
+		)
+
+		expected := "lisp> ....> 3\nlisp> "
+
+		if out.String() != expected {
+			t.Errorf("%s: wrong output. want=%q, got=%q", engine.name, expected, out.String())
+		}
+	}
+}
+
+func TestColor(t *testing.T) {
+	input := "(+ 1 2)\n(len 1)\n(+ 1 z)\n"
+
+	// Output that isn't to a terminal never contains escape codes.
+	for _, engine := range engines {
+		var out strings.Builder
+
+		engine.start(strings.NewReader(input), &out, WithColor(true))
+
+		if strings.Contains(out.String(), "\x1b[") {
+			t.Errorf("%s: escape codes in output: %q", engine.name, out.String())
+		}
+	}
+
+	for _, engine := range engines {
+		var out strings.Builder
+
+		s := newSession(strings.NewReader(input), &out, engine.name, newConfig(nil))
+		s.color = true
+		s.run()
+
+		if !strings.HasPrefix(out.String(), ">>> 3\n>>> \x1b[31m") {
+			t.Errorf("%s: result coloured or error not red: %q", engine.name, out.String())
+		}
+
+		if count := strings.Count(out.String(), "\x1b[0m\n"); count != 2 {
+			t.Errorf("%s: expected 2 coloured errors, got %d: %q", engine.name, count, out.String())
+		}
+	}
+}
+
+func TestErrorOutput(t *testing.T) {
+	input := "(+ 1 2)\n(+ 1 z)\n(+ 3 4)\n"
+
+	for _, engine := range engines {
+		var out strings.Builder
+
+		engine.start(strings.NewReader(input), &out, WithPrompt(""))
+
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+
+		if len(lines) != 3 {
+			t.Fatalf("%s: expected 3 lines of output, got %q", engine.name, lines)
+		}
+
+		for i, isError := range []bool{false, true, false} {
+			if strings.HasPrefix(lines[i], ERROR_PREFIX) != isError {
+				t.Errorf("%s: wrong prefix for line %d: %q", engine.name, i, lines[i])
+			}
+		}
+	}
+
+	// Errors can be written separately from results.
+	for _, engine := range engines {
+		var out, errOut strings.Builder
+
+		engine.start(strings.NewReader(input), &out, WithPrompt(""), WithErrorWriter(&errOut))
+
+		if out.String() != "3\n7\n" {
+			t.Errorf("%s: wrong output, got %q", engine.name, out.String())
+		}
+
+		if !strings.HasPrefix(errOut.String(), ERROR_PREFIX) || strings.Count(errOut.String(), "\n") != 1 {
+			t.Errorf("%s: wrong error output, got %q", engine.name, errOut.String())
+		}
+	}
+}
+
+// Warnings from compiling an input are written with the errors, not the
+// results.
+func TestWarningsWithErrors(t *testing.T) {
+	var out, errOut strings.Builder
+
+	StartCompiled(strings.NewReader("(lambda (x y) x)\n"), &out, WithPrompt(""), WithErrorWriter(&errOut))
+
+	if out.String() != "#<lambda anonymous/2>\n" {
+		t.Errorf("wrong output, got %q", out.String())
+	}
+
+	expected := "warning: unused parameter 'y' in anonymous lambda\n"
+
+	if errOut.String() != expected {
+		t.Errorf("wrong error output, expected %q, got %q", expected, errOut.String())
+	}
+}
+
+func TestArgs(t *testing.T) {
+	// *args* is always defined, so it isn't listed by :env.
+	runReplTests(t, "(len *args*)\n:reset\n:env\n*args*\n", ">>> 0\n>>> >>> no variables defined\n>>> ()\n>>> ")
+}
+
+func TestWithSession(t *testing.T) {
+	for _, name := range []interpreter.Engine{interpreter.EVAL_ENGINE, interpreter.VM_ENGINE} {
+		session := interpreter.NewSession(name)
+		session.Set("base", &object.Number{Value: 20})
+
+		var out strings.Builder
+
+		// The engine of the Session is used, whichever function starts the
+		// REPL.
+		Start(strings.NewReader("(+ base 1)\n*1\n(len *args*)\n:engine\n"), &out, WithSession(session))
+
+		expected := ">>> 21\n>>> 21\n>>> 0\n>>> engine is " + string(name) + "\n>>> "
+
+		if out.String() != expected {
+			t.Errorf("%s: wrong output. want=%q, got=%q", name, expected, out.String())
+		}
+	}
+}
+
+func TestPrintedOutput(t *testing.T) {
+	// Printed output appears in order with the results.
+	runReplContains(
+		t,
+		"(print \"a\" 1)\n(def show (lambda (x) (print x) x))\n(show 2)\n",
+		[]string{">>> a 1\nnull\n>>> ", "\n>>> 2\n2\n>>> "},
+		nil,
+	)
+}
+
+func TestLambdaEcho(t *testing.T) {
+	runReplTests(
+		t,
+		"(def add (lambda (a b) (+ a b)))\n(lambda (x _y) x)\nadd\n(def none (lambda () 1))\n",
+		">>> #<lambda add (a b)>\n>>> #<lambda anonymous/2>\n>>> #<lambda add (a b)>\n>>> #<lambda none ()>\n>>> ",
+	)
+}
+
+// Ensure a loop written as tail recursion runs to completion with both
+// engines.
+func TestTailRecursion(t *testing.T) {
+	runReplTests(
+		t,
+		"(def count (lambda (n) (if (= n 0) \"done\" (count (- n 1)))))\n(count 1000000)\n",
+		">>> #<lambda count (n)>\n>>> done\n>>> ",
+	)
+}
@@ -0,0 +1,73 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"lisp/interpreter"
+	"os"
+	"path/filepath"
+)
+
+// The environment variable that sets the location of the startup file.
+const RC_ENV = "LISP_RC"
+
+// The name of the startup file in the user's home directory, used when no
+// other location is provided.
+const RC_FILE = ".lisprc"
+
+// Return the line shown at the start of an interactive session, naming the
+// interpreter, the build it's from and the engine in use.
+func banner(e *interpreter.Session) string {
+	return fmt.Sprintf("%s using the %s engine, enter :help to list the commands", interpreter.Version(), e.Engine())
+}
+
+// Return the location of the startup file from the environment. Otherwise
+// the default location in the home directory is used, but only for
+// interactive sessions, so that piping a file in isn't affected by it.
+// Returns an empty string if there's no startup file to run.
+func startupFile(interactive bool) string {
+	if path := os.Getenv(RC_ENV); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+
+	if err != nil || !interactive {
+		return ""
+	}
+
+	return filepath.Join(home, RC_FILE)
+}
+
+// Run the startup file at the provided path with the engine in use, if the
+// file exists, so that the variables it defines are available from the first
+// prompt. Its results aren't shown, but errors are reported without ending
+// the session.
+func (s *session) runStartupFile(path string) {
+	contents, err := os.ReadFile(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+
+	if err != nil {
+		s.errorf("%s\n", err)
+		return
+	}
+
+	program, ok := s.parseFile(path, contents)
+
+	if !ok {
+		return
+	}
+
+	ctx, stop := s.interruptible()
+	defer stop()
+
+	_, _, err = s.runProgram(ctx, program)
+
+	if err != nil {
+		s.reportError(path, err)
+	}
+}
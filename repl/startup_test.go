@@ -0,0 +1,49 @@
+package repl
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStartupFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lisprc")
+
+	writeFile(t, path, "(def double (lambda (x) (* x 2)))\n(double 1)\n")
+	t.Setenv(RC_ENV, path)
+
+	// The results of the startup file aren't shown, and piped input has no
+	// banner.
+	runReplTests(t, "(double 21)\n", ">>> 42\n>>> ")
+
+	// Errors are reported, but the session continues.
+	writeFile(t, path, "(def a 1)\n(len 1)\n(def b 2)\n")
+
+	runReplContains(
+		t,
+		"(+ a 1)\n",
+		[]string{"error: " + path + ": ", ">>> 2\n"},
+		nil,
+	)
+
+	writeFile(t, path, "(def a 1\n")
+
+	runReplContains(t, "(+ 1 2)\n", []string{"error: " + path + ": 2:1: Reached EOF", ">>> 3\n"}, nil)
+
+	// A startup file that doesn't exist is ignored.
+	t.Setenv(RC_ENV, filepath.Join(dir, "missing"))
+
+	runReplTests(t, "(+ 1 2)\n", ">>> 3\n>>> ")
+}
+
+func TestBanner(t *testing.T) {
+	for _, engine := range engines {
+		s := newSession(strings.NewReader(""), &strings.Builder{}, engine.name, newConfig(nil))
+		b := banner(s.engine)
+
+		if !strings.HasPrefix(b, "lisp ") || !strings.Contains(b, "using the "+engine.name+" engine") {
+			t.Errorf("%s: wrong banner, got %q", engine.name, b)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+//go:build linux
+
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+	termios := &syscall.Termios{}
+
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		fd,
+		syscall.TCGETS,
+		uintptr(unsafe.Pointer(termios)),
+	)
+
+	if errno != 0 {
+		return nil, errno
+	}
+
+	return termios, nil
+}
+
+func setTermios(fd uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		fd,
+		syscall.TCSETS,
+		uintptr(unsafe.Pointer(termios)),
+	)
+
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// Report whether the file descriptor refers to a terminal.
+func isTerminal(fd uintptr) bool {
+	_, err := getTermios(fd)
+
+	return err == nil
+}
+
+// Put the terminal into raw mode, so that each key press can be read as it
+// happens without being echoed. Output processing is left on so that newlines
+// are still written as usual. Returns a function that restores the previous
+// mode.
+func makeRaw(fd uintptr) (func(), error) {
+	old, err := getTermios(fd)
+
+	if err != nil {
+		return nil, err
+	}
+
+	raw := *old
+	raw.Iflag &^= syscall.ICRNL | syscall.INLCR | syscall.IGNCR | syscall.IXON | syscall.ISTRIP
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	err = setTermios(fd, &raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func() { setTermios(fd, old) }, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// Line editing is only supported on linux, elsewhere input is always read
+// without editing.
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
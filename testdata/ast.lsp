@@ -0,0 +1,4 @@
+(def origin {"x" 0 "y" 0})
+(def names '("a" "b"))
+(def distance (lambda (p)
+  (+ (get p "x") (get p "y"))))
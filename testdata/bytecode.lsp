@@ -0,0 +1,8 @@
+(def fib (lambda (n)
+  (if (< n 2)
+    n
+    (+ (fib (- n 1)) (fib (- n 2))))))
+
+(def names '("a" "b" true))
+
+(list (fib 15) (len names) (len *args*))
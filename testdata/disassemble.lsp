@@ -0,0 +1,8 @@
+(def greeting "hello")
+
+(def make-counter (lambda (start)
+  (lambda (step) (+ start step))))
+
+(def count (make-counter 10))
+
+(print greeting (count (len greeting)))
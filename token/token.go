@@ -11,6 +11,9 @@ const (
 	NUM    = "number"
 	STRING = "string"
 	IDENT  = "identifier"
+	// A name that starts with a colon, such as :name. The Literal is the
+	// name without the colon.
+	KEYWORD = "keyword"
 
 	LPAREN = "lparen"
 	RPAREN = "rparen"
@@ -23,4 +26,6 @@ const (
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // the line of the input the Token starts on, counting from 1
+	Column  int // the column of the line the Token starts on, counting from 1
 }
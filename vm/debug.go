@@ -0,0 +1,104 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"lisp/object"
+)
+
+// ErrBreakpoint is returned by Run when execution reaches a breakpoint. The
+// VM can be inspected at this point, and calling Run again continues
+// execution from the breakpoint.
+var ErrBreakpoint = errors.New("breakpoint reached")
+
+// ErrFinished is returned by Step when there are no instructions left to
+// execute.
+var ErrFinished = errors.New("execution finished")
+
+// A position in the instructions of a compiled lambda.
+type breakpoint struct {
+	lambda *object.CompiledLambda
+	ip     int
+}
+
+// Stop execution before the instruction at the provided position in the
+// lambda's instructions is executed.
+func (vm *VM) SetBreakpoint(lambda *object.CompiledLambda, ip int) {
+	if vm.breakpoints == nil {
+		vm.breakpoints = map[breakpoint]bool{}
+	}
+
+	vm.breakpoints[breakpoint{lambda, ip}] = true
+}
+
+// Remove a breakpoint added by SetBreakpoint.
+func (vm *VM) ClearBreakpoint(lambda *object.CompiledLambda, ip int) {
+	delete(vm.breakpoints, breakpoint{lambda, ip})
+}
+
+// Report whether the next instruction to execute has a breakpoint.
+func (vm *VM) atBreakpoint() bool {
+	frame := vm.currentFrame()
+
+	return vm.breakpoints[breakpoint{frame.Closure.Lambda, frame.ip + 1}]
+}
+
+// Execute exactly one instruction, ignoring any breakpoint set on it. Returns
+// ErrFinished if there are no instructions left to execute, otherwise errors
+// are returned in the same way as Run.
+func (vm *VM) Step() error {
+	if vm.Finished() {
+		return ErrFinished
+	}
+
+	vm.paused = false
+
+	err := vm.run(context.Background(), true)
+
+	if err != nil {
+		return vm.runtimeError(err)
+	}
+
+	return nil
+}
+
+// Report whether every instruction of the program has been executed.
+func (vm *VM) Finished() bool {
+	frame := vm.currentFrame()
+
+	return frame.ip >= len(frame.Instructions())-1
+}
+
+// Return the currently executing Frame. The Frame is reused once its function
+// returns, so it should only be inspected while execution is stopped.
+func (vm *VM) CurrentFrame() *Frame {
+	return vm.currentFrame()
+}
+
+// Return the values on the stack, with the top of the stack last.
+func (vm *VM) Stack() []object.Object {
+	return append([]object.Object{}, vm.stack[:vm.sp]...)
+}
+
+// Return the value of the global variable at the provided index, or nil if it
+// hasn't been assigned.
+func (vm *VM) Global(index int) object.Object {
+	if index < 0 || index >= len(vm.globals) {
+		return nil
+	}
+
+	return vm.globals[index]
+}
+
+// Return the value of the local variable at the provided index in the current
+// Frame, or nil if it hasn't been assigned. Locals include the parameters of
+// the executing lambda, starting at index 0.
+func (vm *VM) Local(index int) object.Object {
+	frame := vm.currentFrame()
+
+	if vm.framesIndex == 1 || index < 0 || index >= frame.Closure.Lambda.LocalsCount {
+		return nil
+	}
+
+	return vm.stack[frame.basePointer+index]
+}
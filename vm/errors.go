@@ -0,0 +1,132 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"lisp/code"
+)
+
+// The maximum number of frames included in the trace of a RuntimeError.
+const maxTraceFrames = 10
+
+// RuntimeError is returned by Run when execution fails inside a function
+// call. It holds the original error along with a trace of the function calls
+// that were executing when the error occurred.
+type RuntimeError struct {
+	Err   error        // the error that stopped execution
+	Trace []TraceFrame // the executing functions, innermost first
+	// The number of executing functions left out of the trace.
+	Omitted int
+}
+
+// TraceFrame describes a function call that was executing when a
+// RuntimeError occurred.
+type TraceFrame struct {
+	Name string // the name of the function, or a placeholder if it has none
+	IP   int    // the instruction pointer of the frame when the error occurred
+	Line int    // the line of the source being run, or 0 if it isn't known
+}
+
+// Return the original error message, followed by the function calls that
+// were executing. Each call is shown with the line it was running, or its
+// instruction pointer if the line isn't known.
+func (e *RuntimeError) Error() string {
+	var out bytes.Buffer
+
+	out.WriteString(e.Err.Error())
+
+	for _, frame := range e.Trace {
+		if frame.Line > 0 {
+			fmt.Fprintf(&out, "\n    in %s at line %d", frame.Name, frame.Line)
+		} else {
+			fmt.Fprintf(&out, "\n    in %s at ip %d", frame.Name, frame.IP)
+		}
+	}
+
+	if e.Omitted > 0 {
+		fmt.Fprintf(&out, "\n    ... %d more", e.Omitted)
+	}
+
+	return out.String()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// Wrap an error that occurred during execution with a trace of the currently
+// executing frames. Errors that occur at the top level of the program are
+// returned unchanged, as there are no function calls to report.
+func (vm *VM) runtimeError(err error) error {
+	if vm.framesIndex <= 1 {
+		return err
+	}
+
+	trace := []TraceFrame{}
+
+	for i := vm.framesIndex - 1; i >= 0 && len(trace) < maxTraceFrames; i-- {
+		trace = append(trace, TraceFrame{
+			Name: frameName(vm.frames[i], i),
+			IP:   vm.frames[i].ip,
+			Line: frameLine(vm.frames[i]),
+		})
+	}
+
+	return &RuntimeError{
+		Err:     err,
+		Trace:   trace,
+		Omitted: vm.framesIndex - len(trace),
+	}
+}
+
+// Return the name to display for the function executing in the frame at the
+// provided index of the frame stack.
+func frameName(frame *Frame, index int) string {
+	if index == 0 {
+		return "<main>"
+	}
+
+	if frame.Closure.Lambda.Name == "" {
+		return "<anonymous>"
+	}
+
+	return frame.Closure.Lambda.Name
+}
+
+// The width of an OpCall instruction, including its operand.
+var callWidth = len(code.Make(code.OpCall, 0))
+
+// Return the line of the source that the frame was running, found from the
+// call sites of its lambda, or 0 if there are none.
+//
+// Frames other than the innermost are always part way through a call. The
+// innermost frame may have failed at some other instruction, which is
+// attributed to the first call after it, as that's the call it computes an
+// argument of. Failing that, the last call before it is used.
+func frameLine(frame *Frame) int {
+	line := 0
+	next := -1
+	previous := -1
+
+	for pos, site := range frame.Closure.Lambda.CallSites {
+		if site.Line == 0 {
+			continue
+		}
+
+		if pos+callWidth > frame.ip {
+			if next == -1 || pos < next {
+				next = pos
+			}
+		} else if pos > previous {
+			previous = pos
+		}
+	}
+
+	if next != -1 {
+		line = frame.Closure.Lambda.CallSites[next].Line
+	} else if previous != -1 {
+		line = frame.Closure.Lambda.CallSites[previous].Line
+	}
+
+	return line
+}
@@ -15,18 +15,32 @@ type Frame struct {
 	// Used for interacting with local bindings, which are stored
 	// on top of the stack.
 	basePointer int
+	// The instructions of the Closure, kept here as they're read for every
+	// instruction executed.
+	instructions code.Instructions
 }
 
 // Create a new VM with the provided compiled lambda.
 func NewFrame(closure *object.Closure, basePointer int) *Frame {
 	return &Frame{
-		Closure:     closure,
-		ip:          -1, // so that ip == 0 after increment
-		basePointer: basePointer,
+		Closure:      closure,
+		ip:           -1, // so that ip == 0 after increment
+		basePointer:  basePointer,
+		instructions: closure.Lambda.Instructions,
 	}
 }
 
 // Return the instructions of the Closure associated with the current Frame.
 func (f *Frame) Instructions() code.Instructions {
-	return f.Closure.Lambda.Instructions
+	return f.instructions
+}
+
+// Return the position of the next instruction the Frame will execute.
+func (f *Frame) IP() int {
+	return f.ip + 1
+}
+
+// Return the position on the stack where the Frame's local values begin.
+func (f *Frame) BasePointer() int {
+	return f.basePointer
 }
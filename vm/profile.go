@@ -0,0 +1,124 @@
+package vm
+
+import (
+	"fmt"
+	"lisp/code"
+	"lisp/object"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Counters collected while a VM runs with profiling enabled.
+type Profile struct {
+	// The number of times each opcode was executed
+	Opcodes map[code.Opcode]int
+	// The calls made to each compiled lambda
+	Lambdas map[*object.CompiledLambda]*LambdaProfile
+
+	// The time each active frame was entered, by frame index
+	started []time.Time
+}
+
+// The calls made to a single compiled lambda.
+type LambdaProfile struct {
+	Name  string // the name of the lambda, or <anonymous>
+	Calls int    // the number of times the lambda was called
+	// The total time spent in calls to the lambda that returned, including
+	// time spent in nested calls. Recursive calls are counted at each level.
+	Time time.Duration
+}
+
+func newProfile(maxFrames int) *Profile {
+	return &Profile{
+		Opcodes: map[code.Opcode]int{},
+		Lambdas: map[*object.CompiledLambda]*LambdaProfile{},
+		started: make([]time.Time, maxFrames),
+	}
+}
+
+// Record a call to the provided lambda, executing in the frame at the
+// provided index.
+func (p *Profile) enter(lambda *object.CompiledLambda, frameIndex int) {
+	lp, ok := p.Lambdas[lambda]
+
+	if !ok {
+		name := lambda.Name
+
+		if name == "" {
+			name = "<anonymous>"
+		}
+
+		lp = &LambdaProfile{Name: name}
+		p.Lambdas[lambda] = lp
+	}
+
+	lp.Calls++
+	p.started[frameIndex] = time.Now()
+}
+
+// Record the return of the provided lambda from the frame at the provided
+// index.
+func (p *Profile) exit(lambda *object.CompiledLambda, frameIndex int) {
+	p.Lambdas[lambda].Time += time.Since(p.started[frameIndex])
+}
+
+// Render the profile as a table of opcodes followed by a table of lambdas,
+// each sorted with the most executed first.
+func (p *Profile) String() string {
+	var out strings.Builder
+
+	ops := make([]code.Opcode, 0, len(p.Opcodes))
+
+	for op := range p.Opcodes {
+		ops = append(ops, op)
+	}
+
+	sort.Slice(ops, func(i, j int) bool {
+		if p.Opcodes[ops[i]] != p.Opcodes[ops[j]] {
+			return p.Opcodes[ops[i]] > p.Opcodes[ops[j]]
+		}
+
+		return ops[i] < ops[j]
+	})
+
+	out.WriteString("opcode                  count\n")
+
+	for _, op := range ops {
+		name := fmt.Sprintf("opcode %d", op)
+
+		if def, err := code.Lookup(byte(op)); err == nil {
+			name = def.Name
+		}
+
+		fmt.Fprintf(&out, "%-20s %8d\n", name, p.Opcodes[op])
+	}
+
+	lambdas := make([]*LambdaProfile, 0, len(p.Lambdas))
+
+	for _, lp := range p.Lambdas {
+		lambdas = append(lambdas, lp)
+	}
+
+	sort.Slice(lambdas, func(i, j int) bool {
+		if lambdas[i].Calls != lambdas[j].Calls {
+			return lambdas[i].Calls > lambdas[j].Calls
+		}
+
+		return lambdas[i].Name < lambdas[j].Name
+	})
+
+	out.WriteString("\nlambda                  calls         time\n")
+
+	for _, lp := range lambdas {
+		fmt.Fprintf(&out, "%-20s %8d %12s\n", lp.Name, lp.Calls, lp.Time)
+	}
+
+	return out.String()
+}
+
+// Return the counters collected by the VM, or nil if it wasn't created with
+// profiling enabled.
+func (vm *VM) Profile() *Profile {
+	return vm.profile
+}
@@ -0,0 +1,49 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"lisp/code"
+	"strings"
+)
+
+// The number of values from the top of the stack included in each line of a
+// trace.
+const traceStackValues = 3
+
+// Write a line describing the instruction at the provided position to the
+// VM's trace writer, along with the values on top of the stack before it's
+// executed. Lines are indented by the depth of the current Frame so that
+// nested calls can be followed.
+func (vm *VM) traceInstruction(ins code.Instructions, ip int) {
+	var out strings.Builder
+
+	out.WriteString(strings.Repeat("  ", vm.framesIndex-1))
+	fmt.Fprintf(&out, "%04d %-24s", ip, ins.FormatAt(ip))
+
+	out.WriteString(" [")
+
+	for i := 0; i < traceStackValues && i < vm.sp; i++ {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+
+		obj := vm.stack[vm.sp-1-i]
+
+		if obj == nil {
+			out.WriteString("<nil>")
+			continue
+		}
+
+		out.WriteString(truncate(obj.Inspect(), maxInspectLength))
+	}
+
+	if vm.sp > traceStackValues {
+		out.WriteString(", ...")
+	}
+
+	out.WriteString("]\n")
+
+	// Tracing is a debugging aid, so a failed write shouldn't stop execution.
+	_, _ = io.WriteString(vm.trace, out.String())
+}
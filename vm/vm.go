@@ -1,9 +1,27 @@
 // The vm package contains the definition of the VM type, which executes
 // bytecode instructions created by a Compiler.
+//
+// # Concurrency
+//
+// A VM must only be used by one goroutine at a time, but any number of VMs can
+// run the same Bytecode at once. The VM never modifies the Bytecode or its
+// constants: compiled lambdas and strings are read only, and lists are never
+// changed in place, as builtins such as push return a new list instead.
+//
+// Each VM created by New or NewWithOptions has its own globals. NewWithState
+// uses the globals it's given, so VMs created from the same globals share them
+// and can't run at the same time.
+//
+// A Bytecode shares memory with the Compiler that produced it, so it must not
+// be run while the Compiler is still in use. Clone the Bytecode to keep a
+// copy that can be run while compilation continues.
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"lisp/code"
 	"lisp/compiler"
 	"lisp/object"
@@ -13,8 +31,53 @@ const (
 	StackSize  = 2048
 	GlobalSize = 65536
 	MaxFrames  = 1024
+	// The number of stack slots allocated when a VM is created. The stack is
+	// grown as required, up to the maximum stack size.
+	initialStackSize = 64
+	// The number of instructions executed between checks for cancellation.
+	cancelCheckInterval = 1024
+	// The longest representation of a value included in an error message.
+	maxInspectLength = 40
 )
 
+// ErrCancelled is wrapped by the error returned from RunContext when the
+// context is cancelled during execution.
+var ErrCancelled = errors.New("execution cancelled")
+
+// Options sets the limits of a VM. Fields with a zero value use the default
+// limit.
+type Options struct {
+	StackSize  int // the maximum number of values on the stack
+	GlobalSize int // the number of global variables that can be stored
+	MaxFrames  int // the maximum depth of nested function calls
+	// The number of instructions that can be executed before Run stops with
+	// an error. Zero means there is no limit.
+	MaxInstructions int
+	// Where to write a line describing each instruction as it's executed.
+	// Nil means tracing is off.
+	Trace io.Writer
+	// Whether to count the opcodes executed and the calls made to each
+	// lambda, which are available from Profile after running.
+	Profile bool
+}
+
+// Replace zero values with the default limits.
+func (o Options) withDefaults() Options {
+	if o.StackSize <= 0 {
+		o.StackSize = StackSize
+	}
+
+	if o.GlobalSize <= 0 {
+		o.GlobalSize = GlobalSize
+	}
+
+	if o.MaxFrames <= 0 {
+		o.MaxFrames = MaxFrames
+	}
+
+	return o
+}
+
 // Global references to true, false, and null resolve to a single object for
 // for each value.
 var True = object.TRUE
@@ -35,60 +98,284 @@ type VM struct {
 	frames []*Frame
 	// Pointer to the next open place on the frames stack
 	framesIndex int
+	// Names of the global variables, used in error messages
+	globalNames []string
+	// The size the stack is allowed to grow to
+	maxStackSize int
+	// The number of globals that can be stored
+	maxGlobalSize int
+	// The number of instructions executed so far, only counted when
+	// maxInstructions is set
+	instructionCount int
+	// The number of instructions allowed to execute, zero for no limit
+	maxInstructions int
+	// The value of the last expression popped in the main program
+	result object.Object
+	// Where executed instructions are traced to, nil when tracing is off
+	trace io.Writer
+	// The counters collected during execution, nil when profiling is off
+	profile *Profile
+	// The positions that execution stops at when reached by Run
+	breakpoints map[breakpoint]bool
+	// Whether the last run stopped at the breakpoint of the next instruction
+	paused bool
+	// The builtin functions, which are replaced by SetStreams
+	builtins []*object.FunctionObject
 }
 
 // Create a new VM instance from the provided bytecode.
 func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithOptions(bytecode, Options{})
+}
+
+// Create a new VM instance from the provided bytecode, with limits set by the
+// provided Options.
+func NewWithOptions(bytecode *compiler.Bytecode, options Options) *VM {
+	options = options.withDefaults()
+
 	// Represent the entire program as a Closure so that each level of
 	// execution operate the same.
 	mainLambda := &object.CompiledLambda{
 		Instructions: bytecode.Instructions,
+		CallSites:    bytecode.CallSites,
 	}
 	mainClosure := &object.Closure{Lambda: mainLambda}
 
 	mainFrame := NewFrame(mainClosure, 0)
 
-	frames := make([]*Frame, MaxFrames)
+	frames := make([]*Frame, options.MaxFrames)
 	frames[0] = mainFrame
 
-	return &VM{
-		constants:   bytecode.Constants,
-		stack:       make([]object.Object, StackSize),
-		sp:          0,
-		globals:     make([]object.Object, GlobalSize),
-		frames:      frames,
-		framesIndex: 1,
+	vm := &VM{
+		constants:       bytecode.Constants,
+		stack:           make([]object.Object, min(initialStackSize, options.StackSize)),
+		sp:              0,
+		globals:         make([]object.Object, min(len(bytecode.GlobalNames), options.GlobalSize)),
+		frames:          frames,
+		framesIndex:     1,
+		globalNames:     bytecode.GlobalNames,
+		maxStackSize:    options.StackSize,
+		maxGlobalSize:   options.GlobalSize,
+		maxInstructions: options.MaxInstructions,
+		trace:           options.Trace,
+		builtins:        object.Builtins,
 	}
+
+	if options.Profile {
+		vm.profile = newProfile(options.MaxFrames)
+	}
+
+	return vm
 }
 
 // Create a new VM instance from the provided bytecode, along with predefined
 // globals so that state can be maintained between VM instances.
+//
+// The globals are grown if the bytecode defines more than they can hold, in
+// which case the VM no longer shares them with the caller. Use Globals to get
+// the VM's globals after running.
 func NewWithState(bytecode *compiler.Bytecode, globals []object.Object) *VM {
 	vm := New(bytecode)
 	vm.globals = globals
 
+	// An error here means the globals can't hold every global, which is
+	// reported when the missing globals are used.
+	_ = vm.ensureGlobals(min(len(bytecode.GlobalNames), vm.maxGlobalSize))
+
 	return vm
 }
 
+// Prepare the VM to run the provided bytecode from the start, as if it had
+// just been created with New but reusing the memory of the VM. Globals are
+// cleared, along with any breakpoints and profiling counters.
+func (vm *VM) Reset(bytecode *compiler.Bytecode) {
+	clear(vm.globals)
+	vm.LoadBytecode(bytecode)
+
+	vm.breakpoints = nil
+
+	if vm.profile != nil {
+		vm.profile = newProfile(len(vm.frames))
+	}
+}
+
+// Prepare the VM to run the provided bytecode from the start, keeping the
+// values of its globals so that the bytecode can refer to globals defined by
+// earlier programs, in the same way as NewWithState.
+func (vm *VM) LoadBytecode(bytecode *compiler.Bytecode) {
+	// Release everything referenced by the previous run, which may have
+	// stopped part way through because of an error.
+	clear(vm.stack)
+
+	for _, frame := range vm.frames[1:vm.framesIndex] {
+		frame.Closure = nil
+		frame.instructions = nil
+	}
+
+	mainLambda := &object.CompiledLambda{
+		Instructions: bytecode.Instructions,
+		CallSites:    bytecode.CallSites,
+	}
+
+	main := vm.frames[0]
+	main.Closure = &object.Closure{Lambda: mainLambda}
+	main.instructions = mainLambda.Instructions
+	main.ip = -1
+	main.basePointer = 0
+
+	vm.constants = bytecode.Constants
+	vm.globalNames = bytecode.GlobalNames
+	vm.sp = 0
+	vm.framesIndex = 1
+	vm.instructionCount = 0
+	vm.result = nil
+	vm.paused = false
+
+	// As with NewWithState, missing globals are reported when they're used.
+	_ = vm.ensureGlobals(min(len(bytecode.GlobalNames), vm.maxGlobalSize))
+}
+
+// Use the provided Streams for the builtins that read and write, instead of
+// the streams of the process.
+func (vm *VM) SetStreams(streams *object.Streams) {
+	vm.builtins = make([]*object.FunctionObject, len(object.Builtins))
+
+	for i, builtin := range object.Builtins {
+		vm.builtins[i] = builtin.WithStreams(streams)
+	}
+}
+
+// Return the global values of the VM, which can be passed to NewWithState to
+// keep them for another program.
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
 // Execute the bytecode instructions, using a fetch, decode, execute cycle.
 //
 // The top Frame of the VM represents the currently executing state of the VM,
 // including executing instructions in the form of a Closure, the instruction
 // pointer, and the pointer to where the current Frame execution began.
 //
-// Returns an error if something in execution fails.
+// Returns an error if something in execution fails. Errors that occur inside
+// a function call are returned as a *RuntimeError, which includes a trace of
+// the executing functions.
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// Execute the bytecode instructions in the same way as Run, returning the
+// value of the last expression in the program. The returned Object is nil
+// whenever the error is not, and is Null if the program has no expressions.
+func (vm *VM) RunResult() (object.Object, error) {
+	return vm.RunResultContext(context.Background())
+}
+
+// Execute the bytecode instructions in the same way as RunResult, stopping
+// with an error that wraps ErrCancelled if the context is cancelled.
+func (vm *VM) RunResultContext(ctx context.Context) (object.Object, error) {
+	err := vm.RunContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if vm.result == nil {
+		return Null, nil
+	}
+
+	return vm.result, nil
+}
+
+// Execute the bytecode instructions in the same way as Run, stopping with an
+// error that wraps ErrCancelled if the context is cancelled before execution
+// completes.
+func (vm *VM) RunContext(ctx context.Context) error {
+	err := vm.run(ctx, false)
+
+	if err == ErrBreakpoint {
+		return err
+	}
+
+	if err != nil {
+		return vm.runtimeError(err)
+	}
+
+	return nil
+}
+
+// The fetch, decode, execute cycle used by RunContext. When step is true,
+// only the next instruction is executed, ignoring any breakpoint on it.
+func (vm *VM) run(ctx context.Context, step bool) error {
 	var ip int
-	var ins code.Instructions
 	var op code.Opcode
 
+	// The current Frame and its instructions are kept in locals rather than
+	// looked up on every cycle, and have to be updated whenever a Frame is
+	// pushed or popped.
+	frame := vm.currentFrame()
+	ins := frame.Instructions()
+
+	// Checking the context on every instruction would slow execution, so it
+	// is only checked once every cancelCheckInterval instructions. A nil done
+	// channel means the context can never be cancelled.
+	done := ctx.Done()
+	untilCancelCheck := cancelCheckInterval
+
+	// Instructions are only counted when there's a budget to enforce.
+	budgeted := vm.maxInstructions > 0 && !step
+	checkBreakpoints := len(vm.breakpoints) > 0 && !step
+
 	// Fetch
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
-		vm.currentFrame().ip++
-		ip = vm.currentFrame().ip
-		ins = vm.currentFrame().Instructions()
+	for frame.ip < len(ins)-1 {
+		if done != nil {
+			untilCancelCheck--
+
+			if untilCancelCheck == 0 {
+				untilCancelCheck = cancelCheckInterval
+
+				select {
+				case <-done:
+					return fmt.Errorf("%w: %w", ErrCancelled, ctx.Err())
+				default:
+				}
+			}
+		}
+
+		// The breakpoint that stopped the previous run is skipped, so that
+		// running again continues past it.
+		if checkBreakpoints {
+			if !vm.paused && vm.atBreakpoint() {
+				vm.paused = true
+				return ErrBreakpoint
+			}
+
+			vm.paused = false
+		}
+
+		if budgeted {
+			vm.instructionCount++
+
+			if vm.instructionCount > vm.maxInstructions {
+				return fmt.Errorf(
+					"instruction budget exceeded: executed %d instructions",
+					vm.instructionCount-1,
+				)
+			}
+		}
+
+		frame.ip++
+		ip = frame.ip
 		op = code.Opcode(ins[ip])
 
+		if vm.trace != nil {
+			vm.traceInstruction(ins, ip)
+		}
+
+		if vm.profile != nil {
+			vm.profile.Opcodes[op]++
+		}
+
 		// Decode
 		switch op {
 		case code.OpConstant:
@@ -96,7 +383,7 @@ func (vm *VM) Run() error {
 
 			// Place the references constant on top of the stack.
 			constIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
 			err := vm.push(vm.constants[constIndex])
 
@@ -104,8 +391,29 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpPop:
-			// Remove the top item from the stack.
-			vm.pop()
+			// Remove the top item from the stack. An error that's discarded
+			// inside a function ends the call instead, becoming its result as
+			// it does with the evaluator. An error that reaches the top level
+			// of the program without being handled ends execution.
+			errObj, isError := vm.stack[vm.sp-1].(*object.ErrorObject)
+
+			if isError && vm.framesIndex > 1 {
+				vm.returnFromFrame()
+
+				frame = vm.currentFrame()
+				ins = frame.Instructions()
+				break
+			}
+
+			obj := vm.pop()
+
+			if vm.framesIndex == 1 {
+				if isError {
+					return errObj
+				}
+
+				vm.result = obj
+			}
 		case code.OpTrue:
 			// Place the value of 'true' of top of the stack.
 			err := vm.push(True)
@@ -126,20 +434,28 @@ func (vm *VM) Run() error {
 
 			// Decrement the new position so that we arrive at the target
 			// position when the cycle increments the instruction pointer.
-			vm.currentFrame().ip = pos - 1
+			frame.ip = pos - 1
 		case code.OpJumpWhenFalse:
 			// Take the object on top of the stack and evaluate its truthiness,
-			// jump to the provided instruction position if the evaluation is
-			// false.
+			// jump to the first provided instruction position if the evaluation
+			// is false.
 			pos := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			end := int(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+
+			// An error isn't true or false, so leave it on the stack as the
+			// result of the whole if expression.
+			if _, ok := vm.stack[vm.sp-1].(*object.ErrorObject); ok {
+				frame.ip = end - 1
+				break
+			}
 
 			condition := vm.pop()
 
 			if !isTruthy(condition) {
 				// Decrement the new position so that we arrive at the target
 				// position when the cycle increments the instruction pointer.
-				vm.currentFrame().ip = pos - 1
+				frame.ip = pos - 1
 			}
 		case code.OpNull:
 			// Place the value of 'null' of top of the stack.
@@ -151,14 +467,29 @@ func (vm *VM) Run() error {
 		case code.OpSetGlobal:
 			// Set the value of the global at the provided index to the object
 			// on top of the stack without removing the object from the stack.
-			index := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			index := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			err := vm.ensureGlobals(index + 1)
+
+			if err != nil {
+				return err
+			}
 
 			vm.globals[index] = vm.stack[vm.sp-1]
 		case code.OpGetGlobal:
 			// Place the requested global value onto the top of the stack.
-			index := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			index := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			// A global can be defined without being assigned a value, such
+			// as by a def in an if branch that wasn't taken.
+			if index >= len(vm.globals) || vm.globals[index] == nil {
+				return fmt.Errorf(
+					"variable '%s' referenced before assignment",
+					vm.globalName(index),
+				)
+			}
 
 			err := vm.push(vm.globals[index])
 
@@ -169,22 +500,26 @@ func (vm *VM) Run() error {
 			// Set the value of the local at the provided index to the object on
 			// top of the stack without removing the object from the stack.
 			index := int(ins[ip+1])
-			vm.currentFrame().ip += 1
-
-			basePointer := vm.currentFrame().basePointer
+			frame.ip += 1
 
-			vm.stack[basePointer+index] = vm.stack[vm.sp-1]
+			vm.stack[frame.basePointer+index] = vm.stack[vm.sp-1]
 		case code.OpGetLocal:
 			// Place the requested local value onto the top of the stack.
 			index := int(ins[ip+1])
-			vm.currentFrame().ip += 1
-
-			basePointer := vm.currentFrame().basePointer
+			frame.ip += 1
 
 			// Local values are retrieved from the 'hole' in the stack
 			// that's reserved for locals, which sits just above the
 			// currently executing Closure.
-			err := vm.push(vm.stack[basePointer+index])
+			value := vm.stack[frame.basePointer+index]
+
+			// As with globals, a local can be defined without being assigned
+			// a value.
+			if value == nil {
+				return fmt.Errorf("local variable referenced before assignment")
+			}
+
+			err := vm.push(value)
 
 			if err != nil {
 				return err
@@ -193,18 +528,18 @@ func (vm *VM) Run() error {
 			// Retrieve the builtin function at the provided index and place it
 			// on top of the stack.
 			index := int(ins[ip+1])
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
-			err := vm.push(object.Builtins[index])
+			err := vm.push(vm.builtins[index])
 
 			if err != nil {
 				return err
 			}
-		case code.OpCall:
+		case code.OpCall, code.OpTailCall:
 			// Execute the function at the top of the stack, using the arguments
 			// placed on top of it.
 			argCount := int(ins[ip+1])
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
 			// Look for the fn before the arguments that have been pushed
 			// onto the stack above it.
@@ -216,16 +551,66 @@ func (vm *VM) Run() error {
 				// onto the frame stack, the next loop through Run will use the
 				// instructions and values of the new Frame, which will be
 				// popped off the frame stack when execution completes.
-				if argCount != fn.Lambda.ParameterCount {
+				if argCount != fn.Lambda.ParameterCount && !fn.Lambda.Variadic ||
+					argCount < fn.Lambda.ParameterCount {
+					name := ""
+
+					if fn.Lambda.Name != "" {
+						name = fmt.Sprintf(" to '%s'", fn.Lambda.Name)
+					}
+
+					expected := fmt.Sprint(fn.Lambda.ParameterCount)
+
+					if fn.Lambda.Variadic {
+						expected = "at least " + expected
+					}
+
 					return fmt.Errorf(
-						"wrong number of arguments: expected=%d got=%d",
-						fn.Lambda.ParameterCount, argCount,
+						"wrong number of arguments%s: expected=%s got=%d",
+						name, expected, argCount,
 					)
 				}
 
-				frame := NewFrame(fn, vm.sp-argCount)
+				if fn.Lambda.Variadic {
+					var err error
+					argCount, err = vm.collectRest(fn.Lambda.ParameterCount, argCount)
+
+					if err != nil {
+						return err
+					}
+				}
+
+				if op == code.OpTailCall {
+					err := vm.tailCall(frame, fn, argCount)
+
+					if err != nil {
+						return err
+					}
+
+					ins = frame.Instructions()
+					break
+				}
+
+				basePointer := vm.sp - argCount
+
+				err := vm.ensureStack(basePointer + fn.Lambda.LocalsCount)
+
+				if err != nil {
+					return err
+				}
+
+				frame, err = vm.pushFrame(fn, basePointer)
+
+				if err != nil {
+					return err
+				}
+
+				ins = frame.Instructions()
+
+				if vm.profile != nil {
+					vm.profile.enter(fn.Lambda, vm.framesIndex-1)
+				}
 
-				vm.pushFrame(frame)
 				// Reserve space on the stack for local bindings:
 				//
 				// The space between frame.basePointer (the current stack pointer)
@@ -237,40 +622,36 @@ func (vm *VM) Run() error {
 			case *object.FunctionObject:
 				// When executing a builtin function, call the inner function
 				// written in go and push the resulting value onto the stack.
+				// Errors are pushed as values so that the program can handle
+				// them, and an error passed as an argument becomes the result
+				// unless the builtin handles errors itself.
 				args := vm.stack[vm.sp-argCount : vm.sp]
 
-				result := fn.Fn(args...)
+				result := firstError(args)
 
-				if result.Type() == object.ERROR_OBJ {
-					errObj, _ := result.(*object.ErrorObject)
+				if result == nil || fn.HandlesErrors() {
+					result = fn.Fn(args...)
 
-					return fmt.Errorf("%s", errObj.Error)
+					if errObj, ok := result.(*object.ErrorObject); ok {
+						result = vm.locateError(errObj, frame, ip)
+					}
 				}
 
-				vm.sp = vm.sp - argCount - 1
-
-				err := vm.push(result)
-
-				if err != nil {
-					return err
-				}
+				// The result replaces the function on the stack.
+				vm.stack[vm.sp-argCount-1] = result
+				vm.dropTo(vm.sp - argCount)
 			default:
-				return fmt.Errorf("calling non-function")
+				return vm.nonFunctionError(fn, ip)
 			}
 		case code.OpReturn:
 			// Return the value from a function. Pop the current Frame from the
 			// frame stack and remove its execution state from the stack, then
 			// push the resulting value on to the top of the stack
-			returnValue := vm.pop()
-
-			frame := vm.popFrame()
-			vm.sp = frame.basePointer - 1
+			// The return value replaces the Closure that was called.
+			vm.returnFromFrame()
 
-			err := vm.push(returnValue)
-
-			if err != nil {
-				return err
-			}
+			frame = vm.currentFrame()
+			ins = frame.Instructions()
 		case code.OpEmptyList:
 			// Place an empty list object on top of the stack.
 			err := vm.push(&object.List{})
@@ -284,7 +665,7 @@ func (vm *VM) Run() error {
 			// place the new Closure on top of the stack.
 			index := code.ReadUint16(ins[ip+1:])
 			freeCount := int(ins[ip+3])
-			vm.currentFrame().ip += 3
+			frame.ip += 3
 
 			constant := vm.constants[index]
 			lambda, ok := constant.(*object.CompiledLambda)
@@ -299,7 +680,7 @@ func (vm *VM) Run() error {
 				freeVariables[i] = vm.stack[vm.sp-freeCount+i]
 			}
 
-			vm.sp -= freeCount
+			vm.dropTo(vm.sp - freeCount)
 
 			err := vm.push(&object.Closure{Lambda: lambda, Free: freeVariables})
 
@@ -310,9 +691,9 @@ func (vm *VM) Run() error {
 			// Retrieve the free variable at the provided index from the
 			// free variables associated with the Closure of the current Frame.
 			index := int(ins[ip+1])
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
-			err := vm.push(vm.currentFrame().Closure.Free[index])
+			err := vm.push(frame.Closure.Free[index])
 
 			if err != nil {
 				return err
@@ -320,7 +701,7 @@ func (vm *VM) Run() error {
 		case code.OpCurrentClosure:
 			// Place the Closure of the currently executing Frame and place it
 			// on top of the stack
-			currentClosure := vm.currentFrame().Closure
+			currentClosure := frame.Closure
 
 			err := vm.push(currentClosure)
 
@@ -328,6 +709,10 @@ func (vm *VM) Run() error {
 				return err
 			}
 		}
+
+		if step {
+			return nil
+		}
 	}
 
 	return nil
@@ -344,8 +729,12 @@ func (vm *VM) StackTop() object.Object {
 
 // Add an object onto the stack, return an error if the stack is full.
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+	if vm.sp >= len(vm.stack) {
+		err := vm.ensureStack(vm.sp + 1)
+
+		if err != nil {
+			return err
+		}
 	}
 
 	vm.stack[vm.sp] = o
@@ -354,16 +743,152 @@ func (vm *VM) push(o object.Object) error {
 	return nil
 }
 
+// Grow the stack so that it holds at least size values, doubling its length
+// each time it grows. Return an error if size is beyond the maximum stack
+// size.
+func (vm *VM) ensureStack(size int) error {
+	if size <= len(vm.stack) {
+		return nil
+	}
+
+	if size > vm.maxStackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	newSize := max(len(vm.stack), 1)
+
+	for newSize < size {
+		newSize *= 2
+	}
+
+	stack := make([]object.Object, min(newSize, vm.maxStackSize))
+	copy(stack, vm.stack)
+	vm.stack = stack
+
+	return nil
+}
+
+// Make sure the globals can hold at least the provided number of values,
+// growing them if required. Returns an error if more than the maximum number
+// of globals are required.
+func (vm *VM) ensureGlobals(size int) error {
+	if size <= len(vm.globals) {
+		return nil
+	}
+
+	if size > vm.maxGlobalSize {
+		return fmt.Errorf(
+			"too many global variables: the maximum is %d", vm.maxGlobalSize,
+		)
+	}
+
+	globals := make([]object.Object, max(size, min(len(vm.globals)*2, vm.maxGlobalSize)))
+	copy(globals, vm.globals)
+	vm.globals = globals
+
+	return nil
+}
+
 // Return the item from the top of the stack and decrement the stack pointer.
+// The slot is cleared so that the stack doesn't keep the item from being
+// garbage collected.
 func (vm *VM) pop() object.Object {
 	o := vm.stack[vm.sp-1]
+	vm.stack[vm.sp-1] = nil
 	vm.sp--
 	return o
 }
 
-// Return the item that was last popped from the stack.
+// Move the stack pointer down to the provided position, clearing every slot
+// above it.
+func (vm *VM) dropTo(sp int) {
+	for vm.sp > sp {
+		vm.sp--
+		vm.stack[vm.sp] = nil
+	}
+}
+
+// Return the item that was last popped from the stack in the main program.
+//
+// Deprecated: the value is only meaningful after a successful run, use
+// RunResult to get the value of a program instead.
 func (vm *VM) LastPoppedStackElem() object.Object {
-	return vm.stack[vm.sp]
+	return vm.result
+}
+
+// Return the first ErrorObject in the provided objects, or nil if there are
+// none.
+func firstError(objs []object.Object) object.Object {
+	for _, obj := range objs {
+		if errObj, ok := obj.(*object.ErrorObject); ok {
+			return errObj
+		}
+	}
+
+	return nil
+}
+
+// Return a copy of an error created by a builtin, with the location of the
+// OpCall at the provided position of the Frame's instructions added to its
+// message. The error is returned unchanged if the location isn't known.
+func (vm *VM) locateError(errObj *object.ErrorObject, frame *Frame, pos int) *object.ErrorObject {
+	site, ok := frame.Closure.Lambda.CallSites[pos]
+
+	if !ok || site.Line == 0 {
+		return errObj
+	}
+
+	return &object.ErrorObject{
+		Kind:    errObj.Kind,
+		Message: errObj.Message,
+		Line:    site.Line,
+		Trace:   []string{fmt.Sprintf("%s at line %d", frameName(frame, vm.framesIndex-1), site.Line)},
+	}
+}
+
+// Create the error for an OpCall at the provided position of the current
+// Frame's instructions that attempted to call a value that isn't a function.
+func (vm *VM) nonFunctionError(fn object.Object, pos int) error {
+	callee := ""
+
+	if site, ok := vm.currentFrame().Closure.Lambda.CallSites[pos]; ok && site.Name != "" {
+		callee = fmt.Sprintf(" '%s'", site.Name)
+	}
+
+	if fn == nil {
+		return fmt.Errorf("calling non-function%s: no value", callee)
+	}
+
+	if _, ok := fn.(*object.LambdaObject); ok {
+		return fmt.Errorf(
+			"calling non-function%s: %s was created by the eval engine and can't be called by the vm engine",
+			callee, fn.Type(),
+		)
+	}
+
+	return fmt.Errorf(
+		"calling non-function%s: %s (%s)",
+		callee, fn.Type(), truncate(fn.Inspect(), maxInspectLength),
+	)
+}
+
+// Shorten a string to the maximum length, marking where it was cut.
+func truncate(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+
+	return s[:maxLength-3] + "..."
+}
+
+// Return the name of the global variable at the provided index, or a
+// description of the index if the name is unknown.
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) && vm.globalNames[index] != "" {
+		return vm.globalNames[index]
+	}
+
+	return fmt.Sprintf("global %d", index)
 }
 
 // Evaluate the Object as true or false.
@@ -375,12 +900,101 @@ func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
-	vm.frames[vm.framesIndex] = f
+// Add a Frame executing the provided Closure to the frame stack, return an
+// error if the maximum call depth has been reached.
+//
+// Frames are only allocated the first time a call depth is reached, after
+// which the Frame at that depth is reused by every call made there.
+func (vm *VM) pushFrame(closure *object.Closure, basePointer int) (*Frame, error) {
+	if vm.framesIndex >= len(vm.frames) {
+		return nil, fmt.Errorf("maximum call depth exceeded")
+	}
+
+	frame := vm.frames[vm.framesIndex]
+
+	if frame == nil {
+		frame = &Frame{}
+		vm.frames[vm.framesIndex] = frame
+	}
+
+	frame.Closure = closure
+	frame.ip = -1 // so that ip == 0 after increment
+	frame.basePointer = basePointer
+	frame.instructions = closure.Lambda.Instructions
 	vm.framesIndex++
+
+	return frame, nil
+}
+
+// Replace the current Frame with a call to the Closure, whose arguments are on
+// top of the stack. The Closure and its arguments are moved down to replace
+// the Closure and locals of the current Frame, which are no longer needed as
+// the result of the call is returned.
+func (vm *VM) tailCall(frame *Frame, fn *object.Closure, argCount int) error {
+	basePointer := frame.basePointer
+
+	err := vm.ensureStack(basePointer + fn.Lambda.LocalsCount)
+
+	if err != nil {
+		return err
+	}
+
+	copy(vm.stack[basePointer-1:], vm.stack[vm.sp-argCount-1:vm.sp])
+
+	// Clear everything above the arguments, so that the locals of the
+	// Closure start empty, then reserve space for them.
+	vm.dropTo(basePointer + argCount)
+	vm.sp = basePointer + fn.Lambda.LocalsCount
+
+	if vm.profile != nil {
+		vm.profile.exit(frame.Closure.Lambda, vm.framesIndex-1)
+		vm.profile.enter(fn.Lambda, vm.framesIndex-1)
+	}
+
+	frame.Closure = fn
+	frame.ip = -1 // so that ip == 0 after increment
+	frame.instructions = fn.Lambda.Instructions
+
+	return nil
+}
+
+// Replace the arguments after the fixed parameters of a variadic lambda with a
+// List holding them, which becomes the value of its rest parameter. Returns
+// the number of arguments left on the stack.
+func (vm *VM) collectRest(fixed int, argCount int) (int, error) {
+	start := vm.sp - argCount + fixed
+	rest := append([]object.Object{}, vm.stack[start:vm.sp]...)
+
+	vm.dropTo(start)
+
+	return fixed + 1, vm.push(&object.List{Values: rest})
+}
+
+// Remove the current Frame from the frame stack and return it. The returned
+// Frame will be reused by the next call, so shouldn't be kept.
+// Return the value on top of the stack from the current Frame, replacing the
+// Closure that was called with it.
+func (vm *VM) returnFromFrame() {
+	frame := vm.currentFrame()
+	returnValue := vm.stack[vm.sp-1]
+
+	if vm.profile != nil {
+		vm.profile.exit(frame.Closure.Lambda, vm.framesIndex-1)
+	}
+
+	basePointer := frame.basePointer
+	vm.popFrame()
+	vm.stack[basePointer-1] = returnValue
+	vm.dropTo(basePointer)
 }
 
 func (vm *VM) popFrame() *Frame {
 	vm.framesIndex--
-	return vm.frames[vm.framesIndex]
+	frame := vm.frames[vm.framesIndex]
+
+	// Release the Closure so that it can be garbage collected.
+	frame.Closure = nil
+	frame.instructions = nil
+
+	return frame
 }
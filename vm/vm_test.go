@@ -1,13 +1,22 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"lisp/ast"
+	"lisp/code"
 	"lisp/compiler"
 	"lisp/lexer"
 	"lisp/object"
 	"lisp/parser"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Ensure arithmetic functions as expected.
@@ -196,19 +205,1527 @@ func TestLambdasWithWrongArgCount(t *testing.T) {
 			input:    "((lambda (a b) a b) 1)",
 			expected: "wrong number of arguments: expected=2 got=1",
 		},
+		{
+			input:    "((lambda (a b & rest) a) 1)",
+			expected: "wrong number of arguments: expected=at least 2 got=1",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+
+		err := comp.Compile(program)
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+
+		err = vm.Run()
+
+		if err == nil {
+			t.Fatalf("expected VM error but none occurred.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf(
+				"wrong error occurred: expected=%q got=%q",
+				tt.expected,
+				err,
+			)
+		}
+	}
+}
+
+// Ensure calling a value that isn't a function reports what the value was.
+func TestCallingNonFunction(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			"(def a 5) (a 1)",
+			fmt.Errorf("calling non-function 'a': NUMBER (5)"),
+		},
+		{
+			`(def s "hello") (s)`,
+			fmt.Errorf("calling non-function 's': STRING (hello)"),
+		},
+		{
+			"(def l '(1 2 3)) (l 1)",
+			fmt.Errorf("calling non-function 'l': LIST ((1 2 3))"),
+		},
+		{
+			"(def f (lambda (x) (x))) (f 4)",
+			fmt.Errorf("calling non-function 'x': NUMBER (4)"),
+		},
+		{
+			"((first '(1 2)))",
+			fmt.Errorf("calling non-function: NUMBER (1)"),
+		},
+		{
+			`(def long "this string is far too long to include in full") (long)`,
+			fmt.Errorf("calling non-function 'long': STRING (this string is far too long to includ...)"),
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Ensure reading a global that has been defined but never assigned is an
+// error rather than a panic.
+func TestUnassignedGlobals(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			"(def a (if false (def b 1) 2)) b",
+			fmt.Errorf("variable 'b' referenced before assignment"),
+		},
+		{
+			"(def x (+ x 1))",
+			fmt.Errorf("variable 'x' referenced before assignment"),
+		},
+		{
+			`
+            (if false (def g (lambda () 1)))
+            (def f (lambda () (g)))
+            (f)
+            `,
+			fmt.Errorf("variable 'g' referenced before assignment"),
+		},
+		{
+			`
+            (def f (lambda () (if false (def x 1)) (+ x 1)))
+            (f)
+            `,
+			fmt.Errorf("local variable referenced before assignment"),
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Ensure lambdas created by the eval engine are reported when called by the
+// VM, as can happen when the engines share global values.
+func TestCallingEvalLambda(t *testing.T) {
+	globals := make([]object.Object, GlobalSize)
+	globals[0] = &object.LambdaObject{}
+
+	bytecode := &compiler.Bytecode{
+		Instructions: slices.Concat(
+			code.Make(code.OpGetGlobal, 0),
+			code.Make(code.OpCall, 0),
+			code.Make(code.OpPop),
+		),
+		CallSites: map[int]object.CallSite{3: {Name: "f"}},
+	}
+
+	err := NewWithState(bytecode, globals).Run()
+
+	expected := "calling non-function 'f': LAMBDA was created by the eval engine and can't be called by the vm engine"
+
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error: want=%q got=%v", expected, err)
+	}
+}
+
+// Ensure RunResult returns the value of the program's last expression, and
+// nil when execution fails.
+func TestRunResult(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectError bool
+	}{
+		{"(+ 1 2)", false},
+		{`(def s "hello") s`, false},
+		{"(def f (lambda (x) (* x 2))) (f 4)", false},
+		{"'(1 2 3)", false},
+		{"(if false 1)", false},
+		{"(len 1)", true},
+		{"(def f (lambda (a) a)) (f)", true},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		result, err := New(comp.Bytecode()).RunResult()
+
+		if tt.expectError {
+			if err == nil {
+				t.Errorf("expected error for %q, got result %v", tt.input, result)
+			}
+
+			if result != nil {
+				t.Errorf("expected nil result alongside error, got %v", result)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+
+		err = vm.Run()
+
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if result.Inspect() != vm.LastPoppedStackElem().Inspect() {
+			t.Errorf("wrong result for %q: want=%s got=%s",
+				tt.input, vm.LastPoppedStackElem().Inspect(), result.Inspect())
+		}
+	}
+}
+
+// Ensure no stack slot above the stack pointer keeps a reference to an object
+// once execution has finished.
+func TestStackSlotsCleared(t *testing.T) {
+	inputs := []string{
+		"(+ 1 2)",
+		`(def f (lambda (x) (def y (list x x)) (len y))) (f "hello")`,
+		"(def f (lambda (a b) (lambda () (+ a b)))) ((f 1 2))",
+		"(def f (lambda (n) (if (= n 0) 0 (f (- n 1))))) (f 10) 5",
+	}
+
+	for _, input := range inputs {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		for i := vm.sp; i < len(vm.stack); i++ {
+			if vm.stack[i] != nil {
+				t.Errorf("stack slot %d not cleared for %q: %s",
+					i, input, vm.stack[i].Inspect())
+			}
+		}
+	}
+}
+
+// Ensure a large value passed through a function call can be garbage
+// collected once the call returns, even while the VM is still reachable.
+func TestTemporariesCollectible(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("(def big null) (def f (lambda (x) (len x)))"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	globals := make([]object.Object, GlobalSize)
+	err = NewWithState(comp.Bytecode(), globals).Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	collected := make(chan struct{})
+
+	big := &object.List{Values: make([]object.Object, 100000)}
+	runtime.SetFinalizer(big, func(*object.List) { close(collected) })
+	globals[0] = big
+	big = nil
+
+	comp.Reset()
+	err = comp.Compile(parse("(f big) 1"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := NewWithState(comp.Bytecode(), globals)
+	err = vm.Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// Only the VM's stack can still refer to the list.
+	globals[0] = nil
+	deadline := time.After(time.Second)
+
+	for {
+		runtime.GC()
+
+		select {
+		case <-collected:
+			runtime.KeepAlive(vm)
+			return
+		case <-deadline:
+			t.Fatalf("large list passed to f was not garbage collected")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// Ensure builtin function can be executed.
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"(+ 1 2)", 3},
+		{"(+ 1 2 3)", 6},
+		{`(len "hello")`, 5},
+		{
+			`(len 1)`,
+			fmt.Errorf(
+				"attempted to call len with unsupported type NUMBER (1)\n    in <main> at line 1",
+			),
+		},
+		{
+			`(print "hello")`,
+			Null,
+		},
+		{`(symbol? (symbol "a"))`, true},
+		{`(= (symbol "a") "a")`, false},
+		{`(get (set (dict) (symbol "a") 1) (symbol "a"))`, 1},
+		{"(= (list 1 (list 2)) (list 1.0 '(2)))", true},
+		{`(= (set (dict) "a" 1) (set (dict) "b" 1))`, false},
+		{"(= (if false 1) (if false 2))", true},
+		{`(len (bytes "abc"))`, 3},
+		{`(def b (bytes 3)) (set b 1 255) (get b 1)`, 255},
+		{`(bytes->string (slice (string->bytes "hello") 1 3))`, "el"},
+		{`(= (bytes "ab") (bytes "ab"))`, true},
+		{
+			`(get (bytes 3) 3)`,
+			fmt.Errorf("attempted to call get with index 3, which is out of range\n    in <main> at line 1"),
+		},
+		{
+			`(set (bytes 3) 0 256)`,
+			fmt.Errorf("attempted to set a byte to 256, expected a whole number from 0 to 255\n    in <main> at line 1"),
+		},
+		{"(random 1)", 0},
+		{"(< (random) 1)", true},
+		{"(< (random 6) 6)", true},
+		{
+			"(random 0.5)",
+			fmt.Errorf(
+				"attempted to call random with 0.5, expected a whole number above 0\n    in <main> at line 1",
+			),
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Ensure errors returned by builtins can be handled by the program, and only
+// stop execution when they reach the top level unhandled.
+func TestBuiltinErrorValues(t *testing.T) {
+	tests := []vmTestCase{
+		{"(error? (len 1))", true},
+		{"(error? (len \"abc\"))", false},
+		{"(if (error? (get 1 \"key\")) 0 1)", 0},
+		{"(error? (+ 1 (len 1)))", true},
+		{
+			`(def safe-len (lambda (x)
+                (if (error? (len x)) 0 (len x))))
+            (+ (safe-len 1) (safe-len "hello"))`,
+			5,
+		},
+		// An error that isn't used ends the function call, becoming its
+		// result, as it does with the evaluator.
+		{"(def f (lambda () (len 1) 5)) (error? (f))", true},
+		{"(def f (lambda () (print (len 1)) 7)) (error? (f))", true},
+		{"(def f (lambda (x) (def result (len x)) 7)) (error? (f 1))", true},
+		{"(error? ((lambda () (do (len 1) 2))))", true},
+		{
+			`(def f (lambda ()
+                (def i 0)
+                (while (< i 2) (len 1) (def i (+ i 1)))
+                i))
+            (error? (f))`,
+			true,
+		},
+		{
+			"(def f (lambda () (len 1) 5)) (f)",
+			fmt.Errorf("attempted to call len with unsupported type NUMBER (1)\n    in f at line 1"),
+		},
+		{
+			`(def failed (lambda () (len 1)))
+            (error? (failed))
+            (+ 1 2)`,
+			3,
+		},
+		{
+			"(+ 1 (len 1))",
+			fmt.Errorf("attempted to call len with unsupported type NUMBER (1)\n    in <main> at line 1"),
+		},
+		{
+			"(def f (lambda () (len 1))) (f) (+ 1 2)",
+			fmt.Errorf("attempted to call len with unsupported type NUMBER (1)\n    in f at line 1"),
+		},
+		{
+			"(def x (len 1)) 5",
+			fmt.Errorf("attempted to call len with unsupported type NUMBER (1)\n    in <main> at line 1"),
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Ensure an error that stops a program can be found with errors.As, keeping
+// its kind and where it occurred.
+func TestErrorObjectFromRun(t *testing.T) {
+	tests := []struct {
+		input   string
+		kind    object.ErrorKind
+		message string
+		trace   []string
+	}{
+		{"(len 1)", object.TYPE_ERROR, "attempted to call len with unsupported type NUMBER (1)", []string{"<main> at line 1"}},
+		{"\n(def f (lambda () (rem 1 0)))\n(f)", object.VALUE_ERROR, "Attempted rem of 0", []string{"f at line 2"}},
+		{`(error "failed")`, object.USER_ERROR, "failed", []string{"<main> at line 1"}},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+
+		var errObj *object.ErrorObject
+
+		if !errors.As(err, &errObj) {
+			t.Fatalf("expected an ErrorObject for %q, got %T(%v)", tt.input, err, err)
+		}
+
+		if errObj.Kind != tt.kind {
+			t.Errorf("wrong kind for %q. want=%s, got=%s", tt.input, tt.kind, errObj.Kind)
+		}
+
+		if errObj.Message != tt.message {
+			t.Errorf("wrong message for %q. want=%q, got=%q", tt.input, tt.message, errObj.Message)
+		}
+
+		if !slices.Equal(errObj.Trace, tt.trace) {
+			t.Errorf("wrong trace for %q. want=%q, got=%q", tt.input, tt.trace, errObj.Trace)
+		}
+	}
+}
+
+// Ensure an error used as a condition is the result of the if expression
+// rather than being branched on, and that the boolean builtins propagate
+// errors in the same way.
+func TestErrorConditions(t *testing.T) {
+	tests := []vmTestCase{
+		{"(error? (if (len 1) 1 2))", true},
+		{"(error? (if (len 1) 1))", true},
+		{"(def f (lambda () (if (len 1) 1 2))) (error? (f))", true},
+		{"(def f (lambda (x) (if x 1 2))) (error? (f (len 1)))", true},
+		{"(error? (if (len 1) (if true 1 2) 3))", true},
+		{"(error? (not (len 1)))", true},
+		{"(error? (and (len 1) false))", true},
+		{"(error? (or true (len 1)))", true},
+		{
+			"(if (len 1) 1 2)",
+			fmt.Errorf("attempted to call len with unsupported type NUMBER (1)\n    in <main> at line 1"),
+		},
+		{
+			"(def f (lambda () (if (len 1) 1 2))) (f)",
+			fmt.Errorf("attempted to call len with unsupported type NUMBER (1)\n    in f at line 1"),
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Ensure errors created by builtins include the function and line where the
+// builtin was called.
+func TestBuiltinErrorLocation(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`(def a 1)
+            (def b 0)
+            (/ a b)`,
+			fmt.Errorf("Attempted to divide by 0\n    in <main> at line 3"),
+		},
+		{
+			`(def divide (lambda (a b)
+                (+ 1
+                   (/ a b))))
+            (divide 1 0)`,
+			fmt.Errorf("Attempted to divide by 0\n    in divide at line 3"),
+		},
+		{
+			`(def apply (lambda (f)
+                (f 1 0)))
+            (apply (lambda (a b)
+                     (/ a b)))`,
+			fmt.Errorf("Attempted to divide by 0\n    in <anonymous> at line 4"),
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Test that closures work correctly, including recursive closures and closures
+// defined inside other closures.
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+            (def newClosure (lambda (a)
+                              (lambda (n) (+ n a))))
+            (def closure (newClosure 5))
+            (closure 5)
+            `,
+			expected: 10,
+		},
+		{
+			input: `
+            (def countdown (lambda (n)
+                             (if (= n 0)
+                               0
+                               (countdown (- n 1)))))
+            (countdown 2)
+            `,
+			expected: 0,
+		},
+		{
+			input: `
+            (def countdown (lambda (n)
+                             (if (= n 0)
+                               0
+                               (countdown (- n 1)))))
+
+            (def wrapper (lambda ()
+                           (countdown 10)))
+
+            (wrapper)
+            `,
+			expected: 0,
+		},
+		{
+			input: `
+            (def wrapper (lambda ()
+                (def countdown (lambda (n)
+                    (if (= n 0)
+                        0
+                        (countdown (- n 1)))))
+                (countdown 100)))
+            (wrapper)
+            `,
+			expected: 0,
+		},
+		{
+			input: `
+            (def reduce (lambda (lst f acc)
+                (if (= 0 (len lst))
+                    acc
+                    (reduce (rest lst) f (f acc (first lst))))))
+
+            (def map (lambda (lst fn)
+                (reduce lst (lambda (acc n) (push acc (fn n))) '())))
+
+            (map '(1 2 3) (lambda (n) (* n n)))
+            `,
+			expected: []interface{}{1, 4, 9},
+		},
+		{
+			input: `
+            (def outer (lambda (x y)
+              (lambda ()
+                (lambda () (+ y x y x)))))
+            (((outer 1 2)))
+            `,
+			expected: 6,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Test that quoted list constants are shared safely: lists built from them
+// never modify the constant.
+func TestQuotedListConstants(t *testing.T) {
+	tests := []vmTestCase{
+		{"'(1 2 3)", []interface{}{1, 2, 3}},
+		{"'(1 '(2 3))", []interface{}{1, []interface{}{2, 3}}},
+		{
+			input: `
+            (def table (lambda () '(1 2)))
+            (push (table) 3)
+            (table)
+            `,
+			expected: []interface{}{1, 2},
+		},
+		{
+			input: `
+            (def table (lambda () '(1 2)))
+            (def grown (push (table) 3))
+            (push (rest (table)) 4)
+            grown
+            `,
+			expected: []interface{}{1, 2, 3},
+		},
+		{"(def a 5) '(a 2)", []interface{}{&object.Symbol{Name: "a"}, 2}},
+		{"'(a (b c) 3)", []interface{}{&object.Symbol{Name: "a"}, []interface{}{&object.Symbol{Name: "b"}, &object.Symbol{Name: "c"}}, 3}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestQuoting(t *testing.T) {
+	tests := []vmTestCase{
+		{"'a", &object.Symbol{Name: "a"}},
+		{"(first '(a b c))", &object.Symbol{Name: "a"}},
+		{"(= 'a (symbol \"a\"))", true},
+		{"''a", &object.Symbol{Name: "a"}},
+		{"'5", 5},
+		{"(get '{a 1} 'a)", 1},
+		{"(def f (lambda () '(x y))) (first (f))", &object.Symbol{Name: "x"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMacros(t *testing.T) {
+	tests := []vmTestCase{
+		{"(defmacro my-unless (test body) (list 'if test null body)) (my-unless false 1)", 1},
+		{"(defmacro my-unless (test body) (list 'if test null body)) (my-unless true (len 1))", Null},
+		{"(defmacro square (x) (list '* x x)) (square (+ 1 2))", 9},
+		{"(defmacro swap (form) (list (first (rest form)) (first form) (last form))) (swap (1 - 3))", -2},
+		{"(defmacro q (x) (list 'quote x)) (q a)", &object.Symbol{Name: "a"}},
+		{"(defmacro q (x) (list 'quote x)) (q (a 1))", []interface{}{&object.Symbol{Name: "a"}, 1}},
+		{"(defmacro id (x) x) (id 'a)", &object.Symbol{Name: "a"}},
+		{"(defmacro count-down (n) (if (= n 0) \"done\" (list 'count-down (- n 1)))) (count-down 5)", "done"},
+		{"(defmacro my-unless (test body) (list 'if test null body)) (defmacro my-when (test body) (list 'my-unless (list 'not test) body)) (my-when true 2)", 2},
+		{"(defmacro my-unless (test body) (list 'if test null body)) (def f (lambda (n) (my-unless (= n 0) (f (- n 1))))) (f 10000)", Null},
+		{"(defmacro m () 1) (def m 2) m", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestKeywords(t *testing.T) {
+	tests := []vmTestCase{
+		{":name", &object.Keyword{Name: "name"}},
+		{"(= :a :a)", true},
+		{"(= :a :b)", false},
+		{"(= :a 'a)", false},
+		{"(= :a \"a\")", false},
+		{"(get {:name \"ada\"} :name)", "ada"},
+		{"(get {:name \"ada\"} \"name\")", Null},
+		{"(str {:a 1})", "{:a: 1}"},
+		{"(first '(:a))", &object.Keyword{Name: "a"}},
+		{"(defmacro k (x) x) (k :a)", &object.Keyword{Name: "a"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestPushInPlace(t *testing.T) {
+	tests := []vmTestCase{
+		{"(def l (list 1 2)) (push! l 3) l", []interface{}{1, 2, 3}},
+		{"(def l (list 1 2)) (pop! l)", 2},
+		{"(def l (list 1 2)) (pop! l) l", []interface{}{1}},
+		{"(pop! (list))", Null},
+		{"(def l (list 1 2 3)) (def r (rest l)) (push! l 4) r", []interface{}{2, 3}},
+		{"(def l (list 1 2 3)) (def r (rest l)) (pop! l) (push! l 9) r", []interface{}{2, 3}},
+		{"(def l (list 1)) (def m (push l 2)) (push! l 3) m", []interface{}{1, 2}},
+		{"(error-kind (push! '(1 2) 3))", "ValueError"},
+		{"(def r (rest '(1 2))) (push! r 3) r", []interface{}{2, 3}},
+		{
+			input: `
+            (def table (lambda () '(1 2)))
+            (pop! (table))
+            `,
+			expected: fmt.Errorf("attempted to call pop! with the quoted list (1 2), which can't be changed, copy it with slice first\n    in <main> at line 3"),
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Ensure recursion in tail position reuses the calling Frame, so that it
+// isn't limited by MaxFrames.
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+            (def countdown (lambda (n) (if (= n 0) 0 (countdown (- n 1)))))
+            (countdown 1000000)
+            `,
+			expected: 0,
+		},
+		{
+			input: `
+            (def sum (lambda (n acc)
+                (if (= n 0)
+                    acc
+                    (sum (- n 1) (+ acc n)))))
+            (sum 100000 0)
+            `,
+			expected: 5000050000,
+		},
+		{
+			// The called lambda has more locals than the caller, which
+			// start empty.
+			input: `
+            (def helper (lambda (n) (def a (* n 2)) (def b (+ a 1)) b))
+            (def caller (lambda (n) (helper n)))
+            (caller 4)
+            `,
+			expected: 9,
+		},
+		{
+			input: `
+            (def make-loop (lambda (step)
+                (lambda (n) (if (< n 1) n (step n)))))
+            (def loop (make-loop (lambda (n) (loop (- n 1)))))
+            (loop 5000)
+            `,
+			expected: 0,
+		},
+		{
+			input: `
+            (def last (lambda (l) (if (= (len l) 1) (first l) (last (rest l)))))
+            (last (list 1 2 3))
+            `,
+			expected: 3,
+		},
+		{
+			input: `
+            (def f (lambda (n) (if (= n 0) (len 1) (f (- n 1)))))
+            (error-kind (f 5000))
+            `,
+			expected: "TypeError",
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLetExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"(let ((x 1) (y 2)) (+ x y))", 3},
+		{"(let ((x 1) (y (+ x 1))) y)", 2},
+		{"(let () 5)", 5},
+		{"(let ((x 1)))", Null},
+		{"(let ((x 1)) (def y 2) (+ x y))", 3},
+		{"(def x 5) (let ((x 1)) x) x", 5},
+		{"(def x 5) (let ((x (+ x 1))) x)", 6},
+		{"(def f (lambda (x) (let ((x (* x 2))) x) x)) (f 3)", 3},
+		{"(def f (lambda (x) (let ((y (* x 2))) (+ x y)))) (f 3)", 9},
+		{"((let ((n 10)) (lambda (x) (+ x n))) 5)", 15},
+		{"(def f (lambda (n) (let ((g (lambda () n))) (g)))) (f 4)", 4},
+		{
+			input: `
+            (def loop (lambda (n)
+                (let ((m (- n 1)))
+                    (if (= m 0) m (loop m)))))
+            (loop 100000)
+            `,
+			expected: 0,
+		},
+		{"(let ((x (len 1))) x)", fmt.Errorf("attempted to call len with unsupported type NUMBER (1)\n    in let at line 1")},
+		{"(def f (lambda () (let ((x 1) (x (+ x 1))) x))) (f)", 2},
+		{"(def f (lambda () (def y 1) (let () (def y 2)) y)) (f)", 1},
+		{"(def f (lambda () (let ((x 1)) (let ((x 2)) x)))) (f)", 2},
+		{"(def f (lambda (x) (let ((y 1)) (def x 5)) x)) (f 3)", 3},
+		{
+			// Each closure keeps the value bound when it was created.
+			input: `
+            (def f (lambda ()
+                (def fs (list))
+                (def i 0)
+                (while (< i 3)
+                    (let ((n i))
+                        (push! fs (lambda () n)))
+                    (def i (+ i 1)))
+                (list ((first fs)) ((last fs)))))
+            (f)
+            `,
+			expected: []interface{}{0, 2},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCondExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"(cond (true 1) (else 2))", 1},
+		{"(cond (false 1) (else 2))", 2},
+		{"(cond (false 1) (true 2))", 2},
+		{"(cond ((< 2 1) 1) ((= 1 1) 2) (else 3))", 2},
+		{"(cond (false 1))", Null},
+		{"(cond)", Null},
+		{"(cond (1 \"a\") (else \"b\"))", "a"},
+		{"(+ 1 (cond (false 1) (else 2)))", 3},
+		{
+			input: `
+            (def sign (lambda (n)
+                (cond ((< n 0) -1)
+                      ((= n 0) 0)
+                      (else 1))))
+            (list (sign -5) (sign 0) (sign 5))
+            `,
+			expected: []interface{}{-1, 0, 1},
+		},
+		{
+			input: `
+            (def loop (lambda (n)
+                (cond ((= n 0) n)
+                      (else (loop (- n 1))))))
+            (loop 100000)
+            `,
+			expected: 0,
+		},
+		{"(cond ((len 1) 1) (else 2))", fmt.Errorf("attempted to call len with unsupported type NUMBER (1)\n    in <main> at line 1")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestWhenExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"(when true 1 2)", 2},
+		{"(when false 1 2)", Null},
+		{"(when true)", Null},
+		{"(unless false 1 2)", 2},
+		{"(unless true 1 2)", Null},
+		{"(def x 1) (when (= x 1) (def y 2) (+ x y))", 3},
+		{"(def x 1) (unless (= x 1) (def y 2)) x", 1},
+		{"(+ 1 (when true 2))", 3},
+		{
+			input: `
+            (def loop (lambda (n)
+                (unless (= n 0)
+                    (def m (- n 1))
+                    (loop m))))
+            (loop 100000)
+            `,
+			expected: Null,
+		},
+		{"(when (len 1) 1)", fmt.Errorf("attempted to call len with unsupported type NUMBER (1)\n    in <main> at line 1")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDoExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"(do 1 2 3)", 3},
+		{"(do)", Null},
+		{"(do (def x 2) (* x 3))", 6},
+		{"(if true (do (def y 1) (+ y 1)) 0)", 2},
+		{"(def f (lambda (x) (do (def y (* x 2)) (+ x y)))) (f 3)", 9},
+		{"(do (len 1) 2)", fmt.Errorf("attempted to call len with unsupported type NUMBER (1)\n    in <main> at line 1")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestWhileExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"(while false 1)", Null},
+		{"(def i 0) (while (< i 10) (def i (+ i 1)))", Null},
+		{"(def i 0) (while (< i 100000) (def i (+ i 1)) i) i", 100000},
+		{"(def i 0) (while (< i 3) (def i (+ i 1)) (while false)) i", 3},
+		{
+			input: `
+            (def sum (lambda (n)
+                (def total 0)
+                (while (> n 0)
+                    (def total (+ total n))
+                    (def n (- n 1)))
+                total))
+            (sum 100)
+            `,
+			expected: 5050,
+		},
+		{
+			input: `
+            (def xs (list 1 2 3))
+            (def ys (list))
+            (while (> (len xs) 0) (push! ys (pop! xs)))
+            ys
+            `,
+			expected: []interface{}{3, 2, 1},
+		},
+		{"(while (len 1) 1)", fmt.Errorf("attempted to call len with unsupported type NUMBER (1)\n    in <main> at line 1")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRedefinition(t *testing.T) {
+	tests := []vmTestCase{
+		{"(def x 1) (def x (+ x 1)) x", 2},
+		{"(def f (lambda (n) (def n (* n 2)) n)) (f 3)", 6},
+		{"(def f (lambda () (def a 1) (def a (+ a 1)) a)) (f)", 2},
+		{"(def x 1) (def f (lambda () (def x 2) x)) (f) x", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestVariadicLambdas(t *testing.T) {
+	tests := []vmTestCase{
+		{"((lambda (a & rest) rest) 1 2 3)", []interface{}{2, 3}},
+		{"((lambda (a & rest) rest) 1)", []interface{}{}},
+		{"((lambda (a & rest) a) 1 2 3)", 1},
+		{"((lambda (& xs) (len xs)))", 0},
+		{"((lambda (& xs) xs) 1 2)", []interface{}{1, 2}},
+		{"(def my-list (lambda (& items) items)) (my-list 1 (+ 1 1) 3)", []interface{}{1, 2, 3}},
+		{"(def f (lambda (a & rest) (let ((n (len rest))) (+ a n)))) (f 10 1 1 1)", 13},
+		{"(def f (lambda (x) (lambda (& ys) (list x ys)))) ((f 1) 2)", []interface{}{1, []interface{}{2}}},
+		{
+			input: `
+            (def count (lambda (n & seen)
+                (if (= n 0) (len seen) (count (- n 1) n n))))
+            (count 100000)
+            `,
+			expected: 2,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Celebtration test case showing that the compiler works well.
+func TestRecursiveFibonacci(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+            (def fibonacci (lambda (n)
+                (if (or (= n 0)
+                        (= n 1))
+                    n
+                    (+ (fibonacci (- n 1))
+                       (fibonacci (- n 2))))))
+            (fibonacci 15)
+            `,
+			expected: 610,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Ensure each executed instruction is written to the trace writer, indented
+// by the depth of the Frame executing it.
+func TestTrace(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("(def f (lambda (x) x)) (f 1)"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var trace bytes.Buffer
+
+	vm := NewWithOptions(comp.Bytecode(), Options{Trace: &trace})
+	err = vm.Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	expected := []string{
+		"0000 OpClosure 0 0",
+		"0004 OpSetGlobal 0",
+		"0007 OpPop",
+		"0008 OpGetGlobal 0",
+		"0011 OpConstant 1",
+		"0014 OpCall 1",
+		"  0000 OpGetLocal 0",
+		"  0002 OpReturn",
+		"0016 OpPop",
+	}
+
+	lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong number of trace lines: want=%d got=%d\n%s",
+			len(expected), len(lines), trace.String())
+	}
+
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("wrong trace line %d: want prefix=%q got=%q",
+				i, prefix, lines[i])
+		}
+	}
+
+	if !strings.Contains(lines[7], "[1, 1, #<lambda f (x)>]") {
+		t.Errorf("stack values missing from trace line: %q", lines[7])
+	}
+}
+
+// Ensure the profile counts executed opcodes and the calls made to each
+// lambda.
+func TestProfile(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`
+        (def fibonacci (lambda (n)
+            (if (or (= n 0)
+                    (= n 1))
+                n
+                (+ (fibonacci (- n 1))
+                   (fibonacci (- n 2))))))
+        (fibonacci 10)
+        `))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+
+	if vm.Run() != nil || vm.Profile() != nil {
+		t.Fatalf("expected no profile when profiling is disabled")
+	}
+
+	vm = NewWithOptions(comp.Bytecode(), Options{Profile: true})
+	err = vm.Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	profile := vm.Profile()
+
+	if profile.Opcodes[code.OpCall] <= profile.Opcodes[code.OpClosure] {
+		t.Errorf("expected more OpCall than OpClosure: OpCall=%d OpClosure=%d",
+			profile.Opcodes[code.OpCall], profile.Opcodes[code.OpClosure])
+	}
+
+	var fibonacci *LambdaProfile
+
+	for _, lp := range profile.Lambdas {
+		if lp.Name == "fibonacci" {
+			fibonacci = lp
+		}
+	}
+
+	if fibonacci == nil {
+		t.Fatalf("fibonacci missing from profile: %s", profile)
+	}
+
+	// (fibonacci 10) makes 177 calls to fibonacci.
+	if fibonacci.Calls != 177 {
+		t.Errorf("wrong number of calls to fibonacci: want=%d got=%d",
+			177, fibonacci.Calls)
+	}
+
+	if !strings.Contains(profile.String(), "fibonacci") {
+		t.Errorf("fibonacci missing from rendered profile: %s", profile)
+	}
+}
+
+// Ensure execution stops at a breakpoint inside a lambda, where the VM can be
+// inspected, and that running again continues to completion.
+func TestBreakpoints(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("(def add (lambda (a b) (+ a b))) (add 2 3) (add 4 5)"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+
+	var add *object.CompiledLambda
+
+	for _, constant := range bytecode.Constants {
+		if lambda, ok := constant.(*object.CompiledLambda); ok {
+			add = lambda
+		}
+	}
+
+	vm := New(bytecode)
+
+	// Stop before the call to +.
+	vm.SetBreakpoint(add, 6)
+
+	for _, expected := range []float64{2, 4} {
+		err = vm.Run()
+
+		if err != ErrBreakpoint {
+			t.Fatalf("expected breakpoint, got %v", err)
+		}
+
+		frame := vm.CurrentFrame()
+
+		if frame.Closure.Lambda != add || frame.IP() != 6 {
+			t.Fatalf("stopped in wrong place: lambda=%s ip=%d",
+				frame.Closure.Lambda.Name, frame.IP())
+		}
+
+		testExpectedObject(t, expected, vm.Local(0))
+		testExpectedObject(t, expected+1, vm.Local(1))
+		testExpectedObject(t, expected+1, vm.Stack()[len(vm.Stack())-1])
+	}
+
+	result, err := vm.RunResult()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, float64(9), result)
+}
+
+// Ensure Step executes a single instruction at a time.
+func TestStep(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("(def x 1) (+ x 2)"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+
+	err = vm.Step()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, float64(1), vm.StackTop())
+
+	if vm.Global(0) != nil {
+		t.Errorf("global assigned before OpSetGlobal was executed")
+	}
+
+	err = vm.Step()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, float64(1), vm.Global(0))
+
+	steps := 2
+
+	for !vm.Finished() {
+		err = vm.Step()
+
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		steps++
+	}
+
+	if steps != 8 {
+		t.Errorf("wrong number of steps: want=%d got=%d", 8, steps)
+	}
+
+	if vm.Step() != ErrFinished {
+		t.Errorf("expected ErrFinished after the last instruction")
+	}
+
+	testExpectedObject(t, float64(3), vm.LastPoppedStackElem())
+}
+
+// Measure a call-heavy workload, reporting allocations so that the cost of
+// each call can be tracked.
+func BenchmarkVMFibonacci(b *testing.B) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`
+        (def fibonacci (lambda (n)
+            (if (or (= n 0)
+                    (= n 1))
+                n
+                (+ (fibonacci (- n 1))
+                   (fibonacci (- n 2))))))
+        (fibonacci 20)
+        `))
+
+	if err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := New(bytecode).Run()
+
+		if err != nil {
+			b.Fatalf("vm error: %s", err)
+		}
+	}
+}
+
+// Ensure the stack size can be configured, and that the stack grows as
+// required up to its maximum size.
+func TestStackSizeOptions(t *testing.T) {
+	fibonacci := `
+    (def fibonacci (lambda (n)
+        (if (or (= n 0)
+                (= n 1))
+            n
+            (+ (fibonacci (- n 1))
+               (fibonacci (- n 2))))))
+    (fibonacci 20)
+    `
+
+	comp := compiler.New()
+
+	err := comp.Compile(parse(fibonacci))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := NewWithOptions(comp.Bytecode(), Options{StackSize: 16})
+
+	err = vm.Run()
+
+	if err == nil || withoutTrace(err).Error() != "stack overflow" {
+		t.Fatalf("expected stack overflow error, got=%v", err)
+	}
+
+	vm = NewWithOptions(comp.Bytecode(), Options{StackSize: 4096})
+
+	err = vm.Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 6765, vm.LastPoppedStackElem())
+
+	// A call with more arguments than the initial stack size forces the
+	// stack to grow.
+	var wide bytes.Buffer
+
+	wide.WriteString("(+")
+
+	for i := 0; i < 3*initialStackSize; i++ {
+		wide.WriteString(" 1")
+	}
+
+	wide.WriteString(")")
+
+	comp = compiler.New()
+
+	err = comp.Compile(parse(wide.String()))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm = New(comp.Bytecode())
+
+	err = vm.Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 3*initialStackSize, vm.LastPoppedStackElem())
+
+	if len(vm.stack) <= initialStackSize {
+		t.Errorf("stack did not grow: len=%d", len(vm.stack))
+	}
+}
+
+// Ensure the globals are sized from the bytecode, grow when a program needs
+// more of them, and are limited by the configured maximum.
+func TestGlobalsGrowth(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("(def a 1) (def b 2) (def c 3) (+ a b c)"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+
+	if len(vm.Globals()) != 3 {
+		t.Errorf("wrong number of globals: want=%d got=%d", 3, len(vm.Globals()))
+	}
+
+	vm = NewWithState(comp.Bytecode(), []object.Object{})
+	result, err := vm.RunResult()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 6, result)
+
+	for i, expected := range []int{1, 2, 3} {
+		testExpectedObject(t, expected, vm.Globals()[i])
+	}
+
+	err = NewWithOptions(comp.Bytecode(), Options{GlobalSize: 2}).Run()
+
+	expected := "too many global variables: the maximum is 2"
+
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error: want=%q got=%v", expected, err)
+	}
+}
+
+// Ensure globals are kept between programs in the way the REPL runs them,
+// with each line compiled by the same compiler and run on a new VM.
+func TestGlobalsBetweenPrograms(t *testing.T) {
+	lines := []struct {
+		input    string
+		expected int
+	}{
+		{"(def a 1)", 1},
+		{"(def b (+ a 1))", 2},
+		{"(def c 3) (def d 4)", 4},
+		{"(+ a b c d)", 10},
+	}
+
+	comp := compiler.New()
+	globals := []object.Object{}
+
+	for _, line := range lines {
+		comp.Reset()
+		err := comp.Compile(parse(line.input))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := NewWithState(comp.Bytecode(), globals)
+		result, err := vm.RunResult()
+
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, line.expected, result)
+
+		globals = vm.Globals()
 	}
+}
 
-	for _, tt := range tests {
-		program := parse(tt.input)
+// Ensure a VM can run different programs one after the other when reset,
+// without anything from one run remaining in the next.
+func TestReset(t *testing.T) {
+	first := compiler.New()
+	err := first.Compile(parse(`(def f (lambda (x) (list x x))) (f "first")`))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	second := compiler.New()
+	err = second.Compile(parse("(def a 2) (def b 3) (* a b)"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(first.Bytecode())
+
+	// The first run stops part way through a call, leaving values on the
+	// stack and an extra Frame.
+	vm.SetBreakpoint(first.Bytecode().Constants[0].(*object.CompiledLambda), 0)
+
+	if vm.Run() != ErrBreakpoint {
+		t.Fatalf("expected first run to stop at breakpoint")
+	}
+
+	vm.Reset(second.Bytecode())
+
+	if vm.sp != 0 || vm.framesIndex != 1 {
+		t.Fatalf("VM not rewound: sp=%d framesIndex=%d", vm.sp, vm.framesIndex)
+	}
+
+	for i, obj := range vm.stack {
+		if obj != nil {
+			t.Errorf("stack slot %d not cleared: %s", i, obj.Inspect())
+		}
+	}
+
+	for i, obj := range vm.Globals() {
+		if obj != nil {
+			t.Errorf("global %d not cleared: %s", i, obj.Inspect())
+		}
+	}
+
+	result, err := vm.RunResult()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 6, result)
+
+	vm.Reset(first.Bytecode())
+	result, err = vm.RunResult()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if result.Inspect() != "(first first)" {
+		t.Errorf("wrong result: want=%s got=%s", "(first first)", result.Inspect())
+	}
+}
+
+// Ensure LoadBytecode keeps the globals defined by earlier programs.
+func TestLoadBytecode(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("(def a 2)"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	comp.Reset()
+	err = comp.Compile(parse("(def b 3) (* a b)"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm.LoadBytecode(comp.Bytecode())
+	result, err := vm.RunResult()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 6, result)
+}
+
+// Ensure reusing a VM allocates less than creating a new one for each run.
+func TestResetAllocations(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("(def a 2) (def b 3) (* a b)"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+
+	created := testing.AllocsPerRun(10, func() {
+		_ = New(bytecode).Run()
+	})
+
+	vm := New(bytecode)
+
+	reused := testing.AllocsPerRun(10, func() {
+		vm.Reset(bytecode)
+		_ = vm.Run()
+	})
+
+	if reused >= created {
+		t.Errorf("expected fewer allocations when reusing the VM: new=%f reset=%f",
+			created, reused)
+	}
+}
+
+// Ensure many VMs can run the same Bytecode at once, including programs that
+// build new lists from quoted list constants. Run with -race to check that
+// nothing shared is modified.
+func TestConcurrentRuns(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`
+        (def base '(1 2 3))
+        (def extend (lambda (l n)
+            (if (= n 0)
+                l
+                (extend (push l n) (- n 1)))))
+        (def result (extend base 5))
+        (+ (len base) (len result))
+        `))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+	errs := make(chan error, 100)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			result, err := New(bytecode).RunResult()
+
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			if err := testIntegerObject(11, result); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for _, constant := range bytecode.Constants {
+		if list, ok := constant.(*object.List); ok && list.Inspect() != "(1 2 3)" {
+			t.Errorf("list constant modified: %s", list.Inspect())
+		}
+	}
+}
+
+// Ensure exceeding the maximum call depth is an error rather than a panic.
+func TestMaximumCallDepth(t *testing.T) {
+	input := `
+    (def forever (lambda (n) (+ 1 (forever n))))
+    (forever 1)
+    `
+
+	tests := []Options{
+		{StackSize: 1 << 20},
+		{MaxFrames: 10},
+	}
+
+	for _, options := range tests {
 		comp := compiler.New()
 
-		err := comp.Compile(program)
+		err := comp.Compile(parse(input))
 
 		if err != nil {
 			t.Fatalf("compiler error: %s", err)
 		}
 
-		vm := New(comp.Bytecode())
+		vm := NewWithOptions(comp.Bytecode(), options)
 
 		err = vm.Run()
 
@@ -216,123 +1733,191 @@ func TestLambdasWithWrongArgCount(t *testing.T) {
 			t.Fatalf("expected VM error but none occurred.")
 		}
 
-		if err.Error() != tt.expected {
-			t.Fatalf(
-				"wrong error occurred: expected=%q got=%q",
-				tt.expected,
-				err,
-			)
+		if withoutTrace(err).Error() != "maximum call depth exceeded" {
+			t.Errorf("wrong error: want=%q got=%q",
+				"maximum call depth exceeded", err)
 		}
 	}
 }
 
-// Ensure builtin function can be executed.
-func TestBuiltinFunctions(t *testing.T) {
-	tests := []vmTestCase{
-		{"(+ 1 2)", 3},
-		{"(+ 1 2 3)", 6},
-		{`(len "hello")`, 5},
-		{
-			`(len 1)`,
-			fmt.Errorf(
-				"attempted to call len with unsupported type NUMBER (1)",
-			),
-		},
-		{
-			`(print "hello")`,
-			Null,
-		},
+// Ensure errors inside function calls include a trace of the functions that
+// were executing. The call to middle isn't in tail position, so that outer is
+// still executing when it fails.
+func TestRuntimeErrorTrace(t *testing.T) {
+	input := `
+    (def inner (lambda (a b) a))
+    (def middle (lambda () (inner 1)))
+    (def outer (lambda () (+ (middle) 1)))
+    (outer)
+    `
+
+	comp := compiler.New()
+
+	err := comp.Compile(parse(input))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
 	}
 
-	runVmTests(t, tests)
+	vm := New(comp.Bytecode())
+
+	err = vm.Run()
+
+	var runtimeErr *RuntimeError
+
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected RuntimeError, got=%T(%v)", err, err)
+	}
+
+	if runtimeErr.Err.Error() != "wrong number of arguments to 'inner': expected=2 got=1" {
+		t.Errorf("wrong error: got=%q", runtimeErr.Err)
+	}
+
+	expected := "wrong number of arguments to 'inner': expected=2 got=1" +
+		"\n    in middle at line 3" +
+		"\n    in outer at line 4" +
+		"\n    in <main> at line 5"
+
+	if err.Error() != expected {
+		t.Errorf("wrong error message:\n  want=%q\n  got=%q", expected, err)
+	}
+
+	// Without call sites, a frame is shown with its instruction pointer.
+	bytecode := comp.Bytecode()
+	bytecode.CallSites = nil
+
+	err = New(bytecode).Run()
+
+	if !strings.HasSuffix(err.Error(), "\n    in <main> at ip 28") {
+		t.Errorf("wrong error message without call sites: got=%q", err)
+	}
 }
 
-// Test that closures work correctly, including recursive closures and closures
-// defined inside other closures.
-func TestClosures(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input: `
-            (def newClosure (lambda (a)
-                              (lambda (n) (+ n a))))
-            (def closure (newClosure 5))
-            (closure 5)
-            `,
-			expected: 10,
-		},
-		{
-			input: `
-            (def countdown (lambda (n)
-                             (if (= n 0)
-                               0
-                               (countdown (- n 1)))))
-            (countdown 2)
-            `,
-			expected: 0,
-		},
-		{
-			input: `
-            (def countdown (lambda (n)
-                             (if (= n 0)
-                               0
-                               (countdown (- n 1)))))
+// Ensure execution stops when the context is cancelled.
+func TestRunContextCancellation(t *testing.T) {
+	// A program that jumps back to its own start forever.
+	bytecode := &compiler.Bytecode{
+		Instructions: code.Make(code.OpJump, 0),
+	}
 
-            (def wrapper (lambda ()
-                           (countdown 10)))
+	vm := New(bytecode)
 
-            (wrapper)
-            `,
-			expected: 0,
-		},
-		{
-			input: `
-            (def wrapper (lambda ()
-                (def countdown (lambda (n)
-                    (if (= n 0)
-                        0
-                        (countdown (- n 1)))))
-                (countdown 100)))
-            (wrapper)
-            `,
-			expected: 0,
-		},
-		{
-			input: `
-            (def reduce (lambda (lst f acc)
-                (if (= 0 (len lst))
-                    acc
-                    (reduce (rest lst) f (f acc (first lst))))))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
 
-            (def map (lambda (lst fn)
-                (reduce lst (lambda (acc n) (push acc (fn n))) '())))
+	start := time.Now()
+	err := vm.RunContext(ctx)
+	elapsed := time.Since(start)
 
-            (map '(1 2 3) (lambda (n) (* n n)))
-            `,
-			expected: []interface{}{1, 4, 9},
-		},
+	if !errors.Is(err, ErrCancelled) {
+		t.Fatalf("expected cancellation error, got=%v", err)
 	}
 
-	runVmTests(t, tests)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap the context error, got=%v", err)
+	}
+
+	if err.Error() != "execution cancelled: context deadline exceeded" {
+		t.Errorf("wrong error message: got=%q", err)
+	}
+
+	if elapsed > 100*time.Millisecond {
+		t.Errorf("cancellation took too long: %s", elapsed)
+	}
+
+	// Cancellation inside a function call includes the trace.
+	comp := compiler.New()
+
+	err = comp.Compile(parse("(def forever (lambda () (forever))) (forever)"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm = New(comp.Bytecode())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	err = vm.RunContext(ctx)
+
+	var runtimeErr *RuntimeError
+
+	if !errors.As(err, &runtimeErr) || !errors.Is(err, ErrCancelled) {
+		t.Fatalf("expected cancelled RuntimeError, got=%T(%v)", err, err)
+	}
+
+	if runtimeErr.Trace[0].Name != "forever" {
+		t.Errorf("wrong function in trace: got=%s", runtimeErr.Trace[0].Name)
+	}
 }
 
-// Celebtration test case showing that the compiler works well.
-func TestRecursiveFibonacci(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input: `
-            (def fibonacci (lambda (n)
-                (if (or (= n 0)
-                        (= n 1))
-                    n
-                    (+ (fibonacci (- n 1))
-                       (fibonacci (- n 2))))))
-            (fibonacci 15)
-            `,
-			expected: 610,
-		},
+// Ensure execution stops once the instruction budget has been used.
+func TestInstructionBudget(t *testing.T) {
+	// A program that jumps back to its own start forever.
+	loop := &compiler.Bytecode{
+		Instructions: code.Make(code.OpJump, 0),
 	}
 
-	runVmTests(t, tests)
+	vm := NewWithOptions(loop, Options{MaxInstructions: 1000})
+
+	err := vm.Run()
+
+	if err == nil {
+		t.Fatalf("expected VM error but none occurred.")
+	}
+
+	expected := "instruction budget exceeded: executed 1000 instructions"
+
+	if err.Error() != expected {
+		t.Errorf("wrong error: want=%q got=%q", expected, err)
+	}
+
+	comp := compiler.New()
+
+	err = comp.Compile(parse(`
+    (def fibonacci (lambda (n)
+        (if (or (= n 0)
+                (= n 1))
+            n
+            (+ (fibonacci (- n 1))
+               (fibonacci (- n 2))))))
+    (fibonacci 15)
+    `))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm = NewWithOptions(comp.Bytecode(), Options{MaxInstructions: 1_000_000})
+
+	err = vm.Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 610, vm.LastPoppedStackElem())
+
+	vm = NewWithOptions(comp.Bytecode(), Options{MaxInstructions: 100})
+
+	err = vm.Run()
+
+	if err == nil || withoutTrace(err).Error() != "instruction budget exceeded: executed 100 instructions" {
+		t.Errorf("expected budget error, got=%v", err)
+	}
+}
+
+// Return the error without the trace added to errors from inside function
+// calls.
+func withoutTrace(err error) error {
+	var runtimeErr *RuntimeError
+
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr.Err
+	}
+
+	return err
 }
 
 // Helper function to create an AST from source code.
@@ -411,12 +1996,23 @@ type vmTestCase struct {
 
 // Execute vm tests using the given test cases, ensuring that the Object
 // resulting from execution has the correct value.
+//
+// Each test case is run both with and without the compiler's peephole
+// optimizer, to ensure the optimizer preserves the meaning of the program.
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
+	runVmTestsWithOptimize(t, tests, false)
+	runVmTestsWithOptimize(t, tests, true)
+}
+
+func runVmTestsWithOptimize(t *testing.T, tests []vmTestCase, optimize bool) {
+	t.Helper()
+
 	for _, tt := range tests {
 		program := parse(tt.input)
 		comp := compiler.New()
+		comp.Optimize = optimize
 
 		err := comp.Compile(program)
 
@@ -431,7 +2027,7 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 			expectedError, ok := tt.expected.(error)
 
 			if ok {
-				if expectedError.Error() != err.Error() {
+				if expectedError.Error() != withoutTrace(err).Error() {
 					t.Errorf("incorrect error: want=%q got=%q",
 						expectedError, err)
 				}
@@ -482,18 +2078,33 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 			t.Errorf("object is not error: %T(%+v)", actual, actual)
 		}
 
-		if errObj.Error != expected.Error {
+		if errObj.Error() != expected.Error() {
 			t.Errorf("incorrect error message: want=%q got=%q",
-				expected.Error, errObj.Error)
+				expected.Error(), errObj.Error())
 		}
 	case *object.Null:
 		if actual != Null {
 			t.Errorf("object is not null: %T(%+v)", actual, actual)
 		}
+	case *object.Symbol:
+		if !object.Equals(expected, actual) {
+			t.Errorf("object is not symbol %s: %T(%+v)", expected.Name, actual, actual)
+		}
+	case *object.Keyword:
+		if !object.Equals(expected, actual) {
+			t.Errorf("object is not keyword %s: %T(%+v)", expected.Inspect(), actual, actual)
+		}
 	case []interface{}:
 		listObj, ok := actual.(*object.List)
 
 		if !ok {
+			t.Errorf("object is not list: %T(%+v)", actual, actual)
+			return
+		}
+
+		if len(listObj.Values) != len(expected) {
+			t.Errorf("wrong list length: want=%d got=%d (%s)", len(expected), len(listObj.Values), listObj.Inspect())
+			return
 		}
 
 		for i, v := range listObj.Values {